@@ -139,11 +139,16 @@ type APIInterface interface {
 
 // APIListIterator is an iterator for listing APIs.
 type APIListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next API according to the filter conditions.
 	Next() (*API, error)
 }
 
 type apiImpl struct {
+	pluginValidator
+
 	client httpClient
 }
 
@@ -166,7 +171,15 @@ func (iter *apiListIterator) Next() (*API, error) {
 	return &api, nil
 }
 
-func newAPI(cli httpClient) APIInterface {
+func (iter *apiListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *apiListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
+func newAPI(cli httpClient) *apiImpl {
 	return &apiImpl{
 		client: cli,
 	}
@@ -174,6 +187,9 @@ func newAPI(cli httpClient) APIInterface {
 
 func (impl *apiImpl) CreateAPI(ctx context.Context, api *API, opts *ResourceCreateOptions) (*API, error) {
 	var createdAPI API
+	if err := impl.validatePlugins(api.Plugins); err != nil {
+		return nil, err
+	}
 	if !ensureClusterID(impl.client, opts) {
 		return nil, ErrClusterIDNotExist
 	}
@@ -191,6 +207,9 @@ func (impl *apiImpl) UpdateAPI(ctx context.Context, api *API, opts *ResourceUpda
 	if !ensureClusterID(impl.client, opts) {
 		return nil, ErrClusterIDNotExist
 	}
+	if err := impl.validatePlugins(api.Plugins); err != nil {
+		return nil, err
+	}
 	appID := opts.Application.ID
 	uri := path.Join(_apiPathPrefix, "apps", appID.String(), "apis", api.ID.String())
 	err := impl.client.sendPutRequest(ctx, uri, "", api, jsonPayloadDecodeFactory(&updatedAPI), appendHeader(mapClusterIdFromOpts(opts)))
@@ -258,13 +277,20 @@ func (impl *apiImpl) ListAPIs(ctx context.Context, opts *ResourceListOptions) (A
 		return nil, ErrClusterIDNotExist
 	}
 	iter := listIterator{
-		ctx:      ctx,
-		resource: "api",
-		client:   impl.client,
-		path:     path.Join(_apiPathPrefix, "apps", opts.Application.ID.String(), "apis"),
-		paging:   mergePagination(opts.Pagination),
-		filter:   opts.Filter,
-		headers:  appendHeader(mapClusterIdFromOpts(opts)),
+		ctx:           ctx,
+		resource:      "api",
+		client:        impl.client,
+		path:          path.Join(_apiPathPrefix, "apps", opts.Application.ID.String(), "apis"),
+		paging:        mergePagination(opts.Pagination),
+		filter:        opts.Filter,
+		serverFilters: filterLabels | filterActive | filterOrderBy,
+		headers:       appendHeader(mapClusterIdFromOpts(opts)),
+	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
 	}
 
 	return &apiListIterator{iter: iter}, nil
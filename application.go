@@ -116,11 +116,16 @@ type ApplicationInterface interface {
 
 // ApplicationListIterator is an iterator for listing Applications.
 type ApplicationListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next Application according to the filter conditions.
 	Next() (*Application, error)
 }
 
 type applicationImpl struct {
+	pluginValidator
+
 	client httpClient
 }
 
@@ -143,7 +148,15 @@ func (iter *applicationListIterator) Next() (*Application, error) {
 	return &app, nil
 }
 
-func newApplication(cli httpClient) ApplicationInterface {
+func (iter *applicationListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *applicationListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
+func newApplication(cli httpClient) *applicationImpl {
 	return &applicationImpl{
 		client: cli,
 	}
@@ -152,6 +165,9 @@ func newApplication(cli httpClient) ApplicationInterface {
 func (impl *applicationImpl) CreateApplication(ctx context.Context, app *Application, opts *ResourceCreateOptions) (*Application, error) {
 	var createdApp Application
 
+	if err := impl.validatePlugins(app.Plugins); err != nil {
+		return nil, err
+	}
 	clusterID := opts.Cluster.ID
 	uri := path.Join(_apiPathPrefix, "clusters", clusterID.String(), "apps")
 	err := impl.client.sendPostRequest(ctx, uri, "", app, jsonPayloadDecodeFactory(&createdApp), appendHeader(mapClusterIdFromOpts(opts)))
@@ -219,13 +235,20 @@ func (impl *applicationImpl) UnpublishApplication(ctx context.Context, appID ID,
 
 func (impl *applicationImpl) ListApplications(ctx context.Context, opts *ResourceListOptions) (ApplicationListIterator, error) {
 	iter := listIterator{
-		ctx:      ctx,
-		resource: "application",
-		client:   impl.client,
-		path:     path.Join(_apiPathPrefix, "clusters", opts.Cluster.ID.String(), "apps"),
-		paging:   mergePagination(opts.Pagination),
-		filter:   opts.Filter,
-		headers:  appendHeader(mapClusterIdFromOpts(opts)),
+		ctx:           ctx,
+		resource:      "application",
+		client:        impl.client,
+		path:          path.Join(_apiPathPrefix, "clusters", opts.Cluster.ID.String(), "apps"),
+		paging:        mergePagination(opts.Pagination),
+		filter:        opts.Filter,
+		serverFilters: filterLabels | filterActive | filterOrderBy,
+		headers:       appendHeader(mapClusterIdFromOpts(opts)),
+	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
 	}
 
 	return &applicationListIterator{iter: iter}, nil
@@ -16,29 +16,187 @@ package cloud
 
 import (
 	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // AuthInterface is the interface for the authentication process with API7 Cloud.
 type AuthInterface interface {
 	// CreateAccessToken creates a new access token. It returns a new AccessToken object which
 	// fills the Token field.
+	// The given `token` parameter should specify the Notes and the Expire time (zero value means
+	// the token never expires) of the access token.
 	CreateAccessToken(ctx context.Context, token *AccessToken) (*AccessToken, error)
 	// DeleteAccessToken deletes an access token.
+	// The given `token` parameter should specify the ID of the access token.
 	DeleteAccessToken(ctx context.Context, token *AccessToken) error
+	// GetAccessToken gets an existing access token.
+	// The given `tokenID` parameter should specify the access token that you want to get.
+	// Note the Token field will be empty in the returned AccessToken.
+	GetAccessToken(ctx context.Context, tokenID string) (*AccessToken, error)
+	// ListAccessTokens returns an iterator for listing access tokens of the current user with the
+	// given list conditions.
+	// Users can specify the Paging and Filter conditions (if necessary) in the `opts`.
+	// Note the Token field will be empty in the returned AccessToken.
+	ListAccessTokens(ctx context.Context, opts *ResourceListOptions) (AccessTokenListIterator, error)
+	// RotateAccessToken creates a new access token with the same Notes as the given `token`,
+	// and the new token expires at `expire` (zero value means the token never expires),
+	// then it deletes the given `token`.
+	// Note if the old token cannot be deleted, both the new token and the error will be returned,
+	// so that the new token won't be lost.
+	RotateAccessToken(ctx context.Context, token *AccessToken, expire time.Time) (*AccessToken, error)
+	// ListExpiringAccessTokens returns the access tokens which will expire within the given
+	// duration, expired tokens are also included, and tokens that never expire are excluded.
+	// Users can specify the Paging in the `opts`, and `nil` is also OK.
+	ListExpiringAccessTokens(ctx context.Context, within time.Duration, opts *ResourceListOptions) ([]*AccessToken, error)
+}
+
+// AccessTokenListIterator is an iterator for listing access tokens.
+type AccessTokenListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
+	// Next returns the next AccessToken according to the filter conditions.
+	Next() (*AccessToken, error)
 }
 
 type auth struct {
 	client httpClient
 }
 
+type accessTokenListIterator struct {
+	iter listIterator
+}
+
+func (iter *accessTokenListIterator) Next() (*AccessToken, error) {
+	var token AccessToken
+	rawData, err := iter.iter.Next()
+	if err != nil {
+		return nil, err
+	}
+	if rawData == nil {
+		return nil, nil
+	}
+	if err = json.Unmarshal(rawData, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (iter *accessTokenListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *accessTokenListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
 func newAuth(client httpClient) AuthInterface {
 	return &auth{client: client}
 }
 
 func (auth *auth) CreateAccessToken(ctx context.Context, token *AccessToken) (*AccessToken, error) {
-	return nil, nil
+	var createdToken AccessToken
+
+	body := struct {
+		Notes  string     `json:"notes"`
+		Expire *time.Time `json:"expire,omitempty"`
+	}{
+		Notes: token.Notes,
+	}
+	if !token.Expire.IsZero() {
+		body.Expire = &token.Expire
+	}
+
+	uri := path.Join(_apiPathPrefix, "access_tokens")
+	err := auth.client.sendPostRequest(ctx, uri, "", body, jsonPayloadDecodeFactory(&createdToken), appendHeader())
+	if err != nil {
+		return nil, err
+	}
+	return &createdToken, nil
 }
 
 func (auth *auth) DeleteAccessToken(ctx context.Context, token *AccessToken) error {
-	return nil
+	uri := path.Join(_apiPathPrefix, "access_tokens", token.ID)
+	return auth.client.sendDeleteRequest(ctx, uri, "", nil, appendHeader())
+}
+
+func (auth *auth) GetAccessToken(ctx context.Context, tokenID string) (*AccessToken, error) {
+	var token AccessToken
+
+	uri := path.Join(_apiPathPrefix, "access_tokens", tokenID)
+	err := auth.client.sendGetRequest(ctx, uri, "", jsonPayloadDecodeFactory(&token), appendHeader())
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (auth *auth) ListAccessTokens(ctx context.Context, opts *ResourceListOptions) (AccessTokenListIterator, error) {
+	var (
+		paging     *Pagination
+		filter     *Filter
+		resumeFrom string
+	)
+	if opts != nil {
+		paging = opts.Pagination
+		filter = opts.Filter
+		resumeFrom = opts.ResumeFrom
+	}
+
+	iter := listIterator{
+		ctx:      ctx,
+		resource: "access_token",
+		client:   auth.client,
+		path:     path.Join(_apiPathPrefix, "access_tokens"),
+		paging:   mergePagination(paging),
+		filter:   filter,
+		headers:  appendHeader(),
+	}
+	if err := iter.resume(resumeFrom); err != nil {
+		return nil, err
+	}
+
+	return &accessTokenListIterator{iter: iter}, nil
+}
+
+func (auth *auth) RotateAccessToken(ctx context.Context, token *AccessToken, expire time.Time) (*AccessToken, error) {
+	newToken, err := auth.CreateAccessToken(ctx, &AccessToken{
+		Notes:  token.Notes,
+		Expire: expire,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create new access token")
+	}
+	if err = auth.DeleteAccessToken(ctx, token); err != nil {
+		return newToken, errors.Wrapf(err, "delete old access token %s", token.ID)
+	}
+	return newToken, nil
+}
+
+func (auth *auth) ListExpiringAccessTokens(ctx context.Context, within time.Duration, opts *ResourceListOptions) ([]*AccessToken, error) {
+	var tokens []*AccessToken
+
+	iter, err := auth.ListAccessTokens(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(within)
+	for {
+		token, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if token == nil {
+			break
+		}
+		if !token.Expire.IsZero() && token.Expire.Before(deadline) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
 }
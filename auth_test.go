@@ -0,0 +1,271 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAccessToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		token         *AccessToken
+		mockFunc      func(*testing.T) httpClient
+		expectedToken *AccessToken
+		expectedError string
+	}{
+		{
+			name: "mock error",
+			token: &AccessToken{
+				Notes: "ci",
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+				return cli
+			},
+			expectedError: "mock error",
+		},
+		{
+			name: "success",
+			token: &AccessToken{
+				Notes: "ci",
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, body interface{}, decode payloadDecodeFunc, _ http.Header) error {
+						data, err := json.Marshal(body)
+						assert.Nil(t, err, "check encoding body")
+						assert.JSONEq(t, `{"notes":"ci"}`, string(data), "check request body")
+						return decode(json.RawMessage(`{"id":"tk1","notes":"ci","token":"secret"}`))
+					})
+				return cli
+			},
+			expectedToken: &AccessToken{
+				ID:    "tk1",
+				Notes: "ci",
+				Token: "secret",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			token, err := newAuth(tc.mockFunc(t)).CreateAccessToken(context.Background(), tc.token)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check error")
+			} else {
+				assert.Nil(t, err, "check if error is nil")
+				assert.Equal(t, tc.expectedToken, token, "check token")
+			}
+		})
+	}
+}
+
+func TestDeleteAccessToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		mockFunc      func(*testing.T) httpClient
+		expectedError string
+	}{
+		{
+			name: "mock error",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens", "tk1"), "", nil, gomock.Any()).Return(errors.New("mock error"))
+				return cli
+			},
+			expectedError: "mock error",
+		},
+		{
+			name: "success",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens", "tk1"), "", nil, gomock.Any()).Return(nil)
+				return cli
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := newAuth(tc.mockFunc(t)).DeleteAccessToken(context.Background(), &AccessToken{ID: "tk1"})
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check error")
+			} else {
+				assert.Nil(t, err, "check if error is nil")
+			}
+		})
+	}
+}
+
+func TestGetAccessToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		mockFunc      func(*testing.T) httpClient
+		expectedError string
+	}{
+		{
+			name: "mock error",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens", "tk1"), "", gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+				return cli
+			},
+			expectedError: "mock error",
+		},
+		{
+			name: "success",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens", "tk1"), "", gomock.Any(), gomock.Any()).Return(nil)
+				return cli
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newAuth(tc.mockFunc(t)).GetAccessToken(context.Background(), "tk1")
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check error")
+			} else {
+				assert.Nil(t, err, "check if error is nil")
+			}
+		})
+	}
+}
+
+func TestRotateAccessToken(t *testing.T) {
+	t.Parallel()
+
+	expire := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name          string
+		mockFunc      func(*testing.T) httpClient
+		expectedToken bool
+		expectedError string
+	}{
+		{
+			name: "failed to create new token",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+				return cli
+			},
+			expectedError: "create new access token: mock error",
+		},
+		{
+			name: "failed to delete old token",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens", "tk1"), "", nil, gomock.Any()).Return(errors.New("mock error"))
+				return cli
+			},
+			expectedToken: true,
+			expectedError: "delete old access token tk1: mock error",
+		},
+		{
+			name: "success",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, body interface{}, decode payloadDecodeFunc, _ http.Header) error {
+						data, err := json.Marshal(body)
+						assert.Nil(t, err, "check encoding body")
+						assert.JSONEq(t, `{"notes":"ci","expire":"2030-01-01T00:00:00Z"}`, string(data), "check request body")
+						return nil
+					})
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens", "tk1"), "", nil, gomock.Any()).Return(nil)
+				return cli
+			},
+			expectedToken: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			token, err := newAuth(tc.mockFunc(t)).RotateAccessToken(context.Background(), &AccessToken{ID: "tk1", Notes: "ci"}, expire)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "check error")
+			} else {
+				assert.Nil(t, err, "check if error is nil")
+			}
+			assert.Equal(t, tc.expectedToken, token != nil, "check new token")
+		})
+	}
+}
+
+func TestListExpiringAccessTokens(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	ctrl := gomock.NewController(t)
+	cli := NewMockhttpClient(ctrl)
+	cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens"), "page=1&page_size=10", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+			return decode(json.RawMessage(fmt.Sprintf(`{"list":[{"id":"expired","expire":%q},{"id":"soon","expire":%q},{"id":"later","expire":%q},{"id":"never"}]}`,
+				now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339), now.Add(72*time.Hour).Format(time.RFC3339))))
+		})
+	cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "access_tokens"), "page=2&page_size=10", gomock.Any(), gomock.Any()).Return(nil)
+
+	tokens, err := newAuth(cli).ListExpiringAccessTokens(context.Background(), 24*time.Hour, nil)
+	assert.Nil(t, err, "check if error is nil")
+
+	var ids []string
+	for _, token := range tokens {
+		ids = append(ids, token.ID)
+	}
+	assert.Equal(t, []string{"expired", "soon"}, ids, "check expiring tokens")
+}
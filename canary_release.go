@@ -120,6 +120,9 @@ type CanaryReleaseInterface interface {
 
 // CanaryReleaseListIterator is an iterator for listening CanaryReleases.
 type CanaryReleaseListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next CanaryRelease according ro the dilter conditions.
 	Next() (*CanaryRelease, error)
 }
@@ -154,6 +157,14 @@ func (iter *canaryReleaseListIterator) Next() (*CanaryRelease, error) {
 	return &cr, nil
 }
 
+func (iter *canaryReleaseListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *canaryReleaseListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
 func (impl *canaryReleaseImpl) CreateCanaryRelease(ctx context.Context, cr *CanaryRelease, opts *ResourceCreateOptions) (*CanaryRelease, error) {
 	var createdCr CanaryRelease
 	if !ensureClusterID(impl.client, opts) {
@@ -263,6 +274,12 @@ func (impl *canaryReleaseImpl) ListCanaryReleases(ctx context.Context, opts *Res
 		filter:   opts.Filter,
 		headers:  appendHeader(mapClusterIdFromOpts(opts)),
 	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
+	}
 
 	return &canaryReleaseListIterator{iter: iter}, nil
 }
@@ -18,7 +18,11 @@ import (
 	"context"
 	"encoding/json"
 	"path"
+	"reflect"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Certificate is the definition of API7 Cloud Certificate, which also contains
@@ -68,7 +72,8 @@ type CertificateMetadata struct {
 	Extensions map[string]string `json:"extensions,omitempty"`
 }
 
-// CertificateDetails contains the details of the user uploaded certificate.
+// CertificateDetails contains the details of the user uploaded certificate,
+// it's the read model of all the certificate calls.
 type CertificateDetails struct {
 	// Extensions is extensions of certificate
 	Extensions map[string]string `json:"extensions,omitempty"`
@@ -102,6 +107,89 @@ type CertificateDetails struct {
 	Labels []string `json:"labels,omitempty"`
 	// Type is certificate type
 	Type string `json:"type"`
+	// Extra contains the fields returned by API7 Cloud which are not modelled
+	// by the CertificateDetails, they're kept when encoding the CertificateDetails.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// _certificateMetadataField is the field which carries the certificate metadata
+// in some responses (e.g., the update certificate response), instead of inlining them.
+const _certificateMetadataField = "metadata"
+
+// UnmarshalJSON decodes the CertificateDetails, the metadata fields can be
+// either inlined or nested in the "Metadata" field, and the fields which are not
+// modelled are saved to the Extra.
+func (details *CertificateDetails) UnmarshalJSON(data []byte) error {
+	type certificateDetails CertificateDetails
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	var decoded certificateDetails
+	known := make(map[string]struct{})
+	for _, name := range jsonFieldNames(reflect.TypeOf(decoded)) {
+		known[name] = struct{}{}
+	}
+	var (
+		metadataField string
+		metadataValue json.RawMessage
+	)
+	for name, value := range fields {
+		if strings.EqualFold(name, _certificateMetadataField) {
+			metadataField, metadataValue = name, value
+		}
+	}
+	if metadataField != "" {
+		delete(fields, metadataField)
+		var metadata map[string]json.RawMessage
+		if err := json.Unmarshal(metadataValue, &metadata); err != nil {
+			return errors.Wrap(err, "decode certificate metadata")
+		}
+		if err := json.Unmarshal(metadataValue, &decoded); err != nil {
+			return errors.Wrap(err, "decode certificate metadata")
+		}
+		// The top-level fields take precedence over the metadata fields.
+		for name, value := range metadata {
+			if _, ok := fields[name]; !ok {
+				fields[name] = value
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	for name := range fields {
+		if _, ok := known[name]; ok {
+			delete(fields, name)
+		}
+	}
+	if len(fields) > 0 {
+		decoded.Extra = fields
+	}
+	*details = CertificateDetails(decoded)
+	return nil
+}
+
+// MarshalJSON encodes the CertificateDetails with the metadata fields inlined,
+// the Extra fields are encoded as well.
+func (details CertificateDetails) MarshalJSON() ([]byte, error) {
+	type certificateDetails CertificateDetails
+	data, err := json.Marshal(certificateDetails(details))
+	if err != nil || len(details.Extra) == 0 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range details.Extra {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
 }
 
 // CertificateSpec is the specification of the Certificate
@@ -154,16 +242,55 @@ type CertificateInterface interface {
 	// Users need to specify the Cluster.ID in the `opts`.
 	// Note, the private key won't be returned due to the security concerns.
 	DebugCertificateResources(ctx context.Context, appID ID, opts *ResourceGetOptions) (string, error)
+	// ScanExpiringCertificates returns the certificates which expire within the given
+	// duration (including the expired ones) in the specified cluster, all the clusters in
+	// the organizations of the current user are scanned if `clusterID` is zero.
+	// Each returned certificate carries the Applications that reference it (through the
+	// Application.AvailableCertIDs), and they're sorted by the expiry time.
+	ScanExpiringCertificates(ctx context.Context, clusterID ID, within time.Duration) ([]*ExpiringCertificate, error)
+	// RenewCertificate replaces the certificate and the private key of an existing
+	// API7 Cloud Certificate in the specified cluster.
+	// The given `spec` parameter should specify the new certificate and private key, the Type
+	// and Labels of the existing Certificate are kept if they're not specified. The new
+	// certificate is validated locally (see CertificateSpec.Validate), and it should cover
+	// all the SNIs of the existing Certificate.
+	// Users need to specify the Cluster in the `opts`.
+	RenewCertificate(ctx context.Context, certID ID, spec *CertificateSpec, opts *ResourceUpdateOptions) (*CertificateDetails, error)
+	// IssueApplicationCertificate obtains a server certificate for the Hosts of the
+	// specified Application from an ACME server (see ObtainACMECertificate), and
+	// creates it as an API7 Cloud Certificate.
+	// Users need to specify the Cluster in the `opts`.
+	IssueApplicationCertificate(ctx context.Context, appID ID, acmeOpts *ACMEOptions, opts *ResourceCreateOptions) (*CertificateDetails, error)
+	// RenewACMECertificate obtains a new certificate for the SNIs of the specified
+	// Certificate from an ACME server, and replaces the Certificate with it (see
+	// RenewCertificate). Nothing is changed and the current Certificate is returned
+	// if it doesn't expire within the `acmeOpts.RenewBefore`.
+	// Users need to specify the Cluster in the `opts`.
+	RenewACMECertificate(ctx context.Context, certID ID, acmeOpts *ACMEOptions, opts *ResourceUpdateOptions) (*CertificateDetails, error)
+	// CreateDevCertificate issues a certificate by the development CA (see DevCA.IssueCertificate),
+	// and creates it as an API7 Cloud Certificate.
+	// Users need to specify the Cluster in the `opts`.
+	CreateDevCertificate(ctx context.Context, ca *DevCA, req *DevCertificateRequest, opts *ResourceCreateOptions) (*CertificateDetails, error)
+	// CreateDevUpstreamClientCertificate issues a client certificate by the development CA, creates it
+	// as an API7 Cloud Certificate and sets it as the Upstream.ClientCertID of the specified Application.
+	// Only the upstream with the `upstreamVersion` is changed, or all the upstreams if it's empty.
+	// The created Certificate is deleted if the Application can't be updated.
+	// Users need to specify the Cluster in the `opts`.
+	CreateDevUpstreamClientCertificate(ctx context.Context, ca *DevCA, appID ID, upstreamVersion string, req *DevCertificateRequest, opts *ResourceCreateOptions) (*CertificateDetails, error)
 }
 
 // CertificateListIterator is an iterator for listing Certificates.
 type CertificateListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next Certificate according to the filter conditions.
 	Next() (*CertificateDetails, error)
 }
 
 type certificateImpl struct {
-	client httpClient
+	client       httpClient
+	applications ApplicationInterface
 }
 type certificatesListIterator struct {
 	iter listIterator
@@ -184,9 +311,18 @@ func (iter *certificatesListIterator) Next() (*CertificateDetails, error) {
 	return &cert, nil
 }
 
-func newCertificate(cli httpClient) CertificateInterface {
+func (iter *certificatesListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *certificatesListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
+func newCertificate(cli httpClient) *certificateImpl {
 	return &certificateImpl{
-		client: cli,
+		client:       cli,
+		applications: newApplication(cli),
 	}
 }
 
@@ -203,25 +339,7 @@ func (impl *certificateImpl) CreateCertificate(ctx context.Context, cert *Certif
 }
 
 func (impl *certificateImpl) UpdateCertificate(ctx context.Context, cert *Certificate, opts *ResourceUpdateOptions) (*CertificateDetails, error) {
-	type fixedCertificateModel struct {
-		Metadata  CertificateMetadata `json:"Metadata"`
-		ClusterID ID                  `json:"cluster_id"`
-		// CreatedAt is the object creation time.
-		CreatedAt time.Time `json:"created_at"`
-		// ID is the unique identify to mark an object.
-		ID ID `json:"id"`
-		// CACertificate is CA certificate to verify client certificate
-		CACertificate *CertificateMetadata `json:"ca_certificate,omitempty"`
-		// Status is status of certificate
-		Status EntityStatus `json:"status"`
-		// UpdatedAt is the last modified time of this object.
-		UpdatedAt time.Time `json:"updated_at"`
-		// Labels are used for resource classification and indexing
-		Labels []string `json:"labels,omitempty"`
-		// Type is certificate type
-		Type string `json:"type"`
-	}
-	var updatedCert fixedCertificateModel
+	var updatedCert CertificateDetails
 
 	clusterID := opts.Cluster.ID
 	uri := path.Join(_apiPathPrefix, "clusters", clusterID.String(), "certificates", cert.ID.String())
@@ -229,24 +347,7 @@ func (impl *certificateImpl) UpdateCertificate(ctx context.Context, cert *Certif
 	if err != nil {
 		return nil, err
 	}
-	return &CertificateDetails{
-		Extensions:         updatedCert.Metadata.Extensions,
-		Issuer:             updatedCert.Metadata.Issuer,
-		NotBefore:          updatedCert.Metadata.NotBefore,
-		NotAfter:           updatedCert.Metadata.NotAfter,
-		SNIs:               updatedCert.Metadata.SNIs,
-		SerialNumber:       updatedCert.Metadata.SerialNumber,
-		Subject:            updatedCert.Metadata.Subject,
-		SignatureAlgorithm: updatedCert.Metadata.SignatureAlgorithm,
-		ClusterID:          updatedCert.ClusterID,
-		CreatedAt:          updatedCert.CreatedAt,
-		ID:                 updatedCert.ID,
-		CACertificate:      updatedCert.CACertificate,
-		Status:             updatedCert.Status,
-		UpdatedAt:          updatedCert.UpdatedAt,
-		Labels:             updatedCert.Labels,
-		Type:               updatedCert.Type,
-	}, nil
+	return &updatedCert, nil
 }
 
 func (impl *certificateImpl) DeleteCertificate(ctx context.Context, certID ID, opts *ResourceDeleteOptions) error {
@@ -269,13 +370,20 @@ func (impl *certificateImpl) GetCertificate(ctx context.Context, certID ID, opts
 
 func (impl *certificateImpl) ListCertificates(ctx context.Context, opts *ResourceListOptions) (CertificateListIterator, error) {
 	iter := listIterator{
-		ctx:      ctx,
-		resource: "certificates",
-		client:   impl.client,
-		path:     path.Join(_apiPathPrefix, "clusters", opts.Cluster.ID.String(), "certificates"),
-		paging:   mergePagination(opts.Pagination),
-		filter:   opts.Filter,
-		headers:  appendHeader(mapClusterIdFromOpts(opts)),
+		ctx:           ctx,
+		resource:      "certificates",
+		client:        impl.client,
+		path:          path.Join(_apiPathPrefix, "clusters", opts.Cluster.ID.String(), "certificates"),
+		paging:        mergePagination(opts.Pagination),
+		filter:        opts.Filter,
+		serverFilters: filterLabels,
+		headers:       appendHeader(mapClusterIdFromOpts(opts)),
+	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
 	}
 
 	return &certificatesListIterator{iter: iter}, nil
@@ -0,0 +1,363 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// ACMEChallengeHTTP01 is the ACME HTTP-01 challenge type.
+	ACMEChallengeHTTP01 = "http-01"
+	// ACMEChallengeDNS01 is the ACME DNS-01 challenge type.
+	ACMEChallengeDNS01 = "dns-01"
+
+	// DefaultACMERenewBefore is the default duration before the certificate
+	// expiry to renew an ACME certificate.
+	DefaultACMERenewBefore = 30 * 24 * time.Hour
+
+	_http01ChallengePathPrefix = "/.well-known/acme-challenge/"
+)
+
+// ACMEChallengeSolver solves the ACME challenges to prove the control of domains.
+type ACMEChallengeSolver interface {
+	// ChallengeType returns the type of the challenges that the solver solves,
+	// e.g., ACMEChallengeHTTP01.
+	ChallengeType() string
+	// Present makes the challenge `response` available for the `domain`.
+	// The `response` is the key authorization for the HTTP-01 challenge,
+	// or the TXT record value for the DNS-01 challenge.
+	Present(ctx context.Context, domain, token, response string) error
+	// CleanUp removes the challenge response after the challenge is done.
+	CleanUp(ctx context.Context, domain, token, response string) error
+}
+
+// HTTP01Solver solves the HTTP-01 challenges, it's an http.Handler which
+// should serve the port 80 of the domains.
+type HTTP01Solver struct {
+	next http.Handler
+
+	mu        sync.RWMutex
+	responses map[string]string
+}
+
+// NewHTTP01Solver creates a HTTP-01 challenge solver. Requests other than
+// the challenge requests are passed to the `next` handler, a 404 response is
+// sent for them if `next` is nil.
+func NewHTTP01Solver(next http.Handler) *HTTP01Solver {
+	return &HTTP01Solver{
+		next:      next,
+		responses: make(map[string]string),
+	}
+}
+
+// ChallengeType implements the ACMEChallengeSolver interface.
+func (s *HTTP01Solver) ChallengeType() string {
+	return ACMEChallengeHTTP01
+}
+
+// Present implements the ACMEChallengeSolver interface.
+func (s *HTTP01Solver) Present(_ context.Context, _, token, response string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[token] = response
+	return nil
+}
+
+// CleanUp implements the ACMEChallengeSolver interface.
+func (s *HTTP01Solver) CleanUp(_ context.Context, _, token, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, token)
+	return nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *HTTP01Solver) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.URL.Path, _http01ChallengePathPrefix) {
+		if s.next != nil {
+			s.next.ServeHTTP(rw, req)
+		} else {
+			http.NotFound(rw, req)
+		}
+		return
+	}
+
+	s.mu.RLock()
+	response, ok := s.responses[strings.TrimPrefix(req.URL.Path, _http01ChallengePathPrefix)]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/plain")
+	_, _ = rw.Write([]byte(response))
+}
+
+// DNSProvider manipulates the TXT records for the DNS-01 challenges.
+type DNSProvider interface {
+	// SetTXTRecord creates the TXT record `fqdn` with the `value`.
+	// The `fqdn` is something like "_acme-challenge.api7.ai.".
+	SetTXTRecord(ctx context.Context, fqdn, value string) error
+	// DeleteTXTRecord deletes the TXT record `fqdn` with the `value`.
+	DeleteTXTRecord(ctx context.Context, fqdn, value string) error
+}
+
+// DNS01Solver solves the DNS-01 challenges through a DNSProvider.
+type DNS01Solver struct {
+	// Provider is the DNS provider to create the TXT records.
+	Provider DNSProvider
+	// PropagationDelay is the duration to wait after creating the TXT
+	// records, so that they can be seen by the ACME server.
+	PropagationDelay time.Duration
+}
+
+// ChallengeType implements the ACMEChallengeSolver interface.
+func (s *DNS01Solver) ChallengeType() string {
+	return ACMEChallengeDNS01
+}
+
+func dns01RecordName(domain string) string {
+	return "_acme-challenge." + strings.TrimPrefix(domain, "*.") + "."
+}
+
+// Present implements the ACMEChallengeSolver interface.
+func (s *DNS01Solver) Present(ctx context.Context, domain, _, response string) error {
+	if err := s.Provider.SetTXTRecord(ctx, dns01RecordName(domain), response); err != nil {
+		return err
+	}
+	if s.PropagationDelay > 0 {
+		timer := time.NewTimer(s.PropagationDelay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// CleanUp implements the ACMEChallengeSolver interface.
+func (s *DNS01Solver) CleanUp(ctx context.Context, domain, _, response string) error {
+	return s.Provider.DeleteTXTRecord(ctx, dns01RecordName(domain), response)
+}
+
+// ACMEOptions contains the options to obtain certificates from an ACME server.
+type ACMEOptions struct {
+	// DirectoryURL is the ACME directory URL, the Let's Encrypt production
+	// directory is used if it's empty. Set it to a local ACME server (e.g., Pebble)
+	// for testing.
+	DirectoryURL string
+	// AccountKey is the key of the ACME account. It's required by the Let's
+	// Encrypt production directory, so that the same account is reused rather
+	// than registering a new one on each call, which hits the rate limits soon.
+	// For other directories, a new account is registered with a random key if
+	// it's nil.
+	AccountKey crypto.Signer
+	// Email is the contact email of the ACME account.
+	Email string
+	// HTTPClient is the HTTP client to talk to the ACME server, e.g., with the
+	// CA certificate of the local ACME server trusted. The http.DefaultClient
+	// is used if it's nil.
+	HTTPClient *http.Client
+	// Solver solves the ACME challenges, it's required.
+	Solver ACMEChallengeSolver
+	// RenewBefore is the duration before the certificate expiry to renew the
+	// certificate, DefaultACMERenewBefore is used if it's zero.
+	RenewBefore time.Duration
+}
+
+// ObtainACMECertificate obtains a server certificate for the `domains` from the ACME server.
+// The returned Certificate contains the certificate chain and the private key,
+// which can be uploaded through the CreateCertificate.
+func ObtainACMECertificate(ctx context.Context, domains []string, opts *ACMEOptions) (*Certificate, error) {
+	if opts == nil || opts.Solver == nil {
+		return nil, errors.New("ACME challenge solver is required")
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("no domain to obtain certificate for")
+	}
+
+	accountKey := opts.AccountKey
+	if accountKey == nil {
+		if opts.DirectoryURL == "" || opts.DirectoryURL == acme.LetsEncryptURL {
+			return nil, errors.New("ACME account key is required by the Let's Encrypt production directory")
+		}
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate ACME account key")
+		}
+		accountKey = key
+	}
+	client := &acme.Client{
+		Key:          accountKey,
+		DirectoryURL: opts.DirectoryURL,
+		HTTPClient:   opts.HTTPClient,
+	}
+
+	account := &acme.Account{}
+	if opts.Email != "" {
+		account.Contact = []string{"mailto:" + opts.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, errors.Wrap(err, "register ACME account")
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, errors.Wrap(err, "create ACME order")
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err = solveACMEAuthorization(ctx, client, authzURL, opts.Solver); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, errors.Wrap(err, "wait ACME order")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate private key")
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: domains}, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create certificate request")
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "finalize ACME order")
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal private key")
+	}
+	return NewCertificateFromDER(chain, keyDER, ServerCertificate)
+}
+
+func solveACMEAuthorization(ctx context.Context, client *acme.Client, authzURL string, solver ACMEChallengeSolver) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return errors.Wrap(err, "get ACME authorization")
+	}
+	domain := authz.Identifier.Value
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == solver.ChallengeType() {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("ACME server doesn't offer the %s challenge for %s", solver.ChallengeType(), domain)
+	}
+
+	var response string
+	switch chal.Type {
+	case ACMEChallengeHTTP01:
+		response, err = client.HTTP01ChallengeResponse(chal.Token)
+	case ACMEChallengeDNS01:
+		response, err = client.DNS01ChallengeRecord(chal.Token)
+	default:
+		return fmt.Errorf("unsupported ACME challenge type %s", chal.Type)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "compute %s challenge response", chal.Type)
+	}
+
+	if err = solver.Present(ctx, domain, chal.Token, response); err != nil {
+		return errors.Wrapf(err, "present %s challenge for %s", chal.Type, domain)
+	}
+	// The challenge result doesn't depend on the cleanup, so its error is ignored.
+	defer func() { _ = solver.CleanUp(ctx, domain, chal.Token, response) }()
+
+	if _, err = client.Accept(ctx, chal); err != nil {
+		return errors.Wrapf(err, "accept %s challenge for %s", chal.Type, domain)
+	}
+	if _, err = client.WaitAuthorization(ctx, authzURL); err != nil {
+		return errors.Wrapf(err, "ACME authorization for %s", domain)
+	}
+	return nil
+}
+
+// applicationDomains returns the deduplicated hosts of the application.
+func applicationDomains(app *Application) []string {
+	var domains []string
+	seen := make(map[string]struct{})
+	for _, host := range app.Hosts {
+		host = strings.ToLower(host)
+		if _, ok := seen[host]; ok || host == "" {
+			continue
+		}
+		seen[host] = struct{}{}
+		domains = append(domains, host)
+	}
+	return domains
+}
+
+func (impl *certificateImpl) IssueApplicationCertificate(ctx context.Context, appID ID, acmeOpts *ACMEOptions, opts *ResourceCreateOptions) (*CertificateDetails, error) {
+	app, err := impl.applications.GetApplication(ctx, appID, &ResourceGetOptions{Cluster: opts.Cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "get application")
+	}
+	domains := applicationDomains(app)
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("application %s has no hosts", appID)
+	}
+
+	cert, err := ObtainACMECertificate(ctx, domains, acmeOpts)
+	if err != nil {
+		return nil, err
+	}
+	return impl.CreateCertificate(ctx, cert, opts)
+}
+
+func (impl *certificateImpl) RenewACMECertificate(ctx context.Context, certID ID, acmeOpts *ACMEOptions, opts *ResourceUpdateOptions) (*CertificateDetails, error) {
+	current, err := impl.GetCertificate(ctx, certID, &ResourceGetOptions{Cluster: opts.Cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "get certificate")
+	}
+	renewBefore := DefaultACMERenewBefore
+	if acmeOpts != nil && acmeOpts.RenewBefore > 0 {
+		renewBefore = acmeOpts.RenewBefore
+	}
+	if time.Until(current.NotAfter) > renewBefore {
+		return current, nil
+	}
+
+	cert, err := ObtainACMECertificate(ctx, current.SNIs, acmeOpts)
+	if err != nil {
+		return nil, err
+	}
+	return impl.renewCertificate(ctx, current, &cert.CertificateSpec, opts)
+}
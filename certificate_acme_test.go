@@ -0,0 +1,333 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme"
+
+	"github.com/api7/cloud-go-sdk/internal/fake"
+)
+
+type memoryDNSProvider struct {
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func (p *memoryDNSProvider) SetTXTRecord(_ context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records[fqdn] = append(p.records[fqdn], value)
+	return nil
+}
+
+func (p *memoryDNSProvider) DeleteTXTRecord(_ context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var records []string
+	for _, record := range p.records[fqdn] {
+		if record != value {
+			records = append(records, record)
+		}
+	}
+	p.records[fqdn] = records
+	return nil
+}
+
+func (p *memoryDNSProvider) LookupTXT(name string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.records[name], nil
+}
+
+// startFakeACMEServer starts a fake ACME server, which validates the HTTP-01
+// challenges through the `http01Solver` and the DNS-01 challenges through the `dns`.
+func startFakeACMEServer(t *testing.T, http01Solver http.Handler, dns *memoryDNSProvider) *fake.ACMEServer {
+	server, err := fake.NewACMEServer()
+	assert.Nil(t, err, "check create fake ACME server error")
+	go func() {
+		_ = server.Serve()
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	http01 := httptest.NewServer(http01Solver)
+	t.Cleanup(http01.Close)
+	server.SetHTTP01Address(strings.TrimPrefix(http01.URL, "http://"))
+	server.SetTXTResolver(dns.LookupTXT)
+	return server
+}
+
+func TestObtainACMECertificate(t *testing.T) {
+	t.Parallel()
+
+	http01Solver := NewHTTP01Solver(nil)
+	dns := &memoryDNSProvider{records: make(map[string][]string)}
+	server := startFakeACMEServer(t, http01Solver, dns)
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err, "generate account key")
+	// The cleanups run after all the parallel subtests.
+	t.Cleanup(func() {
+		assert.Empty(t, dns.records["_acme-challenge.api7.ai."], "check the TXT records are cleaned up")
+	})
+
+	testCases := []struct {
+		name          string
+		domains       []string
+		solver        ACMEChallengeSolver
+		expectedError string
+	}{
+		{
+			name:    "HTTP-01 challenge",
+			domains: []string{"api7.ai", "www.api7.ai"},
+			solver:  http01Solver,
+		},
+		{
+			name:    "DNS-01 challenge with wildcard domain",
+			domains: []string{"*.api7.ai", "api7.ai"},
+			solver:  &DNS01Solver{Provider: dns},
+		},
+		{
+			name:          "HTTP-01 challenge with wildcard domain",
+			domains:       []string{"*.api7.ai"},
+			solver:        http01Solver,
+			expectedError: "ACME server doesn't offer the http-01 challenge for api7.ai",
+		},
+		{
+			name:          "challenge not presented",
+			domains:       []string{"api7.ai"},
+			solver:        &DNS01Solver{Provider: &memoryDNSProvider{records: make(map[string][]string)}},
+			expectedError: "ACME authorization for api7.ai",
+		},
+		{
+			name:          "no solver",
+			domains:       []string{"api7.ai"},
+			expectedError: "ACME challenge solver is required",
+		},
+		{
+			name:          "no domains",
+			solver:        http01Solver,
+			expectedError: "no domain to obtain certificate for",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := &ACMEOptions{
+				DirectoryURL: server.DirectoryURL(),
+				AccountKey:   accountKey,
+				Email:        "admin@api7.ai",
+				Solver:       tc.solver,
+			}
+			cert, err := ObtainACMECertificate(context.Background(), tc.domains, opts)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+
+			metadata, err := cert.Validate()
+			assert.Nil(t, err, "check the certificate is valid")
+			assert.Equal(t, tc.domains, metadata.SNIs, "check the SNIs")
+			assert.Equal(t, "CN=Fake ACME Intermediate", metadata.Issuer, "check the issuer")
+
+			chain, err := parseCertificateChain(cert.Certificate)
+			assert.Nil(t, err, "parse the certificate chain")
+			assert.Len(t, chain, 2, "check the chain contains the intermediate certificate")
+			assert.Nil(t, chain[1].CheckSignatureFrom(server.RootCertificate()), "check the chain is issued by the root")
+		})
+	}
+}
+
+func TestObtainACMECertificateWithoutAccountKey(t *testing.T) {
+	t.Parallel()
+
+	for _, directoryURL := range []string{"", acme.LetsEncryptURL} {
+		_, err := ObtainACMECertificate(context.Background(), []string{"api7.ai"}, &ACMEOptions{
+			DirectoryURL: directoryURL,
+			Solver:       NewHTTP01Solver(nil),
+		})
+		assert.Contains(t, err.Error(), "ACME account key is required by the Let's Encrypt production directory", "check the error details")
+	}
+}
+
+func TestHTTP01Solver(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+	solver := NewHTTP01Solver(next)
+	assert.Nil(t, solver.Present(context.Background(), "api7.ai", "token", "token.thumbprint"), "present the challenge")
+
+	rec := httptest.NewRecorder()
+	solver.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/token", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "check the challenge status")
+	assert.Equal(t, "token.thumbprint", rec.Body.String(), "check the challenge response")
+
+	rec = httptest.NewRecorder()
+	solver.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+	assert.Equal(t, http.StatusTeapot, rec.Code, "check the request is passed to the next handler")
+
+	assert.Nil(t, solver.CleanUp(context.Background(), "api7.ai", "token", "token.thumbprint"), "clean up the challenge")
+	rec = httptest.NewRecorder()
+	solver.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/token", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "check the challenge is cleaned up")
+}
+
+func TestIssueApplicationCertificate(t *testing.T) {
+	t.Parallel()
+
+	http01Solver := NewHTTP01Solver(nil)
+	server := startFakeACMEServer(t, http01Solver, &memoryDNSProvider{})
+
+	testCases := []struct {
+		name          string
+		mockFunc      func(t *testing.T) httpClient
+		expectedError string
+	}{
+		{
+			name: "issued",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/apps/3"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"id":"3","name":"app","hosts":["api7.ai","API7.ai","www.api7.ai"]}`))
+					})
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, body interface{}, _ payloadDecodeFunc, _ http.Header) error {
+						metadata, err := body.(*Certificate).Validate()
+						assert.Nil(t, err, "check the certificate is valid")
+						assert.Equal(t, []string{"api7.ai", "www.api7.ai"}, metadata.SNIs, "check the SNIs")
+						return nil
+					})
+				return cli
+			},
+		},
+		{
+			name: "application without hosts",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/apps/3"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"id":"3","name":"app"}`))
+					})
+				return cli
+			},
+			expectedError: "application 3 has no hosts",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newCertificate(tc.mockFunc(t)).IssueApplicationCertificate(context.Background(), 3, &ACMEOptions{
+				DirectoryURL: server.DirectoryURL(),
+				Solver:       http01Solver,
+			}, &ResourceCreateOptions{
+				Cluster: &Cluster{ID: 1},
+			})
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+		})
+	}
+}
+
+func TestRenewACMECertificate(t *testing.T) {
+	t.Parallel()
+
+	http01Solver := NewHTTP01Solver(nil)
+	server := startFakeACMEServer(t, http01Solver, &memoryDNSProvider{})
+
+	mockGet := func(cli *MockhttpClient, notAfter time.Time) {
+		payload := fmt.Sprintf(`{"id":"12","snis":["api7.ai"],"type":"Server","not_after":"%s"}`, notAfter.UTC().Format(time.RFC3339))
+		cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates/12"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+				return decode(json.RawMessage(payload))
+			})
+	}
+
+	testCases := []struct {
+		name     string
+		mockFunc func(t *testing.T) httpClient
+	}{
+		{
+			name: "not due",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGet(cli, time.Now().Add(60*24*time.Hour))
+				return cli
+			},
+		},
+		{
+			name: "renewed",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGet(cli, time.Now().Add(10*24*time.Hour))
+				cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates/12"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, body interface{}, _ payloadDecodeFunc, _ http.Header) error {
+						metadata, err := body.(*Certificate).Validate()
+						assert.Nil(t, err, "check the certificate is valid")
+						assert.Equal(t, []string{"api7.ai"}, metadata.SNIs, "check the SNIs")
+						return nil
+					})
+				return cli
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newCertificate(tc.mockFunc(t)).RenewACMECertificate(context.Background(), 12, &ACMEOptions{
+				DirectoryURL: server.DirectoryURL(),
+				Solver:       http01Solver,
+			}, &ResourceUpdateOptions{
+				Cluster: &Cluster{ID: 1},
+			})
+			assert.Nil(t, err, "check the error")
+		})
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDevCAValidity is the default validity of the development root CA.
+	DefaultDevCAValidity = 10 * 365 * 24 * time.Hour
+	// DefaultDevCertificateValidity is the default validity of the certificates
+	// issued by the development CA.
+	DefaultDevCertificateValidity = 365 * 24 * time.Hour
+)
+
+// DevCAOptions contains the options to create a development CA.
+type DevCAOptions struct {
+	// CommonName is the common name of the root CA, default is "API7 Cloud Dev CA".
+	CommonName string
+	// Validity is the validity of the root CA, default is DefaultDevCAValidity.
+	Validity time.Duration
+	// CertificateValidity is the validity of the issued certificates, default
+	// is DefaultDevCertificateValidity.
+	CertificateValidity time.Duration
+}
+
+// DevCertificateRequest describes the certificate to be issued by the development CA.
+type DevCertificateRequest struct {
+	// Type is the certificate type, default is ServerCertificate.
+	Type CertificateType
+	// SNIs are the DNS names (or IP addresses) of the server certificate, it's
+	// required for the server certificate.
+	SNIs []string
+	// Subject is the subject of the certificate, the CommonName is required for
+	// the client certificate. The CommonName of the server certificate is the
+	// first SNI if it's empty.
+	Subject pkix.Name
+	// Labels are the labels of the API7 Cloud Certificate.
+	Labels []string
+}
+
+// DevCA is a minimal certificate authority for the development clusters, it issues
+// the server and client certificates by a self-signed root CA.
+// DO NOT use it in production.
+type DevCA struct {
+	cert     *x509.Certificate
+	key      crypto.Signer
+	validity time.Duration
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "generate serial number")
+	}
+	return serial, nil
+}
+
+// NewDevCA creates a development CA with a new ECDSA P-256 root.
+func NewDevCA(opts *DevCAOptions) (*DevCA, error) {
+	if opts == nil {
+		opts = &DevCAOptions{}
+	}
+	cn := opts.CommonName
+	if cn == "" {
+		cn = "API7 Cloud Dev CA"
+	}
+	validity := opts.Validity
+	if validity == 0 {
+		validity = DefaultDevCAValidity
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate private key")
+	}
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"API7 Cloud Development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create root certificate")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse root certificate")
+	}
+	return &DevCA{
+		cert:     cert,
+		key:      key,
+		validity: opts.CertificateValidity,
+	}, nil
+}
+
+// LoadDevCA loads a development CA from the root certificate and the private
+// key in PEM format, e.g., the ones saved from the Certificate and PrivateKey.
+func LoadDevCA(certPEM, keyPEM string, opts *DevCAOptions) (*DevCA, error) {
+	chain, err := parseCertificateChain(certPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "certificate")
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "private key")
+	}
+	cert := chain[0]
+	if !cert.IsCA {
+		return nil, errors.New("the certificate is not a CA certificate")
+	}
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return nil, errors.New("private key doesn't match the certificate")
+	}
+
+	ca := &DevCA{
+		cert: cert,
+		key:  key,
+	}
+	if opts != nil {
+		ca.validity = opts.CertificateValidity
+	}
+	return ca, nil
+}
+
+// Certificate returns the root certificate in PEM format.
+func (ca *DevCA) Certificate() string {
+	return encodeCertificatesPEM([]*x509.Certificate{ca.cert})
+}
+
+// PrivateKey returns the private key of the root certificate in PKCS#8 PEM format.
+func (ca *DevCA) PrivateKey() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(ca.key)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal private key")
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// IssueCertificate issues a certificate with a new ECDSA P-256 private key.
+// For the server certificate, the Certificate only contains the leaf certificate;
+// for the client certificate, the root certificate is put into the CACertificate.
+func (ca *DevCA) IssueCertificate(req *DevCertificateRequest) (*Certificate, error) {
+	typ := req.Type
+	if typ == "" {
+		typ = ServerCertificate
+	}
+
+	subject := req.Subject
+	tmpl := &x509.Certificate{
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	}
+	switch typ {
+	case ServerCertificate:
+		if len(req.SNIs) == 0 {
+			return nil, errors.New("SNIs are required for the server certificate")
+		}
+		if subject.CommonName == "" {
+			subject.CommonName = req.SNIs[0]
+		}
+		for _, sni := range req.SNIs {
+			if ip := net.ParseIP(sni); ip != nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			} else {
+				tmpl.DNSNames = append(tmpl.DNSNames, sni)
+			}
+		}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	case ClientCertificate:
+		if subject.CommonName == "" {
+			return nil, errors.New("subject common name is required for the client certificate")
+		}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	default:
+		return nil, fmt.Errorf("unknown certificate type %s", typ)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate private key")
+	}
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	validity := ca.validity
+	if validity == 0 {
+		validity = DefaultDevCertificateValidity
+	}
+	now := time.Now()
+	tmpl.SerialNumber = serial
+	tmpl.Subject = subject
+	tmpl.NotBefore = now.Add(-time.Hour)
+	tmpl.NotAfter = now.Add(validity)
+	if tmpl.NotAfter.After(ca.cert.NotAfter) {
+		tmpl.NotAfter = ca.cert.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create certificate")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse certificate")
+	}
+	certificate, err := newCertificateFromParts([]*x509.Certificate{cert, ca.cert}, key, typ)
+	if err != nil {
+		return nil, err
+	}
+	certificate.Labels = req.Labels
+	return certificate, nil
+}
+
+func (impl *certificateImpl) CreateDevCertificate(ctx context.Context, ca *DevCA, req *DevCertificateRequest, opts *ResourceCreateOptions) (*CertificateDetails, error) {
+	cert, err := ca.IssueCertificate(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "issue certificate")
+	}
+	return impl.CreateCertificate(ctx, cert, opts)
+}
+
+func (impl *certificateImpl) CreateDevUpstreamClientCertificate(ctx context.Context, ca *DevCA, appID ID, upstreamVersion string,
+	req *DevCertificateRequest, opts *ResourceCreateOptions) (*CertificateDetails, error) {
+	if req.Type != "" && req.Type != ClientCertificate {
+		return nil, fmt.Errorf("unexpected certificate type %s, only %s certificate can be used for upstream", req.Type, ClientCertificate)
+	}
+	clientReq := *req
+	clientReq.Type = ClientCertificate
+
+	app, err := impl.applications.GetApplication(ctx, appID, &ResourceGetOptions{Cluster: opts.Cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "get application")
+	}
+	var upstreams []*Upstream
+	for i := range app.Upstreams {
+		if upstreamVersion == "" || app.Upstreams[i].Version == upstreamVersion {
+			upstreams = append(upstreams, &app.Upstreams[i].Upstream)
+		}
+	}
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("application %s has no upstream with version %q", appID, upstreamVersion)
+	}
+
+	cert, err := impl.CreateDevCertificate(ctx, ca, &clientReq, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, upstream := range upstreams {
+		upstream.ClientCertID = cert.ID
+	}
+	if _, err = impl.applications.UpdateApplication(ctx, app, &ResourceUpdateOptions{Cluster: opts.Cluster}); err != nil {
+		// Don't leave the unused certificate behind.
+		if deleteErr := impl.DeleteCertificate(ctx, cert.ID, &ResourceDeleteOptions{Cluster: opts.Cluster}); deleteErr != nil {
+			return nil, errors.Wrapf(err, "set client certificate %s for application (the certificate is kept since it can't be deleted: %s)", cert.ID, deleteErr)
+		}
+		return nil, errors.Wrapf(err, "set client certificate %s for application (the certificate is deleted)", cert.ID)
+	}
+	return cert, nil
+}
@@ -0,0 +1,279 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevCAIssueCertificate(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	roots := x509.NewCertPool()
+	chain, err := parseCertificateChain(ca.Certificate())
+	assert.Nil(t, err, "parse root certificate")
+	roots.AddCert(chain[0])
+
+	testCases := []struct {
+		name          string
+		req           *DevCertificateRequest
+		expectedSNIs  []string
+		expectedError string
+	}{
+		{
+			name: "server certificate",
+			req: &DevCertificateRequest{
+				SNIs:   []string{"api7.local", "*.api7.local", "127.0.0.1"},
+				Labels: []string{"dev"},
+			},
+			expectedSNIs: []string{"api7.local", "*.api7.local"},
+		},
+		{
+			name: "client certificate",
+			req: &DevCertificateRequest{
+				Type:    ClientCertificate,
+				Subject: pkix.Name{CommonName: "gateway", Organization: []string{"API7"}},
+			},
+			expectedSNIs: []string{"gateway"},
+		},
+		{
+			name:          "server certificate without SNIs",
+			req:           &DevCertificateRequest{},
+			expectedError: "SNIs are required for the server certificate",
+		},
+		{
+			name: "client certificate without common name",
+			req: &DevCertificateRequest{
+				Type: ClientCertificate,
+			},
+			expectedError: "subject common name is required for the client certificate",
+		},
+		{
+			name: "unknown type",
+			req: &DevCertificateRequest{
+				Type: "Peer",
+			},
+			expectedError: "unknown certificate type Peer",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cert, err := ca.IssueCertificate(tc.req)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			assert.Equal(t, tc.req.Labels, cert.Labels, "check the labels")
+
+			metadata, err := cert.Validate()
+			assert.Nil(t, err, "check the certificate is valid")
+			assert.Equal(t, tc.expectedSNIs, metadata.SNIs, "check the SNIs")
+
+			leaf, err := parseCertificateChain(cert.Certificate)
+			assert.Nil(t, err, "parse the certificate")
+			assert.Len(t, leaf, 1, "check the root is not in the certificate")
+			_, err = leaf[0].Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+			assert.Nil(t, err, "check the certificate is issued by the root")
+			if cert.Type == ClientCertificate {
+				assert.Equal(t, ca.Certificate(), cert.CACertificate, "check the CA certificate")
+			} else {
+				assert.Empty(t, cert.CACertificate, "check the CA certificate")
+			}
+		})
+	}
+}
+
+func TestLoadDevCA(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(&DevCAOptions{CommonName: "Test CA"})
+	assert.Nil(t, err, "create dev CA")
+	keyPEM, err := ca.PrivateKey()
+	assert.Nil(t, err, "export the private key")
+
+	loaded, err := LoadDevCA(ca.Certificate(), keyPEM, nil)
+	assert.Nil(t, err, "load dev CA")
+	cert, err := loaded.IssueCertificate(&DevCertificateRequest{SNIs: []string{"api7.local"}})
+	assert.Nil(t, err, "issue certificate")
+	metadata, err := cert.Validate()
+	assert.Nil(t, err, "check the certificate is valid")
+	assert.Equal(t, "CN=Test CA,O=API7 Cloud Development", metadata.Issuer, "check the issuer")
+
+	other, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	otherKeyPEM, err := other.PrivateKey()
+	assert.Nil(t, err, "export the private key")
+	_, err = LoadDevCA(ca.Certificate(), otherKeyPEM, nil)
+	assert.Contains(t, err.Error(), "private key doesn't match the certificate", "check the error details")
+
+	_, err = LoadDevCA(cert.Certificate, cert.PrivateKey, nil)
+	assert.Contains(t, err.Error(), "the certificate is not a CA certificate", "check the error details")
+}
+
+func TestCreateDevUpstreamClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+
+	appPayload := `{"id":"3","name":"app","upstreams":[
+		{"version":"v1","upstream":{"scheme":"https"}},
+		{"version":"v2","upstream":{"scheme":"https"}}
+	]}`
+	mockGetApp := func(cli *MockhttpClient) {
+		cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/apps/3"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+				return decode(json.RawMessage(appPayload))
+			})
+	}
+
+	mockCreateCert := func(cli *MockhttpClient) {
+		cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, _ interface{}, decode payloadDecodeFunc, _ http.Header) error {
+				return decode(json.RawMessage(`{"id":"9","type":"Client"}`))
+			})
+	}
+	mockUpdateAppFailure := func(cli *MockhttpClient) {
+		cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/apps/3"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+	}
+
+	testCases := []struct {
+		name          string
+		version       string
+		req           *DevCertificateRequest
+		mockFunc      func(t *testing.T) httpClient
+		expectedError string
+	}{
+		{
+			name:    "set client certificate for upstream",
+			version: "v2",
+			req: &DevCertificateRequest{
+				Subject: pkix.Name{CommonName: "gateway"},
+				Labels:  []string{"dev"},
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGetApp(cli)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, body interface{}, decode payloadDecodeFunc, _ http.Header) error {
+						cert := body.(*Certificate)
+						assert.Equal(t, ClientCertificate, cert.Type, "check the certificate type")
+						assert.Equal(t, []string{"dev"}, cert.Labels, "check the labels")
+						return decode(json.RawMessage(`{"id":"9","type":"Client"}`))
+					})
+				cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/apps/3"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, body interface{}, _ payloadDecodeFunc, _ http.Header) error {
+						app := body.(*Application)
+						assert.Equal(t, ID(0), app.Upstreams[0].Upstream.ClientCertID, "check the v1 upstream is unchanged")
+						assert.Equal(t, ID(9), app.Upstreams[1].Upstream.ClientCertID, "check the v2 upstream client certificate")
+						return nil
+					})
+				return cli
+			},
+		},
+		{
+			name:    "unknown upstream version",
+			version: "v3",
+			req: &DevCertificateRequest{
+				Subject: pkix.Name{CommonName: "gateway"},
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGetApp(cli)
+				return cli
+			},
+			expectedError: `application 3 has no upstream with version "v3"`,
+		},
+		{
+			name: "certificate deleted after application update failure",
+			req: &DevCertificateRequest{
+				Subject: pkix.Name{CommonName: "gateway"},
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGetApp(cli)
+				mockCreateCert(cli)
+				mockUpdateAppFailure(cli)
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates/9"), "", nil, gomock.Any()).Return(nil)
+				return cli
+			},
+			expectedError: "set client certificate 9 for application (the certificate is deleted): mock error",
+		},
+		{
+			name: "certificate kept after application update failure",
+			req: &DevCertificateRequest{
+				Subject: pkix.Name{CommonName: "gateway"},
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGetApp(cli)
+				mockCreateCert(cli)
+				mockUpdateAppFailure(cli)
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates/9"), "", nil, gomock.Any()).Return(errors.New("delete error"))
+				return cli
+			},
+			expectedError: "set client certificate 9 for application (the certificate is kept since it can't be deleted: delete error): mock error",
+		},
+		{
+			name: "server certificate",
+			req: &DevCertificateRequest{
+				Type: ServerCertificate,
+				SNIs: []string{"api7.local"},
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				return NewMockhttpClient(gomock.NewController(t))
+			},
+			expectedError: "only Client certificate can be used for upstream",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cert, err := newCertificate(tc.mockFunc(t)).CreateDevUpstreamClientCertificate(context.Background(), ca, 3, tc.version, tc.req, &ResourceCreateOptions{
+				Cluster: &Cluster{ID: 1},
+			})
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			assert.Equal(t, ID(9), cert.ID, "check the certificate id")
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExpiringCertificate is a certificate which is going to expire (or has expired).
+type ExpiringCertificate struct {
+	// ClusterID is the cluster that the certificate belongs to.
+	ClusterID ID
+	// Certificate is the certificate details.
+	Certificate *CertificateDetails
+	// Expired indicates whether the certificate has expired.
+	Expired bool
+	// ExpiresIn is the remaining validity of the certificate, it's negative if the
+	// certificate has expired.
+	ExpiresIn time.Duration
+	// Applications are the applications which reference the certificate.
+	Applications []*Application
+}
+
+// scanClusterIDs returns the specified cluster, or all the clusters in the organizations of the current user.
+func (impl *certificateImpl) scanClusterIDs(ctx context.Context, clusterID ID) ([]ID, error) {
+	if clusterID != 0 {
+		return []ID{clusterID}, nil
+	}
+	user, err := newUser(impl.client).Me(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ids []ID
+	for _, orgID := range user.OrgIDs {
+		iter, err := newCluster(impl.client).ListClusters(ctx, &ResourceListOptions{
+			Organization: &Organization{ID: orgID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for {
+			cluster, err := iter.Next()
+			if err != nil {
+				return nil, errors.Wrapf(err, "list clusters in organization %s", orgID)
+			}
+			if cluster == nil {
+				break
+			}
+			ids = append(ids, cluster.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (impl *certificateImpl) ScanExpiringCertificates(ctx context.Context, clusterID ID, within time.Duration) ([]*ExpiringCertificate, error) {
+	clusterIDs, err := impl.scanClusterIDs(ctx, clusterID)
+	if err != nil {
+		return nil, errors.Wrap(err, "scan expiring certificates")
+	}
+
+	now := time.Now()
+	var expiring []*ExpiringCertificate
+	for _, id := range clusterIDs {
+		opts := &ResourceListOptions{Cluster: &Cluster{ID: id}}
+		certIter, err := impl.ListCertificates(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[ID]*ExpiringCertificate)
+		for {
+			cert, err := certIter.Next()
+			if err != nil {
+				return nil, errors.Wrapf(err, "list certificates in cluster %s", id)
+			}
+			if cert == nil {
+				break
+			}
+			if cert.NotAfter.Sub(now) > within {
+				continue
+			}
+			ec := &ExpiringCertificate{
+				ClusterID:   id,
+				Certificate: cert,
+				Expired:     !now.Before(cert.NotAfter),
+				ExpiresIn:   cert.NotAfter.Sub(now),
+			}
+			found[cert.ID] = ec
+			expiring = append(expiring, ec)
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		appIter, err := impl.applications.ListApplications(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			app, err := appIter.Next()
+			if err != nil {
+				return nil, errors.Wrapf(err, "list applications in cluster %s", id)
+			}
+			if app == nil {
+				break
+			}
+			for _, certID := range app.AvailableCertIDs {
+				if ec, ok := found[certID]; ok {
+					ec.Applications = append(ec.Applications, app)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].Certificate.NotAfter.Before(expiring[j].Certificate.NotAfter)
+	})
+	return expiring, nil
+}
+
+// sniCovered reports whether the `sni` is covered by the `snis`, the wildcard
+// SNI (e.g. "*.api7.ai") covers the SNIs of one more label (e.g. "www.api7.ai").
+func sniCovered(sni string, snis []string) bool {
+	sni = strings.ToLower(sni)
+	for _, s := range snis {
+		s = strings.ToLower(s)
+		if s == sni {
+			return true
+		}
+		if strings.HasPrefix(s, "*.") && !strings.HasPrefix(sni, "*.") {
+			if idx := strings.IndexByte(sni, '.'); idx > 0 && sni[idx:] == s[1:] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (impl *certificateImpl) RenewCertificate(ctx context.Context, certID ID, spec *CertificateSpec, opts *ResourceUpdateOptions) (*CertificateDetails, error) {
+	current, err := impl.GetCertificate(ctx, certID, &ResourceGetOptions{Cluster: opts.Cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "get certificate")
+	}
+	return impl.renewCertificate(ctx, current, spec, opts)
+}
+
+// renewCertificate replaces the `current` certificate with the `spec`.
+func (impl *certificateImpl) renewCertificate(ctx context.Context, current *CertificateDetails, spec *CertificateSpec, opts *ResourceUpdateOptions) (*CertificateDetails, error) {
+	renewed := *spec
+	if renewed.Type == "" {
+		renewed.Type = CertificateType(current.Type)
+	}
+	if renewed.Labels == nil {
+		renewed.Labels = current.Labels
+	}
+	if current.CACertificate != nil && renewed.CACertificate == "" {
+		return nil, errors.New("the certificate has a CA certificate, the CA certificate should be specified as well")
+	}
+	metadata, err := renewed.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "validate certificate")
+	}
+
+	var uncovered []string
+	for _, sni := range current.SNIs {
+		if !sniCovered(sni, metadata.SNIs) {
+			uncovered = append(uncovered, sni)
+		}
+	}
+	if len(uncovered) > 0 {
+		return nil, fmt.Errorf("the new certificate doesn't cover the SNIs: %s", strings.Join(uncovered, ", "))
+	}
+
+	return impl.UpdateCertificate(ctx, &Certificate{
+		CertificateSpec: renewed,
+		ID:              current.ID,
+	}, opts)
+}
@@ -0,0 +1,290 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockListPage(cli *MockhttpClient, uri, payload string) {
+	cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, uri), "page=1&page_size=10",
+		gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+			return decode(json.RawMessage(payload))
+		})
+	cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, uri), "page=2&page_size=10",
+		gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+}
+
+func TestScanExpiringCertificates(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	notAfter := func(d time.Duration) string {
+		return now.Add(d).UTC().Format(time.RFC3339)
+	}
+	certsPayload := fmt.Sprintf(`{"list":[
+		{"id":"1","not_after":"%s","snis":["a.api7.ai"]},
+		{"id":"2","not_after":"%s","snis":["b.api7.ai"]},
+		{"id":"3","not_after":"%s","snis":["c.api7.ai"]}
+	]}`, notAfter(10*24*time.Hour), notAfter(-time.Hour), notAfter(90*24*time.Hour))
+	appsPayload := `{"list":[
+		{"id":"7","name":"a","available_cert_ids":["1","3"]},
+		{"id":"8","name":"b","available_cert_ids":["1","2"]}
+	]}`
+
+	testCases := []struct {
+		name          string
+		clusterID     ID
+		mockFunc      func(t *testing.T) httpClient
+		expectedIDs   []ID
+		expectedApps  map[ID][]ID
+		expectedError string
+	}{
+		{
+			name:      "single cluster",
+			clusterID: 1,
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockListPage(cli, "/clusters/1/certificates", certsPayload)
+				mockListPage(cli, "/clusters/1/apps", appsPayload)
+				return cli
+			},
+			expectedIDs: []ID{2, 1},
+			expectedApps: map[ID][]ID{
+				1: {7, 8},
+				2: {8},
+			},
+		},
+		{
+			name: "all clusters",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/user/me"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"id":"1","org_ids":["1"]}`))
+					})
+				mockListPage(cli, "/orgs/1/clusters", `{"list":[{"id":"1"},{"id":"2"}]}`)
+				mockListPage(cli, "/clusters/1/certificates", `{"list":[]}`)
+				mockListPage(cli, "/clusters/2/certificates", certsPayload)
+				mockListPage(cli, "/clusters/2/apps", appsPayload)
+				return cli
+			},
+			expectedIDs: []ID{2, 1},
+			expectedApps: map[ID][]ID{
+				1: {7, 8},
+				2: {8},
+			},
+		},
+		{
+			name:      "failed to list certificates",
+			clusterID: 1,
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates"), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errors.New("mock error"))
+				return cli
+			},
+			expectedError: "list certificates in cluster 1",
+		},
+		{
+			name: "failed to get the current user",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/user/me"), "", gomock.Any(), gomock.Any()).
+					Return(errors.New("mock error"))
+				return cli
+			},
+			expectedError: "scan expiring certificates",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			certs, err := newCertificate(tc.mockFunc(t)).ScanExpiringCertificates(context.Background(), tc.clusterID, 30*24*time.Hour)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+
+			var ids []ID
+			for _, cert := range certs {
+				ids = append(ids, cert.Certificate.ID)
+				var appIDs []ID
+				for _, app := range cert.Applications {
+					appIDs = append(appIDs, app.ID)
+				}
+				assert.Equal(t, tc.expectedApps[cert.Certificate.ID], appIDs, "check the applications of certificate %s", cert.Certificate.ID)
+				assert.Equal(t, cert.Certificate.ID == 2, cert.Expired, "check the expired flag")
+				assert.Equal(t, cert.Expired, cert.ExpiresIn < 0, "check the remaining validity")
+			}
+			assert.Equal(t, tc.expectedIDs, ids, "check the expiring certificates")
+		})
+	}
+}
+
+func TestSNICovered(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		sni      string
+		snis     []string
+		expected bool
+	}{
+		{sni: "api7.ai", snis: []string{"API7.ai"}, expected: true},
+		{sni: "www.api7.ai", snis: []string{"*.api7.ai"}, expected: true},
+		{sni: "*.api7.ai", snis: []string{"*.api7.ai"}, expected: true},
+		{sni: "api7.ai", snis: []string{"*.api7.ai"}, expected: false},
+		{sni: "a.b.api7.ai", snis: []string{"*.api7.ai"}, expected: false},
+		{sni: "*.api7.ai", snis: []string{"www.api7.ai"}, expected: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, sniCovered(tc.sni, tc.snis), "check %s covered by %v", tc.sni, tc.snis)
+	}
+}
+
+func TestRenewCertificate(t *testing.T) {
+	t.Parallel()
+
+	root := newTestCertificate(t, "root", nil, nil)
+	renewed := newTestCertificate(t, "renewed", root, func(tmpl *x509.Certificate) {
+		tmpl.DNSNames = []string{"api7.ai", "*.api7.ai"}
+	})
+
+	mockGet := func(cli *MockhttpClient, payload string) {
+		cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates/12"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+				return decode(json.RawMessage(payload))
+			})
+	}
+
+	testCases := []struct {
+		name          string
+		spec          *CertificateSpec
+		mockFunc      func(t *testing.T) httpClient
+		expectedError string
+	}{
+		{
+			name: "renewed",
+			spec: &CertificateSpec{
+				Certificate: renewed.certPEM,
+				PrivateKey:  renewed.keyPEM,
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGet(cli, `{"id":"12","snis":["api7.ai","www.api7.ai"],"labels":["prod"],"type":"Server"}`)
+				cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates/12"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, body interface{}, _ payloadDecodeFunc, _ http.Header) error {
+						cert := body.(*Certificate)
+						assert.Equal(t, []string{"prod"}, cert.Labels, "check the labels are kept")
+						assert.Equal(t, ServerCertificate, cert.Type, "check the type is kept")
+						assert.Equal(t, renewed.certPEM, cert.Certificate, "check the certificate")
+						return nil
+					})
+				return cli
+			},
+		},
+		{
+			name: "SNIs not covered",
+			spec: &CertificateSpec{
+				Certificate: renewed.certPEM,
+				PrivateKey:  renewed.keyPEM,
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGet(cli, `{"id":"12","snis":["api7.ai","apisix.apache.org"],"type":"Server"}`)
+				return cli
+			},
+			expectedError: "the new certificate doesn't cover the SNIs: apisix.apache.org",
+		},
+		{
+			name: "CA certificate missing",
+			spec: &CertificateSpec{
+				Certificate: renewed.certPEM,
+				PrivateKey:  renewed.keyPEM,
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGet(cli, `{"id":"12","snis":["api7.ai"],"type":"Client","ca_certificate":{"snis":["root"]}}`)
+				return cli
+			},
+			expectedError: "the CA certificate should be specified as well",
+		},
+		{
+			name: "invalid certificate",
+			spec: &CertificateSpec{
+				Certificate: renewed.certPEM,
+				PrivateKey:  root.keyPEM,
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				mockGet(cli, `{"id":"12","snis":["api7.ai"],"type":"Server"}`)
+				return cli
+			},
+			expectedError: "validate certificate: private key doesn't match the certificate",
+		},
+		{
+			name: "failed to get certificate",
+			spec: &CertificateSpec{},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates/12"), "", gomock.Any(), gomock.Any()).
+					Return(errors.New("mock error"))
+				return cli
+			},
+			expectedError: "get certificate",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newCertificate(tc.mockFunc(t)).RenewCertificate(context.Background(), 12, tc.spec, &ResourceUpdateOptions{
+				Cluster: &Cluster{ID: 1},
+			})
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+		})
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	_oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	_oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	_oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	_oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	_oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	_oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	_oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	_oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	_oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+
+	_errBadPassphrase = errors.New("decrypt private key: incorrect passphrase")
+)
+
+// _maxPBKDF2Iterations caps the PBKDF2 iteration count of the encrypted private
+// key, so that a crafted key can't keep the caller busy for hours.
+const _maxPBKDF2Iterations = 10000000
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8PrivateKey decrypts the PKCS#8 private key which is encrypted by
+// PBES2 (PBKDF2 with AES-CBC or DES-EDE3-CBC), it's the default of OpenSSL.
+func decryptPKCS8PrivateKey(der []byte, passphrase string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.Wrap(err, "parse encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(_oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption algorithm %s", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrap(err, "parse PBES2 parameters")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(_oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, errors.Wrap(err, "parse PBKDF2 parameters")
+	}
+	if kdf.IterationCount <= 0 || kdf.IterationCount > _maxPBKDF2Iterations {
+		return nil, fmt.Errorf("PBKDF2 iteration count %d must be between 1 and %d", kdf.IterationCount, _maxPBKDF2Iterations)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(_oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(_oidHMACWithSHA256):
+		prf = sha256.New
+	case kdf.PRF.Algorithm.Equal(_oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", kdf.PRF.Algorithm)
+	}
+
+	var (
+		keyLen   int
+		newBlock func([]byte) (cipher.Block, error)
+	)
+	scheme := params.EncryptionScheme.Algorithm
+	switch {
+	case scheme.Equal(_oidAES128CBC):
+		keyLen, newBlock = 16, aes.NewCipher
+	case scheme.Equal(_oidAES192CBC):
+		keyLen, newBlock = 24, aes.NewCipher
+	case scheme.Equal(_oidAES256CBC):
+		keyLen, newBlock = 32, aes.NewCipher
+	case scheme.Equal(_oidDESEDE3CBC):
+		keyLen, newBlock = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported private key encryption scheme %s", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.Wrap(err, "parse encryption scheme IV")
+	}
+
+	block, err := newBlock(pbkdf2.Key([]byte(passphrase), kdf.Salt, kdf.IterationCount, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("decrypt private key: malformed encrypted data")
+	}
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	// Remove the PKCS#7 padding, a wrong passphrase most likely results in a bad padding.
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, _errBadPassphrase
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// parseEncryptedPrivateKey parses the private key in PEM format, the key can be
+// encrypted either in the legacy OpenSSL format or in the PKCS#8 format.
+func parseEncryptedPrivateKey(data []byte, passphrase string) (crypto.Signer, error) {
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("no private key found in PEM data")
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+
+		der := block.Bytes
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			var err error
+			if der, err = decryptPKCS8PrivateKey(block.Bytes, passphrase); err != nil {
+				return nil, err
+			}
+		// The legacy format is insecure by design, but it's still widely used.
+		case x509.IsEncryptedPEMBlock(block): //nolint:staticcheck
+			var err error
+			if der, err = x509.DecryptPEMBlock(block, []byte(passphrase)); err != nil { //nolint:staticcheck
+				return nil, _errBadPassphrase
+			}
+		}
+		key, err := parsePrivateKeyDER(der)
+		if err != nil && block.Type == "ENCRYPTED PRIVATE KEY" {
+			return nil, _errBadPassphrase
+		}
+		return key, err
+	}
+}
+
+func isSelfSignedCertificate(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+func encodeCertificatesPEM(certs []*x509.Certificate) string {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.String()
+}
+
+// newCertificateFromParts normalizes the certificates and the private key to a PEM Certificate.
+// The leaf certificate is the one which matches the private key, it's put first and
+// followed by its issuers in order. For the server certificate, the self-signed roots are
+// dropped and the certificates out of the chain are rejected; for the client certificate,
+// all the CA certificates are put into the CACertificate.
+func newCertificateFromParts(certs []*x509.Certificate, key crypto.Signer, typ CertificateType) (*Certificate, error) {
+	if typ == "" {
+		typ = ServerCertificate
+	}
+	if typ != ServerCertificate && typ != ClientCertificate {
+		return nil, fmt.Errorf("unknown certificate type %s", typ)
+	}
+
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	leafIndex := -1
+	for i, cert := range certs {
+		if pub.Equal(cert.PublicKey) {
+			leafIndex = i
+			break
+		}
+	}
+	if leafIndex < 0 {
+		return nil, errors.New("no certificate matches the private key")
+	}
+
+	chain := []*x509.Certificate{certs[leafIndex]}
+	remaining := make([]*x509.Certificate, 0, len(certs)-1)
+	remaining = append(remaining, certs[:leafIndex]...)
+	remaining = append(remaining, certs[leafIndex+1:]...)
+	for {
+		current := chain[len(chain)-1]
+		if isSelfSignedCertificate(current) {
+			break
+		}
+		issuer := -1
+		for i, cert := range remaining {
+			if current.CheckSignatureFrom(cert) == nil {
+				issuer = i
+				break
+			}
+		}
+		if issuer < 0 {
+			break
+		}
+		chain = append(chain, remaining[issuer])
+		remaining = append(remaining[:issuer], remaining[issuer+1:]...)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal private key")
+	}
+	spec := CertificateSpec{
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+		Type:       typ,
+	}
+	if typ == ClientCertificate {
+		var cas []*x509.Certificate
+		for _, cert := range append(chain[1:], remaining...) {
+			if cert.IsCA {
+				cas = append(cas, cert)
+			}
+		}
+		spec.Certificate = encodeCertificatesPEM(chain[:1])
+		spec.CACertificate = encodeCertificatesPEM(cas)
+	} else {
+		if len(remaining) > 0 {
+			subjects := make([]string, 0, len(remaining))
+			for _, cert := range remaining {
+				subjects = append(subjects, fmt.Sprintf("%q", cert.Subject.String()))
+			}
+			return nil, fmt.Errorf("certificates %s are not in the chain of the leaf certificate", strings.Join(subjects, ", "))
+		}
+		bundle := chain[:1]
+		for _, cert := range chain[1:] {
+			if !isSelfSignedCertificate(cert) {
+				bundle = append(bundle, cert)
+			}
+		}
+		spec.Certificate = encodeCertificatesPEM(bundle)
+	}
+	return &Certificate{CertificateSpec: spec}, nil
+}
+
+// NewCertificateFromPKCS12 builds a Certificate from the PKCS#12 (.p12 or .pfx)
+// bundle which is protected by the `password`.
+// The leaf certificate is put first, see NewCertificateFromPEM for the details.
+func NewCertificateFromPKCS12(data []byte, password string, typ CertificateType) (*Certificate, error) {
+	key, leaf, cas, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode PKCS#12 data")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return newCertificateFromParts(append([]*x509.Certificate{leaf}, cas...), signer, typ)
+}
+
+// NewCertificateFromDER builds a Certificate from the certificates and the private
+// key (PKCS#8, PKCS#1 or SEC 1) in DER format.
+// The leaf certificate is put first, see NewCertificateFromPEM for the details.
+func NewCertificateFromDER(certs [][]byte, key []byte, typ CertificateType) (*Certificate, error) {
+	var parsed []*x509.Certificate
+	for i, der := range certs {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse certificate[%d]", i)
+		}
+		parsed = append(parsed, cert)
+	}
+	signer, err := parsePrivateKeyDER(key)
+	if err != nil {
+		return nil, err
+	}
+	return newCertificateFromParts(parsed, signer, typ)
+}
+
+// NewCertificateFromPEM builds a Certificate from the certificates and the private key
+// in PEM format, the certificates can be in any order and the private key can be
+// encrypted (either the PKCS#8 "ENCRYPTED PRIVATE KEY" or the legacy OpenSSL format)
+// by the `passphrase`. The private key is converted to PKCS#8 without encryption.
+// The leaf certificate (which matches the private key) is put first. For the server
+// certificate, it's followed by the intermediate certificates in order, and the
+// self-signed roots are dropped; for the client certificate, all the CA certificates
+// are moved to the CACertificate.
+func NewCertificateFromPEM(certPEM, keyPEM []byte, passphrase string, typ CertificateType) (*Certificate, error) {
+	certs, err := parseCertificateChain(string(certPEM))
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseEncryptedPrivateKey(keyPEM, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return newCertificateFromParts(certs, key, typ)
+}
+
+// certificatePEMBlocks returns the CERTIFICATE blocks in the PEM data, the
+// other blocks (e.g., the private key) are dropped.
+func certificatePEMBlocks(data []byte) []byte {
+	var certs []byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, pem.EncodeToMemory(block)...)
+		}
+	}
+}
+
+// NewCertificateFromChainFile builds a Certificate from the full chain file and the
+// private key file in PEM format. The `keyFile` can be empty if the private key is
+// in the chain file. See NewCertificateFromPEM for the details.
+func NewCertificateFromChainFile(chainFile, keyFile, passphrase string, typ CertificateType) (*Certificate, error) {
+	chain, err := os.ReadFile(chainFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read chain file")
+	}
+	key := chain
+	if keyFile != "" {
+		if key, err = os.ReadFile(keyFile); err != nil {
+			return nil, errors.Wrap(err, "read private key file")
+		}
+	}
+	return NewCertificateFromPEM(certificatePEMBlocks(chain), key, passphrase, typ)
+}
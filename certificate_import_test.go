@@ -0,0 +1,265 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestNewCertificateFromPKCS12(t *testing.T) {
+	t.Parallel()
+
+	root := newTestCertificate(t, "root", nil, nil)
+	intermediate := newTestCertificate(t, "intermediate", root, asCA)
+	leaf := newTestCertificate(t, "leaf", intermediate, nil)
+
+	bundle, err := pkcs12.Modern.Encode(leaf.key, leaf.cert, []*x509.Certificate{root.cert, intermediate.cert}, "secret")
+	assert.Nil(t, err, "encode PKCS#12 bundle")
+	opensslBundle, err := os.ReadFile("testdata/test.p12")
+	assert.Nil(t, err, "read the test PKCS#12 bundle")
+	vaultCert, err := os.ReadFile("testdata/test.pem")
+	assert.Nil(t, err, "read the test certificate")
+
+	testCases := []struct {
+		name                  string
+		data                  []byte
+		password              string
+		typ                   CertificateType
+		expectedCertificate   string
+		expectedCACertificate string
+		expectedError         string
+	}{
+		{
+			name:                "server certificate",
+			data:                bundle,
+			password:            "secret",
+			expectedCertificate: leaf.certPEM + intermediate.certPEM,
+		},
+		{
+			name:                  "client certificate",
+			data:                  bundle,
+			password:              "secret",
+			typ:                   ClientCertificate,
+			expectedCertificate:   leaf.certPEM,
+			expectedCACertificate: intermediate.certPEM + root.certPEM,
+		},
+		{
+			name:                "bundle generated by openssl",
+			data:                opensslBundle,
+			password:            "api7",
+			expectedCertificate: string(vaultCert),
+		},
+		{
+			name:          "wrong password",
+			data:          bundle,
+			password:      "bad",
+			expectedError: "decode PKCS#12 data",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cert, err := NewCertificateFromPKCS12(tc.data, tc.password, tc.typ)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			assert.Equal(t, tc.expectedCertificate, cert.Certificate, "check the certificate")
+			assert.Equal(t, tc.expectedCACertificate, cert.CACertificate, "check the CA certificate")
+			_, err = cert.Validate()
+			assert.Nil(t, err, "check the certificate is valid")
+		})
+	}
+}
+
+func TestNewCertificateFromDER(t *testing.T) {
+	t.Parallel()
+
+	root := newTestCertificate(t, "root", nil, nil)
+	intermediate := newTestCertificate(t, "intermediate", root, asCA)
+	leaf := newTestCertificate(t, "leaf", intermediate, nil)
+	other := newTestCertificate(t, "other", root, nil)
+	keyDER, err := x509.MarshalECPrivateKey(leaf.key)
+	assert.Nil(t, err, "marshal private key")
+
+	cert, err := NewCertificateFromDER([][]byte{root.cert.Raw, leaf.cert.Raw, intermediate.cert.Raw}, keyDER, ServerCertificate)
+	assert.Nil(t, err, "check the error")
+	assert.Equal(t, leaf.certPEM+intermediate.certPEM, cert.Certificate, "check the certificate")
+	assert.Equal(t, leaf.keyPEM, cert.PrivateKey, "check the private key is converted to PKCS#8")
+
+	_, err = NewCertificateFromDER([][]byte{other.cert.Raw}, keyDER, ServerCertificate)
+	assert.Contains(t, err.Error(), "no certificate matches the private key", "check the error details")
+
+	_, err = NewCertificateFromDER([][]byte{leaf.cert.Raw, intermediate.cert.Raw, other.cert.Raw}, keyDER, ServerCertificate)
+	assert.Contains(t, err.Error(), `certificates "CN=other,O=API7" are not in the chain of the leaf certificate`, "check the error details")
+
+	_, err = NewCertificateFromDER([][]byte{[]byte("bad")}, keyDER, ServerCertificate)
+	assert.Contains(t, err.Error(), "parse certificate[0]", "check the error details")
+}
+
+func TestNewCertificateFromPEM(t *testing.T) {
+	t.Parallel()
+
+	vaultCert, err := os.ReadFile("testdata/test.pem")
+	assert.Nil(t, err, "read the test certificate")
+	encryptedPKCS8, err := os.ReadFile("testdata/test-encrypted.key")
+	assert.Nil(t, err, "read the test encrypted private key")
+
+	leaf := newTestCertificate(t, "leaf", nil, nil)
+	block, _ := pem.Decode([]byte(leaf.keyPEM))
+	//nolint:staticcheck
+	legacyBlock, err := x509.EncryptPEMBlock(rand.Reader, "PRIVATE KEY", block.Bytes, []byte("secret"), x509.PEMCipherAES256)
+	assert.Nil(t, err, "encrypt private key")
+	legacy := pem.EncodeToMemory(legacyBlock)
+
+	// Drop the encrypted data of the PKCS#8 private key.
+	encryptedBlock, _ := pem.Decode(encryptedPKCS8)
+	var info encryptedPrivateKeyInfo
+	_, err = asn1.Unmarshal(encryptedBlock.Bytes, &info)
+	assert.Nil(t, err, "parse the encrypted private key")
+	info.EncryptedData = []byte{}
+	encryptedBlock.Bytes, err = asn1.Marshal(info)
+	assert.Nil(t, err, "encode the encrypted private key")
+	emptyPKCS8 := pem.EncodeToMemory(encryptedBlock)
+
+	// Raise the iteration count of the PKCS#8 private key above the cap.
+	encryptedBlock, _ = pem.Decode(encryptedPKCS8)
+	_, err = asn1.Unmarshal(encryptedBlock.Bytes, &info)
+	assert.Nil(t, err, "parse the encrypted private key")
+	var params pbes2Params
+	_, err = asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params)
+	assert.Nil(t, err, "parse the PBES2 parameters")
+	var kdf pbkdf2Params
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+	assert.Nil(t, err, "parse the PBKDF2 parameters")
+	kdf.IterationCount = _maxPBKDF2Iterations + 1
+	params.KeyDerivationFunc.Parameters.FullBytes, err = asn1.Marshal(kdf)
+	assert.Nil(t, err, "encode the PBKDF2 parameters")
+	info.Algorithm.Parameters.FullBytes, err = asn1.Marshal(params)
+	assert.Nil(t, err, "encode the PBES2 parameters")
+	encryptedBlock.Bytes, err = asn1.Marshal(info)
+	assert.Nil(t, err, "encode the encrypted private key")
+	expensivePKCS8 := pem.EncodeToMemory(encryptedBlock)
+
+	testCases := []struct {
+		name          string
+		certPEM       []byte
+		keyPEM        []byte
+		passphrase    string
+		expectedError string
+	}{
+		{
+			name:       "encrypted PKCS#8 private key",
+			certPEM:    vaultCert,
+			keyPEM:     encryptedPKCS8,
+			passphrase: "api7",
+		},
+		{
+			name:          "wrong passphrase",
+			certPEM:       vaultCert,
+			keyPEM:        encryptedPKCS8,
+			passphrase:    "bad",
+			expectedError: "decrypt private key: incorrect passphrase",
+		},
+		{
+			name:          "empty encrypted data",
+			certPEM:       vaultCert,
+			keyPEM:        emptyPKCS8,
+			passphrase:    "api7",
+			expectedError: "decrypt private key: malformed encrypted data",
+		},
+		{
+			name:          "too many PBKDF2 iterations",
+			certPEM:       vaultCert,
+			keyPEM:        expensivePKCS8,
+			passphrase:    "api7",
+			expectedError: "PBKDF2 iteration count 10000001 must be between 1 and 10000000",
+		},
+		{
+			name:          "private key in certificates",
+			certPEM:       []byte(leaf.certPEM + leaf.keyPEM),
+			keyPEM:        []byte(leaf.keyPEM),
+			expectedError: `unexpected PEM block "PRIVATE KEY"`,
+		},
+		{
+			name:       "legacy encrypted private key",
+			certPEM:    []byte(leaf.certPEM),
+			keyPEM:     legacy,
+			passphrase: "secret",
+		},
+		{
+			name:       "plain private key",
+			certPEM:    []byte(leaf.certPEM),
+			keyPEM:     []byte(leaf.keyPEM),
+			passphrase: "ignored",
+		},
+		{
+			name:          "no private key",
+			certPEM:       []byte(leaf.certPEM),
+			keyPEM:        []byte(leaf.certPEM),
+			expectedError: "no private key found in PEM data",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cert, err := NewCertificateFromPEM(tc.certPEM, tc.keyPEM, tc.passphrase, ServerCertificate)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			_, err = cert.Validate()
+			assert.Nil(t, err, "check the certificate is valid")
+		})
+	}
+}
+
+func TestNewCertificateFromChainFile(t *testing.T) {
+	t.Parallel()
+
+	root := newTestCertificate(t, "root", nil, nil)
+	intermediate := newTestCertificate(t, "intermediate", root, asCA)
+	leaf := newTestCertificate(t, "leaf", intermediate, nil)
+
+	dir := t.TempDir()
+	fullChain := filepath.Join(dir, "fullchain.pem")
+	assert.Nil(t, os.WriteFile(fullChain, []byte(root.certPEM+intermediate.certPEM+leaf.keyPEM+leaf.certPEM), 0600), "write chain file")
+
+	cert, err := NewCertificateFromChainFile(fullChain, "", "", ClientCertificate)
+	assert.Nil(t, err, "check the error")
+	assert.Equal(t, leaf.certPEM, cert.Certificate, "check the certificate")
+	assert.Equal(t, intermediate.certPEM+root.certPEM, cert.CACertificate, "check the CA certificate")
+	assert.Equal(t, ClientCertificate, cert.Type, "check the certificate type")
+
+	_, err = NewCertificateFromChainFile(fullChain, filepath.Join(dir, "missing.key"), "", ServerCertificate)
+	assert.Contains(t, err.Error(), "read private key file", "check the error details")
+}
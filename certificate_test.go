@@ -16,10 +16,13 @@ package cloud
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -324,3 +327,93 @@ func TestListCertificates(t *testing.T) {
 		})
 	}
 }
+
+func TestCertificateDetailsDecoding(t *testing.T) {
+	t.Parallel()
+
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name            string
+		payload         string
+		expectedDetails *CertificateDetails
+	}{
+		{
+			name:    "inlined metadata",
+			payload: `{"id":"12","cluster_id":"1","snis":["api7.ai"],"not_after":"2030-01-01T00:00:00Z","issuer":"CN=root","type":"Server"}`,
+			expectedDetails: &CertificateDetails{
+				ID:        12,
+				ClusterID: 1,
+				SNIs:      []string{"api7.ai"},
+				NotAfter:  notAfter,
+				Issuer:    "CN=root",
+				Type:      "Server",
+			},
+		},
+		{
+			name:    "nested metadata",
+			payload: `{"id":"12","cluster_id":"1","Metadata":{"snis":["api7.ai"],"not_after":"2030-01-01T00:00:00Z","issuer":"CN=root"},"type":"Server"}`,
+			expectedDetails: &CertificateDetails{
+				ID:        12,
+				ClusterID: 1,
+				SNIs:      []string{"api7.ai"},
+				NotAfter:  notAfter,
+				Issuer:    "CN=root",
+				Type:      "Server",
+			},
+		},
+		{
+			name:    "unknown fields",
+			payload: `{"id":"12","fingerprint":"ab:cd","Metadata":{"snis":["api7.ai"],"key_type":"EC"}}`,
+			expectedDetails: &CertificateDetails{
+				ID:   12,
+				SNIs: []string{"api7.ai"},
+				Extra: map[string]json.RawMessage{
+					"fingerprint": json.RawMessage(`"ab:cd"`),
+					"key_type":    json.RawMessage(`"EC"`),
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var details CertificateDetails
+			err := json.Unmarshal([]byte(tc.payload), &details)
+			assert.Nil(t, err, "check decode error")
+			assert.Equal(t, tc.expectedDetails, &details, "check the certificate details")
+
+			data, err := json.Marshal(details)
+			assert.Nil(t, err, "check encode error")
+			var decoded CertificateDetails
+			err = json.Unmarshal(data, &decoded)
+			assert.Nil(t, err, "check decode error")
+			assert.Equal(t, details, decoded, "check the certificate details are kept")
+		})
+	}
+}
+
+func TestUpdateCertificateResponse(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	cli := NewMockhttpClient(ctrl)
+	cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/certificates/12"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, _ interface{}, decode payloadDecodeFunc, _ http.Header) error {
+			return decode(json.RawMessage(`{"id":"12","cluster_id":"1","Metadata":{"snis":["api7.ai"],"subject":"CN=api7.ai"},"labels":["prod"],"type":"Server","revision":3}`))
+		})
+
+	details, err := newCertificate(cli).UpdateCertificate(context.Background(), &Certificate{ID: 12}, &ResourceUpdateOptions{
+		Cluster: &Cluster{ID: 1},
+	})
+	assert.Nil(t, err, "check update error")
+	assert.Equal(t, &CertificateDetails{
+		ID:        12,
+		ClusterID: 1,
+		SNIs:      []string{"api7.ai"},
+		Subject:   "CN=api7.ai",
+		Labels:    []string{"prod"},
+		Type:      "Server",
+		Extra:     map[string]json.RawMessage{"revision": json.RawMessage(`3`)},
+	}, details, "check the certificate details")
+}
@@ -0,0 +1,217 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// parseCertificateChain parses all the certificates in the PEM data, the
+// first one is the leaf certificate.
+func parseCertificateChain(data string) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse certificate[%d]", len(chain))
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate found in PEM data")
+	}
+	return chain, nil
+}
+
+// parsePrivateKey parses the PKCS#1, SEC 1 (EC) or PKCS#8 private key in PEM format.
+func parsePrivateKey(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no private key found in PEM data")
+	}
+	if _, ok := block.Headers["DEK-Info"]; ok || block.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, errors.New("the private key is encrypted, decrypt it first")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY":
+		return parsePrivateKeyDER(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+}
+
+// parsePrivateKeyDER parses the PKCS#8, PKCS#1 or SEC 1 (EC) private key in DER format.
+func parsePrivateKeyDER(der []byte) (crypto.Signer, error) {
+	var (
+		key interface{}
+		err error
+	)
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(der); err != nil {
+			if key, err = x509.ParseECPrivateKey(der); err != nil {
+				return nil, errors.New("parse private key: unknown private key format")
+			}
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// newCertificateMetadata returns the metadata of the certificate, the SNIs
+// are the DNS names, or the common name if there are no DNS names.
+func newCertificateMetadata(cert *x509.Certificate) *CertificateMetadata {
+	snis := append([]string(nil), cert.DNSNames...)
+	if len(snis) == 0 && cert.Subject.CommonName != "" {
+		snis = []string{cert.Subject.CommonName}
+	}
+	return &CertificateMetadata{
+		SNIs:               snis,
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       cert.SerialNumber.String(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+	}
+}
+
+// checkCertificateValidity checks whether the `now` is within the validity window of the certificate.
+func checkCertificateValidity(cert *x509.Certificate, now time.Time) error {
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid until %s", cert.Subject.String(), cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %q has expired at %s", cert.Subject.String(), cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkCertificateUsage checks whether the certificate can be used as the `typ` certificate.
+func checkCertificateUsage(cert *x509.Certificate, typ CertificateType) error {
+	if cert.KeyUsage != 0 && cert.KeyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment) == 0 {
+		return errors.New("certificate key usage allows neither digital signature nor key encipherment")
+	}
+	if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
+		return nil
+	}
+
+	expected := x509.ExtKeyUsageServerAuth
+	if typ == ClientCertificate {
+		expected = x509.ExtKeyUsageClientAuth
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == expected || usage == x509.ExtKeyUsageAny {
+			return nil
+		}
+	}
+	if expected == x509.ExtKeyUsageServerAuth {
+		return fmt.Errorf("%s certificate requires the server authentication extended key usage", ServerCertificate)
+	}
+	return fmt.Errorf("%s certificate requires the client authentication extended key usage", ClientCertificate)
+}
+
+// Validate parses and validates the certificate locally, it checks:
+//   - the private key matches the leaf (the first) certificate;
+//   - the chain is ordered, i.e. each certificate is issued by the next one;
+//   - the chain verifies up to the CACertificate (if any);
+//   - the leaf certificate key usage fits the Type;
+//   - all the certificates are within their validity windows.
+//
+// The returned CertificateMetadata describes the leaf certificate, which is
+// the same as the one computed by API7 Cloud.
+func (spec *CertificateSpec) Validate() (*CertificateMetadata, error) {
+	chain, err := parseCertificateChain(spec.Certificate)
+	if err != nil {
+		return nil, errors.Wrap(err, "certificate")
+	}
+	leaf := chain[0]
+
+	key, err := parsePrivateKey(spec.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "private key")
+	}
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(leaf.PublicKey) {
+		return nil, errors.New("private key doesn't match the certificate")
+	}
+
+	for i := 0; i+1 < len(chain); i++ {
+		if err = chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, fmt.Errorf("certificate chain is not ordered: certificate[%d] %q is not issued by certificate[%d] %q",
+				i, chain[i].Subject.String(), i+1, chain[i+1].Subject.String())
+		}
+	}
+
+	now := time.Now()
+	for _, cert := range chain {
+		if err = checkCertificateValidity(cert, now); err != nil {
+			return nil, err
+		}
+	}
+
+	typ := spec.Type
+	if typ == "" {
+		typ = ServerCertificate
+	}
+	if typ != ServerCertificate && typ != ClientCertificate {
+		return nil, fmt.Errorf("unknown certificate type %s", typ)
+	}
+	if err = checkCertificateUsage(leaf, typ); err != nil {
+		return nil, err
+	}
+
+	if spec.CACertificate != "" {
+		cas, err := parseCertificateChain(spec.CACertificate)
+		if err != nil {
+			return nil, errors.Wrap(err, "CA certificate")
+		}
+		roots := x509.NewCertPool()
+		for _, ca := range cas {
+			roots.AddCert(ca)
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err = leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return nil, errors.Wrap(err, "verify certificate with the CA certificate")
+		}
+	}
+
+	return newCertificateMetadata(leaf), nil
+}
@@ -17,6 +17,7 @@ package cloud
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"path"
 	"time"
 
@@ -280,8 +281,42 @@ type GatewayInstance struct {
 	Status GatewayInstanceStatus `json:"status"`
 }
 
+// ClusterWaitOptions contains some options for waiting for a cluster to reach a stage.
+type ClusterWaitOptions struct {
+	// InitialInterval is the interval before the first retry, it will be
+	// doubled after each retry until reaching the MaxInterval.
+	// The default value is 2 seconds.
+	InitialInterval time.Duration
+	// MaxInterval is the upper limit of the retry interval.
+	// The default value is 30 seconds.
+	MaxInterval time.Duration
+	// OnStageChange will be called once the cluster stage changes, the
+	// `from` parameter is zero when the cluster stage is observed at the first time.
+	OnStageChange func(from, to ClusterStage)
+}
+
 // ClusterInterface is the interface for manipulating cluster.
 type ClusterInterface interface {
+	// CreateCluster creates an API7 Cloud Cluster.
+	// The given `cluster` parameter should specify the Name and the ClusterSpec.RegionID.
+	// Users need to specify the Organization in the `opts`, if it's not specified, the
+	// ClusterSpec.OrganizationID will be used.
+	// Note the cluster is built asynchronously, the returned Cluster will be in
+	// the ClusterPending or ClusterCreating stage, users can use WaitForClusterStage to
+	// wait for the cluster to be ClusterNormal.
+	CreateCluster(ctx context.Context, cluster *Cluster, opts *ResourceCreateOptions) (*Cluster, error)
+	// DeleteCluster deletes an existing API7 Cloud Cluster.
+	// The given `clusterID` parameter should specify the Cluster that you want to delete.
+	// Note currently users don't need to pass the `opts` parameter. Just pass `nil` is OK.
+	DeleteCluster(ctx context.Context, clusterID ID, opts *ResourceDeleteOptions) error
+	// WaitForClusterStage polls the specified Cluster (with backoff) until it reaches the given `stage`.
+	// The given `clusterID` parameter should specify the Cluster that you want to wait for.
+	// It fails fast if the cluster enters the ClusterCreateFailed or ClusterDeleted stage,
+	// which means the cluster will never reach the given `stage`. When waiting for the
+	// ClusterDeleted stage, the cluster which cannot be found is treated as deleted.
+	// The `opts` parameter can be `nil`, in such a case, the default options will be used.
+	// The Cluster in the given `stage` will be returned.
+	WaitForClusterStage(ctx context.Context, clusterID ID, stage ClusterStage, opts *ClusterWaitOptions) (*Cluster, error)
 	// GetCluster gets an existing API7 Cloud Cluster.
 	// The given `clusterID` parameter should specify the Cluster that you want to get.
 	// Users need to specify the Organization.ID in the `opts`.
@@ -341,11 +376,16 @@ type ClusterInterface interface {
 
 // ClusterListIterator is an iterator for listing clusters.
 type ClusterListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next cluster according to the filter conditions.
 	Next() (*Cluster, error)
 }
 
 type clusterImpl struct {
+	pluginValidator
+
 	client httpClient
 }
 
@@ -368,7 +408,15 @@ func (iter *clusterListIterator) Next() (*Cluster, error) {
 	return &cluster, nil
 }
 
-func newCluster(cli httpClient) ClusterInterface {
+func (iter *clusterListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *clusterListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
+func newCluster(cli httpClient) *clusterImpl {
 	return &clusterImpl{
 		client: cli,
 	}
@@ -384,6 +432,90 @@ func (impl *clusterImpl) GetCluster(ctx context.Context, clusterID ID, opts *Res
 	return &cluster, nil
 }
 
+func (impl *clusterImpl) CreateCluster(ctx context.Context, cluster *Cluster, opts *ResourceCreateOptions) (*Cluster, error) {
+	var createdCluster Cluster
+
+	orgID := cluster.OrganizationID
+	if opts != nil && opts.Organization != nil {
+		orgID = opts.Organization.ID
+	}
+	if orgID == 0 {
+		return nil, errors.New("create cluster: organization is required")
+	}
+
+	body := struct {
+		Name     string `json:"name"`
+		RegionID ID     `json:"region_id"`
+	}{
+		Name:     cluster.Name,
+		RegionID: cluster.RegionID,
+	}
+
+	uri := path.Join(_apiPathPrefix, "orgs", orgID.String(), "clusters")
+	if err := impl.client.sendPostRequest(ctx, uri, "", body, jsonPayloadDecodeFactory(&createdCluster), appendHeader()); err != nil {
+		return nil, err
+	}
+	return &createdCluster, nil
+}
+
+func (impl *clusterImpl) DeleteCluster(ctx context.Context, clusterID ID, _ *ResourceDeleteOptions) error {
+	uri := path.Join(_apiPathPrefix, "clusters", clusterID.String())
+	return impl.client.sendDeleteRequest(ctx, uri, "", nil, appendHeader(mapClusterId(clusterID)))
+}
+
+func (impl *clusterImpl) WaitForClusterStage(ctx context.Context, clusterID ID, stage ClusterStage, opts *ClusterWaitOptions) (*Cluster, error) {
+	var (
+		waitOpts ClusterWaitOptions
+		current  ClusterStage
+	)
+	if opts != nil {
+		waitOpts = *opts
+	}
+	if waitOpts.InitialInterval <= 0 {
+		waitOpts.InitialInterval = 2 * time.Second
+	}
+	if waitOpts.MaxInterval <= 0 {
+		waitOpts.MaxInterval = 30 * time.Second
+	}
+
+	interval := waitOpts.InitialInterval
+	for {
+		cluster, err := impl.GetCluster(ctx, clusterID, nil)
+		if err != nil {
+			if stage != ClusterDeleted || !isNotFoundError(err) {
+				return nil, errors.Wrap(err, "get cluster")
+			}
+			// The cluster might be removed once it's deleted.
+			cluster = &Cluster{ID: clusterID, ClusterSpec: ClusterSpec{Status: ClusterDeleted}}
+		}
+		if cluster.Status != current {
+			if waitOpts.OnStageChange != nil {
+				waitOpts.OnStageChange(current, cluster.Status)
+			}
+			current = cluster.Status
+		}
+		if current == stage {
+			return cluster, nil
+		}
+		if current == ClusterCreateFailed || current == ClusterDeleted {
+			return nil, fmt.Errorf("cluster %s is %s, it won't be %s", clusterID, current, stage)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrapf(ctx.Err(), "wait for cluster %s to be %s (current: %s)", clusterID, stage, current)
+		case <-timer.C:
+		}
+
+		interval *= 2
+		if interval > waitOpts.MaxInterval {
+			interval = waitOpts.MaxInterval
+		}
+	}
+}
+
 func (impl *clusterImpl) UpdateClusterSettings(ctx context.Context, clusterID ID, settings *ClusterSettings, opts *ResourceUpdateOptions) error {
 	uri := path.Join(_apiPathPrefix, "clusters", clusterID.String(), "config")
 	if err := impl.client.sendPatchRequest(ctx, uri, "", settings, nil, appendHeader(mapClusterId(clusterID))); err != nil {
@@ -393,6 +525,9 @@ func (impl *clusterImpl) UpdateClusterSettings(ctx context.Context, clusterID ID
 }
 
 func (impl *clusterImpl) UpdateClusterPlugins(ctx context.Context, clusterID ID, plugins Plugins, opts *ResourceUpdateOptions) error {
+	if err := impl.validatePlugins(plugins); err != nil {
+		return err
+	}
 	uri := path.Join(_apiPathPrefix, "clusters", clusterID.String(), "plugins")
 	if err := impl.client.sendPatchRequest(ctx, uri, "", plugins, nil, appendHeader(mapClusterId(clusterID))); err != nil {
 		return err
@@ -402,13 +537,20 @@ func (impl *clusterImpl) UpdateClusterPlugins(ctx context.Context, clusterID ID,
 
 func (impl *clusterImpl) ListClusters(ctx context.Context, opts *ResourceListOptions) (ClusterListIterator, error) {
 	iter := listIterator{
-		ctx:      ctx,
-		resource: "cluster",
-		client:   impl.client,
-		path:     path.Join(_apiPathPrefix, "orgs", opts.Organization.ID.String(), "clusters"),
-		paging:   mergePagination(opts.Pagination),
-		filter:   opts.Filter,
-		headers:  appendHeader(mapClusterIdFromOpts(opts)),
+		ctx:                ctx,
+		resource:           "cluster",
+		client:             impl.client,
+		path:               path.Join(_apiPathPrefix, "orgs", opts.Organization.ID.String(), "clusters"),
+		paging:             mergePagination(opts.Pagination),
+		filter:             opts.Filter,
+		unsupportedFilters: filterStatus,
+		headers:            appendHeader(mapClusterIdFromOpts(opts)),
+	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
 	}
 
 	return &clusterListIterator{iter: iter}, nil
@@ -16,9 +16,13 @@ package cloud
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -444,3 +448,194 @@ func TestDebugClusterSettings(t *testing.T) {
 	}
 
 }
+
+func TestCreateCluster(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		opts           *ResourceCreateOptions
+		organizationID ID
+		mockFunc       func(t *testing.T) httpClient
+		expectedError  string
+	}{
+		{
+			name: "mock error",
+			opts: &ResourceCreateOptions{
+				Organization: &Organization{ID: 1},
+			},
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "orgs", "1", "clusters"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+				return cli
+			},
+			expectedError: "mock error",
+		},
+		{
+			name: "no organization",
+			mockFunc: func(t *testing.T) httpClient {
+				return NewMockhttpClient(gomock.NewController(t))
+			},
+			expectedError: "create cluster: organization is required",
+		},
+		{
+			name:           "use the organization of the cluster",
+			organizationID: 2,
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "orgs", "2", "clusters"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, body interface{}, _ payloadDecodeFunc, _ http.Header) error {
+						data, err := json.Marshal(body)
+						assert.Nil(t, err, "check encoding body")
+						assert.JSONEq(t, `{"name":"staging","region_id":"3"}`, string(data), "check request body")
+						return nil
+					})
+				return cli
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newCluster(tc.mockFunc(t)).CreateCluster(context.Background(), &Cluster{
+				Name: "staging",
+				ClusterSpec: ClusterSpec{
+					OrganizationID: tc.organizationID,
+					RegionID:       3,
+				},
+			}, tc.opts)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check error")
+			} else {
+				assert.Nil(t, err, "check if error is nil")
+			}
+		})
+	}
+}
+
+func TestDeleteCluster(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	cli := NewMockhttpClient(ctrl)
+	cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "clusters", "1"), "", nil, gomock.Any()).Return(errors.New("mock error"))
+
+	err := newCluster(cli).DeleteCluster(context.Background(), 1, nil)
+	assert.EqualError(t, err, "mock error", "check error")
+}
+
+func TestWaitForClusterStage(t *testing.T) {
+	t.Parallel()
+
+	mockStages := func(t *testing.T, stages ...ClusterStage) httpClient {
+		ctrl := gomock.NewController(t)
+		cli := NewMockhttpClient(ctrl)
+		for _, stage := range stages {
+			stage := stage
+			cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "clusters", "1"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+					return decode(json.RawMessage(fmt.Sprintf(`{"id":"1","status":%d}`, stage)))
+				})
+		}
+		return cli
+	}
+
+	testCases := []struct {
+		name                string
+		stage               ClusterStage
+		mockFunc            func(t *testing.T) httpClient
+		timeout             time.Duration
+		expectedTransitions []string
+		expectedError       string
+	}{
+		{
+			name: "cluster becomes normal",
+			mockFunc: func(t *testing.T) httpClient {
+				return mockStages(t, ClusterPending, ClusterCreating, ClusterCreating, ClusterNormal)
+			},
+			expectedTransitions: []string{"unknown -> pending", "pending -> creating", "creating -> normal"},
+		},
+		{
+			name: "cluster create failed",
+			mockFunc: func(t *testing.T) httpClient {
+				return mockStages(t, ClusterCreating, ClusterCreateFailed)
+			},
+			expectedTransitions: []string{"unknown -> creating", "creating -> create failed"},
+			expectedError:       "cluster 1 is create failed, it won't be normal",
+		},
+		{
+			name:  "deleted cluster is not found",
+			stage: ClusterDeleted,
+			mockFunc: func(t *testing.T) httpClient {
+				cli := mockStages(t, ClusterDeleting).(*MockhttpClient)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "clusters", "1"), "", gomock.Any(), gomock.Any()).
+					Return(fmt.Errorf("mock: %w", &responseError{statusCode: http.StatusNotFound, message: "not found"}))
+				return cli
+			},
+			expectedTransitions: []string{"unknown -> deleting", "deleting -> deleted"},
+		},
+		{
+			name: "cluster is not found",
+			mockFunc: func(t *testing.T) httpClient {
+				cli := NewMockhttpClient(gomock.NewController(t))
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "clusters", "1"), "", gomock.Any(), gomock.Any()).
+					Return(&responseError{statusCode: http.StatusNotFound, message: "not found"})
+				return cli
+			},
+			expectedError: "get cluster: not found",
+		},
+		{
+			name: "context timeout",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "clusters", "1"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(fmt.Sprintf(`{"id":"1","status":%d}`, ClusterCreating)))
+					}).AnyTimes()
+				return cli
+			},
+			timeout:             50 * time.Millisecond,
+			expectedTransitions: []string{"unknown -> creating"},
+			expectedError:       "wait for cluster 1 to be normal (current: creating): context deadline exceeded",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var transitions []string
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			stage := tc.stage
+			if stage == 0 {
+				stage = ClusterNormal
+			}
+			cluster, err := newCluster(tc.mockFunc(t)).WaitForClusterStage(ctx, 1, stage, &ClusterWaitOptions{
+				InitialInterval: time.Millisecond,
+				MaxInterval:     5 * time.Millisecond,
+				OnStageChange: func(from, to ClusterStage) {
+					transitions = append(transitions, from.String()+" -> "+to.String())
+				},
+			})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError, "check error")
+			} else {
+				assert.Nil(t, err, "check if error is nil")
+				assert.Equal(t, stage, cluster.Status, "check cluster stage")
+			}
+			assert.Equal(t, tc.expectedTransitions, transitions, "check stage transitions")
+		})
+	}
+}
@@ -277,6 +277,12 @@ type ResourceListOptions struct {
 	Pagination *Pagination
 	// Filter indicates conditions to filter out resources.
 	Filter *Filter
+	// ResumeFrom is a checkpoint token returned by the Checkpoint method of a list iterator,
+	// when it's specified, the iteration continues from the recorded position, and the
+	// Pagination field is ignored.
+	// Note the Filter and the listed resources should be the same as the ones when
+	// the checkpoint was saved, or the checkpoint will be rejected.
+	ResumeFrom string
 }
 
 func (r *ResourceListOptions) GetCluster() *Cluster {
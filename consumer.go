@@ -17,7 +17,11 @@ package cloud
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"path"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Consumer is an abstraction of Application/API caller.
@@ -27,7 +31,9 @@ type Consumer struct {
 	// Name of the consumer, should be unique among all applications in the same cluster.
 	Name string `json:"name" gorm:"column:name"`
 	// Description for this consumer.
-	Description string                 `json:"description"` // Certificates are used to authenticate the consumer.
+	Description string `json:"description"`
+	// Credentials are used to authenticate the consumer, the key is the credential
+	// type, use SetCredential and GetCredential to manipulate the typed credentials.
 	Credentials map[string]interface{} `json:"credentials,omitempty"`
 	// Plugins settings on Consumer level
 	Plugins Plugins `json:"plugins,omitempty"`
@@ -35,6 +41,26 @@ type Consumer struct {
 	Labels []string `json:"labels,omitempty"`
 }
 
+// ConsumerCredentialRotateOptions contains some options for rotating the consumer credential.
+type ConsumerCredentialRotateOptions struct {
+	// GracePeriod is the duration that both the old and new credentials are valid,
+	// callers should distribute the new credential to the clients in this period.
+	// Note the requests with the new credential are authenticated as the shadow
+	// consumer in this period, so the consumer-scoped configurations (e.g., the
+	// consumer names in the ACLs, the limit-count keys and the logs) see the
+	// shadow consumer name.
+	GracePeriod time.Duration
+	// ShadowName is the name of the temporary consumer which carries the new
+	// credential during the grace period. The default value is the consumer
+	// name plus the "-rotating" suffix.
+	ShadowName string
+	// Verify will be called once the new credential takes effect, it's used to
+	// smoke test the new credential (e.g. sending a request with the token
+	// minted by MintJWT). The rotation will be aborted (and the old credential
+	// remains valid) if it returns an error.
+	Verify func(ctx context.Context, shadow *Consumer) error
+}
+
 // ConsumerInterface is the interface for manipulating Consumers.
 type ConsumerInterface interface {
 	// CreateConsumer creates an API7 Cloud Consumer in the specified cluster.
@@ -66,15 +92,39 @@ type ConsumerInterface interface {
 	// The given `consumerID` parameter should specify the Consumer that you want to operate.
 	// Users need to specify the cluster.ID in the `opts`.
 	DebugConsumerResources(ctx context.Context, consumerID ID, opts *ResourceGetOptions) (string, error)
+	// RotateConsumerCredential replaces the credential of the specified Consumer without downtime.
+	// The given `consumerID` parameter should specify the Consumer that you want to operate.
+	// The given `cred` parameter is the new credential, which identifying field (e.g. the key of
+	// key-auth, the username of basic-auth) must be different from the old one, since a
+	// credential can only identify a consumer, see Generate*Credential for creating it.
+	// The rotation takes the following steps:
+	// 1. Create a shadow consumer (copying the plugins and labels) with the new credential,
+	//    so both the old and new credentials are valid.
+	// 2. Call the rotateOpts.Verify (if any) and wait for the rotateOpts.GracePeriod.
+	// 3. Update the consumer with the new credential by UpdateConsumer, and delete the shadow consumer.
+	//    The consumer and the shadow consumer hold the new credential until the shadow consumer is
+	//    deleted, so that the new credential is always valid.
+	// The shadow consumer will be deleted if the rotation fails before the step 3, otherwise it's
+	// kept so that the new credential remains valid (e.g., UpdateConsumer fails as API7 Cloud
+	// rejects the credential which is held by the shadow consumer), callers can delete it after
+	// retrying. The error tells whether the consumer was updated.
+	// Users need to specify the cluster in the `opts`.
+	// The updated Consumer will be returned.
+	RotateConsumerCredential(ctx context.Context, consumerID ID, cred ConsumerCredential, rotateOpts *ConsumerCredentialRotateOptions, opts *ResourceUpdateOptions) (*Consumer, error)
 }
 
 // ConsumerListIterator is an iterator for listing Consumers.
 type ConsumerListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next Consumer according to the filter conditions.
 	Next() (*Consumer, error)
 }
 
 type consumerImpl struct {
+	pluginValidator
+
 	client httpClient
 }
 
@@ -97,7 +147,15 @@ func (iter *consumerListIterator) Next() (*Consumer, error) {
 	return &consumer, nil
 }
 
-func newConsumer(cli httpClient) ConsumerInterface {
+func (iter *consumerListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *consumerListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
+func newConsumer(cli httpClient) *consumerImpl {
 	return &consumerImpl{
 		client: cli,
 	}
@@ -106,6 +164,9 @@ func newConsumer(cli httpClient) ConsumerInterface {
 func (impl *consumerImpl) CreateConsumer(ctx context.Context, consumer *Consumer, opts *ResourceCreateOptions) (*Consumer, error) {
 	var createdConsumer Consumer
 
+	if err := impl.validatePlugins(consumer.Plugins); err != nil {
+		return nil, err
+	}
 	clusterID := opts.Cluster.ID
 	uri := path.Join(_apiPathPrefix, "clusters", clusterID.String(), "consumers")
 	err := impl.client.sendPostRequest(ctx, uri, "", consumer, jsonPayloadDecodeFactory(&createdConsumer), appendHeader(mapClusterIdFromOpts(opts)))
@@ -118,6 +179,9 @@ func (impl *consumerImpl) CreateConsumer(ctx context.Context, consumer *Consumer
 func (impl *consumerImpl) UpdateConsumer(ctx context.Context, consumer *Consumer, opts *ResourceUpdateOptions) (*Consumer, error) {
 	var updatedConsumer Consumer
 
+	if err := impl.validatePlugins(consumer.Plugins); err != nil {
+		return nil, err
+	}
 	clusterID := opts.Cluster.ID
 	uri := path.Join(_apiPathPrefix, "clusters", clusterID.String(), "consumers", consumer.ID.String())
 	err := impl.client.sendPutRequest(ctx, uri, "", consumer, jsonPayloadDecodeFactory(&updatedConsumer), appendHeader(mapClusterIdFromOpts(opts)))
@@ -147,12 +211,20 @@ func (impl *consumerImpl) GetConsumer(ctx context.Context, consumerID ID, opts *
 
 func (impl *consumerImpl) ListConsumers(ctx context.Context, opts *ResourceListOptions) (ConsumerListIterator, error) {
 	iter := listIterator{
-		ctx:      ctx,
-		resource: "consumer",
-		client:   impl.client,
-		path:     path.Join(_apiPathPrefix, "clusters", opts.Cluster.ID.String(), "consumers"),
-		paging:   mergePagination(opts.Pagination),
-		headers:  appendHeader(mapClusterIdFromOpts(opts)),
+		ctx:           ctx,
+		resource:      "consumer",
+		client:        impl.client,
+		path:          path.Join(_apiPathPrefix, "clusters", opts.Cluster.ID.String(), "consumers"),
+		paging:        mergePagination(opts.Pagination),
+		filter:        opts.Filter,
+		serverFilters: filterLabels,
+		headers:       appendHeader(mapClusterIdFromOpts(opts)),
+	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
 	}
 
 	return &consumerListIterator{iter: iter}, nil
@@ -167,3 +239,87 @@ func (impl *consumerImpl) DebugConsumerResources(ctx context.Context, consumerID
 	}
 	return formatJSONData(rawData)
 }
+
+func (impl *consumerImpl) RotateConsumerCredential(ctx context.Context, consumerID ID, cred ConsumerCredential, rotateOpts *ConsumerCredentialRotateOptions, opts *ResourceUpdateOptions) (*Consumer, error) {
+	var rotateOptions ConsumerCredentialRotateOptions
+	if rotateOpts != nil {
+		rotateOptions = *rotateOpts
+	}
+	if err := cred.Validate(); err != nil {
+		return nil, err
+	}
+
+	consumer, err := impl.GetConsumer(ctx, consumerID, &ResourceGetOptions{Cluster: opts.Cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "get consumer")
+	}
+	var old ConsumerCredential
+	if credType := cred.CredentialType(); newConsumerCredential(credType) != nil {
+		old = newConsumerCredential(credType)
+		found, err := consumer.GetCredential(old)
+		if err != nil {
+			return nil, err
+		}
+		if found && credentialIdentity(old) == credentialIdentity(cred) {
+			return nil, fmt.Errorf("the new %s credential should not have the same identity as the old one", credType)
+		}
+	}
+
+	shadow := &Consumer{
+		Name:        rotateOptions.ShadowName,
+		Description: consumer.Description,
+		Plugins:     consumer.Plugins,
+		Labels:      consumer.Labels,
+	}
+	if shadow.Name == "" {
+		shadow.Name = consumer.Name + "-rotating"
+	}
+	if err = shadow.SetCredential(cred); err != nil {
+		return nil, err
+	}
+	shadow, err = impl.CreateConsumer(ctx, shadow, &ResourceCreateOptions{Cluster: opts.Cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "create shadow consumer")
+	}
+
+	if err = impl.waitForRotation(ctx, shadow, &rotateOptions); err != nil {
+		// Use a new context as the original one might be canceled.
+		if delErr := impl.DeleteConsumer(context.Background(), shadow.ID, &ResourceDeleteOptions{Cluster: opts.Cluster}); delErr != nil {
+			return nil, errors.Wrapf(err, "rotation aborted (shadow consumer %s was not deleted: %s)", shadow.ID, delErr)
+		}
+		return nil, errors.Wrap(err, "rotation aborted")
+	}
+
+	// Update the consumer before deleting the shadow consumer, so that the new
+	// credential is always valid once the clients switch to it.
+	if err = consumer.SetCredential(cred); err != nil {
+		return nil, err
+	}
+	updated, err := impl.UpdateConsumer(ctx, consumer, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "update consumer (shadow consumer %s is kept so that the new credential remains valid)", shadow.ID)
+	}
+	if err = impl.DeleteConsumer(ctx, shadow.ID, &ResourceDeleteOptions{Cluster: opts.Cluster}); err != nil {
+		return updated, errors.Wrapf(err, "delete shadow consumer %s", shadow.ID)
+	}
+	return updated, nil
+}
+
+func (impl *consumerImpl) waitForRotation(ctx context.Context, shadow *Consumer, opts *ConsumerCredentialRotateOptions) error {
+	if opts.Verify != nil {
+		if err := opts.Verify(ctx, shadow); err != nil {
+			return errors.Wrap(err, "verify new credential")
+		}
+	}
+	if opts.GracePeriod <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(opts.GracePeriod)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,563 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyAuthCredentialType is the type of key-auth credential.
+	KeyAuthCredentialType = "key-auth"
+	// BasicAuthCredentialType is the type of basic-auth credential.
+	BasicAuthCredentialType = "basic-auth"
+	// JWTAuthCredentialType is the type of jwt-auth credential.
+	JWTAuthCredentialType = "jwt-auth"
+	// HMACAuthCredentialType is the type of hmac-auth credential.
+	HMACAuthCredentialType = "hmac-auth"
+	// LDAPAuthCredentialType is the type of ldap-auth credential.
+	LDAPAuthCredentialType = "ldap-auth"
+)
+
+const (
+	// JWTAlgorithmHS256 is the HMAC SHA-256 JWT signing algorithm.
+	JWTAlgorithmHS256 = "HS256"
+	// JWTAlgorithmHS512 is the HMAC SHA-512 JWT signing algorithm.
+	JWTAlgorithmHS512 = "HS512"
+	// JWTAlgorithmRS256 is the RSA SHA-256 JWT signing algorithm.
+	JWTAlgorithmRS256 = "RS256"
+	// JWTAlgorithmES256 is the ECDSA P-256 SHA-256 JWT signing algorithm.
+	JWTAlgorithmES256 = "ES256"
+
+	// HMACAlgorithmSHA1 is the hmac-sha1 signing algorithm.
+	HMACAlgorithmSHA1 = "hmac-sha1"
+	// HMACAlgorithmSHA256 is the hmac-sha256 signing algorithm.
+	HMACAlgorithmSHA256 = "hmac-sha256"
+	// HMACAlgorithmSHA512 is the hmac-sha512 signing algorithm.
+	HMACAlgorithmSHA512 = "hmac-sha512"
+)
+
+// ConsumerCredential is the typed credential of a Consumer.
+type ConsumerCredential interface {
+	// CredentialType returns the credential type, which is also the key
+	// of the credential in the Consumer.Credentials.
+	CredentialType() string
+	// Validate checks whether the credential is valid.
+	Validate() error
+}
+
+// KeyAuthCredential is the credential for the key-auth plugin.
+type KeyAuthCredential struct {
+	// Key is the unique key of the consumer, it should be carried
+	// in the request header or the query string.
+	Key string `json:"key"`
+}
+
+// CredentialType implements ConsumerCredential.
+func (cred *KeyAuthCredential) CredentialType() string {
+	return KeyAuthCredentialType
+}
+
+// Validate implements ConsumerCredential.
+func (cred *KeyAuthCredential) Validate() error {
+	if cred.Key == "" {
+		return credentialFieldRequired(KeyAuthCredentialType, "key")
+	}
+	return nil
+}
+
+// BasicAuthCredential is the credential for the basic-auth plugin.
+type BasicAuthCredential struct {
+	// Username is the unique username of the consumer.
+	Username string `json:"username"`
+	// Password is the password of the consumer.
+	Password string `json:"password"`
+}
+
+// CredentialType implements ConsumerCredential.
+func (cred *BasicAuthCredential) CredentialType() string {
+	return BasicAuthCredentialType
+}
+
+// Validate implements ConsumerCredential.
+func (cred *BasicAuthCredential) Validate() error {
+	if cred.Username == "" {
+		return credentialFieldRequired(BasicAuthCredentialType, "username")
+	}
+	if cred.Password == "" {
+		return credentialFieldRequired(BasicAuthCredentialType, "password")
+	}
+	return nil
+}
+
+// JWTAuthCredential is the credential for the jwt-auth plugin.
+type JWTAuthCredential struct {
+	// Key is the unique key of the consumer, it should be
+	// carried in the "key" claim of the token.
+	Key string `json:"key"`
+	// Secret is the secret for the HMAC algorithms (HS256 and HS512).
+	Secret string `json:"secret,omitempty"`
+	// PublicKey is the PEM encoded public key for the RS256 and ES256 algorithms.
+	PublicKey string `json:"public_key,omitempty"`
+	// PrivateKey is the PEM encoded private key for the RS256 and ES256 algorithms.
+	PrivateKey string `json:"private_key,omitempty"`
+	// Algorithm is the signing algorithm, default is JWTAlgorithmHS256.
+	// Optional values can be:
+	// * JWTAlgorithmHS256
+	// * JWTAlgorithmHS512
+	// * JWTAlgorithmRS256
+	// * JWTAlgorithmES256
+	Algorithm string `json:"algorithm,omitempty"`
+	// Exp is the expiry time of the token in seconds.
+	Exp int64 `json:"exp,omitempty"`
+	// Base64Secret indicates whether the Secret is base64 encoded.
+	Base64Secret bool `json:"base64_secret,omitempty"`
+	// LifetimeGracePeriod is the grace period in seconds to tolerate
+	// the clock skew when checking the token.
+	LifetimeGracePeriod int64 `json:"lifetime_grace_period,omitempty"`
+}
+
+// CredentialType implements ConsumerCredential.
+func (cred *JWTAuthCredential) CredentialType() string {
+	return JWTAuthCredentialType
+}
+
+// Validate implements ConsumerCredential.
+func (cred *JWTAuthCredential) Validate() error {
+	if cred.Key == "" {
+		return credentialFieldRequired(JWTAuthCredentialType, "key")
+	}
+	switch cred.Algorithm {
+	case "", JWTAlgorithmHS256, JWTAlgorithmHS512:
+		if cred.Secret == "" {
+			return credentialFieldRequired(JWTAuthCredentialType, "secret")
+		}
+	case JWTAlgorithmRS256, JWTAlgorithmES256:
+		if cred.PublicKey == "" {
+			return credentialFieldRequired(JWTAuthCredentialType, "public_key")
+		}
+		if cred.Base64Secret {
+			return fmt.Errorf("%s credential: base64_secret is not supported by algorithm %s", JWTAuthCredentialType, cred.Algorithm)
+		}
+	default:
+		return fmt.Errorf("%s credential: unknown algorithm %s", JWTAuthCredentialType, cred.Algorithm)
+	}
+	if cred.Exp < 0 {
+		return fmt.Errorf("%s credential: exp should not be negative", JWTAuthCredentialType)
+	}
+	if cred.LifetimeGracePeriod < 0 {
+		return fmt.Errorf("%s credential: lifetime_grace_period should not be negative", JWTAuthCredentialType)
+	}
+	return nil
+}
+
+// HMACAuthCredential is the credential for the hmac-auth plugin.
+type HMACAuthCredential struct {
+	// AccessKey is the unique access key of the consumer.
+	AccessKey string `json:"access_key"`
+	// SecretKey is the secret key for signing the requests.
+	SecretKey string `json:"secret_key"`
+	// Algorithm is the signing algorithm, default is HMACAlgorithmSHA256.
+	// Optional values can be:
+	// * HMACAlgorithmSHA1
+	// * HMACAlgorithmSHA256
+	// * HMACAlgorithmSHA512
+	Algorithm string `json:"algorithm,omitempty"`
+	// ClockSkew is the maximum allowed time difference in seconds between the
+	// client and the gateway, zero means not checking it.
+	ClockSkew int64 `json:"clock_skew,omitempty"`
+	// SignedHeaders contains the headers which are allowed to be signed.
+	SignedHeaders []string `json:"signed_headers,omitempty"`
+	// KeepHeaders indicates whether to keep the signing headers in the upstream request.
+	KeepHeaders bool `json:"keep_headers,omitempty"`
+	// EncodeURIParams indicates whether to encode the URI parameters when signing.
+	EncodeURIParams *bool `json:"encode_uri_params,omitempty"`
+	// ValidateRequestBody indicates whether to validate the request body digest.
+	ValidateRequestBody bool `json:"validate_request_body,omitempty"`
+	// MaxReqBody is the maximum request body size in bytes for validating the digest.
+	MaxReqBody int64 `json:"max_req_body,omitempty"`
+}
+
+// CredentialType implements ConsumerCredential.
+func (cred *HMACAuthCredential) CredentialType() string {
+	return HMACAuthCredentialType
+}
+
+// Validate implements ConsumerCredential.
+func (cred *HMACAuthCredential) Validate() error {
+	if cred.AccessKey == "" {
+		return credentialFieldRequired(HMACAuthCredentialType, "access_key")
+	}
+	if cred.SecretKey == "" {
+		return credentialFieldRequired(HMACAuthCredentialType, "secret_key")
+	}
+	switch cred.Algorithm {
+	case "", HMACAlgorithmSHA1, HMACAlgorithmSHA256, HMACAlgorithmSHA512:
+	default:
+		return fmt.Errorf("%s credential: unknown algorithm %s", HMACAuthCredentialType, cred.Algorithm)
+	}
+	if cred.ClockSkew < 0 {
+		return fmt.Errorf("%s credential: clock_skew should not be negative", HMACAuthCredentialType)
+	}
+	if cred.MaxReqBody < 0 {
+		return fmt.Errorf("%s credential: max_req_body should not be negative", HMACAuthCredentialType)
+	}
+	return nil
+}
+
+// LDAPAuthCredential is the credential for the ldap-auth plugin.
+type LDAPAuthCredential struct {
+	// UserDN is the distinguished name of the consumer in the LDAP server,
+	// e.g. "cn=user01,ou=users,dc=example,dc=org".
+	UserDN string `json:"user_dn"`
+}
+
+// CredentialType implements ConsumerCredential.
+func (cred *LDAPAuthCredential) CredentialType() string {
+	return LDAPAuthCredentialType
+}
+
+// Validate implements ConsumerCredential.
+func (cred *LDAPAuthCredential) Validate() error {
+	if cred.UserDN == "" {
+		return credentialFieldRequired(LDAPAuthCredentialType, "user_dn")
+	}
+	return nil
+}
+
+func credentialFieldRequired(credType, field string) error {
+	return fmt.Errorf("%s credential: %s is required", credType, field)
+}
+
+// SetCredential validates the credential and sets it to the Consumer, the existing
+// credential of the same type will be replaced, but the fields that are unknown to
+// the typed credential will be kept.
+func (c *Consumer) SetCredential(cred ConsumerCredential) error {
+	if err := cred.Validate(); err != nil {
+		return err
+	}
+	value, err := mergeTypedValue(c.Credentials[cred.CredentialType()], cred)
+	if err != nil {
+		return fmt.Errorf("encode %s credential: %s", cred.CredentialType(), err)
+	}
+	if c.Credentials == nil {
+		c.Credentials = make(map[string]interface{})
+	}
+	c.Credentials[cred.CredentialType()] = value
+	return nil
+}
+
+// GetCredential decodes the credential which type is cred.CredentialType() into `cred`.
+// The returned boolean value reports whether the Consumer has this type of credential.
+func (c *Consumer) GetCredential(cred ConsumerCredential) (bool, error) {
+	value, ok := c.Credentials[cred.CredentialType()]
+	if !ok {
+		return false, nil
+	}
+	if err := decodeTypedValue(value, cred); err != nil {
+		return true, fmt.Errorf("decode %s credential: %s", cred.CredentialType(), err)
+	}
+	return true, nil
+}
+
+// RemoveCredential removes the credential of the given type from the Consumer.
+func (c *Consumer) RemoveCredential(credType string) {
+	delete(c.Credentials, credType)
+}
+
+// ValidateCredentials validates all the credentials which types are known by the SDK,
+// credentials of other types are left untouched.
+func (c *Consumer) ValidateCredentials() error {
+	credTypes := make([]string, 0, len(c.Credentials))
+	for credType := range c.Credentials {
+		credTypes = append(credTypes, credType)
+	}
+	sort.Strings(credTypes)
+
+	for _, credType := range credTypes {
+		cred := newConsumerCredential(credType)
+		if cred == nil {
+			continue
+		}
+		if _, err := c.GetCredential(cred); err != nil {
+			return err
+		}
+		if err := cred.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newConsumerCredential(credType string) ConsumerCredential {
+	switch credType {
+	case KeyAuthCredentialType:
+		return &KeyAuthCredential{}
+	case BasicAuthCredentialType:
+		return &BasicAuthCredential{}
+	case JWTAuthCredentialType:
+		return &JWTAuthCredential{}
+	case HMACAuthCredentialType:
+		return &HMACAuthCredential{}
+	case LDAPAuthCredentialType:
+		return &LDAPAuthCredential{}
+	default:
+		return nil
+	}
+}
+
+// credentialIdentity returns the field which is used by the gateway to
+// identify the consumer, it must be unique among consumers.
+func credentialIdentity(cred ConsumerCredential) string {
+	switch c := cred.(type) {
+	case *KeyAuthCredential:
+		return c.Key
+	case *BasicAuthCredential:
+		return c.Username
+	case *JWTAuthCredential:
+		return c.Key
+	case *HMACAuthCredential:
+		return c.AccessKey
+	case *LDAPAuthCredential:
+		return c.UserDN
+	default:
+		return ""
+	}
+}
+
+// randomString returns a URL-safe random string which carries `n` bytes entropy.
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "generate random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// GenerateKeyAuthCredential generates a key-auth credential with a random key (256 bits entropy).
+func GenerateKeyAuthCredential() (*KeyAuthCredential, error) {
+	key, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyAuthCredential{Key: key}, nil
+}
+
+// GenerateBasicAuthCredential generates a basic-auth credential for the given
+// `username` with a random password (192 bits entropy).
+func GenerateBasicAuthCredential(username string) (*BasicAuthCredential, error) {
+	password, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	return &BasicAuthCredential{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// GenerateJWTAuthCredential generates a jwt-auth credential for the given `key`
+// with the given `algorithm`, for the HMAC algorithms, a random secret will be
+// generated, for the RS256 and ES256, a key pair (RSA 2048 bits or ECDSA P-256)
+// will be generated and encoded in PEM format.
+func GenerateJWTAuthCredential(key, algorithm string) (*JWTAuthCredential, error) {
+	cred := &JWTAuthCredential{
+		Key:       key,
+		Algorithm: algorithm,
+	}
+
+	var (
+		privateKey interface{}
+		publicKey  interface{}
+		err        error
+	)
+	switch algorithm {
+	case "", JWTAlgorithmHS256:
+		cred.Secret, err = randomString(32)
+		return cred, err
+	case JWTAlgorithmHS512:
+		cred.Secret, err = randomString(64)
+		return cred, err
+	case JWTAlgorithmRS256:
+		var rsaKey *rsa.PrivateKey
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate RSA key")
+		}
+		privateKey, publicKey = rsaKey, &rsaKey.PublicKey
+	case JWTAlgorithmES256:
+		var ecKey *ecdsa.PrivateKey
+		ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate ECDSA key")
+		}
+		privateKey, publicKey = ecKey, &ecKey.PublicKey
+	default:
+		return nil, fmt.Errorf("%s credential: unknown algorithm %s", JWTAuthCredentialType, algorithm)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode private key")
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode public key")
+	}
+	cred.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	cred.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	return cred, nil
+}
+
+// GenerateHMACAuthCredential generates a hmac-auth credential for the given
+// `accessKey` with a random secret key (256 bits entropy).
+func GenerateHMACAuthCredential(accessKey string) (*HMACAuthCredential, error) {
+	secretKey, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	return &HMACAuthCredential{
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Algorithm: HMACAlgorithmSHA256,
+	}, nil
+}
+
+// MintJWT signs a token with the jwt-auth credential, it's used to smoke test the credential.
+// The "key" claim is filled by the credential Key, and the "exp" claim is decided by the
+// `expiresIn` parameter (or the credential Exp if `expiresIn` is zero, 86400 seconds if
+// both are zero). The `extraClaims` will be merged into the token payload.
+// Note the credential PrivateKey is required for the RS256 and ES256 algorithms.
+func MintJWT(cred *JWTAuthCredential, expiresIn time.Duration, extraClaims map[string]interface{}) (string, error) {
+	if err := cred.Validate(); err != nil {
+		return "", err
+	}
+	algorithm := cred.Algorithm
+	if algorithm == "" {
+		algorithm = JWTAlgorithmHS256
+	}
+	if expiresIn == 0 {
+		expiresIn = time.Duration(cred.Exp) * time.Second
+	}
+	if expiresIn == 0 {
+		expiresIn = 86400 * time.Second
+	}
+
+	claims := make(map[string]interface{}, len(extraClaims)+2)
+	for k, v := range extraClaims {
+		claims[k] = v
+	}
+	claims["key"] = cred.Key
+	claims["exp"] = time.Now().Add(expiresIn).Unix()
+
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "encode claims")
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	signature, err := signJWT(cred, algorithm, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func signJWT(cred *JWTAuthCredential, algorithm string, input []byte) ([]byte, error) {
+	switch algorithm {
+	case JWTAlgorithmHS256, JWTAlgorithmHS512:
+		secret := []byte(cred.Secret)
+		if cred.Base64Secret {
+			decoded, err := base64.StdEncoding.DecodeString(cred.Secret)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode base64 secret")
+			}
+			secret = decoded
+		}
+		newHash := sha256.New
+		if algorithm == JWTAlgorithmHS512 {
+			newHash = sha512.New
+		}
+		mac := hmac.New(newHash, secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	}
+
+	key, err := parseJWTPrivateKey(cred.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(input)
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != JWTAlgorithmRS256 {
+			return nil, fmt.Errorf("algorithm %s mismatches the RSA private key", algorithm)
+		}
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		if algorithm != JWTAlgorithmES256 {
+			return nil, fmt.Errorf("algorithm %s mismatches the ECDSA private key", algorithm)
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed length R || S encoding for ECDSA signatures.
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+func parseJWTPrivateKey(data string) (interface{}, error) {
+	if data == "" {
+		return nil, credentialFieldRequired(JWTAuthCredentialType, "private_key")
+	}
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerCredentialValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		cred          ConsumerCredential
+		expectedError string
+	}{
+		{
+			name: "valid key-auth",
+			cred: &KeyAuthCredential{Key: "abc"},
+		},
+		{
+			name:          "key-auth without key",
+			cred:          &KeyAuthCredential{},
+			expectedError: "key-auth credential: key is required",
+		},
+		{
+			name:          "basic-auth without password",
+			cred:          &BasicAuthCredential{Username: "jack"},
+			expectedError: "basic-auth credential: password is required",
+		},
+		{
+			name: "valid jwt-auth with HMAC",
+			cred: &JWTAuthCredential{Key: "jack", Secret: "secret", Exp: 3600},
+		},
+		{
+			name:          "jwt-auth RS256 without public key",
+			cred:          &JWTAuthCredential{Key: "jack", Algorithm: JWTAlgorithmRS256},
+			expectedError: "jwt-auth credential: public_key is required",
+		},
+		{
+			name:          "jwt-auth with unknown algorithm",
+			cred:          &JWTAuthCredential{Key: "jack", Algorithm: "none"},
+			expectedError: "jwt-auth credential: unknown algorithm none",
+		},
+		{
+			name: "valid hmac-auth",
+			cred: &HMACAuthCredential{AccessKey: "ak", SecretKey: "sk", Algorithm: HMACAlgorithmSHA512, ClockSkew: 300},
+		},
+		{
+			name:          "hmac-auth with negative clock skew",
+			cred:          &HMACAuthCredential{AccessKey: "ak", SecretKey: "sk", ClockSkew: -1},
+			expectedError: "hmac-auth credential: clock_skew should not be negative",
+		},
+		{
+			name:          "ldap-auth without user dn",
+			cred:          &LDAPAuthCredential{},
+			expectedError: "ldap-auth credential: user_dn is required",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.cred.Validate()
+			if tc.expectedError == "" {
+				assert.Nil(t, err, "check validate error")
+			} else {
+				assert.EqualError(t, err, tc.expectedError, "check the error details")
+			}
+		})
+	}
+}
+
+func TestConsumerSetAndGetCredential(t *testing.T) {
+	t.Parallel()
+
+	var consumer Consumer
+	err := json.Unmarshal([]byte(`{
+		"name": "jack",
+		"credentials": {
+			"jwt-auth": {"key": "jack", "secret": "old", "vendor_option": 1},
+			"wolf-rbac": {"appid": "x"}
+		}
+	}`), &consumer)
+	assert.Nil(t, err, "check decode error")
+
+	var jwt JWTAuthCredential
+	found, err := consumer.GetCredential(&jwt)
+	assert.Nil(t, err, "check get credential error")
+	assert.True(t, found, "check jwt credential exists")
+	assert.Equal(t, JWTAuthCredential{Key: "jack", Secret: "old"}, jwt, "check jwt credential")
+
+	jwt.Secret = "new"
+	assert.Nil(t, consumer.SetCredential(&jwt), "check set credential error")
+	assert.Nil(t, consumer.SetCredential(&KeyAuthCredential{Key: "abc"}), "check set credential error")
+	assert.Contains(t, consumer.SetCredential(&BasicAuthCredential{}).Error(), "username is required", "check invalid credential")
+
+	found, err = consumer.GetCredential(&BasicAuthCredential{})
+	assert.Nil(t, err, "check get credential error")
+	assert.False(t, found, "check basic-auth credential doesn't exist")
+
+	data, err := json.Marshal(consumer.Credentials)
+	assert.Nil(t, err, "check encode error")
+	assert.JSONEq(t, `{
+		"jwt-auth": {"key": "jack", "secret": "new", "vendor_option": 1},
+		"key-auth": {"key": "abc"},
+		"wolf-rbac": {"appid": "x"}
+	}`, string(data), "check credentials")
+	assert.Nil(t, consumer.ValidateCredentials(), "check validate credentials")
+
+	consumer.RemoveCredential(JWTAuthCredentialType)
+	consumer.Credentials[LDAPAuthCredentialType] = map[string]interface{}{}
+	assert.EqualError(t, consumer.ValidateCredentials(), "ldap-auth credential: user_dn is required", "check validate credentials")
+}
+
+func TestGenerateConsumerCredentials(t *testing.T) {
+	t.Parallel()
+
+	keyAuth, err := GenerateKeyAuthCredential()
+	assert.Nil(t, err, "check generate error")
+	assert.Nil(t, keyAuth.Validate(), "check key-auth credential")
+	anotherKeyAuth, err := GenerateKeyAuthCredential()
+	assert.Nil(t, err, "check generate error")
+	assert.NotEqual(t, keyAuth.Key, anotherKeyAuth.Key, "check keys are random")
+
+	basicAuth, err := GenerateBasicAuthCredential("jack")
+	assert.Nil(t, err, "check generate error")
+	assert.Equal(t, "jack", basicAuth.Username, "check username")
+	assert.Len(t, basicAuth.Password, 32, "check password length")
+
+	hmacAuth, err := GenerateHMACAuthCredential("ak")
+	assert.Nil(t, err, "check generate error")
+	assert.Nil(t, hmacAuth.Validate(), "check hmac-auth credential")
+
+	for _, algorithm := range []string{JWTAlgorithmHS256, JWTAlgorithmHS512, JWTAlgorithmRS256, JWTAlgorithmES256} {
+		jwtAuth, err := GenerateJWTAuthCredential("jack", algorithm)
+		assert.Nil(t, err, "check generate error")
+		assert.Nil(t, jwtAuth.Validate(), "check jwt-auth credential")
+	}
+	_, err = GenerateJWTAuthCredential("jack", "none")
+	assert.EqualError(t, err, "jwt-auth credential: unknown algorithm none", "check unknown algorithm")
+}
+
+func TestMintJWT(t *testing.T) {
+	t.Parallel()
+
+	decodeSegment := func(t *testing.T, segment string) map[string]interface{} {
+		var v map[string]interface{}
+		data, err := base64.RawURLEncoding.DecodeString(segment)
+		assert.Nil(t, err, "check decode segment error")
+		assert.Nil(t, json.Unmarshal(data, &v), "check decode segment error")
+		return v
+	}
+
+	t.Run("HS256", func(t *testing.T) {
+		cred := &JWTAuthCredential{Key: "jack", Secret: "secret"}
+		token, err := MintJWT(cred, time.Hour, map[string]interface{}{"sub": "smoke-test", "key": "override"})
+		assert.Nil(t, err, "check mint error")
+
+		parts := strings.Split(token, ".")
+		assert.Len(t, parts, 3, "check token segments")
+		assert.Equal(t, "HS256", decodeSegment(t, parts[0])["alg"], "check algorithm")
+		claims := decodeSegment(t, parts[1])
+		assert.Equal(t, "jack", claims["key"], "check key claim")
+		assert.Equal(t, "smoke-test", claims["sub"], "check extra claim")
+		assert.InDelta(t, float64(time.Now().Add(time.Hour).Unix()), claims["exp"], 5, "check exp claim")
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2], "check signature")
+	})
+
+	for _, algorithm := range []string{JWTAlgorithmRS256, JWTAlgorithmES256} {
+		algorithm := algorithm
+		t.Run(algorithm, func(t *testing.T) {
+			cred, err := GenerateJWTAuthCredential("jack", algorithm)
+			assert.Nil(t, err, "check generate error")
+			token, err := MintJWT(cred, 0, nil)
+			assert.Nil(t, err, "check mint error")
+
+			parts := strings.Split(token, ".")
+			block, _ := pem.Decode([]byte(cred.PublicKey))
+			publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+			assert.Nil(t, err, "check parse public key error")
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			assert.Nil(t, err, "check decode signature error")
+
+			switch key := publicKey.(type) {
+			case *rsa.PublicKey:
+				assert.Nil(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature), "check signature")
+			case *ecdsa.PublicKey:
+				r := new(big.Int).SetBytes(signature[:32])
+				s := new(big.Int).SetBytes(signature[32:])
+				assert.True(t, ecdsa.Verify(key, digest[:], r, s), "check signature")
+			}
+		})
+	}
+
+	_, err := MintJWT(&JWTAuthCredential{Key: "jack", Algorithm: JWTAlgorithmRS256, PublicKey: "x"}, 0, nil)
+	assert.EqualError(t, err, "jwt-auth credential: private_key is required", "check missing private key")
+}
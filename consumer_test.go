@@ -16,9 +16,12 @@ package cloud
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -285,3 +288,123 @@ func TestListConsumers(t *testing.T) {
 		})
 	}
 }
+
+func TestRotateConsumerCredential(t *testing.T) {
+	t.Parallel()
+
+	mockGetConsumer := func(cli *MockhttpClient) *gomock.Call {
+		return cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/consumers/12"), "", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+				return decode(json.RawMessage(`{"id":"12","name":"jack","labels":["partner"],"credentials":{"key-auth":{"key":"old"}}}`))
+			})
+	}
+	mockCreateShadow := func(t *testing.T, cli *MockhttpClient) *gomock.Call {
+		return cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/consumers"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, body interface{}, decode payloadDecodeFunc, _ http.Header) error {
+				shadow := body.(*Consumer)
+				assert.Equal(t, "jack-rotating", shadow.Name, "check shadow name")
+				assert.Equal(t, []string{"partner"}, shadow.Labels, "check shadow labels")
+				assert.Equal(t, map[string]interface{}{"key-auth": map[string]interface{}{"key": "new"}}, shadow.Credentials, "check shadow credentials")
+				return decode(json.RawMessage(`{"id":"13","name":"jack-rotating"}`))
+			})
+	}
+	mockDeleteShadow := func(cli *MockhttpClient, err error) *gomock.Call {
+		return cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/consumers/13"), "", nil, gomock.Any()).Return(err)
+	}
+
+	testCases := []struct {
+		name          string
+		cred          ConsumerCredential
+		verify        func(ctx context.Context, shadow *Consumer) error
+		mockFunc      func(t *testing.T, cli *MockhttpClient)
+		expectedError string
+	}{
+		{
+			name: "rotate successfully",
+			cred: &KeyAuthCredential{Key: "new"},
+			mockFunc: func(t *testing.T, cli *MockhttpClient) {
+				// The shadow consumer should be deleted after the consumer
+				// takes the new credential.
+				gomock.InOrder(
+					mockGetConsumer(cli),
+					mockCreateShadow(t, cli),
+					cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/consumers/12"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+						func(_ context.Context, _, _ string, body interface{}, _ payloadDecodeFunc, _ http.Header) error {
+							consumer := body.(*Consumer)
+							assert.Equal(t, map[string]interface{}{"key-auth": map[string]interface{}{"key": "new"}}, consumer.Credentials, "check consumer credentials")
+							return nil
+						}),
+					mockDeleteShadow(cli, nil),
+				)
+			},
+		},
+		{
+			name: "same identity",
+			cred: &KeyAuthCredential{Key: "old"},
+			mockFunc: func(_ *testing.T, cli *MockhttpClient) {
+				mockGetConsumer(cli)
+			},
+			expectedError: "the new key-auth credential should not have the same identity as the old one",
+		},
+		{
+			name: "verification failed",
+			cred: &KeyAuthCredential{Key: "new"},
+			verify: func(_ context.Context, _ *Consumer) error {
+				return errors.New("unauthorized")
+			},
+			mockFunc: func(t *testing.T, cli *MockhttpClient) {
+				mockGetConsumer(cli)
+				mockCreateShadow(t, cli)
+				mockDeleteShadow(cli, nil)
+			},
+			expectedError: "rotation aborted: verify new credential: unauthorized",
+		},
+		{
+			name: "delete shadow failed",
+			cred: &KeyAuthCredential{Key: "new"},
+			mockFunc: func(t *testing.T, cli *MockhttpClient) {
+				mockGetConsumer(cli)
+				mockCreateShadow(t, cli)
+				cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/consumers/12"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				mockDeleteShadow(cli, errors.New("mock error"))
+			},
+			expectedError: "delete shadow consumer 13: mock error",
+		},
+		{
+			name: "update failed",
+			cred: &KeyAuthCredential{Key: "new"},
+			mockFunc: func(t *testing.T, cli *MockhttpClient) {
+				// The shadow consumer is kept.
+				mockGetConsumer(cli)
+				mockCreateShadow(t, cli)
+				cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/clusters/1/consumers/12"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+			},
+			expectedError: "update consumer (shadow consumer 13 is kept so that the new credential remains valid): mock error",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			cli := NewMockhttpClient(ctrl)
+			tc.mockFunc(t, cli)
+
+			_, err := newConsumer(cli).RotateConsumerCredential(context.Background(), 12, tc.cred, &ConsumerCredentialRotateOptions{
+				GracePeriod: time.Millisecond,
+				Verify:      tc.verify,
+			}, &ResourceUpdateOptions{
+				Cluster: &Cluster{
+					ID: 1,
+				},
+			})
+			if tc.expectedError == "" {
+				assert.Nil(t, err, "check rotation error")
+			} else {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			}
+		})
+	}
+}
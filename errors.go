@@ -19,4 +19,9 @@ import "errors"
 var (
 	// ErrEmptyToken indicates the access token value is empty.
 	ErrEmptyToken = errors.New("empty access token")
+	// ErrCheckpointConditionChanged indicates the list conditions are different
+	// from the ones when the checkpoint was saved.
+	ErrCheckpointConditionChanged = errors.New("list conditions changed since the checkpoint was saved")
+	// ErrMemberNotFound indicates the member cannot be found in the organization.
+	ErrMemberNotFound = errors.New("member not found")
 )
@@ -8,8 +8,10 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/sony/sonyflake v1.1.0
 	github.com/stretchr/testify v1.8.0
-	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	golang.org/x/crypto v0.11.0
+	golang.org/x/net v0.10.0
 	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.4.0
 )
 
 require (
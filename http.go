@@ -374,7 +374,10 @@ func (impl *httpClientImpl) sendRequest(req *http.Request, payloadDecodeFunc pay
 	// API7 Cloud won't encapsulate response body into the ResponseWrapper,
 	// so for these responses, we handle it alone.
 	if resp.StatusCode >= 500 {
-		errTrace = fmt.Errorf("status code: %d, message: %s", resp.StatusCode, string(body))
+		errTrace = &responseError{
+			statusCode: resp.StatusCode,
+			message:    fmt.Sprintf("status code: %d, message: %s", resp.StatusCode, string(body)),
+		}
 		return errTrace
 	}
 
@@ -384,7 +387,10 @@ func (impl *httpClientImpl) sendRequest(req *http.Request, payloadDecodeFunc pay
 	}
 
 	if resp.StatusCode != 200 {
-		errTrace = fmt.Errorf("status code: %d, error code: %d, error reason: %s, details: %s", resp.StatusCode, rw.Status.Code, rw.Status.Message, rw.ErrorReason)
+		errTrace = &responseError{
+			statusCode: resp.StatusCode,
+			message:    fmt.Sprintf("status code: %d, error code: %d, error reason: %s, details: %s", resp.StatusCode, rw.Status.Code, rw.Status.Message, rw.ErrorReason),
+		}
 		return errTrace
 	}
 
@@ -397,6 +403,22 @@ func (impl *httpClientImpl) sendRequest(req *http.Request, payloadDecodeFunc pay
 	return nil
 }
 
+// responseError is the error which API7 Cloud responds.
+type responseError struct {
+	statusCode int
+	message    string
+}
+
+func (e *responseError) Error() string {
+	return e.message
+}
+
+// isNotFoundError checks if the error is caused by the 404 response.
+func isNotFoundError(err error) bool {
+	var re *responseError
+	return errors.As(err, &re) && re.statusCode == http.StatusNotFound
+}
+
 func (impl *httpClientImpl) getClusterID() ID {
 	return impl.clusterID
 }
@@ -0,0 +1,306 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// memoryHTTPClient is an in-memory httpClient which stores the resources by
+// their collection paths, it mimics the basic CRUD semantics of API7 Cloud, so
+// that the multi-resource workflows can be tested without mocking every call.
+type memoryHTTPClient struct {
+	mu     sync.Mutex
+	nextID ID
+	// collections maps the collection path (e.g., /api/v1/clusters/1/apps)
+	// to the items, which are indexed by the id.
+	collections map[string]map[ID]map[string]interface{}
+	// calls records the mutating calls, e.g., "POST /api/v1/clusters/1/apps".
+	calls []string
+}
+
+func newMemoryHTTPClient() *memoryHTTPClient {
+	return &memoryHTTPClient{
+		nextID:      100,
+		collections: make(map[string]map[ID]map[string]interface{}),
+	}
+}
+
+// seed adds an item to the collection (the path is relative to the _apiPathPrefix),
+// the created item id is returned.
+func (cli *memoryHTTPClient) seed(collection string, item interface{}) ID {
+	var created map[string]interface{}
+	if err := cli.sendPostRequest(context.Background(), path.Join(_apiPathPrefix, collection), "", item, jsonPayloadDecodeFactory(&created), nil); err != nil {
+		panic(err)
+	}
+	id, _ := strconv.ParseUint(created["id"].(string), 10, 64)
+	cli.calls = nil
+	return ID(id)
+}
+
+// put stores the item with the `id` in the collection (the path is relative to
+// the _apiPathPrefix), it's used to prepare the resources which are not created
+// by POST requests, e.g., clusters.
+func (cli *memoryHTTPClient) put(collection string, id ID, item interface{}) {
+	encoded, err := cli.encode(item)
+	if err != nil {
+		panic(err)
+	}
+	encoded["id"] = id.String()
+	collection = path.Join(_apiPathPrefix, collection)
+	if cli.collections[collection] == nil {
+		cli.collections[collection] = make(map[ID]map[string]interface{})
+	}
+	cli.collections[collection][id] = encoded
+}
+
+// items returns the items in the collection (the path is relative to the
+// _apiPathPrefix), they're sorted by the id.
+func (cli *memoryHTTPClient) items(collection string) []map[string]interface{} {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+	return cli.sortedItems(path.Join(_apiPathPrefix, collection))
+}
+
+func (cli *memoryHTTPClient) sortedItems(collection string) []map[string]interface{} {
+	var ids []ID
+	for id := range cli.collections[collection] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	items := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, cli.collections[collection][id])
+	}
+	return items
+}
+
+func (cli *memoryHTTPClient) encode(v interface{}) (map[string]interface{}, error) {
+	var item map[string]interface{}
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (cli *memoryHTTPClient) respond(item interface{}, decode payloadDecodeFunc) error {
+	if decode == nil {
+		return nil
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return decode(data)
+}
+
+// fill sets the fields which are filled by API7 Cloud.
+func (cli *memoryHTTPClient) fill(collection string, id ID, item map[string]interface{}) error {
+	item["id"] = id.String()
+	segments := strings.Split(strings.TrimPrefix(collection, _apiPathPrefix+"/"), "/")
+	switch {
+	case segments[0] == "clusters" && len(segments) == 3:
+		item["cluster_id"] = segments[1]
+	case segments[0] == "apps" && len(segments) == 3:
+		item["app_id"] = segments[1]
+	}
+	if segments[len(segments)-1] != "certificates" {
+		return nil
+	}
+
+	spec := CertificateSpec{}
+	if err := decodeTypedValue(item, &spec); err != nil {
+		return err
+	}
+	delete(item, "private_key")
+	delete(item, "certificate")
+	delete(item, "ca_certificate")
+	chain, err := parseCertificateChain(spec.Certificate)
+	if err != nil {
+		return err
+	}
+	metadata, err := cli.encode(newCertificateMetadata(chain[0]))
+	if err != nil {
+		return err
+	}
+	for key, value := range metadata {
+		item[key] = value
+	}
+	if spec.CACertificate != "" {
+		caChain, err := parseCertificateChain(spec.CACertificate)
+		if err != nil {
+			return err
+		}
+		item["ca_certificate"] = newCertificateMetadata(caChain[0])
+	}
+	return nil
+}
+
+func (cli *memoryHTTPClient) sendGetRequest(_ context.Context, uri, query string, decode payloadDecodeFunc, _ http.Header) error {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return err
+		}
+		page, _ := strconv.Atoi(values.Get("page"))
+		pageSize, _ := strconv.Atoi(values.Get("page_size"))
+		items := cli.sortedItems(uri)
+		start := (page - 1) * pageSize
+		if start > len(items) {
+			start = len(items)
+		}
+		end := start + pageSize
+		if end > len(items) {
+			end = len(items)
+		}
+		return cli.respond(map[string]interface{}{
+			"list":  items[start:end],
+			"count": len(items),
+		}, decode)
+	}
+
+	id, _ := strconv.ParseUint(path.Base(uri), 10, 64)
+	item, ok := cli.collections[path.Dir(uri)][ID(id)]
+	if !ok {
+		return &responseError{statusCode: http.StatusNotFound, message: fmt.Sprintf("%s not found", uri)}
+	}
+	return cli.respond(item, decode)
+}
+
+func (cli *memoryHTTPClient) sendPostRequest(_ context.Context, uri, _ string, body interface{}, decode payloadDecodeFunc, _ http.Header) error {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	item, err := cli.encode(body)
+	if err != nil {
+		return err
+	}
+	cli.nextID++
+	if err = cli.fill(uri, cli.nextID, item); err != nil {
+		return err
+	}
+	if cli.collections[uri] == nil {
+		cli.collections[uri] = make(map[ID]map[string]interface{})
+	}
+	cli.collections[uri][cli.nextID] = item
+	cli.calls = append(cli.calls, http.MethodPost+" "+uri)
+	return cli.respond(item, decode)
+}
+
+func (cli *memoryHTTPClient) sendPutRequest(_ context.Context, uri, _ string, body interface{}, decode payloadDecodeFunc, _ http.Header) error {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	id, _ := strconv.ParseUint(path.Base(uri), 10, 64)
+	collection := path.Dir(uri)
+	if _, ok := cli.collections[collection][ID(id)]; !ok {
+		return &responseError{statusCode: http.StatusNotFound, message: fmt.Sprintf("%s not found", uri)}
+	}
+	item, err := cli.encode(body)
+	if err != nil {
+		return err
+	}
+	if err = cli.fill(collection, ID(id), item); err != nil {
+		return err
+	}
+	cli.collections[collection][ID(id)] = item
+	cli.calls = append(cli.calls, http.MethodPut+" "+uri)
+	return cli.respond(item, decode)
+}
+
+// _memoryClusterSubresources maps the cluster sub-resources to the cluster fields.
+var _memoryClusterSubresources = map[string]string{
+	"config":  "settings",
+	"plugins": "policies",
+}
+
+func (cli *memoryHTTPClient) sendPatchRequest(_ context.Context, uri, _ string, body interface{}, decode payloadDecodeFunc, _ http.Header) error {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	patch, err := cli.encode(body)
+	if err != nil {
+		return err
+	}
+	target := uri
+	if field, ok := _memoryClusterSubresources[path.Base(uri)]; ok {
+		// PATCH /clusters/{id}/config and /clusters/{id}/plugins replace the field.
+		target = path.Dir(uri)
+		patch = map[string]interface{}{field: patch}
+	}
+	id, _ := strconv.ParseUint(path.Base(target), 10, 64)
+	item, ok := cli.collections[path.Dir(target)][ID(id)]
+	if !ok {
+		return &responseError{statusCode: http.StatusNotFound, message: fmt.Sprintf("%s not found", uri)}
+	}
+	for key, value := range patch {
+		item[key] = value
+	}
+	cli.calls = append(cli.calls, http.MethodPatch+" "+uri)
+	return cli.respond(item, decode)
+}
+
+func (cli *memoryHTTPClient) sendDeleteRequest(_ context.Context, uri, _ string, _ payloadDecodeFunc, _ http.Header) error {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	id, _ := strconv.ParseUint(path.Base(uri), 10, 64)
+	collection := path.Dir(uri)
+	if _, ok := cli.collections[collection][ID(id)]; !ok {
+		return &responseError{statusCode: http.StatusNotFound, message: fmt.Sprintf("%s not found", uri)}
+	}
+	delete(cli.collections[collection], ID(id))
+	if path.Base(collection) == "apps" {
+		appPrefix := path.Join(_apiPathPrefix, "apps", ID(id).String()) + "/"
+		for name := range cli.collections {
+			if strings.HasPrefix(name, appPrefix) {
+				delete(cli.collections, name)
+			}
+		}
+	}
+	cli.calls = append(cli.calls, http.MethodDelete+" "+uri)
+	return nil
+}
+
+func (cli *memoryHTTPClient) sendRequest(_ *http.Request, _ payloadDecodeFunc, _ *TraceSeries) error {
+	return fmt.Errorf("sendRequest is not supported by the memory client")
+}
+
+func (cli *memoryHTTPClient) getClusterID() ID {
+	return 0
+}
+
+func (cli *memoryHTTPClient) setClusterID(_ ID) {}
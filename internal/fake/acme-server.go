@@ -0,0 +1,622 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/nettest"
+)
+
+// ACMEServer is a fake ACME (RFC 8555) server, it supports the account, order,
+// authorization and certificate APIs with the HTTP-01 and DNS-01 challenges.
+// The JWS signatures are not verified.
+type ACMEServer struct {
+	listener net.Listener
+
+	rootCert         *x509.Certificate
+	intermediateCert *x509.Certificate
+	intermediateKey  *ecdsa.PrivateKey
+
+	mu         sync.Mutex
+	http01Addr string
+	lookupTXT  func(name string) ([]string, error)
+	nextID     int
+	accounts   map[string]string
+	orders     map[string]*acmeOrder
+	authzs     map[string]*acmeAuthz
+	certs      map[string][]byte
+}
+
+type acmeOrder struct {
+	identifiers []string
+	authzIDs    []string
+	certID      string
+}
+
+type acmeAuthz struct {
+	domain     string
+	wildcard   bool
+	thumbprint string
+	status     string
+	challenges []*acmeChallenge
+}
+
+type acmeChallenge struct {
+	typ    string
+	token  string
+	status string
+	err    string
+}
+
+type acmeJWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+}
+
+// NewACMEServer creates a fake ACME server, it issues the certificates
+// through an intermediate CA.
+func NewACMEServer() (*ACMEServer, error) {
+	listener, err := nettest.NewLocalListener("tcp")
+	if err != nil {
+		return nil, errors.Wrap(err, "new local listener")
+	}
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate root key")
+	}
+	rootCert, err := createACMECertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Fake ACME Root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate intermediate key")
+	}
+	intermediateCert, err := createACMECertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Fake ACME Intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, rootCert, &intermediateKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ACMEServer{
+		listener:         listener,
+		rootCert:         rootCert,
+		intermediateCert: intermediateCert,
+		intermediateKey:  intermediateKey,
+		accounts:         make(map[string]string),
+		orders:           make(map[string]*acmeOrder),
+		authzs:           make(map[string]*acmeAuthz),
+		certs:            make(map[string][]byte),
+	}, nil
+}
+
+func createACMECertificate(tmpl, parent *x509.Certificate, pub interface{}, key *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, errors.Wrap(err, "generate serial number")
+	}
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(90 * 24 * time.Hour)
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create certificate")
+	}
+	return x509.ParseCertificate(der)
+}
+
+// SetHTTP01Address sets the address which the HTTP-01 challenges are validated
+// against, the domain is carried in the Host header.
+func (acme *ACMEServer) SetHTTP01Address(addr string) {
+	acme.mu.Lock()
+	defer acme.mu.Unlock()
+	acme.http01Addr = addr
+}
+
+// SetTXTResolver sets the function to look up the TXT records for the DNS-01 challenges.
+func (acme *ACMEServer) SetTXTResolver(lookup func(name string) ([]string, error)) {
+	acme.mu.Lock()
+	defer acme.mu.Unlock()
+	acme.lookupTXT = lookup
+}
+
+// RootCertificate returns the root CA certificate.
+func (acme *ACMEServer) RootCertificate() *x509.Certificate {
+	return acme.rootCert
+}
+
+// Addr returns the ACME server addr.
+func (acme *ACMEServer) Addr() string {
+	url := url.URL{
+		Scheme: "http",
+		Host:   acme.listener.Addr().String(),
+	}
+	return url.String()
+}
+
+// DirectoryURL returns the ACME directory URL.
+func (acme *ACMEServer) DirectoryURL() string {
+	return acme.Addr() + "/directory"
+}
+
+// Serve starts to accept HTTP requests.
+func (acme *ACMEServer) Serve() error {
+	return http.Serve(acme.listener, acme)
+}
+
+// Close closes the ACME server.
+func (acme *ACMEServer) Close() error {
+	return acme.listener.Close()
+}
+
+// ServeHTTP implements the HTTP.Handler interface.
+func (acme *ACMEServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	rw.Header().Set("Replay-Nonce", hex.EncodeToString(nonce))
+	rw.Header().Set("Cache-Control", "no-store")
+
+	switch req.URL.Path {
+	case "/directory":
+		acme.writeJSON(rw, http.StatusOK, map[string]string{
+			"newNonce":   acme.Addr() + "/nonce",
+			"newAccount": acme.Addr() + "/new-account",
+			"newOrder":   acme.Addr() + "/new-order",
+			"revokeCert": acme.Addr() + "/revoke-cert",
+			"keyChange":  acme.Addr() + "/key-change",
+		})
+		return
+	case "/nonce":
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	if req.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		body      acmeJWS
+		protected struct {
+			JWK json.RawMessage `json:"jwk"`
+			KID string          `json:"kid"`
+		}
+	)
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		acme.writeProblem(rw, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	header, err := base64.RawURLEncoding.DecodeString(body.Protected)
+	if err == nil {
+		err = json.Unmarshal(header, &protected)
+	}
+	if err != nil {
+		acme.writeProblem(rw, http.StatusBadRequest, "malformed", "bad protected header")
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body.Payload)
+	if err != nil {
+		acme.writeProblem(rw, http.StatusBadRequest, "malformed", "bad payload")
+		return
+	}
+
+	acme.mu.Lock()
+	defer acme.mu.Unlock()
+
+	if req.URL.Path == "/new-account" {
+		acme.newAccount(rw, protected.JWK, payload)
+		return
+	}
+	thumbprint, ok := acme.accounts[protected.KID]
+	if !ok {
+		acme.writeProblem(rw, http.StatusBadRequest, "accountDoesNotExist", "unknown account "+protected.KID)
+		return
+	}
+
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case req.URL.Path == "/new-order":
+		acme.newOrder(rw, thumbprint, payload)
+	case len(segments) == 2 && segments[0] == "order":
+		acme.getOrder(rw, segments[1])
+	case len(segments) == 2 && segments[0] == "authz":
+		acme.getAuthz(rw, segments[1])
+	case len(segments) == 3 && segments[0] == "chall":
+		acme.validateChallenge(rw, segments[1], segments[2])
+	case len(segments) == 2 && segments[0] == "finalize":
+		acme.finalizeOrder(rw, segments[1], payload)
+	case len(segments) == 2 && segments[0] == "cert":
+		acme.getCertificate(rw, segments[1])
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (acme *ACMEServer) newID() string {
+	acme.nextID++
+	return fmt.Sprint(acme.nextID)
+}
+
+func (acme *ACMEServer) newAccount(rw http.ResponseWriter, jwk json.RawMessage, payload []byte) {
+	var req struct {
+		OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+		Contact            []string `json:"contact"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		acme.writeProblem(rw, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	if len(jwk) == 0 {
+		acme.writeProblem(rw, http.StatusBadRequest, "malformed", "jwk is required")
+		return
+	}
+	// The JWK sent by the client is in the canonical form (RFC 7638), so
+	// the thumbprint can be calculated from it directly.
+	sum := sha256.Sum256(jwk)
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	status := http.StatusOK
+	var kid string
+	for k, v := range acme.accounts {
+		if v == thumbprint {
+			kid = k
+		}
+	}
+	if kid == "" {
+		if req.OnlyReturnExisting {
+			acme.writeProblem(rw, http.StatusBadRequest, "accountDoesNotExist", "no account for the key")
+			return
+		}
+		kid = acme.Addr() + "/acct/" + acme.newID()
+		acme.accounts[kid] = thumbprint
+		status = http.StatusCreated
+	}
+	rw.Header().Set("Location", kid)
+	acme.writeJSON(rw, status, map[string]interface{}{
+		"status":  "valid",
+		"contact": req.Contact,
+	})
+}
+
+func (acme *ACMEServer) newOrder(rw http.ResponseWriter, thumbprint string, payload []byte) {
+	var req struct {
+		Identifiers []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		acme.writeProblem(rw, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	if len(req.Identifiers) == 0 {
+		acme.writeProblem(rw, http.StatusBadRequest, "malformed", "no identifiers")
+		return
+	}
+
+	order := &acmeOrder{}
+	for _, ident := range req.Identifiers {
+		if ident.Type != "dns" {
+			acme.writeProblem(rw, http.StatusBadRequest, "unsupportedIdentifier", "unsupported identifier type "+ident.Type)
+			return
+		}
+		authz := &acmeAuthz{
+			domain:     strings.TrimPrefix(ident.Value, "*."),
+			wildcard:   strings.HasPrefix(ident.Value, "*."),
+			thumbprint: thumbprint,
+			status:     "pending",
+		}
+		types := []string{"http-01", "dns-01"}
+		if authz.wildcard {
+			types = []string{"dns-01"}
+		}
+		for _, typ := range types {
+			token := make([]byte, 16)
+			_, _ = rand.Read(token)
+			authz.challenges = append(authz.challenges, &acmeChallenge{
+				typ:    typ,
+				token:  base64.RawURLEncoding.EncodeToString(token),
+				status: "pending",
+			})
+		}
+		id := acme.newID()
+		acme.authzs[id] = authz
+		order.identifiers = append(order.identifiers, ident.Value)
+		order.authzIDs = append(order.authzIDs, id)
+	}
+	id := acme.newID()
+	acme.orders[id] = order
+	rw.Header().Set("Location", acme.Addr()+"/order/"+id)
+	acme.writeJSON(rw, http.StatusCreated, acme.orderObject(id, order))
+}
+
+func (acme *ACMEServer) orderStatus(order *acmeOrder) string {
+	if order.certID != "" {
+		return "valid"
+	}
+	status := "ready"
+	for _, id := range order.authzIDs {
+		switch acme.authzs[id].status {
+		case "invalid":
+			return "invalid"
+		case "pending":
+			status = "pending"
+		}
+	}
+	return status
+}
+
+func (acme *ACMEServer) orderObject(id string, order *acmeOrder) map[string]interface{} {
+	var (
+		identifiers    []map[string]string
+		authorizations []string
+	)
+	for _, ident := range order.identifiers {
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": ident})
+	}
+	for _, authzID := range order.authzIDs {
+		authorizations = append(authorizations, acme.Addr()+"/authz/"+authzID)
+	}
+	object := map[string]interface{}{
+		"status":         acme.orderStatus(order),
+		"identifiers":    identifiers,
+		"authorizations": authorizations,
+		"finalize":       acme.Addr() + "/finalize/" + id,
+	}
+	if order.certID != "" {
+		object["certificate"] = acme.Addr() + "/cert/" + order.certID
+	}
+	return object
+}
+
+func (acme *ACMEServer) getOrder(rw http.ResponseWriter, id string) {
+	order, ok := acme.orders[id]
+	if !ok {
+		acme.writeProblem(rw, http.StatusNotFound, "malformed", "order not found")
+		return
+	}
+	rw.Header().Set("Location", acme.Addr()+"/order/"+id)
+	acme.writeJSON(rw, http.StatusOK, acme.orderObject(id, order))
+}
+
+func (acme *ACMEServer) challengeObject(authzID string, chal *acmeChallenge) map[string]interface{} {
+	object := map[string]interface{}{
+		"type":   chal.typ,
+		"url":    acme.Addr() + "/chall/" + authzID + "/" + chal.typ,
+		"token":  chal.token,
+		"status": chal.status,
+	}
+	if chal.err != "" {
+		object["error"] = map[string]string{
+			"type":   "urn:ietf:params:acme:error:unauthorized",
+			"detail": chal.err,
+		}
+	}
+	return object
+}
+
+func (acme *ACMEServer) getAuthz(rw http.ResponseWriter, id string) {
+	authz, ok := acme.authzs[id]
+	if !ok {
+		acme.writeProblem(rw, http.StatusNotFound, "malformed", "authorization not found")
+		return
+	}
+	var challenges []map[string]interface{}
+	for _, chal := range authz.challenges {
+		challenges = append(challenges, acme.challengeObject(id, chal))
+	}
+	acme.writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"identifier": map[string]string{"type": "dns", "value": authz.domain},
+		"status":     authz.status,
+		"wildcard":   authz.wildcard,
+		"challenges": challenges,
+	})
+}
+
+func (acme *ACMEServer) validateChallenge(rw http.ResponseWriter, authzID, typ string) {
+	authz, ok := acme.authzs[authzID]
+	if !ok {
+		acme.writeProblem(rw, http.StatusNotFound, "malformed", "authorization not found")
+		return
+	}
+	var chal *acmeChallenge
+	for _, c := range authz.challenges {
+		if c.typ == typ {
+			chal = c
+		}
+	}
+	if chal == nil {
+		acme.writeProblem(rw, http.StatusNotFound, "malformed", "challenge not found")
+		return
+	}
+
+	if chal.status == "pending" {
+		keyAuth := chal.token + "." + authz.thumbprint
+		var err error
+		if typ == "http-01" {
+			err = acme.validateHTTP01(authz.domain, chal.token, keyAuth)
+		} else {
+			err = acme.validateDNS01(authz.domain, keyAuth)
+		}
+		chal.status, authz.status = "valid", "valid"
+		if err != nil {
+			chal.status, authz.status, chal.err = "invalid", "invalid", err.Error()
+		}
+	}
+	acme.writeJSON(rw, http.StatusOK, acme.challengeObject(authzID, chal))
+}
+
+func (acme *ACMEServer) validateHTTP01(domain, token, keyAuth string) error {
+	if acme.http01Addr == "" {
+		return errors.New("HTTP-01 address is not set")
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+acme.http01Addr+"/.well-known/acme-challenge/"+token, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = domain
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(data)) != keyAuth {
+		return fmt.Errorf("unexpected HTTP-01 response for %s: status %d", domain, resp.StatusCode)
+	}
+	return nil
+}
+
+func (acme *ACMEServer) validateDNS01(domain, keyAuth string) error {
+	if acme.lookupTXT == nil {
+		return errors.New("TXT resolver is not set")
+	}
+	name := "_acme-challenge." + domain + "."
+	records, err := acme.lookupTXT(name)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	for _, record := range records {
+		if record == expected {
+			return nil
+		}
+	}
+	return fmt.Errorf("no matching TXT record found at %s", name)
+}
+
+func (acme *ACMEServer) finalizeOrder(rw http.ResponseWriter, id string, payload []byte) {
+	order, ok := acme.orders[id]
+	if !ok {
+		acme.writeProblem(rw, http.StatusNotFound, "malformed", "order not found")
+		return
+	}
+	if acme.orderStatus(order) != "ready" {
+		acme.writeProblem(rw, http.StatusForbidden, "orderNotReady", "order is not ready")
+		return
+	}
+
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		acme.writeProblem(rw, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		acme.writeProblem(rw, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		acme.writeProblem(rw, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	names := append([]string(nil), csr.DNSNames...)
+	identifiers := append([]string(nil), order.identifiers...)
+	sort.Strings(names)
+	sort.Strings(identifiers)
+	if strings.Join(names, ",") != strings.Join(identifiers, ",") {
+		acme.writeProblem(rw, http.StatusBadRequest, "badCSR", "CSR names don't match the order identifiers")
+		return
+	}
+
+	cert, err := createACMECertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:    csr.DNSNames,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, acme.intermediateCert, csr.PublicKey, acme.intermediateKey)
+	if err != nil {
+		acme.writeProblem(rw, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: acme.intermediateCert.Raw})...)
+
+	order.certID = acme.newID()
+	acme.certs[order.certID] = chain
+	rw.Header().Set("Location", acme.Addr()+"/order/"+id)
+	acme.writeJSON(rw, http.StatusOK, acme.orderObject(id, order))
+}
+
+func (acme *ACMEServer) getCertificate(rw http.ResponseWriter, id string) {
+	chain, ok := acme.certs[id]
+	if !ok {
+		acme.writeProblem(rw, http.StatusNotFound, "malformed", "certificate not found")
+		return
+	}
+	rw.Header().Set("Content-Type", "application/pem-certificate-chain")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(chain)
+}
+
+func (acme *ACMEServer) writeProblem(rw http.ResponseWriter, status int, typ, detail string) {
+	rw.Header().Set("Content-Type", "application/problem+json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+		"type":   "urn:ietf:params:acme:error:" + typ,
+		"detail": detail,
+		"status": status,
+	})
+}
+
+func (acme *ACMEServer) writeJSON(rw http.ResponseWriter, status int, data interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(data)
+}
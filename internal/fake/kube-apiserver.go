@@ -0,0 +1,180 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/nettest"
+)
+
+// KubeAPIServer is a fake Kubernetes API server, it only serves the
+// version and the endpoints APIs.
+type KubeAPIServer struct {
+	listener net.Listener
+	token    string
+	version  string
+
+	mu        sync.Mutex
+	endpoints []kubeEndpoints
+}
+
+type kubeEndpoints struct {
+	namespace string
+	name      string
+	labels    map[string]string
+}
+
+// NewKubeAPIServer creates a fake Kubernetes API server, requests are
+// rejected (with 401) if their bearer token is not the `token`.
+func NewKubeAPIServer(token string) (*KubeAPIServer, error) {
+	listener, err := nettest.NewLocalListener("tcp")
+	if err != nil {
+		return nil, errors.Wrap(err, "new local listener")
+	}
+
+	return &KubeAPIServer{
+		listener: listener,
+		token:    token,
+		version:  "v1.27.3",
+	}, nil
+}
+
+// AddEndpoints adds an Endpoints object.
+func (kube *KubeAPIServer) AddEndpoints(namespace, name string, labels map[string]string) {
+	kube.mu.Lock()
+	defer kube.mu.Unlock()
+	kube.endpoints = append(kube.endpoints, kubeEndpoints{
+		namespace: namespace,
+		name:      name,
+		labels:    labels,
+	})
+}
+
+// Addr returns the Kubernetes API server addr.
+func (kube *KubeAPIServer) Addr() string {
+	url := url.URL{
+		Scheme: "http",
+		Host:   kube.listener.Addr().String(),
+	}
+	return url.String()
+}
+
+// Serve starts to accept HTTP requests.
+func (kube *KubeAPIServer) Serve() error {
+	return http.Serve(kube.listener, kube)
+}
+
+// Close closes the Kubernetes API server.
+func (kube *KubeAPIServer) Close() error {
+	return kube.listener.Close()
+}
+
+// ServeHTTP implements the HTTP.Handler interface.
+func (kube *KubeAPIServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != "Bearer "+kube.token {
+		kube.writeJSON(rw, http.StatusUnauthorized, map[string]interface{}{
+			"kind":    "Status",
+			"status":  "Failure",
+			"message": "Unauthorized",
+			"code":    http.StatusUnauthorized,
+		})
+		return
+	}
+
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case req.URL.Path == "/version":
+		kube.writeJSON(rw, http.StatusOK, map[string]string{
+			"gitVersion": kube.version,
+			"platform":   "linux/amd64",
+		})
+	case req.URL.Path == "/api/v1/endpoints":
+		kube.listEndpoints(rw, req, "")
+	case len(segments) == 5 && segments[0] == "api" && segments[1] == "v1" &&
+		segments[2] == "namespaces" && segments[4] == "endpoints":
+		kube.listEndpoints(rw, req, segments[3])
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (kube *KubeAPIServer) listEndpoints(rw http.ResponseWriter, req *http.Request, namespace string) {
+	kube.mu.Lock()
+	defer kube.mu.Unlock()
+
+	items := []interface{}{}
+	for _, ep := range kube.endpoints {
+		if namespace != "" && ep.namespace != namespace {
+			continue
+		}
+		if !matchLabelSelector(ep.labels, req.URL.Query().Get("labelSelector")) {
+			continue
+		}
+		items = append(items, map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"namespace": ep.namespace,
+				"name":      ep.name,
+				"labels":    ep.labels,
+			},
+		})
+	}
+	kube.writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"kind":       "EndpointsList",
+		"apiVersion": "v1",
+		"items":      items,
+	})
+}
+
+func (kube *KubeAPIServer) writeJSON(rw http.ResponseWriter, statusCode int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+// matchLabelSelector supports the equality-based requirements and the
+// existence requirements, e.g. "app=web,tier!=db,canary,!legacy".
+func matchLabelSelector(labels map[string]string, selector string) bool {
+	if selector == "" {
+		return true
+	}
+	for _, req := range strings.Split(selector, ",") {
+		var matched bool
+		switch {
+		case strings.Contains(req, "!="):
+			kv := strings.SplitN(req, "!=", 2)
+			matched = labels[kv[0]] != kv[1]
+		case strings.Contains(req, "="):
+			kv := strings.SplitN(strings.Replace(req, "==", "=", 1), "=", 2)
+			value, ok := labels[kv[0]]
+			matched = ok && value == kv[1]
+		case strings.HasPrefix(req, "!"):
+			_, ok := labels[req[1:]]
+			matched = !ok
+		default:
+			_, matched = labels[req]
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
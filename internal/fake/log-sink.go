@@ -0,0 +1,125 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/nettest"
+)
+
+// LogSink is a fake HTTP log sink, it records the received log entries.
+type LogSink struct {
+	listener net.Listener
+
+	mu            sync.Mutex
+	statusCode    int
+	authorization string
+	requests      []*LogSinkRequest
+}
+
+// LogSinkRequest is a request received by the LogSink.
+type LogSinkRequest struct {
+	// Header is the request header.
+	Header http.Header
+	// Body is the request body.
+	Body []byte
+}
+
+// NewLogSink creates a fake HTTP log sink, it responds 200 by default.
+func NewLogSink() (*LogSink, error) {
+	listener, err := nettest.NewLocalListener("tcp")
+	if err != nil {
+		return nil, errors.Wrap(err, "new local listener")
+	}
+
+	return &LogSink{
+		listener:   listener,
+		statusCode: http.StatusOK,
+	}, nil
+}
+
+// RespondWith sets the status code to respond.
+func (sink *LogSink) RespondWith(statusCode int) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.statusCode = statusCode
+}
+
+// RequireAuthorization makes the sink reject the requests (with 401) whose
+// Authorization header is not the `authorization`.
+func (sink *LogSink) RequireAuthorization(authorization string) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.authorization = authorization
+}
+
+// Requests returns the accepted requests.
+func (sink *LogSink) Requests() []*LogSinkRequest {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return append([]*LogSinkRequest(nil), sink.requests...)
+}
+
+// Addr returns the log sink addr.
+func (sink *LogSink) Addr() string {
+	url := url.URL{
+		Scheme: "http",
+		Host:   sink.listener.Addr().String(),
+	}
+	return url.String()
+}
+
+// Serve starts to accept HTTP requests.
+func (sink *LogSink) Serve() error {
+	return http.Serve(sink.listener, sink)
+}
+
+// Close closes the log sink.
+func (sink *LogSink) Close() error {
+	return sink.listener.Close()
+}
+
+// ServeHTTP implements the HTTP.Handler interface.
+func (sink *LogSink) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if req.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if sink.authorization != "" && req.Header.Get("Authorization") != sink.authorization {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if sink.statusCode >= 200 && sink.statusCode < 300 {
+		sink.requests = append(sink.requests, &LogSinkRequest{
+			Header: req.Header.Clone(),
+			Body:   body,
+		})
+	}
+	rw.WriteHeader(sink.statusCode)
+}
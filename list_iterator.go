@@ -16,9 +16,16 @@ package cloud
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"net/http"
@@ -44,10 +51,333 @@ func (paging *Pagination) step() {
 	paging.Page++
 }
 
+const (
+	// OrderByName means sorting list results by the resource name.
+	OrderByName = "name"
+	// OrderByCreatedAt means sorting list results by the resource creation time.
+	OrderByCreatedAt = "created_at"
+	// OrderByUpdatedAt means sorting list results by the resource last modified time.
+	OrderByUpdatedAt = "updated_at"
+)
+
 // Filter indicates conditions to filter out list results.
+// Conditions which are not supported by API7 Cloud for the listed
+// resource kind will be applied by the SDK after fetching the list results,
+// see ClientSideFilterReporter for the details.
 type Filter struct {
 	// Search indicates the search condition for filtering out list results.
 	Search string
+	// Labels indicates the labels that resources should carry, the way to
+	// match them is decided by the LabelsMatch field.
+	Labels []string
+	// LabelsMatch indicates how to match the Labels, optional values are:
+	// * MatchAll: resources should carry all the labels, this is the default value.
+	// * MatchAny: resources should carry any of the labels.
+	LabelsMatch ExpressionLogicalRelationship
+	// Status indicates the status that resources should be in,
+	// nil means resources in any status will be listed.
+	// It's not supported when listing clusters, as the cluster status is
+	// a ClusterStage rather than an EntityStatus.
+	Status *EntityStatus
+	// Active indicates the active status that resources should be in,
+	// nil means both active and inactive resources will be listed.
+	// Optional values can be:
+	// * ActiveStatus: the object is active.
+	// * InactiveStatus: the object is inactive.
+	Active *int
+	// OrderBy indicates how to sort the list results, optional values are:
+	// * OrderByName
+	// * OrderByCreatedAt
+	// * OrderByUpdatedAt
+	// Note if API7 Cloud cannot sort the resources, the SDK will fetch all
+	// the pages and sort them before returning the first result.
+	OrderBy string
+	// Descending indicates whether list results should be sorted in descending order.
+	// It's valid only if the OrderBy field is specified.
+	Descending bool
+	// CreatedAfter indicates only the resources which were created after this
+	// time will be listed, zero value means no limitation.
+	CreatedAfter time.Time
+	// UpdatedAfter indicates only the resources which were modified after this
+	// time will be listed, zero value means no limitation.
+	UpdatedAfter time.Time
+	// State indicates the state that members should be in, it's only valid
+	// when listing members (listing other resources with it will fail),
+	// empty value means members in any state will be listed.
+	// Optional values can be:
+	// * MemberStatePending
+	// * MemberStateActive
+	State string
+	// RoleID indicates the role that members should have, it's only valid
+	// when listing members (listing other resources with it will fail),
+	// zero value means no limitation.
+	RoleID ID
+}
+
+// ClientSideFilterReporter reports the Filter conditions that cannot be
+// handled by API7 Cloud for a kind of resources. These conditions are
+// applied by the SDK after fetching the list results.
+type ClientSideFilterReporter interface {
+	// ClientSideFilters returns the names of Filter conditions which
+	// are applied on the client side.
+	ClientSideFilters() []string
+}
+
+// filterField is a bitmask of the Filter conditions.
+type filterField int
+
+const (
+	filterLabels = filterField(1 << iota)
+	filterStatus
+	filterActive
+	filterOrderBy
+	filterCreatedAfter
+	filterUpdatedAfter
+	filterState
+	filterRole
+)
+
+// _resourceSpecificFilters are the Filter conditions which are only valid for
+// some kinds of resources, see listIterator.resourceFilters.
+const _resourceSpecificFilters = filterState | filterRole
+
+var filterFieldNames = []struct {
+	field filterField
+	name  string
+}{
+	{field: filterLabels, name: "labels"},
+	{field: filterStatus, name: "status"},
+	{field: filterActive, name: "active"},
+	{field: filterOrderBy, name: "order_by"},
+	{field: filterCreatedAfter, name: "created_after"},
+	{field: filterUpdatedAfter, name: "updated_after"},
+	{field: filterState, name: "state"},
+	{field: filterRole, name: "role"},
+}
+
+// names returns the names of the conditions in the fields.
+func (fields filterField) names() []string {
+	var names []string
+	for _, f := range filterFieldNames {
+		if fields&f.field != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// fields returns the conditions that are specified in this filter.
+func (f *Filter) fields() filterField {
+	var fields filterField
+	if f == nil {
+		return fields
+	}
+	if len(f.Labels) > 0 {
+		fields |= filterLabels
+	}
+	if f.Status != nil {
+		fields |= filterStatus
+	}
+	if f.Active != nil {
+		fields |= filterActive
+	}
+	if f.OrderBy != "" {
+		fields |= filterOrderBy
+	}
+	if !f.CreatedAfter.IsZero() {
+		fields |= filterCreatedAfter
+	}
+	if !f.UpdatedAfter.IsZero() {
+		fields |= filterUpdatedAfter
+	}
+	if f.State != "" {
+		fields |= filterState
+	}
+	if f.RoleID != 0 {
+		fields |= filterRole
+	}
+	return fields
+}
+
+// encode encodes the conditions which are in the given fields to the query string.
+func (f *Filter) encode(query url.Values, fields filterField) {
+	if f.Search != "" {
+		query.Set("search", f.Search)
+	}
+	if fields&filterLabels != 0 {
+		match := f.LabelsMatch
+		if match == "" {
+			match = MatchAll
+		}
+		query.Set("labels", strings.Join(f.Labels, ","))
+		query.Set("labels_match", strings.ToLower(string(match)))
+	}
+	if fields&filterStatus != 0 {
+		query.Set("status", strconv.Itoa(int(*f.Status)))
+	}
+	if fields&filterActive != 0 {
+		query.Set("active", strconv.Itoa(*f.Active))
+	}
+	if fields&filterOrderBy != 0 {
+		query.Set("order_by", f.OrderBy)
+		if f.Descending {
+			query.Set("order", "desc")
+		} else {
+			query.Set("order", "asc")
+		}
+	}
+	if fields&filterCreatedAfter != 0 {
+		query.Set("created_after", f.CreatedAfter.Format(time.RFC3339))
+	}
+	if fields&filterUpdatedAfter != 0 {
+		query.Set("updated_after", f.UpdatedAfter.Format(time.RFC3339))
+	}
+	if fields&filterState != 0 {
+		query.Set("state", f.State)
+	}
+	if fields&filterRole != 0 {
+		query.Set("role_id", f.RoleID.String())
+	}
+}
+
+// listItemFields contains the fields that client side filters need.
+type listItemFields struct {
+	Name      string        `json:"name"`
+	Labels    []string      `json:"labels"`
+	Status    *EntityStatus `json:"status"`
+	Active    *int          `json:"active"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	State     string        `json:"state"`
+	Roles     []struct {
+		ID ID `json:"id"`
+	} `json:"roles"`
+}
+
+// match checks if the item satisfies the conditions which are in the given fields.
+func (f *Filter) match(item *listItemFields, fields filterField) bool {
+	if fields&filterLabels != 0 && !matchLabels(item.Labels, f.Labels, f.LabelsMatch) {
+		return false
+	}
+	if fields&filterStatus != 0 && (item.Status == nil || *item.Status != *f.Status) {
+		return false
+	}
+	if fields&filterActive != 0 && (item.Active == nil || *item.Active != *f.Active) {
+		return false
+	}
+	if fields&filterCreatedAfter != 0 && !item.CreatedAt.After(f.CreatedAfter) {
+		return false
+	}
+	if fields&filterUpdatedAfter != 0 && !item.UpdatedAt.After(f.UpdatedAfter) {
+		return false
+	}
+	if fields&filterState != 0 && !strings.EqualFold(item.State, f.State) {
+		return false
+	}
+	if fields&filterRole != 0 {
+		found := false
+		for _, role := range item.Roles {
+			if role.ID == f.RoleID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// less reports whether item a should be sorted before item b.
+func (f *Filter) less(a, b *listItemFields) bool {
+	var less bool
+	switch f.OrderBy {
+	case OrderByCreatedAt:
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return false
+		}
+		less = a.CreatedAt.Before(b.CreatedAt)
+	case OrderByUpdatedAt:
+		if a.UpdatedAt.Equal(b.UpdatedAt) {
+			return false
+		}
+		less = a.UpdatedAt.Before(b.UpdatedAt)
+	default:
+		if a.Name == b.Name {
+			return false
+		}
+		less = a.Name < b.Name
+	}
+	if f.Descending {
+		return !less
+	}
+	return less
+}
+
+func matchLabels(labels, expected []string, match ExpressionLogicalRelationship) bool {
+	owned := make(map[string]struct{}, len(labels))
+	for _, label := range labels {
+		owned[label] = struct{}{}
+	}
+	for _, label := range expected {
+		_, ok := owned[label]
+		if match == MatchAny && ok {
+			return true
+		}
+		if match != MatchAny && !ok {
+			return false
+		}
+	}
+	return match != MatchAny
+}
+
+// Checkpointer saves the position of a list iterator so that the iteration
+// can be resumed later (even in another process), see ResourceListOptions.ResumeFrom.
+type Checkpointer interface {
+	// Checkpoint returns a serializable token which records the current
+	// position of the iterator. The next item returned by Next will be the first
+	// item after resuming from this token.
+	Checkpoint() (string, error)
+}
+
+// ListCheckpoint is the decoded form of a checkpoint token.
+type ListCheckpoint struct {
+	// Resource is the kind of the listed resources.
+	Resource string `json:"resource"`
+	// Pagination indicates the page where the iterator stays.
+	Pagination Pagination `json:"pagination"`
+	// Offset indicates how many items in the page have been consumed.
+	Offset int `json:"offset"`
+	// FilterFingerprint is the digest of the list conditions, it's used to
+	// detect whether the list conditions were changed when resuming.
+	FilterFingerprint string `json:"filter_fingerprint"`
+}
+
+// Token encodes the checkpoint to a token.
+func (cp *ListCheckpoint) Token() (string, error) {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return "", errors.Wrap(err, "encode checkpoint")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// ParseListCheckpoint decodes the checkpoint token.
+func ParseListCheckpoint(token string) (*ListCheckpoint, error) {
+	var cp ListCheckpoint
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode checkpoint")
+	}
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return nil, errors.Wrap(err, "decode checkpoint")
+	}
+	if cp.Pagination.Page <= 0 || cp.Pagination.PageSize <= 0 || cp.Offset < 0 {
+		return nil, errors.New("decode checkpoint: invalid position")
+	}
+	return &cp, nil
 }
 
 type listResponse struct {
@@ -62,45 +392,203 @@ type listIterator struct {
 	path     string
 	paging   Pagination
 	filter   *Filter
-	eof      bool
-	items    []json.RawMessage
-	headers  http.Header
+	// serverFilters contains the Filter conditions that API7 Cloud supports
+	// for this kind of resources, others will be applied on client side.
+	serverFilters filterField
+	// resourceFilters contains the resource-specific Filter conditions which
+	// are valid for this kind of resources.
+	resourceFilters filterField
+	// unsupportedFilters contains the general Filter conditions which are not
+	// applicable to this kind of resources.
+	unsupportedFilters filterField
+	eof                bool
+	items              []json.RawMessage
+	headers            http.Header
+	// itemsPage is the page where the buffered items come from.
+	itemsPage int
+	// offset is the number of consumed items since the itemsPage.
+	offset int
+	// skip is the number of items that should be dropped after the next fetching,
+	// it's used when resuming from a checkpoint.
+	skip int
 }
 
 func (iter *listIterator) Next() (json.RawMessage, error) {
-	if iter.eof {
-		return nil, nil
+	for {
+		if len(iter.items) == 0 {
+			if iter.eof {
+				return nil, nil
+			}
+			if err := iter.fetch(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		res := iter.items[0]
+		iter.items[0] = nil
+		iter.items = iter.items[1:]
+		iter.offset++
+
+		if iter.clientFilters()&^filterOrderBy == 0 {
+			return res, nil
+		}
+		var fields listItemFields
+		if err := json.Unmarshal(res, &fields); err != nil {
+			return nil, errors.Wrap(err, "filter resources")
+		}
+		if iter.filter.match(&fields, iter.clientFilters()) {
+			return res, nil
+		}
 	}
+}
 
-	if len(iter.items) == 0 {
-		var lr listResponse
+// ClientSideFilters returns the names of Filter conditions which are applied on client side.
+func (iter *listIterator) ClientSideFilters() []string {
+	return iter.clientFilters().names()
+}
 
-		query := make(url.Values)
-		query.Set("page", strconv.Itoa(iter.paging.Page))
-		query.Set("page_size", strconv.Itoa(iter.paging.PageSize))
+func (iter *listIterator) clientFilters() filterField {
+	return iter.filter.fields() &^ iter.serverFilters
+}
 
-		if iter.filter != nil {
-			if iter.filter.Search != "" {
-				query.Set("search", iter.filter.Search)
-			}
-		}
+// fetch fetches the next page, when the list results need to be sorted on the
+// client side, all the remaining pages will be fetched.
+func (iter *listIterator) fetch() error {
+	iter.itemsPage = iter.paging.Page
+	iter.offset = 0
+	defer iter.skipItems()
 
-		err := iter.client.sendGetRequest(iter.ctx, iter.path, query.Encode(), jsonPayloadDecodeFactory(&lr), iter.headers)
+	if iter.clientFilters()&filterOrderBy == 0 {
+		items, err := iter.fetchPage()
 		if err != nil {
-			return nil, errors.Wrap(err, "list resources")
+			return err
 		}
+		iter.items = items
+		return nil
+	}
 
-		iter.items = lr.List
+	var all []json.RawMessage
+	for !iter.eof {
+		items, err := iter.fetchPage()
+		if err != nil {
+			return err
+		}
+		all = append(all, items...)
+	}
 
-		if len(iter.items) == 0 {
-			iter.eof = true
-			return nil, nil
+	fields := make([]listItemFields, len(all))
+	for i := range all {
+		if err := json.Unmarshal(all[i], &fields[i]); err != nil {
+			return errors.Wrap(err, "sort resources")
 		}
-		(&iter.paging).step()
+	}
+	indexes := make([]int, len(all))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return iter.filter.less(&fields[indexes[i]], &fields[indexes[j]])
+	})
+	iter.items = make([]json.RawMessage, 0, len(all))
+	for _, idx := range indexes {
+		iter.items = append(iter.items, all[idx])
+	}
+	return nil
+}
+
+func (iter *listIterator) skipItems() {
+	if iter.skip == 0 || len(iter.items) == 0 {
+		return
+	}
+	n := iter.skip
+	if n > len(iter.items) {
+		n = len(iter.items)
+	}
+	iter.items = iter.items[n:]
+	iter.offset = n
+	iter.skip = 0
+}
+
+// Checkpoint returns a token which records the current position of the iterator.
+func (iter *listIterator) Checkpoint() (string, error) {
+	cp := ListCheckpoint{
+		Resource:          iter.resource,
+		Pagination:        iter.paging,
+		FilterFingerprint: iter.fingerprint(),
+	}
+	if len(iter.items) > 0 {
+		cp.Pagination.Page = iter.itemsPage
+		cp.Offset = iter.offset
+	} else if iter.skip > 0 {
+		cp.Offset = iter.skip
+	}
+	return cp.Token()
+}
+
+// validateFilter checks if the Filter conditions are valid for this kind of resources.
+func (iter *listIterator) validateFilter() error {
+	invalid := iter.filter.fields() & (_resourceSpecificFilters&^iter.resourceFilters | iter.unsupportedFilters)
+	if invalid != 0 {
+		return fmt.Errorf("list %s: filter %s is not supported", iter.resource, strings.Join(invalid.names(), ", "))
+	}
+	return nil
+}
+
+// resume restores the position of the iterator from the checkpoint token,
+// the token will be rejected if the list conditions were changed.
+func (iter *listIterator) resume(token string) error {
+	if token == "" {
+		return nil
+	}
+	cp, err := ParseListCheckpoint(token)
+	if err != nil {
+		return err
+	}
+	if cp.Resource != iter.resource {
+		return fmt.Errorf("resume list: checkpoint is for %s, not %s", cp.Resource, iter.resource)
+	}
+	if cp.FilterFingerprint != iter.fingerprint() {
+		return ErrCheckpointConditionChanged
+	}
+	iter.paging = cp.Pagination
+	iter.skip = cp.Offset
+	iter.items = nil
+	iter.eof = false
+	return nil
+}
+
+// fingerprint returns the digest of the list conditions.
+func (iter *listIterator) fingerprint() string {
+	h := sha256.New()
+	h.Write([]byte(iter.path))
+	if iter.filter != nil {
+		data, _ := json.Marshal(iter.filter)
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (iter *listIterator) fetchPage() ([]json.RawMessage, error) {
+	var lr listResponse
+
+	query := make(url.Values)
+	query.Set("page", strconv.Itoa(iter.paging.Page))
+	query.Set("page_size", strconv.Itoa(iter.paging.PageSize))
+
+	if iter.filter != nil {
+		iter.filter.encode(query, iter.filter.fields()&iter.serverFilters)
 	}
 
-	res := iter.items[0]
-	iter.items[0] = nil
-	iter.items = iter.items[1:]
-	return res, nil
+	err := iter.client.sendGetRequest(iter.ctx, iter.path, query.Encode(), jsonPayloadDecodeFactory(&lr), iter.headers)
+	if err != nil {
+		return nil, errors.Wrap(err, "list resources")
+	}
+
+	if len(lr.List) == 0 {
+		iter.eof = true
+		return nil, nil
+	}
+	(&iter.paging).step()
+	return lr.List, nil
 }
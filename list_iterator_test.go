@@ -18,7 +18,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -115,3 +117,285 @@ func TestListIterator(t *testing.T) {
 		})
 	}
 }
+
+func TestListIteratorWithFilter(t *testing.T) {
+	t.Parallel()
+
+	active := ActiveStatus
+	testCases := []struct {
+		name              string
+		mockFn            func(t *testing.T) *listIterator
+		getItems          []interface{}
+		clientSideFilters []string
+	}{
+		{
+			name: "encode filter into query",
+			mockFn: func(t *testing.T) *listIterator {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/clusters/1/apps",
+					"active=0&labels=team%3Dpayments%2Cteam%3Dorders&labels_match=any&order=desc&order_by=name&page=1&page_size=10",
+					gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"list":[{"id":"1","name":"b"},{"id":"2","name":"a"}],"count":2}`))
+					})
+				cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/clusters/1/apps",
+					"active=0&labels=team%3Dpayments%2Cteam%3Dorders&labels_match=any&order=desc&order_by=name&page=2&page_size=10",
+					gomock.Any(), gomock.Any()).Return(nil)
+
+				return &listIterator{
+					ctx:           context.Background(),
+					resource:      "applications",
+					client:        cli,
+					path:          "/api/v1/clusters/1/apps",
+					paging:        DefaultPagination,
+					serverFilters: filterLabels | filterActive | filterOrderBy,
+					filter: &Filter{
+						Labels:      []string{"team=payments", "team=orders"},
+						LabelsMatch: MatchAny,
+						Active:      &active,
+						OrderBy:     OrderByName,
+						Descending:  true,
+					},
+				}
+			},
+			getItems: []interface{}{
+				json.RawMessage(`{"id":"1","name":"b"}`),
+				json.RawMessage(`{"id":"2","name":"a"}`),
+			},
+		},
+		{
+			name: "filter on client side",
+			mockFn: func(t *testing.T) *listIterator {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/clusters/1/apps", "page=1&page_size=2",
+					gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"list":[{"id":"1","labels":["a"],"updated_at":"2022-01-01T00:00:00Z"},{"id":"2","labels":["a","b"],"updated_at":"2022-01-01T00:00:00Z"}]}`))
+					})
+				cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/clusters/1/apps", "page=2&page_size=2",
+					gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"list":[{"id":"3","labels":["a","b"],"updated_at":"2022-03-01T00:00:00Z"}]}`))
+					})
+				cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/clusters/1/apps", "page=3&page_size=2",
+					gomock.Any(), gomock.Any()).Return(nil)
+
+				return &listIterator{
+					ctx:      context.Background(),
+					resource: "applications",
+					client:   cli,
+					path:     "/api/v1/clusters/1/apps",
+					paging: Pagination{
+						Page:     1,
+						PageSize: 2,
+					},
+					filter: &Filter{
+						Labels:       []string{"a", "b"},
+						UpdatedAfter: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+					},
+				}
+			},
+			getItems: []interface{}{
+				json.RawMessage(`{"id":"3","labels":["a","b"],"updated_at":"2022-03-01T00:00:00Z"}`),
+			},
+			clientSideFilters: []string{"labels", "updated_after"},
+		},
+		{
+			name: "sort on client side",
+			mockFn: func(t *testing.T) *listIterator {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/regions", "page=1&page_size=2",
+					gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"list":[{"name":"us-west"},{"name":"ap-east"}]}`))
+					})
+				cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/regions", "page=2&page_size=2",
+					gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"list":[{"name":"eu-central"}]}`))
+					})
+				cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/regions", "page=3&page_size=2",
+					gomock.Any(), gomock.Any()).Return(nil)
+
+				return &listIterator{
+					ctx:      context.Background(),
+					resource: "region",
+					client:   cli,
+					path:     "/api/v1/regions",
+					paging: Pagination{
+						Page:     1,
+						PageSize: 2,
+					},
+					filter: &Filter{
+						OrderBy: OrderByName,
+					},
+				}
+			},
+			getItems: []interface{}{
+				json.RawMessage(`{"name":"ap-east"}`),
+				json.RawMessage(`{"name":"eu-central"}`),
+				json.RawMessage(`{"name":"us-west"}`),
+			},
+			clientSideFilters: []string{"order_by"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var items []interface{}
+			iter := tc.mockFn(t)
+			for {
+				item, err := iter.Next()
+				assert.Nil(t, err, "check if error is nil")
+				if item == nil {
+					break
+				}
+				items = append(items, item)
+			}
+			assert.Equal(t, tc.getItems, items, "check items")
+			assert.Equal(t, tc.clientSideFilters, iter.ClientSideFilters(), "check client side filters")
+		})
+	}
+}
+
+func TestListIteratorCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	page := func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+		return decode(json.RawMessage(`{"list":[{"id":"1"},{"id":"2"},{"id":"3"}]}`))
+	}
+	newIter := func(cli httpClient, search string) *listIterator {
+		return &listIterator{
+			ctx:      context.Background(),
+			resource: "application",
+			client:   cli,
+			path:     "/api/v1/clusters/1/apps",
+			paging: Pagination{
+				Page:     1,
+				PageSize: 3,
+			},
+			filter: &Filter{
+				Search: search,
+			},
+		}
+	}
+
+	ctrl := gomock.NewController(t)
+	cli := NewMockhttpClient(ctrl)
+	cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/clusters/1/apps", "page=1&page_size=3&search=app", gomock.Any(), gomock.Any()).DoAndReturn(page).Times(2)
+	cli.EXPECT().sendGetRequest(gomock.Any(), "/api/v1/clusters/1/apps", "page=2&page_size=3&search=app", gomock.Any(), gomock.Any()).Return(nil)
+
+	iter := newIter(cli, "app")
+	item, err := iter.Next()
+	assert.Nil(t, err, "check iterating error")
+	assert.Equal(t, json.RawMessage(`{"id":"1"}`), item, "check the first item")
+
+	token, err := iter.Checkpoint()
+	assert.Nil(t, err, "check checkpoint error")
+	cp, err := ParseListCheckpoint(token)
+	assert.Nil(t, err, "check checkpoint parsing error")
+	assert.Equal(t, Pagination{Page: 1, PageSize: 3}, cp.Pagination, "check checkpoint pagination")
+	assert.Equal(t, 1, cp.Offset, "check checkpoint offset")
+
+	err = newIter(cli, "another app").resume(token)
+	assert.Equal(t, ErrCheckpointConditionChanged, err, "check resuming with changed filter")
+
+	resumed := newIter(cli, "app")
+	resumed.paging = DefaultPagination
+	assert.Nil(t, resumed.resume(token), "check resuming error")
+
+	var items []json.RawMessage
+	for {
+		item, err := resumed.Next()
+		assert.Nil(t, err, "check iterating error")
+		if item == nil {
+			break
+		}
+		items = append(items, item)
+	}
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`{"id":"2"}`), json.RawMessage(`{"id":"3"}`)}, items, "check the resumed items")
+}
+
+func TestResumeListWithInvalidCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	cp := &ListCheckpoint{
+		Resource:   "consumer",
+		Pagination: DefaultPagination,
+	}
+	token, err := cp.Token()
+	assert.Nil(t, err, "check encoding checkpoint")
+
+	_, err = newApplication(nil).ListApplications(context.Background(), &ResourceListOptions{
+		Cluster:    &Cluster{ID: 1},
+		ResumeFrom: token,
+	})
+	assert.Contains(t, err.Error(), "checkpoint is for consumer, not application", "check resource mismatch")
+
+	_, err = newApplication(nil).ListApplications(context.Background(), &ResourceListOptions{
+		Cluster:    &Cluster{ID: 1},
+		ResumeFrom: "!invalid",
+	})
+	assert.Contains(t, err.Error(), "decode checkpoint", "check invalid token")
+}
+
+func TestListWithResourceSpecificFilter(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		filter        *Filter
+		expectedError string
+	}{
+		{
+			name:          "state",
+			filter:        &Filter{State: MemberStateActive},
+			expectedError: "list application: filter state is not supported",
+		},
+		{
+			name:          "state and role",
+			filter:        &Filter{State: MemberStateActive, RoleID: 1, Labels: []string{"a"}},
+			expectedError: "list application: filter state, role is not supported",
+		},
+		{
+			name:   "general conditions",
+			filter: &Filter{Labels: []string{"a"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newApplication(nil).ListApplications(context.Background(), &ResourceListOptions{
+				Cluster: &Cluster{ID: 1},
+				Filter:  tc.filter,
+			})
+			if tc.expectedError == "" {
+				assert.Nil(t, err, "check the error")
+			} else {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			}
+		})
+	}
+
+	_, err := newOrganization(nil).ListMembers(context.Background(), &ResourceListOptions{
+		Organization: &Organization{ID: 1},
+		Filter:       &Filter{State: MemberStateActive, RoleID: 1},
+	})
+	assert.Nil(t, err, "check listing members")
+
+	status := Normal
+	_, err = newCluster(nil).ListClusters(context.Background(), &ResourceListOptions{
+		Organization: &Organization{ID: 1},
+		Filter:       &Filter{Status: &status},
+	})
+	assert.Contains(t, err.Error(), "list cluster: filter status is not supported", "check listing clusters by status")
+}
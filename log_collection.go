@@ -17,7 +17,13 @@ package cloud
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/url"
 	"path"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
 )
 
 // LogCollectionType is the type of log collection
@@ -26,10 +32,213 @@ type LogCollectionType string
 var (
 	// HTTPLogCollection means http log collection
 	HTTPLogCollection LogCollectionType = "http-logger"
+	// KafkaLogCollection means kafka log collection
+	KafkaLogCollection LogCollectionType = "kafka-logger"
 	// KakfaLogCollection means kafka log collection
-	KakfaLogCollection LogCollectionType = "kafka-logger"
+	//
+	// Deprecated: use KafkaLogCollection instead.
+	KakfaLogCollection = KafkaLogCollection
+	// TCPLogCollection means tcp log collection
+	TCPLogCollection LogCollectionType = "tcp-logger"
+	// UDPLogCollection means udp log collection
+	UDPLogCollection LogCollectionType = "udp-logger"
+	// SyslogLogCollection means syslog log collection
+	SyslogLogCollection LogCollectionType = "syslog"
+	// ClickHouseLogCollection means clickhouse log collection
+	ClickHouseLogCollection LogCollectionType = "clickhouse-logger"
+	// ElasticsearchLogCollection means elasticsearch log collection
+	ElasticsearchLogCollection LogCollectionType = "elasticsearch-logger"
 )
 
+// LogCollectionSpec is the typed specification of log collection.
+type LogCollectionSpec interface {
+	// Validate checks whether the specification is valid.
+	Validate() error
+}
+
+var logCollectionSpecRegistry = struct {
+	sync.RWMutex
+	factories map[LogCollectionType]func() LogCollectionSpec
+}{
+	factories: map[LogCollectionType]func() LogCollectionSpec{
+		HTTPLogCollection: func() LogCollectionSpec {
+			return &HTTPLoggerSpec{}
+		},
+		KafkaLogCollection: func() LogCollectionSpec {
+			return &KafkaLoggerSpec{}
+		},
+	},
+}
+
+// RegisterLogCollectionSpec registers the typed specification for the log collection type `typ`,
+// the `factory` should return a pointer to the zero value of the specification.
+// After the registration, the Spec of the LogCollection (in type `typ`) returned by
+// GetLogCollection and ListLogCollections will be decoded to the typed specification.
+// Specifications of unregistered types are decoded to map[string]interface{}.
+func RegisterLogCollectionSpec(typ LogCollectionType, factory func() LogCollectionSpec) {
+	logCollectionSpecRegistry.Lock()
+	defer logCollectionSpecRegistry.Unlock()
+	logCollectionSpecRegistry.factories[typ] = factory
+}
+
+func newLogCollectionSpec(typ LogCollectionType) LogCollectionSpec {
+	logCollectionSpecRegistry.RLock()
+	defer logCollectionSpecRegistry.RUnlock()
+	factory, ok := logCollectionSpecRegistry.factories[typ]
+	if !ok {
+		return nil
+	}
+	return factory()
+}
+
+// LogBatchSettings contains the settings of the batch processor, which
+// sends log entries to the sink in batches.
+type LogBatchSettings struct {
+	// BatchMaxSize is the maximum number of log entries in a batch.
+	BatchMaxSize int `json:"batch_max_size,omitempty"`
+	// InactiveTimeout is the time in seconds to flush the batch when there is no new log entry.
+	InactiveTimeout int `json:"inactive_timeout,omitempty"`
+	// BufferDuration is the maximum age in seconds of the oldest log entry in a batch.
+	BufferDuration int `json:"buffer_duration,omitempty"`
+	// MaxRetryCount is the maximum number of retries when a batch failed to be sent.
+	MaxRetryCount int `json:"max_retry_count,omitempty"`
+	// RetryDelay is the time in seconds to delay the retry.
+	RetryDelay int `json:"retry_delay,omitempty"`
+}
+
+func (b *LogBatchSettings) validate(typ LogCollectionType) error {
+	fields := []struct {
+		name  string
+		value int
+	}{
+		{name: "batch_max_size", value: b.BatchMaxSize},
+		{name: "inactive_timeout", value: b.InactiveTimeout},
+		{name: "buffer_duration", value: b.BufferDuration},
+		{name: "max_retry_count", value: b.MaxRetryCount},
+		{name: "retry_delay", value: b.RetryDelay},
+	}
+	for _, field := range fields {
+		if field.value < 0 {
+			return fmt.Errorf("%s spec: %s should not be negative", typ, field.name)
+		}
+	}
+	return nil
+}
+
+// HTTPLoggerSpec is the specification of the http log collection.
+type HTTPLoggerSpec struct {
+	LogBatchSettings `json:",inline"`
+
+	// URI is the HTTP(S) endpoint to receive the log entries.
+	URI string `json:"uri"`
+	// AuthHeader is the value of the Authorization header sent to the endpoint.
+	AuthHeader string `json:"auth_header,omitempty"`
+	// Timeout is the time in seconds to wait for the endpoint response.
+	Timeout int `json:"timeout,omitempty"`
+	// ConcatMethod is the way to concatenate the log entries in a batch,
+	// optional values are "json" (default) and "new_line".
+	ConcatMethod string `json:"concat_method,omitempty"`
+	// SSLVerify indicates whether to verify the endpoint certificate.
+	SSLVerify *bool `json:"ssl_verify,omitempty"`
+}
+
+// Validate implements LogCollectionSpec.
+func (spec *HTTPLoggerSpec) Validate() error {
+	if spec.URI == "" {
+		return fmt.Errorf("%s spec: uri is required", HTTPLogCollection)
+	}
+	u, err := url.Parse(spec.URI)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s spec: uri should be a valid HTTP(S) URL", HTTPLogCollection)
+	}
+	if spec.Timeout < 0 {
+		return fmt.Errorf("%s spec: timeout should not be negative", HTTPLogCollection)
+	}
+	switch spec.ConcatMethod {
+	case "", "json", "new_line":
+	default:
+		return fmt.Errorf("%s spec: unknown concat_method %s", HTTPLogCollection, spec.ConcatMethod)
+	}
+	return spec.LogBatchSettings.validate(HTTPLogCollection)
+}
+
+// KafkaSASLConfig is the SASL authentication settings of a Kafka broker.
+type KafkaSASLConfig struct {
+	// Mechanism is the SASL mechanism, currently only "PLAIN" is supported.
+	Mechanism string `json:"mechanism,omitempty"`
+	// User is the SASL username.
+	User string `json:"user"`
+	// Password is the SASL password.
+	Password string `json:"password"`
+}
+
+// KafkaBroker is a Kafka broker.
+type KafkaBroker struct {
+	// Host is the host of the broker.
+	Host string `json:"host"`
+	// Port is the port of the broker.
+	Port int `json:"port"`
+	// SASLConfig is the SASL authentication settings, nil means no authentication.
+	SASLConfig *KafkaSASLConfig `json:"sasl_config,omitempty"`
+}
+
+// KafkaLoggerSpec is the specification of the kafka log collection.
+type KafkaLoggerSpec struct {
+	LogBatchSettings `json:",inline"`
+
+	// Brokers are the Kafka brokers.
+	Brokers []KafkaBroker `json:"brokers"`
+	// Topic is the topic to receive the log entries.
+	Topic string `json:"kafka_topic"`
+	// Key is the key for partitioning the messages.
+	Key string `json:"key,omitempty"`
+	// ProducerType is the producer type, optional values are "async" (default) and "sync".
+	ProducerType string `json:"producer_type,omitempty"`
+	// RequiredAcks is the number of acknowledgments that the leader needs to receive,
+	// optional values are 1 (default) and -1 (all in-sync replicas).
+	RequiredAcks int `json:"required_acks,omitempty"`
+	// Timeout is the time in seconds to wait for the brokers response.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// Validate implements LogCollectionSpec.
+func (spec *KafkaLoggerSpec) Validate() error {
+	if len(spec.Brokers) == 0 {
+		return fmt.Errorf("%s spec: brokers are required", KafkaLogCollection)
+	}
+	for i, broker := range spec.Brokers {
+		if broker.Host == "" {
+			return fmt.Errorf("%s spec: brokers[%d].host is required", KafkaLogCollection, i)
+		}
+		if broker.Port <= 0 || broker.Port > 65535 {
+			return fmt.Errorf("%s spec: brokers[%d].port should be in range [1, 65535]", KafkaLogCollection, i)
+		}
+		if sasl := broker.SASLConfig; sasl != nil {
+			if sasl.Mechanism != "" && sasl.Mechanism != "PLAIN" {
+				return fmt.Errorf("%s spec: brokers[%d].sasl_config.mechanism %s is not supported", KafkaLogCollection, i, sasl.Mechanism)
+			}
+			if sasl.User == "" || sasl.Password == "" {
+				return fmt.Errorf("%s spec: brokers[%d].sasl_config.user and password are required", KafkaLogCollection, i)
+			}
+		}
+	}
+	if spec.Topic == "" {
+		return fmt.Errorf("%s spec: kafka_topic is required", KafkaLogCollection)
+	}
+	switch spec.ProducerType {
+	case "", "async", "sync":
+	default:
+		return fmt.Errorf("%s spec: unknown producer_type %s", KafkaLogCollection, spec.ProducerType)
+	}
+	if spec.RequiredAcks != 0 && spec.RequiredAcks != 1 && spec.RequiredAcks != -1 {
+		return fmt.Errorf("%s spec: required_acks should be 1 or -1", KafkaLogCollection)
+	}
+	if spec.Timeout < 0 {
+		return fmt.Errorf("%s spec: timeout should not be negative", KafkaLogCollection)
+	}
+	return spec.LogBatchSettings.validate(KafkaLogCollection)
+}
+
 // LogCollection is the abstraction of log storage
 type LogCollection struct {
 	// ID is the unique identify to mark an object.
@@ -40,10 +249,56 @@ type LogCollection struct {
 	Description string `json:"description"`
 	// Type is the type of log collection
 	Type LogCollectionType `json:"type"`
-	// Spec is the specification of log collection
+	// Spec is the specification of log collection, it's decoded to the typed
+	// specification (e.g. *HTTPLoggerSpec for HTTPLogCollection) according
+	// to the Type, see RegisterLogCollectionSpec for the details.
 	Spec interface{} `json:"spec" gorm:"serializer:json"`
 }
 
+// UnmarshalJSON decodes the log collection and its typed specification.
+func (lc *LogCollection) UnmarshalJSON(data []byte) error {
+	type logCollection LogCollection
+	var raw struct {
+		logCollection
+		Spec json.RawMessage `json:"spec"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*lc = LogCollection(raw.logCollection)
+	if len(raw.Spec) == 0 || string(raw.Spec) == "null" {
+		lc.Spec = nil
+		return nil
+	}
+	if spec := newLogCollectionSpec(lc.Type); spec != nil {
+		if err := json.Unmarshal(raw.Spec, spec); err != nil {
+			return errors.Wrapf(err, "decode %s spec", lc.Type)
+		}
+		lc.Spec = spec
+		return nil
+	}
+	var spec interface{}
+	if err := json.Unmarshal(raw.Spec, &spec); err != nil {
+		return errors.Wrapf(err, "decode %s spec", lc.Type)
+	}
+	lc.Spec = spec
+	return nil
+}
+
+// Validate checks whether the typed specification is valid, and matches the Type.
+// Specifications of unregistered types are not checked.
+func (lc *LogCollection) Validate() error {
+	expected := newLogCollectionSpec(lc.Type)
+	if expected == nil {
+		return nil
+	}
+	spec, ok := lc.Spec.(LogCollectionSpec)
+	if !ok || reflect.TypeOf(spec) != reflect.TypeOf(expected) {
+		return fmt.Errorf("spec of %s log collection should be %T, got %T", lc.Type, expected, lc.Spec)
+	}
+	return spec.Validate()
+}
+
 // LogCollectionInterface is the interface of the LogCollection
 type LogCollectionInterface interface {
 	// CreateLogCollection creates an API7 Cloud Log Collection in the specified cluster.
@@ -71,10 +326,20 @@ type LogCollectionInterface interface {
 	// Users need to specify the Cluster, Paging, Filter conditions (if necessary)
 	// in the `opts`.
 	ListLogCollections(ctx context.Context, opts *ResourceListOptions) (LogCollectionIterator, error)
+	// TestLogCollection sends a sample log entry to the sink configured by the `lc`
+	// from the caller's machine, it's useful to make sure the sink is reachable before
+	// (or after) creating the Log Collection. The returned report contains the
+	// DNS, TCP, TLS, authentication and sending results with their latencies. An error
+	// is returned if the `lc` is invalid or any stage failed.
+	// Currently only http-logger and kafka log collections can be tested.
+	TestLogCollection(ctx context.Context, lc *LogCollection) (*LogCollectionTestReport, error)
 }
 
 // LogCollectionIterator is an iterator for listing Log Collections.
 type LogCollectionIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next Log Collection according to the filter conditions.
 	Next() (*LogCollection, error)
 }
@@ -102,6 +367,14 @@ func (iter *logCollectionIterator) Next() (*LogCollection, error) {
 	return &lc, nil
 }
 
+func (iter *logCollectionIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *logCollectionIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
 func newLogCollection(cli httpClient) LogCollectionInterface {
 	return &logCollectionImpl{
 		client: cli,
@@ -160,6 +433,12 @@ func (impl *logCollectionImpl) ListLogCollections(ctx context.Context, opts *Res
 		filter:   opts.Filter,
 		headers:  appendHeader(mapClusterIdFromOpts(opts)),
 	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
+	}
 
 	return &logCollectionIterator{iter: iter}, nil
 }
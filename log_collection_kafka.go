@@ -0,0 +1,489 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Kafka protocol APIs (and versions) used by the log collection test,
+// the versions are the lowest ones which are still supported by the recent brokers.
+const (
+	_kafkaAPIProduce          int16 = 0
+	_kafkaAPIMetadata         int16 = 3
+	_kafkaAPISaslHandshake    int16 = 17
+	_kafkaAPISaslAuthenticate int16 = 36
+
+	_kafkaProduceVersion          int16 = 3
+	_kafkaMetadataVersion         int16 = 4
+	_kafkaSaslHandshakeVersion    int16 = 1
+	_kafkaSaslAuthenticateVersion int16 = 0
+
+	_kafkaClientID = "api7-cloud-go-sdk"
+)
+
+var _kafkaErrors = map[int16]string{
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	33: "UNSUPPORTED_SASL_MECHANISM",
+	34: "ILLEGAL_SASL_STATE",
+	35: "UNSUPPORTED_VERSION",
+	58: "SASL_AUTHENTICATION_FAILED",
+}
+
+func kafkaError(code int16) error {
+	if name, ok := _kafkaErrors[code]; ok {
+		return fmt.Errorf("kafka error %d (%s)", code, name)
+	}
+	return fmt.Errorf("kafka error %d", code)
+}
+
+// kafkaWriter encodes the Kafka protocol primitive types.
+type kafkaWriter struct {
+	bytes.Buffer
+}
+
+func (w *kafkaWriter) int8(v int8) {
+	w.WriteByte(byte(v))
+}
+
+func (w *kafkaWriter) int16(v int16) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *kafkaWriter) int32(v int32) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *kafkaWriter) int64(v int64) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *kafkaWriter) varint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	w.Write(buf[:n])
+}
+
+func (w *kafkaWriter) string(v string) {
+	w.int16(int16(len(v)))
+	w.WriteString(v)
+}
+
+func (w *kafkaWriter) nullString() {
+	w.int16(-1)
+}
+
+func (w *kafkaWriter) bytes(v []byte) {
+	w.int32(int32(len(v)))
+	w.Write(v)
+}
+
+// kafkaReader decodes the Kafka protocol primitive types, the first
+// decoding error is kept and the subsequent reads return zero values.
+type kafkaReader struct {
+	data []byte
+	err  error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *kafkaReader) int8() int8 {
+	if v := r.next(1); v != nil {
+		return int8(v[0])
+	}
+	return 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	if v := r.next(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if v := r.next(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if v := r.next(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+func (r *kafkaReader) bytes() []byte {
+	n := r.int32()
+	if n < 0 {
+		return nil
+	}
+	return r.next(int(n))
+}
+
+// kafkaConn is a minimal Kafka client connection, it only supports
+// the APIs which are required by the log collection test.
+type kafkaConn struct {
+	conn          net.Conn
+	timeout       time.Duration
+	correlationID int32
+}
+
+// roundTrip sends a request and returns the response body (without the header).
+func (c *kafkaConn) roundTrip(apiKey, apiVersion int16, body []byte) (*kafkaReader, error) {
+	c.correlationID++
+
+	var req kafkaWriter
+	req.int16(apiKey)
+	req.int16(apiVersion)
+	req.int32(c.correlationID)
+	req.string(_kafkaClientID)
+	req.Write(body)
+
+	var frame kafkaWriter
+	frame.bytes(req.Bytes())
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(frame.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return nil, err
+	}
+	resp := &kafkaReader{data: data}
+	if id := resp.int32(); resp.err == nil && id != c.correlationID {
+		return nil, fmt.Errorf("unexpected correlation id %d, expected %d", id, c.correlationID)
+	}
+	return resp, resp.err
+}
+
+// saslPlain authenticates the connection with the SASL PLAIN mechanism.
+func (c *kafkaConn) saslPlain(user, password string) error {
+	var handshake kafkaWriter
+	handshake.string("PLAIN")
+	resp, err := c.roundTrip(_kafkaAPISaslHandshake, _kafkaSaslHandshakeVersion, handshake.Bytes())
+	if err != nil {
+		return err
+	}
+	if code := resp.int16(); code != 0 {
+		return kafkaError(code)
+	}
+
+	var auth kafkaWriter
+	auth.bytes([]byte("\x00" + user + "\x00" + password))
+	resp, err = c.roundTrip(_kafkaAPISaslAuthenticate, _kafkaSaslAuthenticateVersion, auth.Bytes())
+	if err != nil {
+		return err
+	}
+	code := resp.int16()
+	message := resp.string()
+	if resp.err != nil {
+		return resp.err
+	}
+	if code != 0 {
+		if message != "" {
+			return fmt.Errorf("%s: %s", kafkaError(code), message)
+		}
+		return kafkaError(code)
+	}
+	return nil
+}
+
+// kafkaPartitionLeader is the leader broker of a topic partition.
+type kafkaPartitionLeader struct {
+	partition int32
+	host      string
+	port      int32
+}
+
+// leader fetches the topic metadata and returns the leader of the first partition.
+func (c *kafkaConn) leader(topic string) (*kafkaPartitionLeader, error) {
+	var req kafkaWriter
+	req.int32(1)
+	req.string(topic)
+	// allow_auto_topic_creation
+	req.int8(0)
+	resp, err := c.roundTrip(_kafkaAPIMetadata, _kafkaMetadataVersion, req.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	// throttle_time_ms
+	resp.int32()
+	brokers := make(map[int32]kafkaPartitionLeader)
+	for i := resp.int32(); i > 0 && resp.err == nil; i-- {
+		id := resp.int32()
+		host := resp.string()
+		brokers[id] = kafkaPartitionLeader{host: host, port: resp.int32()}
+		// rack
+		resp.string()
+	}
+	// cluster_id, controller_id
+	resp.string()
+	resp.int32()
+
+	var leader *kafkaPartitionLeader
+	for i := resp.int32(); i > 0 && resp.err == nil; i-- {
+		code := resp.int16()
+		name := resp.string()
+		// is_internal
+		resp.int8()
+		for j := resp.int32(); j > 0 && resp.err == nil; j-- {
+			partitionCode := resp.int16()
+			partition := resp.int32()
+			leaderID := resp.int32()
+			for k := resp.int32(); k > 0 && resp.err == nil; k-- {
+				resp.int32()
+			}
+			for k := resp.int32(); k > 0 && resp.err == nil; k-- {
+				resp.int32()
+			}
+			if name != topic || leader != nil {
+				continue
+			}
+			if partitionCode != 0 {
+				return nil, fmt.Errorf("partition %d: %s", partition, kafkaError(partitionCode))
+			}
+			addr, ok := brokers[leaderID]
+			if !ok {
+				return nil, fmt.Errorf("partition %d: leader %d is not available", partition, leaderID)
+			}
+			addr.partition = partition
+			leader = &addr
+		}
+		if name == topic && code != 0 {
+			return nil, kafkaError(code)
+		}
+	}
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	if leader == nil {
+		return nil, fmt.Errorf("topic %s has no partitions", topic)
+	}
+	return leader, nil
+}
+
+// kafkaRecordBatch encodes a record batch (magic 2) with a single record.
+func kafkaRecordBatch(key, value []byte, now time.Time) []byte {
+	var record kafkaWriter
+	// attributes, timestamp delta, offset delta
+	record.int8(0)
+	record.varint(0)
+	record.varint(0)
+	if key == nil {
+		record.varint(-1)
+	} else {
+		record.varint(int64(len(key)))
+		record.Write(key)
+	}
+	record.varint(int64(len(value)))
+	record.Write(value)
+	// headers
+	record.varint(0)
+
+	// The part which is covered by the CRC.
+	var body kafkaWriter
+	// attributes, last offset delta
+	body.int16(0)
+	body.int32(0)
+	// base timestamp, max timestamp
+	body.int64(now.UnixMilli())
+	body.int64(now.UnixMilli())
+	// producer id, producer epoch, base sequence
+	body.int64(-1)
+	body.int16(-1)
+	body.int32(-1)
+	body.int32(1)
+	body.varint(int64(record.Len()))
+	body.Write(record.Bytes())
+
+	var batch kafkaWriter
+	// base offset
+	batch.int64(0)
+	// batch length counts from the partition leader epoch
+	batch.int32(int32(4 + 1 + 4 + body.Len()))
+	// partition leader epoch
+	batch.int32(-1)
+	// magic
+	batch.int8(2)
+	batch.int32(int32(crc32.Checksum(body.Bytes(), crc32.MakeTable(crc32.Castagnoli))))
+	batch.Write(body.Bytes())
+	return batch.Bytes()
+}
+
+// produce sends a message to the topic partition.
+func (c *kafkaConn) produce(topic string, partition int32, acks int16, key, value []byte) error {
+	var req kafkaWriter
+	// transactional_id
+	req.nullString()
+	req.int16(acks)
+	req.int32(int32(c.timeout / time.Millisecond))
+	req.int32(1)
+	req.string(topic)
+	req.int32(1)
+	req.int32(partition)
+	req.bytes(kafkaRecordBatch(key, value, time.Now()))
+
+	resp, err := c.roundTrip(_kafkaAPIProduce, _kafkaProduceVersion, req.Bytes())
+	if err != nil {
+		return err
+	}
+	for i := resp.int32(); i > 0 && resp.err == nil; i-- {
+		resp.string()
+		for j := resp.int32(); j > 0 && resp.err == nil; j-- {
+			resp.int32()
+			code := resp.int16()
+			// base_offset, log_append_time_ms
+			resp.int64()
+			resp.int64()
+			if resp.err == nil && code != 0 {
+				return kafkaError(code)
+			}
+		}
+	}
+	return resp.err
+}
+
+// connectKafka connects (and authenticates if necessary) to the broker.
+func (p *logCollectionProber) connectKafka(ctx context.Context, host string, port int, sasl *KafkaSASLConfig) (*kafkaConn, error) {
+	conn, err := p.dial(ctx, host, strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+	kc := &kafkaConn{conn: conn, timeout: p.timeout}
+	if sasl != nil {
+		start := time.Now()
+		err = kc.saslPlain(sasl.User, sasl.Password)
+		if err = p.record(LogCollectionProbeAuth, net.JoinHostPort(host, strconv.Itoa(port)), start, "SASL PLAIN as "+sasl.User, err); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return kc, nil
+}
+
+func (p *logCollectionProber) probeKafka(ctx context.Context, spec *KafkaLoggerSpec) error {
+	var (
+		bootstrap *kafkaConn
+		broker    KafkaBroker
+		errs      []string
+	)
+	for _, broker = range spec.Brokers {
+		conn, err := p.connectKafka(ctx, broker.Host, broker.Port, broker.SASLConfig)
+		if err == nil {
+			bootstrap = conn
+			break
+		}
+		errs = append(errs, err.Error())
+	}
+	if bootstrap == nil {
+		return fmt.Errorf("no broker is available: %s", strings.Join(errs, "; "))
+	}
+	defer bootstrap.conn.Close()
+
+	target := net.JoinHostPort(broker.Host, strconv.Itoa(broker.Port))
+	start := time.Now()
+	leader, err := bootstrap.leader(spec.Topic)
+	var detail string
+	if err == nil {
+		detail = fmt.Sprintf("partition %d leader is %s", leader.partition, net.JoinHostPort(leader.host, strconv.Itoa(int(leader.port))))
+	}
+	if err = p.record(LogCollectionProbeMetadata, target, start, detail, err); err != nil {
+		return err
+	}
+
+	conn := bootstrap
+	if leader.host != broker.Host || int(leader.port) != broker.Port {
+		// The SASL settings are per broker, reuse the bootstrap one
+		// since the leader might not be configured explicitly.
+		sasl := broker.SASLConfig
+		for _, b := range spec.Brokers {
+			if b.Host == leader.host && b.Port == int(leader.port) {
+				sasl = b.SASLConfig
+			}
+		}
+		if conn, err = p.connectKafka(ctx, leader.host, int(leader.port), sasl); err != nil {
+			return err
+		}
+		defer conn.conn.Close()
+		target = net.JoinHostPort(leader.host, strconv.Itoa(int(leader.port)))
+	}
+
+	value, err := json.Marshal(sampleLogEntry())
+	if err != nil {
+		return err
+	}
+	var key []byte
+	if spec.Key != "" {
+		key = []byte(spec.Key)
+	}
+	acks := int16(spec.RequiredAcks)
+	if acks == 0 {
+		acks = 1
+	}
+	start = time.Now()
+	err = conn.produce(spec.Topic, leader.partition, acks, key, value)
+	detail = ""
+	if err == nil {
+		detail = fmt.Sprintf("produced to %s[%d]", spec.Topic, leader.partition)
+	}
+	return p.record(LogCollectionProbeSend, target, start, detail, err)
+}
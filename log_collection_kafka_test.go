@@ -0,0 +1,326 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/nettest"
+)
+
+// fakeKafkaBroker is a single node Kafka broker which only supports
+// the APIs used by the log collection test.
+type fakeKafkaBroker struct {
+	listener net.Listener
+	topic    string
+	user     string
+	password string
+
+	mu       sync.Mutex
+	messages [][]byte
+}
+
+func newFakeKafkaBroker(t *testing.T, topic, user, password string) *fakeKafkaBroker {
+	listener, err := nettest.NewLocalListener("tcp")
+	assert.Nil(t, err, "check create local listener error")
+	broker := &fakeKafkaBroker{
+		listener: listener,
+		topic:    topic,
+		user:     user,
+		password: password,
+	}
+	go broker.serve()
+	return broker
+}
+
+func (b *fakeKafkaBroker) hostPort() (string, int) {
+	addr := b.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func (b *fakeKafkaBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeKafkaBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		req := &kafkaReader{data: data}
+		apiKey := req.int16()
+		req.int16()
+		correlationID := req.int32()
+		req.string()
+
+		var resp kafkaWriter
+		resp.int32(correlationID)
+		switch apiKey {
+		case _kafkaAPISaslHandshake:
+			if req.string() == "PLAIN" {
+				resp.int16(0)
+			} else {
+				resp.int16(33)
+			}
+			resp.int32(1)
+			resp.string("PLAIN")
+		case _kafkaAPISaslAuthenticate:
+			if string(req.bytes()) == "\x00"+b.user+"\x00"+b.password {
+				resp.int16(0)
+				resp.nullString()
+			} else {
+				resp.int16(58)
+				resp.string("Invalid username or password")
+			}
+			resp.bytes(nil)
+		case _kafkaAPIMetadata:
+			req.int32()
+			topic := req.string()
+			host, port := b.hostPort()
+			resp.int32(0)
+			resp.int32(1)
+			resp.int32(1)
+			resp.string(host)
+			resp.int32(int32(port))
+			resp.nullString()
+			resp.nullString()
+			resp.int32(1)
+			resp.int32(1)
+			if topic != b.topic {
+				resp.int16(3)
+				resp.string(topic)
+				resp.int8(0)
+				resp.int32(0)
+				break
+			}
+			resp.int16(0)
+			resp.string(topic)
+			resp.int8(0)
+			resp.int32(1)
+			resp.int16(0)
+			resp.int32(0)
+			resp.int32(1)
+			resp.int32(1)
+			resp.int32(1)
+			resp.int32(1)
+			resp.int32(1)
+		case _kafkaAPIProduce:
+			req.string()
+			req.int16()
+			req.int32()
+			req.int32()
+			topic := req.string()
+			req.int32()
+			partition := req.int32()
+			code := b.appendBatch(req.bytes())
+			resp.int32(1)
+			resp.string(topic)
+			resp.int32(1)
+			resp.int32(partition)
+			resp.int16(code)
+			resp.int64(0)
+			resp.int64(-1)
+			resp.int32(0)
+		default:
+			return
+		}
+
+		var frame kafkaWriter
+		frame.bytes(resp.Bytes())
+		if _, err := conn.Write(frame.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+// appendBatch decodes the record batch and stores the record value.
+func (b *fakeKafkaBroker) appendBatch(batch []byte) int16 {
+	r := &kafkaReader{data: batch}
+	r.int64()
+	r.int32()
+	r.int32()
+	if r.int8() != 2 {
+		return 35
+	}
+	crc := uint32(r.int32())
+	if crc != crc32.Checksum(r.data, crc32.MakeTable(crc32.Castagnoli)) {
+		// CORRUPT_MESSAGE
+		return 2
+	}
+	// attributes ... base sequence, records count
+	r.next(2 + 4 + 8 + 8 + 8 + 2 + 4 + 4)
+	if r.err != nil {
+		return 2
+	}
+
+	record := r.data
+	varint := func() int64 {
+		v, n := binary.Varint(record)
+		record = record[n:]
+		return v
+	}
+	varint()
+	// attributes
+	record = record[1:]
+	varint()
+	varint()
+	if keyLen := varint(); keyLen > 0 {
+		record = record[keyLen:]
+	}
+	value := record[:varint()]
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, value)
+	return 0
+}
+
+func (b *fakeKafkaBroker) received() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.messages
+}
+
+func TestTestLogCollectionKafka(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		topic            string
+		sasl             *KafkaSASLConfig
+		expectedStages   []string
+		expectedMessages int
+		expectedError    string
+	}{
+		{
+			name:  "produce successfully",
+			topic: "logs",
+			expectedStages: []string{
+				LogCollectionProbeTCP,
+				LogCollectionProbeMetadata,
+				LogCollectionProbeSend,
+			},
+			expectedMessages: 1,
+		},
+		{
+			name:  "produce with sasl",
+			topic: "logs",
+			sasl:  &KafkaSASLConfig{Mechanism: "PLAIN", User: "admin", Password: "secret"},
+			expectedStages: []string{
+				LogCollectionProbeTCP,
+				LogCollectionProbeAuth,
+				LogCollectionProbeMetadata,
+				LogCollectionProbeSend,
+			},
+			expectedMessages: 1,
+		},
+		{
+			name:  "sasl authentication failed",
+			topic: "logs",
+			sasl:  &KafkaSASLConfig{User: "admin", Password: "bad"},
+			expectedStages: []string{
+				LogCollectionProbeTCP,
+				LogCollectionProbeAuth,
+			},
+			expectedError: "(SASL_AUTHENTICATION_FAILED): Invalid username or password",
+		},
+		{
+			name:  "unknown topic",
+			topic: "unknown",
+			expectedStages: []string{
+				LogCollectionProbeTCP,
+				LogCollectionProbeMetadata,
+			},
+			expectedError: "UNKNOWN_TOPIC_OR_PARTITION",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			broker := newFakeKafkaBroker(t, "logs", "admin", "secret")
+			defer broker.listener.Close()
+			host, port := broker.hostPort()
+
+			impl := &logCollectionImpl{}
+			report, err := impl.TestLogCollection(context.Background(), &LogCollection{
+				Type: KafkaLogCollection,
+				Spec: &KafkaLoggerSpec{
+					Brokers: []KafkaBroker{
+						{Host: host, Port: port, SASLConfig: tc.sasl},
+					},
+					Topic: tc.topic,
+					Key:   "key",
+				},
+			})
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			} else {
+				assert.Nil(t, err, "check the error")
+				assert.True(t, report.Succeeded(), "check the report")
+			}
+			assert.Equal(t, tc.expectedStages, probeStages(report), "check the stages")
+
+			messages := broker.received()
+			assert.Len(t, messages, tc.expectedMessages, "check the received messages")
+			for _, msg := range messages {
+				var entry map[string]interface{}
+				assert.Nil(t, json.Unmarshal(msg, &entry), "check the log entry")
+				assert.Equal(t, "api7-cloud-sdk-connectivity-test", entry["route_id"], "check the log entry")
+			}
+		})
+	}
+}
+
+func TestTestLogCollectionKafkaNoBroker(t *testing.T) {
+	listener, err := nettest.NewLocalListener("tcp")
+	assert.Nil(t, err, "check create local listener error")
+	addr := listener.Addr().(*net.TCPAddr)
+	_ = listener.Close()
+
+	impl := &logCollectionImpl{}
+	report, err := impl.TestLogCollection(context.Background(), &LogCollection{
+		Type: KafkaLogCollection,
+		Spec: &KafkaLoggerSpec{
+			Brokers: []KafkaBroker{{Host: addr.IP.String(), Port: addr.Port}},
+			Topic:   "logs",
+		},
+	})
+	assert.Contains(t, err.Error(), "no broker is available: tcp "+net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port)), "check the error details")
+	assert.False(t, report.Succeeded(), "check the report")
+}
@@ -0,0 +1,291 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// LogCollectionProbeDNS is the stage of resolving the sink domain.
+	LogCollectionProbeDNS = "dns"
+	// LogCollectionProbeTCP is the stage of connecting to the sink.
+	LogCollectionProbeTCP = "tcp"
+	// LogCollectionProbeTLS is the stage of TLS handshake with the sink.
+	LogCollectionProbeTLS = "tls"
+	// LogCollectionProbeAuth is the stage of authenticating with the sink.
+	LogCollectionProbeAuth = "auth"
+	// LogCollectionProbeMetadata is the stage of fetching the Kafka topic metadata.
+	LogCollectionProbeMetadata = "metadata"
+	// LogCollectionProbeSend is the stage of sending the sample log entry.
+	LogCollectionProbeSend = "send"
+
+	_defaultLogCollectionProbeTimeout = 3 * time.Second
+)
+
+// LogCollectionProbeResult is the result of a stage in the log collection test.
+type LogCollectionProbeResult struct {
+	// Stage is the probing stage, e.g. LogCollectionProbeDNS.
+	Stage string
+	// Target is the address (or domain) that the stage works on.
+	Target string
+	// Latency is the time spent by this stage.
+	Latency time.Duration
+	// Detail describes the stage result, e.g. the resolved addresses.
+	Detail string
+	// Err is the reason of the failure, it's nil if the stage succeeded.
+	Err error
+}
+
+// LogCollectionTestReport is the report of TestLogCollection.
+type LogCollectionTestReport struct {
+	// Results contains the results of the executed stages in order,
+	// the test stops at the first failed stage.
+	Results []LogCollectionProbeResult
+	// Latency is the total time spent by the test.
+	Latency time.Duration
+}
+
+// Succeeded reports whether all the stages succeeded.
+func (r *LogCollectionTestReport) Succeeded() bool {
+	for _, result := range r.Results {
+		if result.Err != nil {
+			return false
+		}
+	}
+	return len(r.Results) > 0
+}
+
+type logCollectionProber struct {
+	report  LogCollectionTestReport
+	timeout time.Duration
+}
+
+// record appends the stage result to the report, the returned
+// error is the annotated `err`.
+func (p *logCollectionProber) record(stage, target string, start time.Time, detail string, err error) error {
+	p.report.Results = append(p.report.Results, LogCollectionProbeResult{
+		Stage:   stage,
+		Target:  target,
+		Latency: time.Since(start),
+		Detail:  detail,
+		Err:     err,
+	})
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", stage, target, err)
+	}
+	return nil
+}
+
+// dial resolves the `host` and connects to it.
+func (p *logCollectionProber) dial(ctx context.Context, host, port string) (net.Conn, error) {
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		start := time.Now()
+		dnsCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		resolved, err := net.DefaultResolver.LookupHost(dnsCtx, host)
+		cancel()
+		if err := p.record(LogCollectionProbeDNS, host, start, fmt.Sprintf("resolved to %v", resolved), err); err != nil {
+			return nil, err
+		}
+		addrs = resolved
+	}
+
+	target := net.JoinHostPort(host, port)
+	start := time.Now()
+	dialer := net.Dialer{Timeout: p.timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	for _, addr := range addrs {
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, port))
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, p.record(LogCollectionProbeTCP, target, start, "", err)
+	}
+	if err = p.record(LogCollectionProbeTCP, target, start, "connected to "+conn.RemoteAddr().String(), nil); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// sampleLogEntry returns a log entry which is similar to the ones generated by the gateway.
+func sampleLogEntry() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"route_id":   "api7-cloud-sdk-connectivity-test",
+		"client_ip":  "127.0.0.1",
+		"start_time": now.UnixMilli(),
+		"latency":    0,
+		"request": map[string]interface{}{
+			"method":  http.MethodGet,
+			"uri":     "/api7-cloud-sdk/connectivity-test",
+			"url":     "http://127.0.0.1/api7-cloud-sdk/connectivity-test",
+			"headers": map[string]string{"user-agent": "api7-cloud-go-sdk"},
+			"size":    0,
+		},
+		"response": map[string]interface{}{
+			"status":  http.StatusOK,
+			"headers": map[string]string{},
+			"size":    0,
+		},
+	}
+}
+
+func (impl *logCollectionImpl) TestLogCollection(ctx context.Context, lc *LogCollection) (*LogCollectionTestReport, error) {
+	spec := newLogCollectionSpec(lc.Type)
+	switch spec.(type) {
+	case *HTTPLoggerSpec, *KafkaLoggerSpec:
+	default:
+		return nil, fmt.Errorf("testing %s log collection is not supported", lc.Type)
+	}
+	// The spec might be built by hand as a map.
+	if typed, ok := lc.Spec.(LogCollectionSpec); ok {
+		spec = typed
+	} else if err := decodeTypedValue(lc.Spec, spec); err != nil {
+		return nil, fmt.Errorf("decode %s spec: %s", lc.Type, err)
+	}
+	checked := *lc
+	checked.Spec = spec
+	if err := checked.Validate(); err != nil {
+		return nil, err
+	}
+
+	prober := &logCollectionProber{timeout: _defaultLogCollectionProbeTimeout}
+	start := time.Now()
+	var err error
+	switch s := spec.(type) {
+	case *HTTPLoggerSpec:
+		if s.Timeout > 0 {
+			prober.timeout = time.Duration(s.Timeout) * time.Second
+		}
+		err = prober.probeHTTP(ctx, s)
+	case *KafkaLoggerSpec:
+		if s.Timeout > 0 {
+			prober.timeout = time.Duration(s.Timeout) * time.Second
+		}
+		err = prober.probeKafka(ctx, s)
+	}
+	prober.report.Latency = time.Since(start)
+	return &prober.report, err
+}
+
+func (p *logCollectionProber) probeHTTP(ctx context.Context, spec *HTTPLoggerSpec) error {
+	u, err := url.Parse(spec.URI)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	target := net.JoinHostPort(u.Hostname(), port)
+
+	conn, err := p.dial(ctx, u.Hostname(), port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if u.Scheme == "https" {
+		start := time.Now()
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: spec.SSLVerify != nil && !*spec.SSLVerify,
+		})
+		handshakeCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		err = tlsConn.HandshakeContext(handshakeCtx)
+		cancel()
+		var detail string
+		if err == nil {
+			state := tlsConn.ConnectionState()
+			detail = tls.VersionName(state.Version)
+			if len(state.PeerCertificates) > 0 {
+				detail += ", certificate subject: " + state.PeerCertificates[0].Subject.String()
+			}
+		}
+		if err = p.record(LogCollectionProbeTLS, target, start, detail, err); err != nil {
+			return err
+		}
+		conn = tlsConn
+	}
+
+	var body []byte
+	contentType := "application/json"
+	if spec.ConcatMethod == "new_line" {
+		contentType = "text/plain"
+		body, err = json.Marshal(sampleLogEntry())
+	} else {
+		body, err = json.Marshal([]interface{}{sampleLogEntry()})
+	}
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, spec.URI, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "api7-cloud-go-sdk")
+	if spec.AuthHeader != "" {
+		req.Header.Set("Authorization", spec.AuthHeader)
+	}
+	req.Close = true
+
+	start := time.Now()
+	if err = conn.SetDeadline(time.Now().Add(p.timeout)); err != nil {
+		return p.record(LogCollectionProbeSend, target, start, "", err)
+	}
+	if err = req.Write(conn); err != nil {
+		return p.record(LogCollectionProbeSend, target, start, "", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return p.record(LogCollectionProbeSend, target, start, "", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return p.record(LogCollectionProbeAuth, target, start, string(respBody), fmt.Errorf("rejected with status %d", resp.StatusCode))
+	}
+	if spec.AuthHeader != "" {
+		if err = p.record(LogCollectionProbeAuth, target, start, "authorization header accepted", nil); err != nil {
+			return err
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return p.record(LogCollectionProbeSend, target, start, string(respBody), fmt.Errorf("unexpected status %d", resp.StatusCode))
+	}
+	return p.record(LogCollectionProbeSend, target, start, "status "+strconv.Itoa(resp.StatusCode), nil)
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/api7/cloud-go-sdk/internal/fake"
+)
+
+func probeStages(report *LogCollectionTestReport) []string {
+	var stages []string
+	for _, result := range report.Results {
+		stages = append(stages, result.Stage)
+	}
+	return stages
+}
+
+func TestTestLogCollectionHTTP(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		spec             func(addr string) interface{}
+		setupSink        func(sink *fake.LogSink)
+		expectedStages   []string
+		expectedRequests int
+		expectedError    string
+	}{
+		{
+			name: "send successfully",
+			spec: func(addr string) interface{} {
+				return &HTTPLoggerSpec{URI: addr + "/logs"}
+			},
+			expectedStages:   []string{LogCollectionProbeTCP, LogCollectionProbeSend},
+			expectedRequests: 1,
+		},
+		{
+			name: "untyped spec",
+			spec: func(addr string) interface{} {
+				return map[string]interface{}{"uri": addr + "/logs", "concat_method": "new_line"}
+			},
+			expectedStages:   []string{LogCollectionProbeTCP, LogCollectionProbeSend},
+			expectedRequests: 1,
+		},
+		{
+			name: "authorization accepted",
+			spec: func(addr string) interface{} {
+				return &HTTPLoggerSpec{URI: addr + "/logs", AuthHeader: "Bearer token"}
+			},
+			setupSink: func(sink *fake.LogSink) {
+				sink.RequireAuthorization("Bearer token")
+			},
+			expectedStages:   []string{LogCollectionProbeTCP, LogCollectionProbeAuth, LogCollectionProbeSend},
+			expectedRequests: 1,
+		},
+		{
+			name: "authorization rejected",
+			spec: func(addr string) interface{} {
+				return &HTTPLoggerSpec{URI: addr + "/logs", AuthHeader: "Bearer bad"}
+			},
+			setupSink: func(sink *fake.LogSink) {
+				sink.RequireAuthorization("Bearer token")
+			},
+			expectedStages: []string{LogCollectionProbeTCP, LogCollectionProbeAuth},
+			expectedError:  "rejected with status 401",
+		},
+		{
+			name: "unexpected status",
+			spec: func(addr string) interface{} {
+				return &HTTPLoggerSpec{URI: addr + "/logs"}
+			},
+			setupSink: func(sink *fake.LogSink) {
+				sink.RespondWith(http.StatusInternalServerError)
+			},
+			expectedStages: []string{LogCollectionProbeTCP, LogCollectionProbeSend},
+			expectedError:  "unexpected status 500",
+		},
+		{
+			name: "invalid spec",
+			spec: func(addr string) interface{} {
+				return &HTTPLoggerSpec{}
+			},
+			expectedError: "uri is required",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sink, err := fake.NewLogSink()
+			assert.Nil(t, err, "check create fake log sink error")
+			go func() {
+				_ = sink.Serve()
+			}()
+			defer func() {
+				_ = sink.Close()
+			}()
+			if tc.setupSink != nil {
+				tc.setupSink(sink)
+			}
+
+			impl := &logCollectionImpl{}
+			report, err := impl.TestLogCollection(context.Background(), &LogCollection{
+				Type: HTTPLogCollection,
+				Spec: tc.spec(sink.Addr()),
+			})
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			} else {
+				assert.Nil(t, err, "check the error")
+				assert.True(t, report.Succeeded(), "check the report")
+			}
+			if tc.expectedStages != nil {
+				assert.Equal(t, tc.expectedStages, probeStages(report), "check the stages")
+			}
+
+			requests := sink.Requests()
+			assert.Len(t, requests, tc.expectedRequests, "check the received requests")
+			for _, req := range requests {
+				var entry interface{}
+				assert.Nil(t, json.Unmarshal(req.Body, &entry), "check the log entry")
+			}
+		})
+	}
+}
+
+func TestTestLogCollectionHTTPS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	// The handshake failure is expected when verifying the certificate.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	impl := &logCollectionImpl{}
+	verify := false
+	report, err := impl.TestLogCollection(context.Background(), &LogCollection{
+		Type: HTTPLogCollection,
+		Spec: &HTTPLoggerSpec{URI: server.URL, SSLVerify: &verify},
+	})
+	assert.Nil(t, err, "check the error")
+	assert.Equal(t, []string{LogCollectionProbeTCP, LogCollectionProbeTLS, LogCollectionProbeSend}, probeStages(report), "check the stages")
+
+	verify = true
+	report, err = impl.TestLogCollection(context.Background(), &LogCollection{
+		Type: HTTPLogCollection,
+		Spec: &HTTPLoggerSpec{URI: server.URL, SSLVerify: &verify},
+	})
+	assert.Contains(t, err.Error(), "certificate", "check the error details")
+	assert.False(t, report.Succeeded(), "check the report")
+	assert.Equal(t, []string{LogCollectionProbeTCP, LogCollectionProbeTLS}, probeStages(report), "check the stages")
+}
+
+func TestTestLogCollectionUnsupported(t *testing.T) {
+	impl := &logCollectionImpl{}
+	_, err := impl.TestLogCollection(context.Background(), &LogCollection{
+		Type: SyslogLogCollection,
+		Spec: map[string]interface{}{},
+	})
+	assert.Contains(t, err.Error(), "testing syslog log collection is not supported", "check the error details")
+}
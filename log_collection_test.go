@@ -16,6 +16,7 @@ package cloud
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"path"
 	"testing"
@@ -278,3 +279,143 @@ func TestUpdateLogCollection(t *testing.T) {
 		})
 	}
 }
+
+func TestLogCollectionDecoding(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		data         string
+		expectedSpec interface{}
+	}{
+		{
+			name: "http logger",
+			data: `{"id":"1","type":"http-logger","spec":{"uri":"https://logs.example.com","auth_header":"Bearer x","batch_max_size":100}}`,
+			expectedSpec: &HTTPLoggerSpec{
+				LogBatchSettings: LogBatchSettings{BatchMaxSize: 100},
+				URI:              "https://logs.example.com",
+				AuthHeader:       "Bearer x",
+			},
+		},
+		{
+			name: "kafka logger",
+			data: `{"id":"1","type":"kafka-logger","spec":{"brokers":[{"host":"127.0.0.1","port":9092,"sasl_config":{"user":"u","password":"p"}}],"kafka_topic":"logs"}}`,
+			expectedSpec: &KafkaLoggerSpec{
+				Brokers: []KafkaBroker{
+					{Host: "127.0.0.1", Port: 9092, SASLConfig: &KafkaSASLConfig{User: "u", Password: "p"}},
+				},
+				Topic: "logs",
+			},
+		},
+		{
+			name:         "unknown logger",
+			data:         `{"id":"1","type":"tcp-logger","spec":{"host":"127.0.0.1","port":5044}}`,
+			expectedSpec: map[string]interface{}{"host": "127.0.0.1", "port": float64(5044)},
+		},
+		{
+			name: "empty spec",
+			data: `{"id":"1","type":"http-logger"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var lc LogCollection
+			assert.Nil(t, json.Unmarshal([]byte(tc.data), &lc), "check decode error")
+			assert.Equal(t, ID(1), lc.ID, "check id")
+			assert.Equal(t, tc.expectedSpec, lc.Spec, "check spec")
+		})
+	}
+}
+
+func TestLogCollectionValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		lc            *LogCollection
+		expectedError string
+	}{
+		{
+			name: "valid http logger",
+			lc:   &LogCollection{Type: HTTPLogCollection, Spec: &HTTPLoggerSpec{URI: "http://127.0.0.1:8080/logs"}},
+		},
+		{
+			name:          "http logger with invalid uri",
+			lc:            &LogCollection{Type: HTTPLogCollection, Spec: &HTTPLoggerSpec{URI: "tcp://127.0.0.1"}},
+			expectedError: "http-logger spec: uri should be a valid HTTP(S) URL",
+		},
+		{
+			name: "http logger with negative batch size",
+			lc: &LogCollection{Type: HTTPLogCollection, Spec: &HTTPLoggerSpec{
+				URI:              "http://127.0.0.1",
+				LogBatchSettings: LogBatchSettings{BatchMaxSize: -1},
+			}},
+			expectedError: "http-logger spec: batch_max_size should not be negative",
+		},
+		{
+			name:          "mismatched spec",
+			lc:            &LogCollection{Type: KakfaLogCollection, Spec: &HTTPLoggerSpec{URI: "http://127.0.0.1"}},
+			expectedError: "spec of kafka-logger log collection should be *cloud.KafkaLoggerSpec, got *cloud.HTTPLoggerSpec",
+		},
+		{
+			name: "kafka logger with invalid sasl",
+			lc: &LogCollection{Type: KafkaLogCollection, Spec: &KafkaLoggerSpec{
+				Brokers: []KafkaBroker{{Host: "127.0.0.1", Port: 9092, SASLConfig: &KafkaSASLConfig{Mechanism: "SCRAM-SHA-256"}}},
+				Topic:   "logs",
+			}},
+			expectedError: "kafka-logger spec: brokers[0].sasl_config.mechanism SCRAM-SHA-256 is not supported",
+		},
+		{
+			name: "kafka logger without topic",
+			lc: &LogCollection{Type: KafkaLogCollection, Spec: &KafkaLoggerSpec{
+				Brokers: []KafkaBroker{{Host: "127.0.0.1", Port: 9092}},
+			}},
+			expectedError: "kafka-logger spec: kafka_topic is required",
+		},
+		{
+			name: "unknown logger",
+			lc:   &LogCollection{Type: TCPLogCollection, Spec: map[string]interface{}{}},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.lc.Validate()
+			if tc.expectedError == "" {
+				assert.Nil(t, err, "check validate error")
+			} else {
+				assert.EqualError(t, err, tc.expectedError, "check the error details")
+			}
+		})
+	}
+}
+
+type testSyslogSpec struct {
+	Host string `json:"host"`
+}
+
+func (spec *testSyslogSpec) Validate() error {
+	return nil
+}
+
+func TestRegisterLogCollectionSpec(t *testing.T) {
+	RegisterLogCollectionSpec("test-syslog", func() LogCollectionSpec {
+		return &testSyslogSpec{}
+	})
+
+	var lc LogCollection
+	assert.Nil(t, json.Unmarshal([]byte(`{"type":"test-syslog","spec":{"host":"127.0.0.1"}}`), &lc), "check decode error")
+	assert.Equal(t, &testSyslogSpec{Host: "127.0.0.1"}, lc.Spec, "check spec")
+	assert.Nil(t, lc.Validate(), "check validate error")
+
+	data, err := json.Marshal(&lc)
+	assert.Nil(t, err, "check encode error")
+	assert.JSONEq(t, `{"id":"0","name":"","description":"","type":"test-syslog","spec":{"host":"127.0.0.1"}}`, string(data), "check encoded log collection")
+}
@@ -0,0 +1,235 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"io"
+)
+
+// ManifestKind is the kind of resources in a Manifest.
+type ManifestKind string
+
+const (
+	// ManifestKindApplication is the kind of Application.
+	ManifestKindApplication ManifestKind = "Application"
+	// ManifestKindAPI is the kind of API.
+	ManifestKindAPI ManifestKind = "API"
+	// ManifestKindCanaryRelease is the kind of CanaryRelease.
+	ManifestKindCanaryRelease ManifestKind = "CanaryRelease"
+	// ManifestKindConsumer is the kind of Consumer.
+	ManifestKindConsumer ManifestKind = "Consumer"
+	// ManifestKindCertificate is the kind of Certificate.
+	ManifestKindCertificate ManifestKind = "Certificate"
+	// ManifestKindLogCollection is the kind of LogCollection.
+	ManifestKindLogCollection ManifestKind = "LogCollection"
+	// ManifestKindServiceRegistry is the kind of ServiceRegistry.
+	ManifestKindServiceRegistry ManifestKind = "ServiceRegistry"
+	// ManifestKindCluster is the kind of the cluster-level configuration.
+	ManifestKindCluster ManifestKind = "Cluster"
+)
+
+// Manifest is the desired state of the resources in a cluster, resources are
+// identified by their names (see ManifestCertificate for Certificates).
+type Manifest struct {
+	// Cluster is the desired cluster-level configuration, nil means the
+	// cluster settings and plugins are not managed by the Manifest.
+	Cluster *ManifestCluster
+	// Certificates are the desired Certificates.
+	Certificates []*ManifestCertificate
+	// ServiceRegistries are the desired ServiceRegistries.
+	ServiceRegistries []*ServiceRegistry
+	// LogCollections are the desired LogCollections.
+	LogCollections []*LogCollection
+	// Consumers are the desired Consumers.
+	Consumers []*Consumer
+	// Applications are the desired Applications with their APIs and CanaryReleases.
+	Applications []*ManifestApplication
+}
+
+// ManifestCluster is the cluster-level configuration in the Manifest, the
+// cluster itself is never created or deleted when applying the Manifest.
+type ManifestCluster struct {
+	// Name is the name of the cluster, it's informational only.
+	Name string `json:"name"`
+	// Settings are the desired ClusterSettings, nil means they're not managed.
+	Settings *ClusterSettings `json:"settings,omitempty"`
+	// Plugins are the desired cluster plugins, nil means they're not managed.
+	Plugins Plugins `json:"plugins,omitempty"`
+}
+
+// ManifestCertificate is a Certificate in the Manifest. API7 Cloud Certificates
+// don't have names, so they're identified by the Type and the SNIs of the leaf
+// certificate, the Name is only used to reference the Certificate in the Manifest.
+type ManifestCertificate struct {
+	Certificate
+
+	// Name is the name to reference the Certificate in the Manifest.
+	Name string
+}
+
+// ManifestApplication is an Application in the Manifest.
+type ManifestApplication struct {
+	Application
+
+	// APIs are the desired APIs of the Application.
+	APIs []*API
+	// CanaryReleases are the desired CanaryReleases of the Application.
+	CanaryReleases []*CanaryRelease
+	// UpstreamReferences reference the Certificates and ServiceRegistries in the
+	// Manifest by name, they're resolved to IDs when applying the Manifest.
+	UpstreamReferences []ManifestUpstreamReference
+}
+
+// ManifestUpstreamReference references the resources that an upstream uses.
+type ManifestUpstreamReference struct {
+	// Version is the version of the upstream.
+	Version string `json:"version"`
+	// ClientCertificate is the name of the ManifestCertificate, which is
+	// used as the Upstream.ClientCertID.
+	ClientCertificate string `json:"client_certificate,omitempty"`
+	// ServiceRegistry is the name of the ServiceRegistry, which is used as
+	// the Upstream.ServiceDiscovery.ServiceRegistryID.
+	ServiceRegistry string `json:"service_registry,omitempty"`
+}
+
+// ApplyOptions contains some options for applying a Manifest.
+type ApplyOptions struct {
+	// Prune indicates whether to delete the resources which are not in the
+	// Manifest, only the resources with all the PruneLabels are deleted.
+	// The resources without labels (LogCollections and ServiceRegistries) are never
+	// pruned; CanaryReleases are pruned if their Application has all the PruneLabels.
+	Prune bool
+	// PruneLabels are the labels to select the resources to prune, they're
+	// required if Prune is true.
+	PruneLabels []string
+}
+
+// PlanAction is the action to reconcile a resource.
+type PlanAction string
+
+const (
+	// PlanActionCreate means the resource will be created.
+	PlanActionCreate PlanAction = "create"
+	// PlanActionUpdate means the resource will be updated.
+	PlanActionUpdate PlanAction = "update"
+	// PlanActionDelete means the resource will be deleted.
+	PlanActionDelete PlanAction = "delete"
+	// PlanActionNoop means the resource is up-to-date.
+	PlanActionNoop PlanAction = "noop"
+)
+
+// PlanStep is the reconciliation of a resource.
+type PlanStep struct {
+	// Kind is the resource kind.
+	Kind ManifestKind
+	// Name is the resource name, for APIs and CanaryReleases, it's prefixed by
+	// the Application name (e.g. "app/api").
+	Name string
+	// Action is the action to reconcile the resource.
+	Action PlanAction
+	// ID is the ID of the live resource, it's set after the resource is created.
+	ID ID
+	// Desired is the desired resource (e.g., *Application), it's nil if the
+	// resource will be deleted.
+	Desired interface{}
+	// Live is the live resource (e.g., *Application), it's nil if the
+	// resource will be created.
+	Live interface{}
+
+	// desiredView and liveView are the comparable views of the desired and
+	// live resources, see manifestView.
+	desiredView interface{}
+	liveView    interface{}
+	apply       func(ctx context.Context, state *applyState) error
+}
+
+// Plan is a list of steps to reconcile the resources, the creations and updates
+// are in the dependency order (Cluster, Certificates, ServiceRegistries, LogCollections,
+// Consumers, Applications, APIs and then CanaryReleases), and then the deletions
+// in the reverse order.
+type Plan struct {
+	Steps []*PlanStep
+}
+
+// Count returns the number of steps with the `action`.
+func (p *Plan) Count(action PlanAction) int {
+	n := 0
+	for _, step := range p.Steps {
+		if step.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// HasChanges returns whether there are steps other than PlanActionNoop.
+func (p *Plan) HasChanges() bool {
+	return p.Count(PlanActionNoop) != len(p.Steps)
+}
+
+// ManifestInterface is the interface for reconciling the resources declaratively.
+type ManifestInterface interface {
+	// PlanManifest compares the `desired` Manifest with the live resources in the
+	// specified cluster, and returns the Plan to reconcile them. Nothing is changed.
+	PlanManifest(ctx context.Context, clusterID ID, desired *Manifest, opts *ApplyOptions) (*Plan, error)
+	// Apply reconciles the live resources in the specified cluster to the `desired`
+	// Manifest, the executed Plan is returned. If an error occurs, the steps before the
+	// failed one have been applied.
+	Apply(ctx context.Context, clusterID ID, desired *Manifest, opts *ApplyOptions) (*Plan, error)
+	// Diff compares the `desired` Manifest with the live resources in the specified
+	// cluster, and returns the field-level differences. Nothing is changed. The
+	// resources to be pruned are not included, use PlanManifest and Plan.Diff for them.
+	Diff(ctx context.Context, clusterID ID, desired *Manifest) (*ManifestDiff, error)
+	// ExportCluster writes the configuration of the specified cluster (the cluster
+	// settings and plugins, Certificates, ServiceRegistries, LogCollections, Consumers,
+	// Applications, APIs and CanaryReleases) as manifest documents, which can be
+	// loaded by LoadManifest. The output is deterministic: the resources are sorted
+	// by name, and the IDs are replaced by the name references. The `opts` can be
+	// nil, in such a case, the secrets are excluded.
+	ExportCluster(ctx context.Context, clusterID ID, w io.Writer, opts *ExportOptions) error
+	// CloneCluster copies the configuration of the source cluster (see ExportCluster)
+	// to the destination cluster, which can be empty or existing. The resources are
+	// matched by name, the references (e.g., the client certificates and service
+	// registries of upstreams) are remapped to the IDs in the destination cluster,
+	// and the Applications and APIs are published or unpublished as in the source
+	// cluster. The `opts` can be nil if there are no Certificates in the source
+	// cluster. The executed Plan is returned.
+	CloneCluster(ctx context.Context, srcClusterID, dstClusterID ID, opts *CloneOptions) (*Plan, error)
+}
+
+type manifestImpl struct {
+	clusters          ClusterInterface
+	applications      ApplicationInterface
+	apis              APIInterface
+	canaryReleases    CanaryReleaseInterface
+	consumers         ConsumerInterface
+	certificates      CertificateInterface
+	logCollections    LogCollectionInterface
+	serviceRegistries ServiceDiscoveryInterface
+}
+
+func newManifest(cli httpClient) *manifestImpl {
+	return &manifestImpl{
+		clusters:          newCluster(cli),
+		applications:      newApplication(cli),
+		apis:              newAPI(cli),
+		canaryReleases:    newCanaryRelease(cli),
+		consumers:         newConsumer(cli),
+		certificates:      newCertificate(cli),
+		logCollections:    newLogCollection(cli),
+		serviceRegistries: newServiceDiscovery(cli),
+	}
+}
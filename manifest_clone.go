@@ -0,0 +1,114 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// CloneOptions contains some options for cloning a cluster.
+type CloneOptions struct {
+	ApplyOptions
+
+	// CertificateSource fills the PEM blocks of the Certificates, as API7 Cloud
+	// only returns the certificate metadata. It's required if there are
+	// Certificates in the source cluster.
+	CertificateSource CertificateSourceFunc
+}
+
+// syncPublishStatus publishes or unpublishes the Applications and APIs in the
+// cluster to match their Active in the Manifest.
+func (impl *manifestImpl) syncPublishStatus(ctx context.Context, clusterID ID, m *Manifest) error {
+	live, err := impl.fetchLiveState(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	cluster := &Cluster{ID: clusterID}
+	liveApps := make(map[string]*Application)
+	for _, app := range live.applications {
+		liveApps[app.Name] = app
+	}
+
+	for _, app := range m.Applications {
+		current, ok := liveApps[app.Name]
+		if !ok {
+			continue
+		}
+		if current.Active != app.Active {
+			opts := &ResourceUpdateOptions{Cluster: cluster}
+			if app.Active == ActiveStatus {
+				_, err = impl.applications.PublishApplication(ctx, current.ID, opts)
+			} else {
+				_, err = impl.applications.UnpublishApplication(ctx, current.ID, opts)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "sync the publish status of application %s", app.Name)
+			}
+		}
+
+		liveAPIs := make(map[string]*API)
+		for _, api := range live.apis[current.ID] {
+			liveAPIs[api.Name] = api
+		}
+		for _, api := range app.APIs {
+			currentAPI, ok := liveAPIs[api.Name]
+			if !ok || currentAPI.Active == api.Active {
+				continue
+			}
+			opts := &ResourceUpdateOptions{Cluster: cluster, Application: current}
+			if api.Active == ActiveStatus {
+				_, err = impl.apis.PublishAPI(ctx, currentAPI.ID, opts)
+			} else {
+				_, err = impl.apis.UnpublishAPI(ctx, currentAPI.ID, opts)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "sync the publish status of api %s/%s", app.Name, api.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// CloneCluster implements ManifestInterface.
+func (impl *manifestImpl) CloneCluster(ctx context.Context, srcClusterID, dstClusterID ID, opts *CloneOptions) (*Plan, error) {
+	if srcClusterID == dstClusterID {
+		return nil, errors.New("clone cluster: the source and destination clusters are the same")
+	}
+	if opts == nil {
+		opts = &CloneOptions{}
+	}
+
+	m, err := impl.exportManifest(ctx, srcClusterID, opts.CertificateSource)
+	if err != nil {
+		return nil, errors.Wrap(err, "clone cluster: export source cluster")
+	}
+	for _, cert := range m.Certificates {
+		if cert.Certificate.Certificate == "" || cert.PrivateKey == "" {
+			return nil, fmt.Errorf("clone cluster: the PEM blocks of certificate %s are unavailable, set the CertificateSource", cert.Name)
+		}
+	}
+
+	plan, err := impl.Apply(ctx, dstClusterID, m, &opts.ApplyOptions)
+	if err != nil {
+		return plan, errors.Wrap(err, "clone cluster")
+	}
+	if err = impl.syncPublishStatus(ctx, dstClusterID, m); err != nil {
+		return plan, errors.Wrap(err, "clone cluster")
+	}
+	return plan, nil
+}
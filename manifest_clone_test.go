@@ -0,0 +1,168 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unpublishedOnCreateClient creates the Applications and APIs unpublished
+// regardless of their Active.
+type unpublishedOnCreateClient struct {
+	*memoryHTTPClient
+}
+
+func (cli *unpublishedOnCreateClient) sendPostRequest(ctx context.Context, uri, query string, body interface{}, decode payloadDecodeFunc, headers http.Header) error {
+	if base := path.Base(uri); base == "apps" || base == "apis" {
+		item, err := cli.encode(body)
+		if err != nil {
+			return err
+		}
+		item["active"] = InactiveStatus
+		body = item
+	}
+	return cli.memoryHTTPClient.sendPostRequest(ctx, uri, query, body, decode, headers)
+}
+
+func TestCloneCluster(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	desired := newTestManifest(t, ca)
+	desired.Applications[0].Active = InactiveStatus
+
+	memory := newMemoryHTTPClient()
+	impl := newManifest(&unpublishedOnCreateClient{memory})
+	newTestCluster(memory, 1, "staging",
+		ClusterSettings{ClientSettings: ClientSettings{MaximumRequestBodySize: 1024}},
+		Plugins{"cors": map[string]interface{}{"allow_origins": "*"}},
+	)
+	newTestCluster(memory, 2, "production", ClusterSettings{}, nil)
+	_, err = impl.Apply(context.Background(), 1, desired, nil)
+	assert.Nil(t, err, "check the apply error")
+	assert.Nil(t, impl.syncPublishStatus(context.Background(), 1, desired), "publish the source resources")
+
+	memory.calls = nil
+	opts := &CloneOptions{CertificateSource: testCertificateSource(t, desired)}
+	plan, err := impl.CloneCluster(context.Background(), 1, 2, opts)
+	assert.Nil(t, err, "check the clone error")
+	assert.Equal(t, []string{
+		"update Cluster staging",
+		"create Certificate api7.local",
+		"create Certificate client-gateway",
+		"create ServiceRegistry dns",
+		"create LogCollection http-logger",
+		"create Consumer jack",
+		"create Application web",
+		"create API web/users",
+		"create CanaryRelease web/v2",
+	}, planActions(plan), "check the plan")
+
+	srcApp := memory.items("/clusters/1/apps")[0]
+	dstApp := memory.items("/clusters/2/apps")[0]
+	dstCerts := memory.items("/clusters/2/certificates")
+	dstRegistries := memory.items("/clusters/2/service_registries")
+	dstAPI := memory.items("/apps/" + dstApp["id"].(string) + "/apis")[0]
+	assert.NotEqual(t, srcApp["id"], dstApp["id"], "check the application is recreated")
+	app, err := impl.applications.GetApplication(context.Background(), plan.Steps[6].ID, &ResourceGetOptions{Cluster: &Cluster{ID: 2}})
+	assert.Nil(t, err, "get the cloned application")
+	assert.Equal(t, dstCerts[1]["id"], app.Upstreams[0].Upstream.ClientCertID.String(), "check the client certificate is remapped")
+	assert.Equal(t, dstRegistries[0]["id"], app.Upstreams[1].Upstream.ServiceDiscovery.ServiceRegistryID.String(), "check the service registry is remapped")
+	assert.Equal(t, InactiveStatus, app.Active, "check the application is unpublished as the source")
+	assert.Contains(t, memory.calls, "PATCH "+_apiPathPrefix+"/apps/"+dstApp["id"].(string)+"/apis/"+dstAPI["id"].(string),
+		"check the api is published as the source")
+	assert.NotContains(t, memory.calls, "PATCH "+_apiPathPrefix+"/clusters/2/apps/"+dstApp["id"].(string),
+		"check the application publish status is kept")
+
+	cluster, err := newCluster(memory).GetCluster(context.Background(), 2, nil)
+	assert.Nil(t, err, "get the destination cluster")
+	assert.Equal(t, uint64(1024), cluster.Settings.ClientSettings.MaximumRequestBodySize, "check the cluster settings")
+	assert.Contains(t, cluster.Plugins, "cors", "check the cluster plugins")
+
+	// Clone to the existing cluster again.
+	memory.calls = nil
+	plan, err = impl.CloneCluster(context.Background(), 1, 2, opts)
+	assert.Nil(t, err, "check the clone error")
+	assert.False(t, plan.HasChanges(), "check nothing changes")
+	assert.Empty(t, memory.calls, "check nothing is changed")
+}
+
+func TestCloneClusterErrors(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+
+	testCases := []struct {
+		name          string
+		dst           ID
+		opts          *CloneOptions
+		certificates  bool
+		expectedError string
+	}{
+		{
+			name:          "same cluster",
+			dst:           1,
+			expectedError: "the source and destination clusters are the same",
+		},
+		{
+			name:          "certificates without PEM blocks",
+			dst:           2,
+			expectedError: "the PEM blocks of certificate api7.local are unavailable, set the CertificateSource",
+		},
+		{
+			name:          "certificate source without PEM blocks",
+			dst:           2,
+			opts:          &CloneOptions{CertificateSource: func(context.Context, *CertificateDetails) (*CertificateSpec, error) { return nil, nil }},
+			expectedError: "the PEM blocks of certificate",
+		},
+		{
+			name:          "unknown destination cluster",
+			dst:           3,
+			certificates:  true,
+			expectedError: "clone cluster: plan manifest: get cluster",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := newMemoryHTTPClient()
+			impl := newManifest(cli)
+			newTestCluster(cli, 1, "staging", ClusterSettings{}, nil)
+			newTestCluster(cli, 2, "production", ClusterSettings{}, nil)
+			desired := newTestManifest(t, ca)
+			_, err := impl.Apply(context.Background(), 1, desired, nil)
+			assert.Nil(t, err, "check the apply error")
+
+			opts := tc.opts
+			if tc.certificates {
+				opts = &CloneOptions{CertificateSource: testCertificateSource(t, desired)}
+			}
+			cli.calls = nil
+			_, err = impl.CloneCluster(context.Background(), 1, tc.dst, opts)
+			assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			assert.Empty(t, cli.calls, "check nothing is changed")
+		})
+	}
+}
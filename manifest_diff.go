@@ -0,0 +1,397 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DiffOperation is the change of a field.
+type DiffOperation string
+
+const (
+	// DiffOperationAdd means the field will be added.
+	DiffOperationAdd DiffOperation = "add"
+	// DiffOperationRemove means the field will be removed.
+	DiffOperationRemove DiffOperation = "remove"
+	// DiffOperationChange means the field value will be changed.
+	DiffOperationChange DiffOperation = "change"
+)
+
+// FieldDiff is the change of a field.
+type FieldDiff struct {
+	// Path is the field path, e.g., "upstreams[0].upstream.scheme".
+	Path string `json:"path"`
+	// Operation is the change of the field.
+	Operation DiffOperation `json:"op"`
+	// Old is the live value, it's nil if the field will be added.
+	Old interface{} `json:"old,omitempty"`
+	// New is the desired value, it's nil if the field will be removed.
+	New interface{} `json:"new,omitempty"`
+}
+
+// ResourceDiff is the changes of a resource.
+type ResourceDiff struct {
+	// Kind is the resource kind.
+	Kind ManifestKind `json:"kind"`
+	// Name is the resource name, see PlanStep.Name.
+	Name string `json:"name"`
+	// Action is the action to reconcile the resource.
+	Action PlanAction `json:"action"`
+	// Fields are the changed fields, sorted by the path.
+	Fields []FieldDiff `json:"fields"`
+}
+
+// ManifestDiff is the field-level difference between the desired Manifest and
+// the live resources. The server-managed fields (ID, Status, CreatedAt and
+// UpdatedAt) are ignored, and the defaults filled by the server are normalized.
+type ManifestDiff struct {
+	// Resources are the resources to be created, updated or deleted, in the
+	// order of the Plan steps.
+	Resources []*ResourceDiff `json:"resources"`
+	// Unchanged is the number of the up-to-date resources.
+	Unchanged int `json:"unchanged"`
+}
+
+// _manifestServerDefaults are the defaults filled by the server, the fields with
+// these values are treated as unset. The "[]" in the paths matches all the
+// elements of the array.
+var _manifestServerDefaults = map[ManifestKind]map[string]interface{}{
+	ManifestKindApplication: {
+		"upstreams[].upstream.lb_type":                                      "roundrobin",
+		"upstreams[].upstream.service_discovery.nacos_service.namespace_id": "public",
+		"upstreams[].upstream.service_discovery.nacos_service.group_name":   "DEFAULT_GROUP",
+	},
+	ManifestKindAPI: {
+		"paths[].path_type": "Prefix",
+	},
+	ManifestKindLogCollection: {
+		"spec.concat_method": "json",
+		"spec.producer_type": "async",
+		"spec.required_acks": float64(1),
+	},
+}
+
+// _manifestServerManagedFields are the fields managed by the server.
+var _manifestServerManagedFields = []string{"id", "status", "created_at", "updated_at"}
+
+// normalizeManifestValue encodes the value to the loosely typed form, and drops
+// the null, empty strings, empty arrays and empty objects, so that the values can be compared
+// regardless of the omitempty settings.
+func normalizeManifestValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err = json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return pruneEmptyValues(value), nil
+}
+
+func pruneEmptyValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			elem = pruneEmptyValues(elem)
+			if elem == nil {
+				delete(v, key)
+			} else {
+				v[key] = elem
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		for i := range v {
+			v[i] = pruneEmptyValues(v[i])
+		}
+		return v
+	case string:
+		if v == "" {
+			return nil
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// visitManifestFields calls `fn` with the object containing the field in the
+// `path`, the "[]" suffix of a path segment matches all the array elements.
+func visitManifestFields(value interface{}, path []string, fn func(obj map[string]interface{}, key string)) {
+	obj, ok := value.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return
+	}
+	key := path[0]
+	if strings.HasSuffix(key, "[]") {
+		items, _ := obj[strings.TrimSuffix(key, "[]")].([]interface{})
+		for _, item := range items {
+			visitManifestFields(item, path[1:], fn)
+		}
+		return
+	}
+	if len(path) == 1 {
+		if _, ok = obj[key]; ok {
+			fn(obj, key)
+		}
+		return
+	}
+	visitManifestFields(obj[key], path[1:], fn)
+}
+
+// manifestView returns the comparable view of the resource of the `kind`, which
+// is the normalized value without the server-managed fields and defaults.
+func manifestView(kind ManifestKind, v interface{}) (interface{}, error) {
+	value, err := normalizeManifestValue(v)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+	for _, field := range _manifestServerManagedFields {
+		delete(obj, field)
+	}
+	for path, def := range _manifestServerDefaults[kind] {
+		def := def
+		visitManifestFields(obj, strings.Split(path, "."), func(parent map[string]interface{}, key string) {
+			if reflect.DeepEqual(parent[key], def) {
+				delete(parent, key)
+			}
+		})
+	}
+	if labels, ok := obj["labels"].([]interface{}); ok {
+		sort.Slice(labels, func(i, j int) bool {
+			return fmt.Sprint(labels[i]) < fmt.Sprint(labels[j])
+		})
+	}
+	return pruneEmptyValues(obj), nil
+}
+
+// markPendingReferences replaces the IDs of the referenced resources which are
+// not created yet in the application view with the placeholders.
+func markPendingReferences(view interface{}, app *ManifestApplication, state *applyState) {
+	obj, _ := view.(map[string]interface{})
+	upstreams, _ := obj["upstreams"].([]interface{})
+	for _, ref := range app.UpstreamReferences {
+		for _, item := range upstreams {
+			uv, _ := item.(map[string]interface{})
+			if uv == nil || uv["version"] != ref.Version {
+				continue
+			}
+			upstream, _ := uv["upstream"].(map[string]interface{})
+			if upstream == nil {
+				continue
+			}
+			if ref.ClientCertificate != "" && state.certificates[ref.ClientCertificate] == 0 {
+				upstream["client_cert_id"] = fmt.Sprintf("(certificate %s)", ref.ClientCertificate)
+			}
+			if sd, ok := upstream["service_discovery"].(map[string]interface{}); ok &&
+				ref.ServiceRegistry != "" && state.serviceRegistries[ref.ServiceRegistry] == 0 {
+				sd["service_registry_id"] = fmt.Sprintf("(service registry %s)", ref.ServiceRegistry)
+			}
+		}
+	}
+}
+
+// diffManifestValues collects the changes from `old` to `new` in the `path`.
+func diffManifestValues(path string, old, new interface{}, fields []FieldDiff) []FieldDiff {
+	if reflect.DeepEqual(old, new) {
+		return fields
+	}
+	if old == nil {
+		return append(fields, FieldDiff{Path: path, Operation: DiffOperationAdd, New: new})
+	}
+	if new == nil {
+		return append(fields, FieldDiff{Path: path, Operation: DiffOperationRemove, Old: old})
+	}
+
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(o)+len(n))
+		for key := range o {
+			keys = append(keys, key)
+		}
+		for key := range n {
+			if _, ok := o[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sub := key
+			if path != "" {
+				sub = path + "." + key
+			}
+			fields = diffManifestValues(sub, o[key], n[key], fields)
+		}
+		return fields
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			var a, b interface{}
+			if i < len(o) {
+				a = o[i]
+			}
+			if i < len(n) {
+				b = n[i]
+			}
+			fields = diffManifestValues(path+"["+strconv.Itoa(i)+"]", a, b, fields)
+		}
+		return fields
+	}
+	return append(fields, FieldDiff{Path: path, Operation: DiffOperationChange, Old: old, New: new})
+}
+
+// Diff returns the field-level changes of the Plan.
+func (p *Plan) Diff() *ManifestDiff {
+	diff := &ManifestDiff{
+		Resources: []*ResourceDiff{},
+	}
+	for _, step := range p.Steps {
+		if step.Action == PlanActionNoop {
+			diff.Unchanged++
+			continue
+		}
+		old, new := step.liveView, step.desiredView
+		switch step.Action {
+		case PlanActionCreate:
+			old = map[string]interface{}{}
+		case PlanActionDelete:
+			new = map[string]interface{}{}
+		}
+		diff.Resources = append(diff.Resources, &ResourceDiff{
+			Kind:   step.Kind,
+			Name:   step.Name,
+			Action: step.Action,
+			Fields: diffManifestValues("", old, new, []FieldDiff{}),
+		})
+	}
+	return diff
+}
+
+// Count returns the number of resources with the `action`.
+func (d *ManifestDiff) Count(action PlanAction) int {
+	if action == PlanActionNoop {
+		return d.Unchanged
+	}
+	n := 0
+	for _, res := range d.Resources {
+		if res.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// HasChanges returns whether there are resources to be created, updated or deleted.
+func (d *ManifestDiff) HasChanges() bool {
+	return len(d.Resources) > 0
+}
+
+func diffValueString(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// Text renders the diff in the unified style, e.g.,
+//
+//	@@ update Application web @@
+//	-upstreams[0].upstream.scheme: "http"
+//	+upstreams[0].upstream.scheme: "https"
+func (d *ManifestDiff) Text() string {
+	var buf bytes.Buffer
+	for _, res := range d.Resources {
+		fmt.Fprintf(&buf, "@@ %s %s %s @@\n", res.Action, res.Kind, res.Name)
+		for _, field := range res.Fields {
+			if field.Operation != DiffOperationAdd {
+				fmt.Fprintf(&buf, "-%s: %s\n", field.Path, diffValueString(field.Old))
+			}
+			if field.Operation != DiffOperationRemove {
+				fmt.Fprintf(&buf, "+%s: %s\n", field.Path, diffValueString(field.New))
+			}
+		}
+	}
+	return buf.String()
+}
+
+// JSON renders the diff in JSON.
+func (d *ManifestDiff) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "encode manifest diff")
+	}
+	return data, nil
+}
+
+// Summary renders a short summary of the diff in Markdown, which is suitable
+// for the pull request comments.
+func (d *ManifestDiff) Summary() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "**Plan:** %d to create, %d to update, %d to delete, %d unchanged.\n",
+		d.Count(PlanActionCreate), d.Count(PlanActionUpdate), d.Count(PlanActionDelete), d.Unchanged)
+	if len(d.Resources) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, res := range d.Resources {
+		fmt.Fprintf(&buf, "- %s %s `%s`", res.Action, res.Kind, res.Name)
+		if res.Action == PlanActionUpdate {
+			paths := make([]string, 0, len(res.Fields))
+			for _, field := range res.Fields {
+				paths = append(paths, "`"+field.Path+"`")
+			}
+			fmt.Fprintf(&buf, ": %s", strings.Join(paths, ", "))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// Diff implements ManifestInterface.
+func (impl *manifestImpl) Diff(ctx context.Context, clusterID ID, desired *Manifest) (*ManifestDiff, error) {
+	plan, err := impl.PlanManifest(ctx, clusterID, desired, nil)
+	if err != nil {
+		return nil, err
+	}
+	return plan.Diff(), nil
+}
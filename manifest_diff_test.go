@@ -0,0 +1,169 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffManifestValues(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		old      string
+		new      string
+		expected []FieldDiff
+	}{
+		{
+			name:     "equal",
+			old:      `{"a": [1, {"b": "c"}]}`,
+			new:      `{"a": [1, {"b": "c"}]}`,
+			expected: []FieldDiff{},
+		},
+		{
+			name: "nested fields",
+			old:  `{"a": {"b": 1, "c": "x"}, "d": true}`,
+			new:  `{"a": {"b": 2, "e": [1]}, "d": true}`,
+			expected: []FieldDiff{
+				{Path: "a.b", Operation: DiffOperationChange, Old: 1.0, New: 2.0},
+				{Path: "a.c", Operation: DiffOperationRemove, Old: "x"},
+				{Path: "a.e", Operation: DiffOperationAdd, New: []interface{}{1.0}},
+			},
+		},
+		{
+			name: "array elements",
+			old:  `{"hosts": ["a", "b"]}`,
+			new:  `{"hosts": ["a", "c", "d"]}`,
+			expected: []FieldDiff{
+				{Path: "hosts[1]", Operation: DiffOperationChange, Old: "b", New: "c"},
+				{Path: "hosts[2]", Operation: DiffOperationAdd, New: "d"},
+			},
+		},
+		{
+			name: "type changes",
+			old:  `{"a": {"b": 1}}`,
+			new:  `{"a": [1]}`,
+			expected: []FieldDiff{
+				{Path: "a", Operation: DiffOperationChange, Old: map[string]interface{}{"b": 1.0}, New: []interface{}{1.0}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var old, new interface{}
+			assert.Nil(t, json.Unmarshal([]byte(tc.old), &old), "decode the old value")
+			assert.Nil(t, json.Unmarshal([]byte(tc.new), &new), "decode the new value")
+			assert.Equal(t, tc.expected, diffManifestValues("", old, new, []FieldDiff{}), "check the diff")
+		})
+	}
+}
+
+func TestManifestDiff(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	desired := newTestManifest(t, ca)
+	cli := newMemoryHTTPClient()
+	impl := newManifest(cli)
+
+	diff, err := impl.Diff(context.Background(), 1, desired)
+	assert.Nil(t, err, "check the diff error")
+	assert.Equal(t, 8, diff.Count(PlanActionCreate), "check the resources to create")
+	created := diff.Resources[5]
+	assert.Equal(t, ManifestKindApplication, created.Kind, "check the created application")
+	for _, field := range created.Fields {
+		if field.Path == "upstreams" {
+			upstreams := field.New.([]interface{})
+			v1 := upstreams[0].(map[string]interface{})["upstream"].(map[string]interface{})
+			v2 := upstreams[1].(map[string]interface{})["upstream"].(map[string]interface{})
+			assert.Equal(t, "(certificate upstream-client)", v1["client_cert_id"], "check the pending certificate reference")
+			assert.Equal(t, "(service registry dns)", v2["service_discovery"].(map[string]interface{})["service_registry_id"],
+				"check the pending service registry reference")
+		}
+	}
+
+	_, err = impl.Apply(context.Background(), 1, desired, nil)
+	assert.Nil(t, err, "check the apply error")
+
+	// The defaults and the server-managed fields filled by the server are ignored.
+	app := cli.items("/clusters/1/apps")[0]
+	app["status"] = 1.0
+	app["created_at"] = "2022-10-01T00:00:00Z"
+	upstream := app["upstreams"].([]interface{})[0].(map[string]interface{})["upstream"].(map[string]interface{})
+	upstream["lb_type"] = "roundrobin"
+	lc := cli.items("/clusters/1/log_collections")[0]
+	lc["spec"].(map[string]interface{})["concat_method"] = "json"
+
+	diff, err = impl.Diff(context.Background(), 1, desired)
+	assert.Nil(t, err, "check the diff error")
+	assert.False(t, diff.HasChanges(), "check nothing changes")
+	assert.Equal(t, "**Plan:** 0 to create, 0 to update, 0 to delete, 8 unchanged.\n", diff.Summary(), "check the summary")
+	assert.Equal(t, "", diff.Text(), "check the text")
+
+	desired.Applications[0].Hosts = append(desired.Applications[0].Hosts, "www.api7.local")
+	desired.Applications[0].Upstreams[0].Upstream.LBType = "chash"
+	desired.Applications[0].Upstreams[0].Upstream.HashKey = "remote_addr"
+	desired.Applications[0].APIs[0].Methods = []string{"GET"}
+	desired.Consumers = append(desired.Consumers, &Consumer{Name: "rose", Description: "VIP"})
+	cli.calls = nil
+	diff, err = impl.Diff(context.Background(), 1, desired)
+	assert.Nil(t, err, "check the diff error")
+	assert.Empty(t, cli.calls, "check nothing is changed")
+
+	assert.Equal(t, `@@ create Consumer rose @@
++description: "VIP"
++name: "rose"
+@@ update Application web @@
++hosts[1]: "www.api7.local"
++upstreams[0].upstream.hash_key: "remote_addr"
++upstreams[0].upstream.lb_type: "chash"
+@@ update API web/users @@
++methods: ["GET"]
+`, diff.Text(), "check the text")
+	assert.Equal(t, "**Plan:** 1 to create, 2 to update, 0 to delete, 6 unchanged.\n\n"+
+		"- create Consumer `rose`\n"+
+		"- update Application `web`: `hosts[1]`, `upstreams[0].upstream.hash_key`, `upstreams[0].upstream.lb_type`\n"+
+		"- update API `web/users`: `methods`\n", diff.Summary(), "check the summary")
+
+	data, err := diff.JSON()
+	assert.Nil(t, err, "encode the diff")
+	var decoded ManifestDiff
+	assert.Nil(t, json.Unmarshal(data, &decoded), "decode the diff")
+	assert.Equal(t, diff.Resources[1].Fields[2], decoded.Resources[1].Fields[2], "check the JSON output")
+	assert.Equal(t, 6, decoded.Unchanged, "check the unchanged resources")
+
+	// The pruned resources are in the Plan diff.
+	cli.seed("/clusters/1/consumers", &Consumer{Name: "legacy", Labels: []string{"managed"}})
+	plan, err := impl.PlanManifest(context.Background(), 1, desired, &ApplyOptions{Prune: true, PruneLabels: []string{"managed"}})
+	assert.Nil(t, err, "check the plan error")
+	diff = plan.Diff()
+	deleted := diff.Resources[len(diff.Resources)-1]
+	assert.Equal(t, PlanActionDelete, deleted.Action, "check the deleted consumer")
+	assert.Equal(t, "legacy", deleted.Name, "check the deleted consumer")
+	assert.Equal(t, []FieldDiff{
+		{Path: "labels", Operation: DiffOperationRemove, Old: []interface{}{"managed"}},
+		{Path: "name", Operation: DiffOperationRemove, Old: "legacy"},
+	}, deleted.Fields, "check the deleted fields")
+}
@@ -0,0 +1,287 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CertificateSourceFunc returns the PEM blocks of the certificate, as API7 Cloud
+// only returns the certificate metadata. A nil CertificateSpec means the PEM
+// blocks are unavailable.
+type CertificateSourceFunc func(ctx context.Context, cert *CertificateDetails) (*CertificateSpec, error)
+
+// ExportOptions contains some options for exporting a cluster.
+type ExportOptions struct {
+	// Format is the output format, ManifestFormatYAML is used if it's empty.
+	Format ManifestFormat
+	// Secrets determines how the secrets are exported, they're excluded by default.
+	// Applying the exported manifests back is safe with any policy:
+	//   - With ExportSecretsExclude, the absent or empty secrets keep the live
+	//     values of the existing resources, so a secret can't be cleared by a
+	//     Manifest. The Certificates without the private keys can't be
+	//     created or updated.
+	//   - With ExportSecretsEncrypt, the Manifest is rejected by PlanManifest
+	//     and Apply until it's decrypted by DecryptManifest.
+	Secrets ExportSecretPolicy
+	// EncryptionKey is the AES key (16, 24 or 32 bytes) to encrypt the secrets,
+	// it's required if Secrets is ExportSecretsEncrypt.
+	EncryptionKey []byte
+	// CertificateSource fills the PEM blocks of the exported Certificates. If
+	// it's nil, the Certificates are exported without the PEM blocks, which
+	// should be filled before applying the manifests.
+	CertificateSource CertificateSourceFunc
+}
+
+// exportCertificateName returns the base name of the exported certificate,
+// which is the first SNI (or "certificate" if there is no SNI), prefixed
+// by "client-" for the client certificates.
+func exportCertificateName(cert *CertificateDetails) string {
+	name := "certificate"
+	if len(cert.SNIs) > 0 {
+		snis := make([]string, 0, len(cert.SNIs))
+		for _, sni := range cert.SNIs {
+			snis = append(snis, strings.ToLower(sni))
+		}
+		sort.Strings(snis)
+		name = snis[0]
+	}
+	if cert.Type == string(ClientCertificate) {
+		name = "client-" + name
+	}
+	return name
+}
+
+// checkExportedNames returns an error if the sorted `names` have duplicates,
+// as the resources are referenced by name in the manifests.
+func checkExportedNames(kind ManifestKind, names []string) error {
+	for i := 1; i < len(names); i++ {
+		if names[i] == names[i-1] {
+			return fmt.Errorf("found multiple %s named %s", kind, names[i])
+		}
+	}
+	return nil
+}
+
+// exportManifest converts the resources in the cluster to the Manifest, the IDs
+// are replaced with the name references, and the resources are sorted by name.
+func (impl *manifestImpl) exportManifest(ctx context.Context, clusterID ID, source CertificateSourceFunc) (*Manifest, error) {
+	cluster, err := impl.clusters.GetCluster(ctx, clusterID, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "get cluster")
+	}
+	live, err := impl.fetchLiveState(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := cluster.Settings
+	m := &Manifest{
+		Cluster: &ManifestCluster{
+			Name:     cluster.Name,
+			Settings: &settings,
+			Plugins:  cluster.Plugins,
+		},
+	}
+
+	certs := make([]*CertificateDetails, len(live.certificates))
+	copy(certs, live.certificates)
+	sort.Slice(certs, func(i, j int) bool {
+		a, b := certs[i], certs[j]
+		if ka, kb := certificateIdentity(a.Type, a.SNIs), certificateIdentity(b.Type, b.SNIs); ka != kb {
+			return ka < kb
+		}
+		return a.SerialNumber < b.SerialNumber
+	})
+	certNames := make(map[ID]string)
+	usedCertNames := make(map[string]int)
+	for _, cert := range certs {
+		name := exportCertificateName(cert)
+		usedCertNames[name]++
+		if n := usedCertNames[name]; n > 1 {
+			name = fmt.Sprintf("%s-%d", name, n)
+		}
+		certNames[cert.ID] = name
+
+		spec := CertificateSpec{
+			Type:   CertificateType(cert.Type),
+			Labels: cert.Labels,
+		}
+		if source != nil {
+			pem, err := source(ctx, cert)
+			if err != nil {
+				return nil, errors.Wrapf(err, "get certificate %s", name)
+			}
+			if pem != nil {
+				spec.Certificate = pem.Certificate
+				spec.PrivateKey = pem.PrivateKey
+				spec.CACertificate = pem.CACertificate
+			}
+		}
+		m.Certificates = append(m.Certificates, &ManifestCertificate{
+			Name:        name,
+			Certificate: Certificate{CertificateSpec: spec},
+		})
+	}
+	sort.Slice(m.Certificates, func(i, j int) bool {
+		return m.Certificates[i].Name < m.Certificates[j].Name
+	})
+
+	registryNames := make(map[ID]string)
+	var names []string
+	for _, registry := range live.serviceRegistries {
+		registryNames[registry.ID] = registry.Name
+		names = append(names, registry.Name)
+		m.ServiceRegistries = append(m.ServiceRegistries, &ServiceRegistry{ServiceRegistrySpec: registry.ServiceRegistrySpec})
+	}
+	sort.Slice(m.ServiceRegistries, func(i, j int) bool {
+		return m.ServiceRegistries[i].Name < m.ServiceRegistries[j].Name
+	})
+	sort.Strings(names)
+	if err = checkExportedNames(ManifestKindServiceRegistry, names); err != nil {
+		return nil, err
+	}
+
+	names = nil
+	for _, lc := range live.logCollections {
+		exported := *lc
+		exported.ID = 0
+		names = append(names, lc.Name)
+		m.LogCollections = append(m.LogCollections, &exported)
+	}
+	sort.Slice(m.LogCollections, func(i, j int) bool {
+		return m.LogCollections[i].Name < m.LogCollections[j].Name
+	})
+	sort.Strings(names)
+	if err = checkExportedNames(ManifestKindLogCollection, names); err != nil {
+		return nil, err
+	}
+
+	names = nil
+	for _, consumer := range live.consumers {
+		exported := *consumer
+		exported.ID = 0
+		names = append(names, consumer.Name)
+		m.Consumers = append(m.Consumers, &exported)
+	}
+	sort.Slice(m.Consumers, func(i, j int) bool {
+		return m.Consumers[i].Name < m.Consumers[j].Name
+	})
+	sort.Strings(names)
+	if err = checkExportedNames(ManifestKindConsumer, names); err != nil {
+		return nil, err
+	}
+
+	names = nil
+	for _, app := range live.applications {
+		exported, err := exportApplication(app, certNames, registryNames)
+		if err != nil {
+			return nil, err
+		}
+		for _, api := range live.apis[app.ID] {
+			exported.APIs = append(exported.APIs, &API{APISpec: api.APISpec})
+		}
+		sort.Slice(exported.APIs, func(i, j int) bool {
+			return exported.APIs[i].Name < exported.APIs[j].Name
+		})
+		for _, cr := range live.canaryReleases[app.ID] {
+			exported.CanaryReleases = append(exported.CanaryReleases, &CanaryRelease{CanaryReleaseSpec: cr.CanaryReleaseSpec})
+		}
+		sort.Slice(exported.CanaryReleases, func(i, j int) bool {
+			return exported.CanaryReleases[i].Name < exported.CanaryReleases[j].Name
+		})
+		names = append(names, app.Name)
+		m.Applications = append(m.Applications, exported)
+	}
+	sort.Slice(m.Applications, func(i, j int) bool {
+		return m.Applications[i].Name < m.Applications[j].Name
+	})
+	sort.Strings(names)
+	if err = checkExportedNames(ManifestKindApplication, names); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// exportApplication replaces the client certificate and service registry IDs in
+// the upstreams with the UpstreamReferences.
+func exportApplication(app *Application, certNames, registryNames map[ID]string) (*ManifestApplication, error) {
+	exported := &ManifestApplication{
+		Application: Application{ApplicationSpec: app.ApplicationSpec},
+	}
+	exported.Upstreams = make([]UpstreamAndVersion, len(app.Upstreams))
+	copy(exported.Upstreams, app.Upstreams)
+
+	for i := range exported.Upstreams {
+		uv := &exported.Upstreams[i]
+		ref := ManifestUpstreamReference{Version: uv.Version}
+		certID := uv.Upstream.ClientCertID
+		if certID == 0 {
+			certID = uv.ClientCertID
+		}
+		if certID != 0 {
+			name, ok := certNames[certID]
+			if !ok {
+				return nil, fmt.Errorf("application %s references unknown certificate %s", app.Name, certID)
+			}
+			ref.ClientCertificate = name
+			uv.ClientCertID = 0
+			uv.Upstream.ClientCertID = 0
+		}
+		if sd := uv.Upstream.ServiceDiscovery; sd != nil && sd.ServiceRegistryID != 0 {
+			name, ok := registryNames[sd.ServiceRegistryID]
+			if !ok {
+				return nil, fmt.Errorf("application %s references unknown service registry %s", app.Name, sd.ServiceRegistryID)
+			}
+			ref.ServiceRegistry = name
+			copied := *sd
+			copied.ServiceRegistryID = 0
+			uv.Upstream.ServiceDiscovery = &copied
+		}
+		if ref.ClientCertificate != "" || ref.ServiceRegistry != "" {
+			exported.UpstreamReferences = append(exported.UpstreamReferences, ref)
+		}
+	}
+	return exported, nil
+}
+
+// ExportCluster implements ManifestInterface.
+func (impl *manifestImpl) ExportCluster(ctx context.Context, clusterID ID, w io.Writer, opts *ExportOptions) error {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	// Check the secret options before fetching the resources.
+	if err := protectManifestSecrets(nil, opts.Secrets, opts.EncryptionKey); err != nil {
+		return errors.Wrap(err, "export cluster")
+	}
+	m, err := impl.exportManifest(ctx, clusterID, opts.CertificateSource)
+	if err != nil {
+		return errors.Wrap(err, "export cluster")
+	}
+	docs, err := m.Documents()
+	if err != nil {
+		return errors.Wrap(err, "export cluster")
+	}
+	if err = protectManifestSecrets(docs, opts.Secrets, opts.EncryptionKey); err != nil {
+		return errors.Wrap(err, "export cluster")
+	}
+	return WriteManifestDocuments(w, docs, opts.Format)
+}
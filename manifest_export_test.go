@@ -0,0 +1,260 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCluster(cli *memoryHTTPClient, id ID, name string, settings ClusterSettings, plugins Plugins) {
+	cli.put("/clusters", id, &Cluster{
+		Name: name,
+		ClusterSpec: ClusterSpec{
+			Settings: settings,
+			Plugins:  plugins,
+		},
+	})
+}
+
+// testCertificateSource returns the PEM blocks of the certificates in the Manifest.
+func testCertificateSource(t *testing.T, m *Manifest) CertificateSourceFunc {
+	pems := make(map[string]*CertificateSpec)
+	for _, cert := range m.Certificates {
+		view, err := desiredCertificateView(&cert.CertificateSpec)
+		assert.Nil(t, err, "parse certificate %s", cert.Name)
+		pems[view.SerialNumber] = &cert.CertificateSpec
+	}
+	return func(_ context.Context, cert *CertificateDetails) (*CertificateSpec, error) {
+		return pems[cert.SerialNumber], nil
+	}
+}
+
+func TestExportCluster(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	desired := newTestManifest(t, ca)
+	assert.Nil(t, desired.Consumers[0].SetCredential(&KeyAuthCredential{Key: "jack-key"}), "set credential")
+
+	cli := newMemoryHTTPClient()
+	impl := newManifest(cli)
+	newTestCluster(cli, 1, "staging",
+		ClusterSettings{ClientSettings: ClientSettings{MaximumRequestBodySize: 1024}},
+		Plugins{"cors": map[string]interface{}{"allow_origins": "*"}},
+	)
+	_, err = impl.Apply(context.Background(), 1, desired, nil)
+	assert.Nil(t, err, "check the apply error")
+
+	opts := &ExportOptions{
+		Secrets:           ExportSecretsPlaintext,
+		CertificateSource: testCertificateSource(t, desired),
+	}
+	var first, second bytes.Buffer
+	assert.Nil(t, impl.ExportCluster(context.Background(), 1, &first, opts), "export the cluster")
+	assert.Nil(t, impl.ExportCluster(context.Background(), 1, &second, opts), "export the cluster again")
+	assert.Equal(t, first.String(), second.String(), "check the output is deterministic")
+	assert.NotContains(t, first.String(), "cluster_id", "check the server-managed fields are dropped")
+
+	exported, err := LoadManifest(&first)
+	assert.Nil(t, err, "load the exported manifest")
+	assert.Equal(t, "staging", exported.Cluster.Name, "check the cluster name")
+	assert.Equal(t, uint64(1024), exported.Cluster.Settings.ClientSettings.MaximumRequestBodySize, "check the cluster settings")
+	assert.Contains(t, exported.Cluster.Plugins, "cors", "check the cluster plugins")
+	assert.Len(t, exported.Certificates, 2, "check the certificates")
+	clientCert := exported.Certificates[0]
+	if clientCert.Type != ClientCertificate {
+		clientCert = exported.Certificates[1]
+	}
+	assert.True(t, exported.Certificates[0].Name < exported.Certificates[1].Name, "check the certificates are sorted")
+
+	app := exported.Applications[0]
+	assert.Equal(t, []ManifestUpstreamReference{
+		{Version: "v1", ClientCertificate: clientCert.Name},
+		{Version: "v2", ServiceRegistry: "dns"},
+	}, app.UpstreamReferences, "check the IDs are replaced by the references")
+	assert.Zero(t, app.Upstreams[0].Upstream.ClientCertID, "check the client certificate id is dropped")
+	assert.Zero(t, app.Upstreams[1].Upstream.ServiceDiscovery.ServiceRegistryID, "check the service registry id is dropped")
+	assert.Len(t, app.APIs, 1, "check the apis")
+	assert.Len(t, app.CanaryReleases, 1, "check the canary releases")
+
+	plan, err := impl.PlanManifest(context.Background(), 1, exported, nil)
+	assert.Nil(t, err, "plan the exported manifest")
+	assert.False(t, plan.HasChanges(), "check the exported manifest matches the cluster")
+
+	// Restore the manifest to another cluster.
+	newTestCluster(cli, 2, "production", ClusterSettings{}, nil)
+	cli.calls = nil
+	_, err = impl.Apply(context.Background(), 2, exported, nil)
+	assert.Nil(t, err, "apply the exported manifest to another cluster")
+	assert.Contains(t, cli.calls, "PATCH "+_apiPathPrefix+"/clusters/2/config", "check the cluster settings are applied")
+	assert.Contains(t, cli.calls, "PATCH "+_apiPathPrefix+"/clusters/2/plugins", "check the cluster plugins are applied")
+	plan, err = impl.PlanManifest(context.Background(), 2, exported, nil)
+	assert.Nil(t, err, "plan the exported manifest")
+	assert.False(t, plan.HasChanges(), "check the restored cluster matches the manifest")
+}
+
+func TestExportClusterSecrets(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	desired := newTestManifest(t, ca)
+	assert.Nil(t, desired.Consumers[0].SetCredential(&KeyAuthCredential{Key: "jack-key"}), "set credential")
+	desired.LogCollections[0].Spec.(*HTTPLoggerSpec).AuthHeader = "Bearer token"
+
+	cli := newMemoryHTTPClient()
+	impl := newManifest(cli)
+	newTestCluster(cli, 1, "staging", ClusterSettings{}, nil)
+	_, err = impl.Apply(context.Background(), 1, desired, nil)
+	assert.Nil(t, err, "check the apply error")
+	key := bytes.Repeat([]byte{7}, 32)
+
+	testCases := []struct {
+		name          string
+		opts          *ExportOptions
+		secretsFound  bool
+		encrypted     bool
+		expectedError string
+	}{
+		{
+			name: "exclude by default",
+			opts: &ExportOptions{},
+		},
+		{
+			name:         "plaintext",
+			opts:         &ExportOptions{Secrets: ExportSecretsPlaintext},
+			secretsFound: true,
+		},
+		{
+			name:      "encrypt",
+			opts:      &ExportOptions{Secrets: ExportSecretsEncrypt, EncryptionKey: key},
+			encrypted: true,
+		},
+		{
+			name:          "encrypt without key",
+			opts:          &ExportOptions{Secrets: ExportSecretsEncrypt},
+			expectedError: "encryption key is required to encrypt secrets",
+		},
+		{
+			name:          "invalid key",
+			opts:          &ExportOptions{Secrets: ExportSecretsEncrypt, EncryptionKey: []byte("short")},
+			expectedError: "encryption key: crypto/aes: invalid key size 5",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := tc.opts
+			if opts != nil {
+				opts.CertificateSource = testCertificateSource(t, desired)
+			}
+			var buf bytes.Buffer
+			err := impl.ExportCluster(context.Background(), 1, &buf, opts)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "export the cluster")
+			for _, secret := range []string{"jack-key", "Bearer token", "PRIVATE KEY"} {
+				assert.Equal(t, tc.secretsFound, bytes.Contains(buf.Bytes(), []byte(secret)), "check the secret %s", secret)
+			}
+			assert.Equal(t, tc.encrypted, bytes.Contains(buf.Bytes(), []byte(_manifestSecretPrefix)), "check the encrypted secrets")
+
+			exported, err := LoadManifest(&buf)
+			assert.Nil(t, err, "load the exported manifest")
+			plan, err := impl.PlanManifest(context.Background(), 1, exported, nil)
+			if !tc.encrypted {
+				// The excluded secrets keep the live values.
+				assert.Nil(t, err, "plan the exported manifest")
+				assert.False(t, plan.HasChanges(), "check the exported manifest matches the cluster")
+				return
+			}
+			assert.Contains(t, err.Error(), "Certificate api7.local: private_key is encrypted, decrypt the manifest by DecryptManifest first",
+				"check the encrypted manifest can't be applied")
+
+			_, err = DecryptManifest(exported, bytes.Repeat([]byte{8}, 32))
+			assert.Contains(t, err.Error(), "incorrect encryption key", "check the wrong key")
+
+			decrypted, err := DecryptManifest(exported, key)
+			assert.Nil(t, err, "decrypt the manifest")
+			var cred KeyAuthCredential
+			found, err := decrypted.Consumers[0].GetCredential(&cred)
+			assert.True(t, found, "check the credential")
+			assert.Nil(t, err, "decode the credential")
+			assert.Equal(t, "jack-key", cred.Key, "check the decrypted credential")
+			assert.Equal(t, "Bearer token", decrypted.LogCollections[0].Spec.(*HTTPLoggerSpec).AuthHeader, "check the decrypted log collection")
+			plan, err = impl.PlanManifest(context.Background(), 1, decrypted, nil)
+			assert.Nil(t, err, "plan the decrypted manifest")
+			assert.False(t, plan.HasChanges(), "check the decrypted manifest matches the cluster")
+		})
+	}
+}
+
+func TestExportClusterErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		seed          func(cli *memoryHTTPClient)
+		expectedError string
+	}{
+		{
+			name: "unknown certificate",
+			seed: func(cli *memoryHTTPClient) {
+				cli.seed("/clusters/1/apps", &Application{ApplicationSpec: ApplicationSpec{
+					Name:      "web",
+					Upstreams: []UpstreamAndVersion{{Version: "v1", Upstream: Upstream{ClientCertID: 99}}},
+				}})
+			},
+			expectedError: "application web references unknown certificate 99",
+		},
+		{
+			name: "duplicated names",
+			seed: func(cli *memoryHTTPClient) {
+				cli.seed("/clusters/1/consumers", &Consumer{Name: "jack"})
+				cli.seed("/clusters/1/consumers", &Consumer{Name: "jack"})
+			},
+			expectedError: "found multiple Consumer named jack",
+		},
+		{
+			name:          "unknown cluster",
+			expectedError: "get cluster",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := newMemoryHTTPClient()
+			if tc.seed != nil {
+				newTestCluster(cli, 1, "staging", ClusterSettings{}, nil)
+				tc.seed(cli)
+			}
+			var buf bytes.Buffer
+			err := newManifest(cli).ExportCluster(context.Background(), 1, &buf, nil)
+			assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+		})
+	}
+}
@@ -0,0 +1,482 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestAPIVersion is the API version of the manifest documents.
+const ManifestAPIVersion = "cloud.api7.ai/v1"
+
+// ManifestFormat is the encoding format of the manifest documents.
+type ManifestFormat string
+
+const (
+	// ManifestFormatYAML encodes the documents to a multi-document YAML stream.
+	ManifestFormatYAML ManifestFormat = "yaml"
+	// ManifestFormatJSON encodes the documents to a stream of JSON objects.
+	ManifestFormatJSON ManifestFormat = "json"
+)
+
+// ManifestMetadata is the metadata of a manifest document.
+type ManifestMetadata struct {
+	// Name is the name of the resource, it's unique among the resources of the
+	// same kind (and the same application for APIs and CanaryReleases).
+	Name string `json:"name"`
+	// Application is the name of the application which the API or
+	// CanaryRelease belongs to.
+	Application string `json:"application,omitempty"`
+}
+
+// ManifestDocument is the file representation of a resource, e.g.,
+//
+//	apiVersion: cloud.api7.ai/v1
+//	kind: API
+//	metadata:
+//	  name: users
+//	  application: web
+//	spec:
+//	  methods: ["GET"]
+//
+// The spec is the JSON encoding of the resource specification (e.g., APISpec),
+// without the id and name fields. Resources are referenced by name instead
+// of id, see ManifestUpstreamReference.
+type ManifestDocument struct {
+	// APIVersion should be ManifestAPIVersion.
+	APIVersion string `json:"apiVersion"`
+	// Kind is the resource kind.
+	Kind ManifestKind `json:"kind"`
+	// Metadata is the resource metadata.
+	Metadata ManifestMetadata `json:"metadata"`
+	// Spec is the resource specification.
+	Spec json.RawMessage `json:"spec"`
+}
+
+// applicationManifestSpec is the spec of the Application document.
+type applicationManifestSpec struct {
+	ApplicationSpec `json:",inline"`
+
+	// UpstreamReferences reference the Certificates and ServiceRegistries by name.
+	UpstreamReferences []ManifestUpstreamReference `json:"upstream_references,omitempty"`
+}
+
+// ParseManifestDocuments parses the manifest documents from either a multi-document
+// YAML stream or a stream of JSON objects (or arrays of objects). The documents
+// are validated against the manifest schema (see ManifestJSONSchema).
+func ParseManifestDocuments(data []byte) ([]*ManifestDocument, error) {
+	var values []interface{}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		for {
+			var value interface{}
+			if err := decoder.Decode(&value); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, errors.Wrap(err, "decode json")
+			}
+			if items, ok := value.([]interface{}); ok {
+				values = append(values, items...)
+			} else {
+				values = append(values, value)
+			}
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var value interface{}
+			if err := decoder.Decode(&value); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, errors.Wrap(err, "decode yaml")
+			}
+			if value != nil {
+				values = append(values, value)
+			}
+		}
+	}
+
+	docs := make([]*ManifestDocument, 0, len(values))
+	for i, value := range values {
+		doc, err := parseManifestDocument(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "document %d", i+1)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func parseManifestDocument(value interface{}) (*ManifestDocument, error) {
+	// Normalize the YAML values (e.g., integers) to the JSON ones.
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	if err = json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	object, ok := normalized.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("document should be an object")
+	}
+	kind, _ := object["kind"].(string)
+	if _, ok = _manifestSpecTypes[ManifestKind(kind)]; !ok {
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+
+	validator, err := manifestDocumentValidator(ManifestKind(kind))
+	if err != nil {
+		return nil, err
+	}
+	if violations := validator.validate(normalized, ""); len(violations) > 0 {
+		messages := make([]string, 0, len(violations))
+		for _, v := range violations {
+			v.Path = strings.TrimPrefix(v.Path, ".")
+			if v.Path == "" {
+				messages = append(messages, v.Message)
+			} else {
+				messages = append(messages, v.String())
+			}
+		}
+		return nil, fmt.Errorf("invalid %s: %s", kind, strings.Join(messages, "; "))
+	}
+
+	var doc ManifestDocument
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// NewManifestFromDocuments assembles the Manifest from the documents, APIs and
+// CanaryReleases are attached to their Applications.
+func NewManifestFromDocuments(docs []*ManifestDocument) (*Manifest, error) {
+	var (
+		manifest = &Manifest{}
+		apps     = make(map[string]*ManifestApplication)
+		children []*ManifestDocument
+		seen     = make(map[string]struct{})
+	)
+	for _, doc := range docs {
+		key := fmt.Sprintf("%s/%s/%s", doc.Kind, doc.Metadata.Application, doc.Metadata.Name)
+		if _, ok := seen[key]; ok {
+			return nil, fmt.Errorf("duplicated %s %s", doc.Kind, manifestDocumentName(doc))
+		}
+		seen[key] = struct{}{}
+
+		name := doc.Metadata.Name
+		var err error
+		switch doc.Kind {
+		case ManifestKindApplication:
+			var spec applicationManifestSpec
+			if err = json.Unmarshal(doc.Spec, &spec); err == nil {
+				app := &ManifestApplication{
+					Application:        Application{ApplicationSpec: spec.ApplicationSpec},
+					UpstreamReferences: spec.UpstreamReferences,
+				}
+				app.Name = name
+				apps[name] = app
+				manifest.Applications = append(manifest.Applications, app)
+			}
+		case ManifestKindAPI, ManifestKindCanaryRelease:
+			children = append(children, doc)
+		case ManifestKindConsumer:
+			consumer := &Consumer{}
+			if err = json.Unmarshal(doc.Spec, consumer); err == nil {
+				consumer.Name = name
+				manifest.Consumers = append(manifest.Consumers, consumer)
+			}
+		case ManifestKindCertificate:
+			cert := &ManifestCertificate{Name: name}
+			if err = json.Unmarshal(doc.Spec, &cert.CertificateSpec); err == nil {
+				manifest.Certificates = append(manifest.Certificates, cert)
+			}
+		case ManifestKindLogCollection:
+			lc := &LogCollection{}
+			if err = json.Unmarshal(doc.Spec, lc); err == nil {
+				lc.Name = name
+				manifest.LogCollections = append(manifest.LogCollections, lc)
+			}
+		case ManifestKindCluster:
+			if manifest.Cluster != nil {
+				return nil, fmt.Errorf("duplicated %s %s", doc.Kind, name)
+			}
+			cluster := &ManifestCluster{}
+			if err = json.Unmarshal(doc.Spec, cluster); err == nil {
+				cluster.Name = name
+				manifest.Cluster = cluster
+			}
+		case ManifestKindServiceRegistry:
+			registry := &ServiceRegistry{}
+			if err = json.Unmarshal(doc.Spec, &registry.ServiceRegistrySpec); err == nil {
+				registry.Name = name
+				manifest.ServiceRegistries = append(manifest.ServiceRegistries, registry)
+			}
+		default:
+			err = fmt.Errorf("unknown kind %q", doc.Kind)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode %s %s", doc.Kind, manifestDocumentName(doc))
+		}
+	}
+
+	for _, doc := range children {
+		app, ok := apps[doc.Metadata.Application]
+		if !ok {
+			return nil, fmt.Errorf("%s %s references unknown application %s", doc.Kind, doc.Metadata.Name, doc.Metadata.Application)
+		}
+		var err error
+		if doc.Kind == ManifestKindAPI {
+			api := &API{}
+			if err = json.Unmarshal(doc.Spec, &api.APISpec); err == nil {
+				api.Name = doc.Metadata.Name
+				app.APIs = append(app.APIs, api)
+			}
+		} else {
+			cr := &CanaryRelease{}
+			if err = json.Unmarshal(doc.Spec, &cr.CanaryReleaseSpec); err == nil {
+				cr.Name = doc.Metadata.Name
+				app.CanaryReleases = append(app.CanaryReleases, cr)
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode %s %s", doc.Kind, manifestDocumentName(doc))
+		}
+	}
+	return manifest, nil
+}
+
+func manifestDocumentName(doc *ManifestDocument) string {
+	if doc.Metadata.Application != "" {
+		return doc.Metadata.Application + "/" + doc.Metadata.Name
+	}
+	return doc.Metadata.Name
+}
+
+// LoadManifest loads the Manifest from the reader, see ParseManifestDocuments
+// for the supported formats.
+func LoadManifest(r io.Reader) (*Manifest, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read manifest")
+	}
+	docs, err := ParseManifestDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewManifestFromDocuments(docs)
+}
+
+// LoadManifestFile loads the Manifest from a file.
+func LoadManifestFile(filename string) (*Manifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := ParseManifestDocuments(data)
+	if err != nil {
+		return nil, errors.Wrap(err, filename)
+	}
+	return NewManifestFromDocuments(docs)
+}
+
+// LoadManifestDir loads the Manifest from the .yaml, .yml and .json files in the
+// directory (and its sub-directories, except the hidden ones) in lexical order.
+// Documents can reference the resources in other files.
+func LoadManifestDir(dir string) (*Manifest, error) {
+	var docs []*ManifestDocument
+	err := filepath.WalkDir(dir, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if filename != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		fileDocs, err := ParseManifestDocuments(data)
+		if err != nil {
+			return errors.Wrap(err, filename)
+		}
+		docs = append(docs, fileDocs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewManifestFromDocuments(docs)
+}
+
+// encodeManifestSpec encodes the resource specification without the omitted fields.
+func encodeManifestSpec(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, field := range _manifestSpecOmittedFields {
+		delete(fields, field)
+	}
+	return json.Marshal(fields)
+}
+
+func newManifestDocument(kind ManifestKind, metadata ManifestMetadata, spec interface{}) (*ManifestDocument, error) {
+	data, err := encodeManifestSpec(spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encode %s %s", kind, metadata.Name)
+	}
+	return &ManifestDocument{
+		APIVersion: ManifestAPIVersion,
+		Kind:       kind,
+		Metadata:   metadata,
+		Spec:       data,
+	}, nil
+}
+
+// Documents converts the Manifest to the documents, in the order of Cluster,
+// Certificates, ServiceRegistries, LogCollections, Consumers and Applications
+// (each followed by its APIs and CanaryReleases).
+func (m *Manifest) Documents() ([]*ManifestDocument, error) {
+	var docs []*ManifestDocument
+	add := func(kind ManifestKind, metadata ManifestMetadata, spec interface{}) error {
+		doc, err := newManifestDocument(kind, metadata, spec)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+		return nil
+	}
+
+	if m.Cluster != nil {
+		if err := add(ManifestKindCluster, ManifestMetadata{Name: m.Cluster.Name}, m.Cluster); err != nil {
+			return nil, err
+		}
+	}
+	for _, cert := range m.Certificates {
+		if err := add(ManifestKindCertificate, ManifestMetadata{Name: cert.Name}, &cert.CertificateSpec); err != nil {
+			return nil, err
+		}
+	}
+	for _, registry := range m.ServiceRegistries {
+		if err := add(ManifestKindServiceRegistry, ManifestMetadata{Name: registry.Name}, &registry.ServiceRegistrySpec); err != nil {
+			return nil, err
+		}
+	}
+	for _, lc := range m.LogCollections {
+		if err := add(ManifestKindLogCollection, ManifestMetadata{Name: lc.Name}, lc); err != nil {
+			return nil, err
+		}
+	}
+	for _, consumer := range m.Consumers {
+		if err := add(ManifestKindConsumer, ManifestMetadata{Name: consumer.Name}, consumer); err != nil {
+			return nil, err
+		}
+	}
+	for _, app := range m.Applications {
+		spec := &applicationManifestSpec{
+			ApplicationSpec:    app.ApplicationSpec,
+			UpstreamReferences: app.UpstreamReferences,
+		}
+		if err := add(ManifestKindApplication, ManifestMetadata{Name: app.Name}, spec); err != nil {
+			return nil, err
+		}
+		for _, api := range app.APIs {
+			if err := add(ManifestKindAPI, ManifestMetadata{Name: api.Name, Application: app.Name}, &api.APISpec); err != nil {
+				return nil, err
+			}
+		}
+		for _, cr := range app.CanaryReleases {
+			if err := add(ManifestKindCanaryRelease, ManifestMetadata{Name: cr.Name, Application: app.Name}, &cr.CanaryReleaseSpec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return docs, nil
+}
+
+// WriteManifestDocuments writes the documents in the `format`.
+func WriteManifestDocuments(w io.Writer, docs []*ManifestDocument, format ManifestFormat) error {
+	for i, doc := range docs {
+		var (
+			data []byte
+			err  error
+		)
+		switch format {
+		case ManifestFormatJSON:
+			data, err = json.MarshalIndent(doc, "", "  ")
+			data = append(data, '\n')
+		case ManifestFormatYAML, "":
+			var (
+				value interface{}
+				buf   bytes.Buffer
+			)
+			if i > 0 {
+				buf.WriteString("---\n")
+			}
+			if err = decodeTypedValue(doc, &value); err == nil {
+				encoder := yaml.NewEncoder(&buf)
+				encoder.SetIndent(2)
+				if err = encoder.Encode(value); err == nil {
+					err = encoder.Close()
+				}
+			}
+			data = buf.Bytes()
+		default:
+			return fmt.Errorf("unknown manifest format %s", format)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "encode %s %s", doc.Kind, manifestDocumentName(doc))
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteManifest writes the Manifest in the `format`, the output can be loaded by LoadManifest.
+func WriteManifest(w io.Writer, m *Manifest, format ManifestFormat) error {
+	docs, err := m.Documents()
+	if err != nil {
+		return err
+	}
+	return WriteManifestDocuments(w, docs, format)
+}
@@ -0,0 +1,264 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const _testManifestYAML = `
+apiVersion: cloud.api7.ai/v1
+kind: ServiceRegistry
+metadata:
+  name: dns
+spec:
+  enabled: true
+  type: dns
+  dns:
+    servers: ["127.0.0.1:53"]
+---
+apiVersion: cloud.api7.ai/v1
+kind: API
+metadata:
+  name: users
+  application: web
+spec:
+  methods: [GET]
+  paths:
+  - path: /users
+    path_type: Prefix
+---
+# The application is declared after its API.
+apiVersion: cloud.api7.ai/v1
+kind: Application
+metadata:
+  name: web
+spec:
+  labels: [managed]
+  path_prefix: /web
+  hosts: [api7.local]
+  upstreams:
+  - version: v1
+    upstream:
+      scheme: http
+      service_discovery:
+        service_registry: dns
+        dns_service:
+          service_name: web.svc
+  default_upstream_version: v1
+  upstream_references:
+  - version: v1
+    service_registry: dns
+---
+apiVersion: cloud.api7.ai/v1
+kind: LogCollection
+metadata:
+  name: http-logger
+spec:
+  type: http-logger
+  spec:
+    uri: http://logs.api7.local
+    timeout: 3
+---
+`
+
+func TestLoadManifest(t *testing.T) {
+	t.Parallel()
+
+	m, err := LoadManifest(strings.NewReader(_testManifestYAML))
+	assert.Nil(t, err, "check the load error")
+
+	assert.Len(t, m.ServiceRegistries, 1, "check the service registries")
+	assert.Equal(t, "dns", m.ServiceRegistries[0].Name, "check the service registry name")
+	assert.Equal(t, ServiceRegistryDNS, m.ServiceRegistries[0].Type, "check the service registry type")
+
+	assert.Len(t, m.Applications, 1, "check the applications")
+	app := m.Applications[0]
+	assert.Equal(t, "web", app.Name, "check the application name")
+	assert.Equal(t, []ManifestUpstreamReference{{Version: "v1", ServiceRegistry: "dns"}}, app.UpstreamReferences, "check the upstream references")
+	assert.Equal(t, "web.svc", app.Upstreams[0].Upstream.ServiceDiscovery.DNSService.ServiceName, "check the upstream")
+	assert.Len(t, app.APIs, 1, "check the apis")
+	assert.Equal(t, "users", app.APIs[0].Name, "check the api name")
+	assert.Equal(t, []string{"GET"}, app.APIs[0].Methods, "check the api methods")
+
+	assert.Len(t, m.LogCollections, 1, "check the log collections")
+	spec, ok := m.LogCollections[0].Spec.(*HTTPLoggerSpec)
+	assert.True(t, ok, "check the log collection spec is typed")
+	assert.Equal(t, 3, spec.Timeout, "check the log collection spec")
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		manifest      string
+		expectedError string
+	}{
+		{
+			name:          "unknown kind",
+			manifest:      `{"apiVersion": "cloud.api7.ai/v1", "kind": "Route", "metadata": {"name": "r"}, "spec": {}}`,
+			expectedError: `document 1: unknown kind "Route"`,
+		},
+		{
+			name: "unknown field",
+			manifest: `
+apiVersion: cloud.api7.ai/v1
+kind: Application
+metadata:
+  name: web
+spec:
+  hostz: [api7.local]
+`,
+			expectedError: "document 1: invalid Application: spec.hostz: is not allowed",
+		},
+		{
+			name: "id should be a string",
+			manifest: `
+apiVersion: cloud.api7.ai/v1
+kind: Application
+metadata:
+  name: web
+spec:
+  upstreams:
+  - upstream:
+      client_cert_id: 5
+`,
+			expectedError: "spec.upstreams[0].upstream.client_cert_id: should be string",
+		},
+		{
+			name: "missing name and api version",
+			manifest: `
+kind: Consumer
+metadata: {}
+spec: {}
+`,
+			expectedError: "invalid Consumer: apiVersion: is required; metadata.name: is required",
+		},
+		{
+			name: "unknown application",
+			manifest: `
+apiVersion: cloud.api7.ai/v1
+kind: CanaryRelease
+metadata:
+  name: v2
+  application: web
+spec: {}
+`,
+			expectedError: "CanaryRelease v2 references unknown application web",
+		},
+		{
+			name: "duplicated",
+			manifest: `
+apiVersion: cloud.api7.ai/v1
+kind: Consumer
+metadata:
+  name: jack
+spec: {}
+---
+apiVersion: cloud.api7.ai/v1
+kind: Consumer
+metadata:
+  name: jack
+spec: {}
+`,
+			expectedError: "duplicated Consumer jack",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := LoadManifest(strings.NewReader(tc.manifest))
+			assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+		})
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	m := newTestManifest(t, ca)
+	expected, err := m.Documents()
+	assert.Nil(t, err, "convert the manifest to documents")
+
+	for _, format := range []ManifestFormat{ManifestFormatYAML, ManifestFormatJSON} {
+		var buf bytes.Buffer
+		assert.Nil(t, WriteManifest(&buf, m, format), "write the manifest in %s", format)
+		loaded, err := LoadManifest(&buf)
+		assert.Nil(t, err, "load the manifest in %s", format)
+		docs, err := loaded.Documents()
+		assert.Nil(t, err, "convert the loaded manifest to documents")
+		assert.Equal(t, len(expected), len(docs), "check the documents in %s", format)
+		for i := range expected {
+			assert.JSONEq(t, string(expected[i].Spec), string(docs[i].Spec), "check the %s %s in %s", docs[i].Kind, docs[i].Metadata.Name, format)
+			assert.Equal(t, expected[i].Metadata, docs[i].Metadata, "check the metadata in %s", format)
+		}
+	}
+}
+
+func TestLoadManifestDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"apps/web.yaml": `
+apiVersion: cloud.api7.ai/v1
+kind: Application
+metadata:
+  name: web
+spec: {}
+`,
+		"apps/web-apis.yml": `
+apiVersion: cloud.api7.ai/v1
+kind: API
+metadata:
+  name: users
+  application: web
+spec: {}
+`,
+		"consumers.json": `[
+  {"apiVersion": "cloud.api7.ai/v1", "kind": "Consumer", "metadata": {"name": "jack"}, "spec": {}},
+  {"apiVersion": "cloud.api7.ai/v1", "kind": "Consumer", "metadata": {"name": "rose"}, "spec": {}}
+]`,
+		".git/config.yaml": "invalid: [",
+		"README.md":        "# Manifests",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filename), 0o755), "create directory")
+		assert.Nil(t, os.WriteFile(filename, []byte(content), 0o600), "write file")
+	}
+
+	m, err := LoadManifestDir(dir)
+	assert.Nil(t, err, "check the load error")
+	assert.Len(t, m.Applications, 1, "check the applications")
+	assert.Len(t, m.Applications[0].APIs, 1, "check the apis in another file")
+	assert.Len(t, m.Consumers, 2, "check the consumers")
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("kind: Consumer\n"), 0o600), "write file")
+	_, err = LoadManifestDir(dir)
+	assert.Contains(t, err.Error(), "broken.yaml: document 1: invalid Consumer", "check the error details")
+}
@@ -0,0 +1,1117 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// manifestLiveState contains the live resources in a cluster.
+type manifestLiveState struct {
+	// cluster is only fetched if the cluster configuration is managed.
+	cluster           *Cluster
+	certificates      []*CertificateDetails
+	serviceRegistries []*ServiceRegistry
+	logCollections    []*LogCollection
+	consumers         []*Consumer
+	applications      []*Application
+	// apis and canaryReleases are indexed by the application id.
+	apis           map[ID][]*API
+	canaryReleases map[ID][]*CanaryRelease
+}
+
+// applyState records the ids of the resources which can be referenced by name,
+// an id is zero if the resource will be created but not created yet.
+type applyState struct {
+	cluster           *Cluster
+	certificates      map[string]ID
+	serviceRegistries map[string]ID
+	applications      map[string]ID
+}
+
+func (impl *manifestImpl) fetchLiveState(ctx context.Context, clusterID ID) (*manifestLiveState, error) {
+	cluster := &Cluster{ID: clusterID}
+	live := &manifestLiveState{
+		apis:           make(map[ID][]*API),
+		canaryReleases: make(map[ID][]*CanaryRelease),
+	}
+
+	certIter, err := impl.certificates.ListCertificates(ctx, &ResourceListOptions{Cluster: cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "list certificates")
+	}
+	for {
+		cert, err := certIter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "list certificates")
+		}
+		if cert == nil {
+			break
+		}
+		live.certificates = append(live.certificates, cert)
+	}
+
+	registryIter, err := impl.serviceRegistries.ListServiceRegistries(ctx, &ResourceListOptions{Cluster: cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "list service registries")
+	}
+	for {
+		registry, err := registryIter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "list service registries")
+		}
+		if registry == nil {
+			break
+		}
+		live.serviceRegistries = append(live.serviceRegistries, registry)
+	}
+
+	lcIter, err := impl.logCollections.ListLogCollections(ctx, &ResourceListOptions{Cluster: cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "list log collections")
+	}
+	for {
+		lc, err := lcIter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "list log collections")
+		}
+		if lc == nil {
+			break
+		}
+		live.logCollections = append(live.logCollections, lc)
+	}
+
+	consumerIter, err := impl.consumers.ListConsumers(ctx, &ResourceListOptions{Cluster: cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "list consumers")
+	}
+	for {
+		consumer, err := consumerIter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "list consumers")
+		}
+		if consumer == nil {
+			break
+		}
+		live.consumers = append(live.consumers, consumer)
+	}
+
+	appIter, err := impl.applications.ListApplications(ctx, &ResourceListOptions{Cluster: cluster})
+	if err != nil {
+		return nil, errors.Wrap(err, "list applications")
+	}
+	for {
+		app, err := appIter.Next()
+		if err != nil {
+			return nil, errors.Wrap(err, "list applications")
+		}
+		if app == nil {
+			break
+		}
+		live.applications = append(live.applications, app)
+	}
+
+	for _, app := range live.applications {
+		listOpts := &ResourceListOptions{Cluster: cluster, Application: app}
+		apiIter, err := impl.apis.ListAPIs(ctx, listOpts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list apis of application %s", app.Name)
+		}
+		for {
+			api, err := apiIter.Next()
+			if err != nil {
+				return nil, errors.Wrapf(err, "list apis of application %s", app.Name)
+			}
+			if api == nil {
+				break
+			}
+			live.apis[app.ID] = append(live.apis[app.ID], api)
+		}
+
+		crIter, err := impl.canaryReleases.ListCanaryReleases(ctx, listOpts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list canary releases of application %s", app.Name)
+		}
+		for {
+			cr, err := crIter.Next()
+			if err != nil {
+				return nil, errors.Wrapf(err, "list canary releases of application %s", app.Name)
+			}
+			if cr == nil {
+				break
+			}
+			live.canaryReleases[app.ID] = append(live.canaryReleases[app.ID], cr)
+		}
+	}
+	return live, nil
+}
+
+// certificateIdentity returns the identity of a certificate, which consists
+// of the type and the sorted lowercase SNIs.
+func certificateIdentity(typ string, snis []string) string {
+	if typ == "" {
+		typ = string(ServerCertificate)
+	}
+	names := make([]string, 0, len(snis))
+	for _, sni := range snis {
+		names = append(names, strings.ToLower(sni))
+	}
+	sort.Strings(names)
+	return typ + ":" + strings.Join(names, ",")
+}
+
+// certificateView is the comparable view of a certificate, the PEM blocks
+// are represented by the metadata so that the private keys are not exposed.
+type certificateView struct {
+	Type           string   `json:"type"`
+	SNIs           []string `json:"snis"`
+	SerialNumber   string   `json:"serial_number"`
+	NotAfter       string   `json:"not_after"`
+	CASerialNumber string   `json:"ca_serial_number,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+}
+
+func newCertificateView(typ string, snis []string, serial string, notAfter time.Time, caSerial string, labels []string) *certificateView {
+	if typ == "" {
+		typ = string(ServerCertificate)
+	}
+	names := make([]string, 0, len(snis))
+	for _, sni := range snis {
+		names = append(names, strings.ToLower(sni))
+	}
+	sort.Strings(names)
+	return &certificateView{
+		Type:           typ,
+		SNIs:           names,
+		SerialNumber:   serial,
+		NotAfter:       notAfter.UTC().Format(time.RFC3339),
+		CASerialNumber: caSerial,
+		Labels:         sortedLabels(labels),
+	}
+}
+
+func desiredCertificateView(spec *CertificateSpec) (*certificateView, error) {
+	chain, err := parseCertificateChain(spec.Certificate)
+	if err != nil {
+		return nil, errors.Wrap(err, "certificate")
+	}
+	var caSerial string
+	if spec.CACertificate != "" {
+		caChain, err := parseCertificateChain(spec.CACertificate)
+		if err != nil {
+			return nil, errors.Wrap(err, "CA certificate")
+		}
+		caSerial = caChain[0].SerialNumber.String()
+	}
+	metadata := newCertificateMetadata(chain[0])
+	return newCertificateView(string(spec.Type), metadata.SNIs, metadata.SerialNumber, metadata.NotAfter, caSerial, spec.Labels), nil
+}
+
+func liveCertificateView(details *CertificateDetails) *certificateView {
+	var caSerial string
+	if details.CACertificate != nil {
+		caSerial = details.CACertificate.SerialNumber
+	}
+	return newCertificateView(details.Type, details.SNIs, details.SerialNumber, details.NotAfter, caSerial, details.Labels)
+}
+
+// compare computes the comparable views of the desired and live resources (nil
+// means absent), and settles the action of the matched resource to update or noop.
+func (step *PlanStep) compare(desired, live interface{}) error {
+	var err error
+	if desired != nil {
+		if step.desiredView, err = manifestView(step.Kind, desired); err != nil {
+			return errors.Wrapf(err, "compare %s %s", step.Kind, step.Name)
+		}
+	}
+	if live != nil {
+		if step.liveView, err = manifestView(step.Kind, live); err != nil {
+			return errors.Wrapf(err, "compare %s %s", step.Kind, step.Name)
+		}
+	}
+	if step.Action == PlanActionUpdate && reflect.DeepEqual(step.desiredView, step.liveView) {
+		step.Action = PlanActionNoop
+	}
+	return nil
+}
+
+// hasAllLabels returns whether the `labels` contain all the `expected` labels.
+func hasAllLabels(labels, expected []string) bool {
+	return len(expected) > 0 && matchLabels(labels, expected, MatchAll)
+}
+
+func sortedLabels(labels []string) []string {
+	sorted := append([]string(nil), labels...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// resolveApplication returns a copy of the desired application whose upstream
+// references are replaced by the ids, `pending` is true if some referenced
+// resources are not created yet.
+func resolveApplication(desired *ManifestApplication, state *applyState) (*Application, bool, error) {
+	app := desired.Application
+	app.Upstreams = make([]UpstreamAndVersion, len(desired.Upstreams))
+	copy(app.Upstreams, desired.Upstreams)
+
+	pending := false
+	for _, ref := range desired.UpstreamReferences {
+		var upstream *Upstream
+		for i := range app.Upstreams {
+			if app.Upstreams[i].Version == ref.Version {
+				upstream = &app.Upstreams[i].Upstream
+				break
+			}
+		}
+		if upstream == nil {
+			return nil, false, fmt.Errorf("application %s has no upstream with version %q", desired.Name, ref.Version)
+		}
+		if ref.ClientCertificate != "" {
+			id, ok := state.certificates[ref.ClientCertificate]
+			if !ok {
+				return nil, false, fmt.Errorf("application %s references unknown certificate %q", desired.Name, ref.ClientCertificate)
+			}
+			pending = pending || id == 0
+			upstream.ClientCertID = id
+		}
+		if ref.ServiceRegistry != "" {
+			id, ok := state.serviceRegistries[ref.ServiceRegistry]
+			if !ok {
+				return nil, false, fmt.Errorf("application %s references unknown service registry %q", desired.Name, ref.ServiceRegistry)
+			}
+			pending = pending || id == 0
+			sd := UpstreamServiceDiscovery{}
+			if upstream.ServiceDiscovery != nil {
+				sd = *upstream.ServiceDiscovery
+			}
+			sd.ServiceRegistryID = id
+			upstream.ServiceDiscovery = &sd
+		}
+	}
+	return &app, pending, nil
+}
+
+// manifestPlanner builds the Plan, the steps are collected by kind so that
+// they can be sorted by the dependency order.
+type manifestPlanner struct {
+	impl    *manifestImpl
+	opts    *ApplyOptions
+	live    *manifestLiveState
+	state   *applyState
+	steps   map[ManifestKind][]*PlanStep
+	deletes map[ManifestKind][]*PlanStep
+}
+
+var _manifestKindOrder = []ManifestKind{
+	ManifestKindCluster,
+	ManifestKindCertificate,
+	ManifestKindServiceRegistry,
+	ManifestKindLogCollection,
+	ManifestKindConsumer,
+	ManifestKindApplication,
+	ManifestKindAPI,
+	ManifestKindCanaryRelease,
+}
+
+func (p *manifestPlanner) add(step *PlanStep) {
+	if step.Action == PlanActionDelete {
+		p.deletes[step.Kind] = append(p.deletes[step.Kind], step)
+	} else {
+		p.steps[step.Kind] = append(p.steps[step.Kind], step)
+	}
+}
+
+func (p *manifestPlanner) plan() *Plan {
+	plan := &Plan{}
+	for _, kind := range _manifestKindOrder {
+		plan.Steps = append(plan.Steps, p.steps[kind]...)
+	}
+	for i := len(_manifestKindOrder) - 1; i >= 0; i-- {
+		plan.Steps = append(plan.Steps, p.deletes[_manifestKindOrder[i]]...)
+	}
+	return plan
+}
+
+func (impl *manifestImpl) plan(ctx context.Context, clusterID ID, desired *Manifest, opts *ApplyOptions) (*Plan, *applyState, error) {
+	if opts == nil {
+		opts = &ApplyOptions{}
+	}
+	if opts.Prune && len(opts.PruneLabels) == 0 {
+		return nil, nil, errors.New("prune labels are required to prune resources")
+	}
+	if desired == nil {
+		desired = &Manifest{}
+	}
+	if err := checkManifestSecrets(desired); err != nil {
+		return nil, nil, err
+	}
+
+	live, err := impl.fetchLiveState(ctx, clusterID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if desired.Cluster != nil {
+		if live.cluster, err = impl.clusters.GetCluster(ctx, clusterID, nil); err != nil {
+			return nil, nil, errors.Wrap(err, "get cluster")
+		}
+	}
+	p := &manifestPlanner{
+		impl: impl,
+		opts: opts,
+		live: live,
+		state: &applyState{
+			cluster:           &Cluster{ID: clusterID},
+			certificates:      make(map[string]ID),
+			serviceRegistries: make(map[string]ID),
+			applications:      make(map[string]ID),
+		},
+		steps:   make(map[ManifestKind][]*PlanStep),
+		deletes: make(map[ManifestKind][]*PlanStep),
+	}
+
+	for _, fn := range []func(*Manifest) error{
+		p.planCluster,
+		p.planCertificates,
+		p.planServiceRegistries,
+		p.planLogCollections,
+		p.planConsumers,
+		p.planApplications,
+	} {
+		if err = fn(desired); err != nil {
+			return nil, nil, err
+		}
+	}
+	return p.plan(), p.state, nil
+}
+
+func (p *manifestPlanner) planCluster(desired *Manifest) error {
+	cluster := desired.Cluster
+	if cluster == nil {
+		return nil
+	}
+	current := p.live.cluster
+
+	// Only the managed configuration is compared.
+	managed := &ManifestCluster{Settings: cluster.Settings, Plugins: cluster.Plugins}
+	live := &ManifestCluster{}
+	if cluster.Settings != nil {
+		live.Settings = &current.Settings
+	}
+	if cluster.Plugins != nil {
+		live.Plugins = current.Plugins
+	}
+	step := &PlanStep{
+		Kind:    ManifestKindCluster,
+		Name:    cluster.Name,
+		Action:  PlanActionUpdate,
+		ID:      p.state.cluster.ID,
+		Desired: cluster,
+		Live:    current,
+	}
+	if err := step.compare(managed, live); err != nil {
+		return err
+	}
+
+	step.apply = func(ctx context.Context, state *applyState) error {
+		if step.Action == PlanActionNoop {
+			return nil
+		}
+		desiredView, _ := step.desiredView.(map[string]interface{})
+		liveView, _ := step.liveView.(map[string]interface{})
+		if cluster.Settings != nil && !reflect.DeepEqual(desiredView["settings"], liveView["settings"]) {
+			if err := p.impl.clusters.UpdateClusterSettings(ctx, state.cluster.ID, cluster.Settings, nil); err != nil {
+				return err
+			}
+		}
+		if cluster.Plugins != nil && !reflect.DeepEqual(desiredView["plugins"], liveView["plugins"]) {
+			if err := p.impl.clusters.UpdateClusterPlugins(ctx, state.cluster.ID, cluster.Plugins, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	p.add(step)
+	return nil
+}
+
+// matchLiveCertificate returns the live certificate which has the same identity
+// as the desired one. When multiple live certificates have the same identity
+// (e.g., the client certificates without SNIs, or a manual rollover), the one
+// with the same serial number is chosen, an error is returned if there is no
+// such certificate.
+func matchLiveCertificate(liveCerts map[string][]*CertificateDetails, view *certificateView) (*CertificateDetails, error) {
+	candidates := liveCerts[certificateIdentity(view.Type, view.SNIs)]
+	if len(candidates) <= 1 {
+		if len(candidates) == 0 {
+			return nil, nil
+		}
+		return candidates[0], nil
+	}
+	var matched *CertificateDetails
+	for _, cert := range candidates {
+		if cert.SerialNumber != view.SerialNumber {
+			continue
+		}
+		if matched != nil {
+			return nil, fmt.Errorf("found multiple %s certificates for SNIs %v with serial number %s", view.Type, view.SNIs, view.SerialNumber)
+		}
+		matched = cert
+	}
+	if matched == nil {
+		return nil, fmt.Errorf("found multiple %s certificates for SNIs %v", view.Type, view.SNIs)
+	}
+	return matched, nil
+}
+
+func (p *manifestPlanner) planCertificates(desired *Manifest) error {
+	// The live certificates with the same identity are ambiguous only if a
+	// desired certificate has this identity, see matchLiveCertificate.
+	liveCerts := make(map[string][]*CertificateDetails)
+	for _, cert := range p.live.certificates {
+		key := certificateIdentity(cert.Type, cert.SNIs)
+		liveCerts[key] = append(liveCerts[key], cert)
+	}
+
+	matched := make(map[ID]struct{})
+	for _, cert := range desired.Certificates {
+		if cert.Name == "" {
+			return errors.New("certificate name is required")
+		}
+		if _, ok := p.state.certificates[cert.Name]; ok {
+			return fmt.Errorf("duplicated certificate %s", cert.Name)
+		}
+		view, err := desiredCertificateView(&cert.CertificateSpec)
+		if err != nil {
+			return errors.Wrapf(err, "certificate %s", cert.Name)
+		}
+		current, err := matchLiveCertificate(liveCerts, view)
+		if err != nil {
+			return errors.Wrapf(err, "certificate %s", cert.Name)
+		}
+		if current != nil {
+			if _, ok := matched[current.ID]; ok {
+				return fmt.Errorf("certificate %s has the same SNIs as another certificate", cert.Name)
+			}
+			matched[current.ID] = struct{}{}
+		}
+
+		step := &PlanStep{
+			Kind:    ManifestKindCertificate,
+			Name:    cert.Name,
+			Action:  PlanActionCreate,
+			Desired: &cert.Certificate,
+		}
+		var live interface{}
+		if current != nil {
+			step.ID = current.ID
+			step.Live = current
+			step.Action = PlanActionUpdate
+			live = liveCertificateView(current)
+		}
+		if err = step.compare(view, live); err != nil {
+			return err
+		}
+		if step.Action != PlanActionNoop {
+			if _, err = cert.Validate(); err != nil {
+				return errors.Wrapf(err, "validate certificate %s", cert.Name)
+			}
+		}
+		p.state.certificates[cert.Name] = step.ID
+
+		cert := cert
+		step.apply = func(ctx context.Context, state *applyState) error {
+			body := cert.Certificate
+			var (
+				details *CertificateDetails
+				err     error
+			)
+			switch step.Action {
+			case PlanActionCreate:
+				details, err = p.impl.certificates.CreateCertificate(ctx, &body, &ResourceCreateOptions{Cluster: state.cluster})
+			case PlanActionUpdate:
+				body.ID = step.ID
+				details, err = p.impl.certificates.UpdateCertificate(ctx, &body, &ResourceUpdateOptions{Cluster: state.cluster})
+			default:
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if step.Action == PlanActionCreate {
+				step.ID = details.ID
+				state.certificates[cert.Name] = details.ID
+			}
+			return nil
+		}
+		p.add(step)
+	}
+
+	if !p.opts.Prune {
+		return nil
+	}
+	for _, cert := range p.live.certificates {
+		if _, ok := matched[cert.ID]; ok || !hasAllLabels(cert.Labels, p.opts.PruneLabels) {
+			continue
+		}
+		cert := cert
+		step := &PlanStep{
+			Kind:   ManifestKindCertificate,
+			Name:   strings.Join(cert.SNIs, ","),
+			Action: PlanActionDelete,
+			ID:     cert.ID,
+			Live:   cert,
+		}
+		if err := step.compare(nil, liveCertificateView(cert)); err != nil {
+			return err
+		}
+		step.apply = func(ctx context.Context, state *applyState) error {
+			return p.impl.certificates.DeleteCertificate(ctx, cert.ID, &ResourceDeleteOptions{Cluster: state.cluster})
+		}
+		p.add(step)
+	}
+	return nil
+}
+
+func (p *manifestPlanner) planServiceRegistries(desired *Manifest) error {
+	liveRegistries := make(map[string]*ServiceRegistry)
+	for _, registry := range p.live.serviceRegistries {
+		if _, ok := liveRegistries[registry.Name]; ok {
+			return fmt.Errorf("found multiple service registries named %s", registry.Name)
+		}
+		liveRegistries[registry.Name] = registry
+		p.state.serviceRegistries[registry.Name] = registry.ID
+	}
+
+	seen := make(map[string]struct{})
+	for _, registry := range desired.ServiceRegistries {
+		if _, ok := seen[registry.Name]; ok {
+			return fmt.Errorf("duplicated service registry %s", registry.Name)
+		}
+		seen[registry.Name] = struct{}{}
+
+		current := liveRegistries[registry.Name]
+		spec := registry.ServiceRegistrySpec
+		step := &PlanStep{
+			Kind:    ManifestKindServiceRegistry,
+			Name:    registry.Name,
+			Action:  PlanActionCreate,
+			Desired: registry,
+		}
+		var live interface{}
+		if current != nil {
+			step.ID = current.ID
+			step.Live = current
+			step.Action = PlanActionUpdate
+			live = current.ServiceRegistrySpec
+			if err := keepLiveManifestSecrets(ManifestKindServiceRegistry, &spec, &current.ServiceRegistrySpec); err != nil {
+				return errors.Wrapf(err, "service registry %s", registry.Name)
+			}
+		}
+		if err := step.compare(spec, live); err != nil {
+			return err
+		}
+		p.state.serviceRegistries[registry.Name] = step.ID
+
+		registry := registry
+		step.apply = func(ctx context.Context, state *applyState) error {
+			switch step.Action {
+			case PlanActionCreate:
+				created, err := p.impl.serviceRegistries.CreateServiceRegistry(ctx, &ServiceRegistry{ServiceRegistrySpec: spec},
+					&ResourceCreateOptions{Cluster: state.cluster})
+				if err != nil {
+					return err
+				}
+				step.ID = created.ID
+				state.serviceRegistries[registry.Name] = created.ID
+			case PlanActionUpdate:
+				body := *current
+				body.ServiceRegistrySpec = spec
+				if _, err := p.impl.serviceRegistries.UpdateServiceRegistry(ctx, &body, &ResourceUpdateOptions{Cluster: state.cluster}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		p.add(step)
+	}
+	return nil
+}
+
+func (p *manifestPlanner) planLogCollections(desired *Manifest) error {
+	liveCollections := make(map[string]*LogCollection)
+	for _, lc := range p.live.logCollections {
+		if _, ok := liveCollections[lc.Name]; ok {
+			return fmt.Errorf("found multiple log collections named %s", lc.Name)
+		}
+		liveCollections[lc.Name] = lc
+	}
+
+	seen := make(map[string]struct{})
+	for _, lc := range desired.LogCollections {
+		if _, ok := seen[lc.Name]; ok {
+			return fmt.Errorf("duplicated log collection %s", lc.Name)
+		}
+		seen[lc.Name] = struct{}{}
+
+		current := liveCollections[lc.Name]
+		body := *lc
+		step := &PlanStep{
+			Kind:    ManifestKindLogCollection,
+			Name:    lc.Name,
+			Action:  PlanActionCreate,
+			Desired: lc,
+		}
+		var live interface{}
+		if current != nil {
+			body.ID = current.ID
+			step.ID = current.ID
+			step.Live = current
+			step.Action = PlanActionUpdate
+			live = current
+			if err := keepLiveManifestSecrets(ManifestKindLogCollection, &body, current); err != nil {
+				return errors.Wrapf(err, "log collection %s", lc.Name)
+			}
+		} else {
+			body.ID = 0
+		}
+		if err := step.compare(&body, live); err != nil {
+			return err
+		}
+
+		step.apply = func(ctx context.Context, state *applyState) error {
+			switch step.Action {
+			case PlanActionCreate:
+				created, err := p.impl.logCollections.CreateLogCollection(ctx, &body, &ResourceCreateOptions{Cluster: state.cluster})
+				if err != nil {
+					return err
+				}
+				step.ID = created.ID
+			case PlanActionUpdate:
+				if _, err := p.impl.logCollections.UpdateLogCollection(ctx, &body, &ResourceUpdateOptions{Cluster: state.cluster}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		p.add(step)
+	}
+	return nil
+}
+
+func (p *manifestPlanner) planConsumers(desired *Manifest) error {
+	liveConsumers := make(map[string]*Consumer)
+	for _, consumer := range p.live.consumers {
+		if _, ok := liveConsumers[consumer.Name]; ok {
+			return fmt.Errorf("found multiple consumers named %s", consumer.Name)
+		}
+		liveConsumers[consumer.Name] = consumer
+	}
+
+	seen := make(map[string]struct{})
+	for _, consumer := range desired.Consumers {
+		if _, ok := seen[consumer.Name]; ok {
+			return fmt.Errorf("duplicated consumer %s", consumer.Name)
+		}
+		seen[consumer.Name] = struct{}{}
+
+		current := liveConsumers[consumer.Name]
+		body := *consumer
+		step := &PlanStep{
+			Kind:    ManifestKindConsumer,
+			Name:    consumer.Name,
+			Action:  PlanActionCreate,
+			Desired: consumer,
+		}
+		var live interface{}
+		if current != nil {
+			body.ID = current.ID
+			step.ID = current.ID
+			step.Live = current
+			step.Action = PlanActionUpdate
+			live = current
+			if err := keepLiveManifestSecrets(ManifestKindConsumer, &body, current); err != nil {
+				return errors.Wrapf(err, "consumer %s", consumer.Name)
+			}
+		} else {
+			body.ID = 0
+		}
+		if err := step.compare(&body, live); err != nil {
+			return err
+		}
+
+		step.apply = func(ctx context.Context, state *applyState) error {
+			switch step.Action {
+			case PlanActionCreate:
+				created, err := p.impl.consumers.CreateConsumer(ctx, &body, &ResourceCreateOptions{Cluster: state.cluster})
+				if err != nil {
+					return err
+				}
+				step.ID = created.ID
+			case PlanActionUpdate:
+				if _, err := p.impl.consumers.UpdateConsumer(ctx, &body, &ResourceUpdateOptions{Cluster: state.cluster}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		p.add(step)
+	}
+
+	if !p.opts.Prune {
+		return nil
+	}
+	for _, consumer := range p.live.consumers {
+		if _, ok := seen[consumer.Name]; ok || !hasAllLabels(consumer.Labels, p.opts.PruneLabels) {
+			continue
+		}
+		consumer := consumer
+		step := &PlanStep{
+			Kind:   ManifestKindConsumer,
+			Name:   consumer.Name,
+			Action: PlanActionDelete,
+			ID:     consumer.ID,
+			Live:   consumer,
+		}
+		if err := step.compare(nil, consumer); err != nil {
+			return err
+		}
+		step.apply = func(ctx context.Context, state *applyState) error {
+			return p.impl.consumers.DeleteConsumer(ctx, consumer.ID, &ResourceDeleteOptions{Cluster: state.cluster})
+		}
+		p.add(step)
+	}
+	return nil
+}
+
+func (p *manifestPlanner) planApplications(desired *Manifest) error {
+	liveApps := make(map[string]*Application)
+	for _, app := range p.live.applications {
+		if _, ok := liveApps[app.Name]; ok {
+			return fmt.Errorf("found multiple applications named %s", app.Name)
+		}
+		liveApps[app.Name] = app
+	}
+
+	for _, app := range desired.Applications {
+		if _, ok := p.state.applications[app.Name]; ok {
+			return fmt.Errorf("duplicated application %s", app.Name)
+		}
+		resolved, pending, err := resolveApplication(app, p.state)
+		if err != nil {
+			return err
+		}
+
+		current := liveApps[app.Name]
+		step := &PlanStep{
+			Kind:    ManifestKindApplication,
+			Name:    app.Name,
+			Action:  PlanActionCreate,
+			Desired: app,
+		}
+		var live interface{}
+		if current != nil {
+			step.ID = current.ID
+			step.Live = current
+			step.Action = PlanActionUpdate
+			live = current.ApplicationSpec
+		}
+		if err = step.compare(resolved.ApplicationSpec, live); err != nil {
+			return err
+		}
+		if pending {
+			// The referenced resources are not created yet, so the
+			// application has to be updated once their IDs are known.
+			markPendingReferences(step.desiredView, app, p.state)
+			if step.Action == PlanActionNoop {
+				step.Action = PlanActionUpdate
+			}
+		}
+		p.state.applications[app.Name] = step.ID
+
+		app := app
+		step.apply = func(ctx context.Context, state *applyState) error {
+			if step.Action == PlanActionNoop {
+				return nil
+			}
+			// Resolve again as the referenced resources might be created just now.
+			resolved, _, err := resolveApplication(app, state)
+			if err != nil {
+				return err
+			}
+			if step.Action == PlanActionCreate {
+				created, err := p.impl.applications.CreateApplication(ctx, &Application{ApplicationSpec: resolved.ApplicationSpec},
+					&ResourceCreateOptions{Cluster: state.cluster})
+				if err != nil {
+					return err
+				}
+				step.ID = created.ID
+				state.applications[app.Name] = created.ID
+				return nil
+			}
+			body := *current
+			body.ApplicationSpec = resolved.ApplicationSpec
+			_, err = p.impl.applications.UpdateApplication(ctx, &body, &ResourceUpdateOptions{Cluster: state.cluster})
+			return err
+		}
+		p.add(step)
+
+		if err = p.planAPIs(app, current); err != nil {
+			return err
+		}
+		if err = p.planCanaryReleases(app, current); err != nil {
+			return err
+		}
+	}
+
+	if !p.opts.Prune {
+		return nil
+	}
+	for _, app := range p.live.applications {
+		if _, ok := p.state.applications[app.Name]; ok || !hasAllLabels(app.Labels, p.opts.PruneLabels) {
+			continue
+		}
+		app := app
+		step := &PlanStep{
+			Kind:   ManifestKindApplication,
+			Name:   app.Name,
+			Action: PlanActionDelete,
+			ID:     app.ID,
+			Live:   app,
+		}
+		if err := step.compare(nil, app.ApplicationSpec); err != nil {
+			return err
+		}
+		step.apply = func(ctx context.Context, state *applyState) error {
+			return p.impl.applications.DeleteApplication(ctx, app.ID, &ResourceDeleteOptions{Cluster: state.cluster})
+		}
+		p.add(step)
+	}
+	return nil
+}
+
+// applicationOptions returns the options to manipulate the resources of the application.
+func applicationOptions(state *applyState, appName string) (*Cluster, *Application, error) {
+	id := state.applications[appName]
+	if id == 0 {
+		return nil, nil, fmt.Errorf("application %s is not created", appName)
+	}
+	return state.cluster, &Application{ID: id}, nil
+}
+
+func (p *manifestPlanner) planAPIs(app *ManifestApplication, currentApp *Application) error {
+	liveAPIs := make(map[string]*API)
+	if currentApp != nil {
+		for _, api := range p.live.apis[currentApp.ID] {
+			if _, ok := liveAPIs[api.Name]; ok {
+				return fmt.Errorf("found multiple apis named %s in application %s", api.Name, app.Name)
+			}
+			liveAPIs[api.Name] = api
+		}
+	}
+
+	appName := app.Name
+	seen := make(map[string]struct{})
+	for _, api := range app.APIs {
+		if _, ok := seen[api.Name]; ok {
+			return fmt.Errorf("duplicated api %s in application %s", api.Name, appName)
+		}
+		seen[api.Name] = struct{}{}
+
+		current := liveAPIs[api.Name]
+		step := &PlanStep{
+			Kind:    ManifestKindAPI,
+			Name:    appName + "/" + api.Name,
+			Action:  PlanActionCreate,
+			Desired: api,
+		}
+		var live interface{}
+		if current != nil {
+			step.ID = current.ID
+			step.Live = current
+			step.Action = PlanActionUpdate
+			live = current.APISpec
+		}
+		if err := step.compare(api.APISpec, live); err != nil {
+			return err
+		}
+
+		api := api
+		step.apply = func(ctx context.Context, state *applyState) error {
+			if step.Action == PlanActionNoop {
+				return nil
+			}
+			cluster, application, err := applicationOptions(state, appName)
+			if err != nil {
+				return err
+			}
+			if step.Action == PlanActionCreate {
+				created, err := p.impl.apis.CreateAPI(ctx, &API{APISpec: api.APISpec},
+					&ResourceCreateOptions{Cluster: cluster, Application: application})
+				if err != nil {
+					return err
+				}
+				step.ID = created.ID
+				return nil
+			}
+			body := *current
+			body.APISpec = api.APISpec
+			_, err = p.impl.apis.UpdateAPI(ctx, &body, &ResourceUpdateOptions{Cluster: cluster, Application: application})
+			return err
+		}
+		p.add(step)
+	}
+
+	if !p.opts.Prune || currentApp == nil {
+		return nil
+	}
+	for _, api := range p.live.apis[currentApp.ID] {
+		if _, ok := seen[api.Name]; ok || !hasAllLabels(api.Labels, p.opts.PruneLabels) {
+			continue
+		}
+		api := api
+		step := &PlanStep{
+			Kind:   ManifestKindAPI,
+			Name:   appName + "/" + api.Name,
+			Action: PlanActionDelete,
+			ID:     api.ID,
+			Live:   api,
+		}
+		if err := step.compare(nil, api.APISpec); err != nil {
+			return err
+		}
+		step.apply = func(ctx context.Context, state *applyState) error {
+			return p.impl.apis.DeleteAPI(ctx, api.ID, &ResourceDeleteOptions{Cluster: state.cluster, Application: currentApp})
+		}
+		p.add(step)
+	}
+	return nil
+}
+
+func (p *manifestPlanner) planCanaryReleases(app *ManifestApplication, currentApp *Application) error {
+	liveReleases := make(map[string]*CanaryRelease)
+	if currentApp != nil {
+		for _, cr := range p.live.canaryReleases[currentApp.ID] {
+			if _, ok := liveReleases[cr.Name]; ok {
+				return fmt.Errorf("found multiple canary releases named %s in application %s", cr.Name, app.Name)
+			}
+			liveReleases[cr.Name] = cr
+		}
+	}
+
+	appName := app.Name
+	seen := make(map[string]struct{})
+	for _, cr := range app.CanaryReleases {
+		if _, ok := seen[cr.Name]; ok {
+			return fmt.Errorf("duplicated canary release %s in application %s", cr.Name, appName)
+		}
+		seen[cr.Name] = struct{}{}
+
+		current := liveReleases[cr.Name]
+		step := &PlanStep{
+			Kind:    ManifestKindCanaryRelease,
+			Name:    appName + "/" + cr.Name,
+			Action:  PlanActionCreate,
+			Desired: cr,
+		}
+		var live interface{}
+		if current != nil {
+			step.ID = current.ID
+			step.Live = current
+			step.Action = PlanActionUpdate
+			live = current.CanaryReleaseSpec
+		}
+		if err := step.compare(cr.CanaryReleaseSpec, live); err != nil {
+			return err
+		}
+
+		cr := cr
+		step.apply = func(ctx context.Context, state *applyState) error {
+			if step.Action == PlanActionNoop {
+				return nil
+			}
+			cluster, application, err := applicationOptions(state, appName)
+			if err != nil {
+				return err
+			}
+			if step.Action == PlanActionCreate {
+				created, err := p.impl.canaryReleases.CreateCanaryRelease(ctx, &CanaryRelease{CanaryReleaseSpec: cr.CanaryReleaseSpec},
+					&ResourceCreateOptions{Cluster: cluster, Application: application})
+				if err != nil {
+					return err
+				}
+				step.ID = created.ID
+				return nil
+			}
+			body := *current
+			body.CanaryReleaseSpec = cr.CanaryReleaseSpec
+			_, err = p.impl.canaryReleases.UpdateCanaryRelease(ctx, &body, &ResourceUpdateOptions{Cluster: cluster, Application: application})
+			return err
+		}
+		p.add(step)
+	}
+
+	if !p.opts.Prune || currentApp == nil || !hasAllLabels(app.Labels, p.opts.PruneLabels) {
+		return nil
+	}
+	for _, cr := range p.live.canaryReleases[currentApp.ID] {
+		if _, ok := seen[cr.Name]; ok {
+			continue
+		}
+		cr := cr
+		step := &PlanStep{
+			Kind:   ManifestKindCanaryRelease,
+			Name:   appName + "/" + cr.Name,
+			Action: PlanActionDelete,
+			ID:     cr.ID,
+			Live:   cr,
+		}
+		if err := step.compare(nil, cr.CanaryReleaseSpec); err != nil {
+			return err
+		}
+		step.apply = func(ctx context.Context, state *applyState) error {
+			return p.impl.canaryReleases.DeleteCanaryRelease(ctx, cr.ID, &ResourceDeleteOptions{Cluster: state.cluster, Application: currentApp})
+		}
+		p.add(step)
+	}
+	return nil
+}
+
+func (impl *manifestImpl) PlanManifest(ctx context.Context, clusterID ID, desired *Manifest, opts *ApplyOptions) (*Plan, error) {
+	plan, _, err := impl.plan(ctx, clusterID, desired, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "plan manifest")
+	}
+	return plan, nil
+}
+
+func (impl *manifestImpl) Apply(ctx context.Context, clusterID ID, desired *Manifest, opts *ApplyOptions) (*Plan, error) {
+	plan, state, err := impl.plan(ctx, clusterID, desired, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "plan manifest")
+	}
+	for _, step := range plan.Steps {
+		if err = step.apply(ctx, state); err != nil {
+			return plan, errors.Wrapf(err, "%s %s %s", step.Action, step.Kind, step.Name)
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,254 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// _manifestSpecTypes are the Go types of the spec field of each kind.
+var _manifestSpecTypes = map[ManifestKind]reflect.Type{
+	ManifestKindApplication:     reflect.TypeOf(applicationManifestSpec{}),
+	ManifestKindAPI:             reflect.TypeOf(APISpec{}),
+	ManifestKindCanaryRelease:   reflect.TypeOf(CanaryReleaseSpec{}),
+	ManifestKindConsumer:        reflect.TypeOf(Consumer{}),
+	ManifestKindCertificate:     reflect.TypeOf(CertificateSpec{}),
+	ManifestKindLogCollection:   reflect.TypeOf(LogCollection{}),
+	ManifestKindServiceRegistry: reflect.TypeOf(ServiceRegistrySpec{}),
+	ManifestKindCluster:         reflect.TypeOf(ManifestCluster{}),
+}
+
+// _manifestSpecOmittedFields are the fields which are not in the spec, the id is
+// managed by API7 Cloud and the name is in the metadata.
+var _manifestSpecOmittedFields = []string{"id", "name"}
+
+var (
+	_idType                  = reflect.TypeOf(ID(0))
+	_timeType                = reflect.TypeOf(time.Time{})
+	_serviceRegistryTypeType = reflect.TypeOf(ServiceRegistryType(0))
+)
+
+// manifestTypeSchema generates the JSON schema of the Go type according to its
+// JSON encoding, `visiting` contains the struct types being generated, which is
+// used to break the recursive types.
+func manifestTypeSchema(typ reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	switch typ {
+	case _idType:
+		return map[string]interface{}{"type": "string", "pattern": "^[0-9]+$"}
+	case _timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case _serviceRegistryTypeType:
+		var values []interface{}
+		var names []string
+		for t, name := range _serviceRegistryTypeNames {
+			values = append(values, int(t))
+			names = append(names, name)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			return values[i].(int) < values[j].(int)
+		})
+		sort.Strings(names)
+		for _, name := range names {
+			values = append(values, name)
+		}
+		return map[string]interface{}{"enum": values}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return nullableSchema(manifestTypeSchema(typ.Elem(), visiting))
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return nullableSchema(map[string]interface{}{
+			"type":  "array",
+			"items": manifestTypeSchema(typ.Elem(), visiting),
+		})
+	case reflect.Map:
+		schema := map[string]interface{}{"type": "object"}
+		if typ.Elem().Kind() != reflect.Interface {
+			schema["additionalProperties"] = manifestTypeSchema(typ.Elem(), visiting)
+		}
+		return nullableSchema(schema)
+	case reflect.Struct:
+		if visiting[typ] {
+			return map[string]interface{}{"type": "object"}
+		}
+		visiting[typ] = true
+		defer delete(visiting, typ)
+
+		properties := make(map[string]interface{})
+		manifestStructProperties(typ, visiting, properties)
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	default:
+		// interface{} accepts any values.
+		return map[string]interface{}{}
+	}
+}
+
+func manifestStructProperties(typ reflect.Type, visiting map[reflect.Type]bool, properties map[string]interface{}) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				manifestStructProperties(embedded, visiting, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = manifestTypeSchema(field.Type, visiting)
+	}
+}
+
+// nullableSchema allows the null value, as the nil pointers, slices and maps
+// are encoded to null if they're not omitted.
+func nullableSchema(schema map[string]interface{}) map[string]interface{} {
+	if typ, ok := schema["type"].(string); ok {
+		schema["type"] = []interface{}{typ, "null"}
+	}
+	return schema
+}
+
+// manifestDocumentSchema generates the JSON schema of the document of the `kind`.
+func manifestDocumentSchema(kind ManifestKind) map[string]interface{} {
+	spec := manifestTypeSchema(_manifestSpecTypes[kind], make(map[reflect.Type]bool))
+	properties := spec["properties"].(map[string]interface{})
+	for _, field := range _manifestSpecOmittedFields {
+		delete(properties, field)
+	}
+
+	metadataProperties := map[string]interface{}{
+		"name": map[string]interface{}{"type": "string", "minLength": 1},
+	}
+	metadataRequired := []interface{}{"name"}
+	if kind == ManifestKindAPI || kind == ManifestKindCanaryRelease {
+		metadataProperties["application"] = map[string]interface{}{"type": "string", "minLength": 1}
+		metadataRequired = append(metadataRequired, "application")
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"required":             []interface{}{"apiVersion", "kind", "metadata", "spec"},
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"apiVersion": map[string]interface{}{"const": ManifestAPIVersion},
+			"kind":       map[string]interface{}{"const": string(kind)},
+			"metadata": map[string]interface{}{
+				"type":                 "object",
+				"required":             metadataRequired,
+				"additionalProperties": false,
+				"properties":           metadataProperties,
+			},
+			"spec": spec,
+		},
+	}
+}
+
+func manifestKinds() []ManifestKind {
+	kinds := make([]ManifestKind, 0, len(_manifestSpecTypes))
+	for kind := range _manifestSpecTypes {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i] < kinds[j]
+	})
+	return kinds
+}
+
+// ManifestJSONSchema returns the JSON schema (draft 7) of the manifest documents,
+// which can be used by the editors to validate the manifest files.
+func ManifestJSONSchema() ([]byte, error) {
+	var documents []interface{}
+	for _, kind := range manifestKinds() {
+		documents = append(documents, manifestDocumentSchema(kind))
+	}
+	schema := map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "API7 Cloud Manifest",
+		"oneOf":   documents,
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "encode manifest schema")
+	}
+	return append(data, '\n'), nil
+}
+
+var manifestSchemaValidators = struct {
+	once       sync.Once
+	validators map[ManifestKind]*jsonSchema
+	err        error
+}{}
+
+// manifestDocumentValidator returns the compiled schema of the document of the `kind`.
+func manifestDocumentValidator(kind ManifestKind) (*jsonSchema, error) {
+	v := &manifestSchemaValidators
+	v.once.Do(func() {
+		v.validators = make(map[ManifestKind]*jsonSchema)
+		for _, kind := range manifestKinds() {
+			data, err := json.Marshal(manifestDocumentSchema(kind))
+			if err != nil {
+				v.err = err
+				return
+			}
+			var s jsonSchema
+			if err = json.Unmarshal(data, &s); err != nil {
+				v.err = err
+				return
+			}
+			if err = s.compile(); err != nil {
+				v.err = err
+				return
+			}
+			v.validators[kind] = &s
+		}
+	})
+	if v.err != nil {
+		return nil, errors.Wrap(v.err, "compile manifest schema")
+	}
+	return v.validators[kind], nil
+}
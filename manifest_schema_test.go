@@ -0,0 +1,58 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestJSONSchema(t *testing.T) {
+	t.Parallel()
+
+	schema, err := ManifestJSONSchema()
+	assert.Nil(t, err, "generate the manifest schema")
+
+	generated, err := os.ReadFile("schemas/manifest.json")
+	assert.Nil(t, err, "read the generated schema")
+	assert.Equal(t, string(schema), string(generated), "check schemas/manifest.json is up to date, run `make manifest-schema` to update it")
+
+	var decoded struct {
+		OneOf []struct {
+			Properties struct {
+				Kind struct {
+					Const string `json:"const"`
+				} `json:"kind"`
+				Spec struct {
+					Properties map[string]interface{} `json:"properties"`
+				} `json:"spec"`
+			} `json:"properties"`
+		} `json:"oneOf"`
+	}
+	assert.Nil(t, json.Unmarshal(schema, &decoded), "decode the manifest schema")
+	kinds := make(map[string]map[string]interface{})
+	for _, doc := range decoded.OneOf {
+		kinds[doc.Properties.Kind.Const] = doc.Properties.Spec.Properties
+	}
+	assert.Len(t, kinds, 8, "check all kinds are in the schema")
+	assert.Contains(t, kinds["Application"], "upstream_references", "check the application references")
+	assert.NotContains(t, kinds["Consumer"], "id", "check the id is omitted")
+	assert.NotContains(t, kinds["LogCollection"], "name", "check the name is omitted")
+	assert.Contains(t, kinds["Certificate"], "private_key", "check the certificate spec")
+	assert.Contains(t, kinds["Cluster"], "settings", "check the cluster spec")
+}
@@ -0,0 +1,391 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ExportSecretPolicy determines how the secrets (e.g., private keys and consumer
+// credentials) are exported.
+// Note only the well-known secret fields of the Certificates, Consumer credentials,
+// Log Collections and Service Registries are handled, the secrets inside the
+// plugin configurations (of the Cluster, Applications, APIs and Consumers) are
+// always exported as they are.
+type ExportSecretPolicy int
+
+const (
+	// ExportSecretsExclude drops the secrets from the exported manifests, it's the default.
+	ExportSecretsExclude ExportSecretPolicy = iota
+	// ExportSecretsEncrypt encrypts the secrets with the ExportOptions.EncryptionKey,
+	// use DecryptManifest to decrypt them after loading the manifests.
+	ExportSecretsEncrypt
+	// ExportSecretsPlaintext exports the secrets as they are.
+	ExportSecretsPlaintext
+)
+
+// _manifestSecretPrefix is the prefix of the encrypted secrets.
+const _manifestSecretPrefix = "encrypted:v1:"
+
+// _manifestSecretFields are the paths of the secrets in the spec of each kind,
+// see visitManifestFields for the path syntax.
+var _manifestSecretFields = map[ManifestKind][]string{
+	ManifestKindCertificate: {"private_key"},
+	ManifestKindConsumer: {
+		"credentials." + KeyAuthCredentialType + ".key",
+		"credentials." + BasicAuthCredentialType + ".password",
+		"credentials." + JWTAuthCredentialType + ".secret",
+		"credentials." + JWTAuthCredentialType + ".private_key",
+		"credentials." + HMACAuthCredentialType + ".secret_key",
+	},
+	ManifestKindLogCollection: {
+		"spec.auth_header",
+		"spec.brokers[].sasl_config.password",
+	},
+	ManifestKindServiceRegistry: {
+		"consul.token",
+		"nacos.password",
+		"kubernetes.service_account_token_value",
+	},
+}
+
+// manifestSecretCipher encrypts the secrets with AES-GCM, the encryption key and
+// the key to derive the nonces are derived from the EncryptionKey by HKDF, so
+// that the EncryptionKey is not used by multiple primitives.
+type manifestSecretCipher struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+func deriveManifestSecretKey(key []byte, info string, size int) ([]byte, error) {
+	derived := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(info)), derived); err != nil {
+		return nil, errors.Wrap(err, "derive encryption key")
+	}
+	return derived, nil
+}
+
+func newManifestSecretCipher(key []byte) (*manifestSecretCipher, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, errors.Wrap(aes.KeySizeError(len(key)), "encryption key")
+	}
+	encKey, err := deriveManifestSecretKey(key, _manifestSecretPrefix+"encryption", len(key))
+	if err != nil {
+		return nil, err
+	}
+	nonceKey, err := deriveManifestSecretKey(key, _manifestSecretPrefix+"nonce", sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "encryption key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &manifestSecretCipher{aead: aead, nonceKey: nonceKey}, nil
+}
+
+// encrypt encrypts the secret with AES-GCM. The nonce is derived from the secret
+// so that the output is deterministic, as a result, the same secrets are
+// encrypted to the same value.
+func (c *manifestSecretCipher) encrypt(secret string) string {
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write([]byte(secret))
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+	sealed := c.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return _manifestSecretPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+func (c *manifestSecretCipher) decrypt(value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, _manifestSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("malformed encrypted secret")
+	}
+	plain, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", errors.New("incorrect encryption key")
+	}
+	return string(plain), nil
+}
+
+func decodeManifestSpec(doc *ManifestDocument) (map[string]interface{}, error) {
+	var spec map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(doc.Spec))
+	decoder.UseNumber()
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, errors.Wrapf(err, "decode %s %s", doc.Kind, manifestDocumentName(doc))
+	}
+	return spec, nil
+}
+
+// protectManifestSecrets drops or encrypts the secrets in the documents according
+// to the `policy`.
+func protectManifestSecrets(docs []*ManifestDocument, policy ExportSecretPolicy, key []byte) error {
+	var secrets *manifestSecretCipher
+	switch policy {
+	case ExportSecretsPlaintext:
+		return nil
+	case ExportSecretsEncrypt:
+		if len(key) == 0 {
+			return errors.New("encryption key is required to encrypt secrets")
+		}
+		var err error
+		if secrets, err = newManifestSecretCipher(key); err != nil {
+			return err
+		}
+	case ExportSecretsExclude:
+	default:
+		return fmt.Errorf("unknown secret policy %d", policy)
+	}
+
+	for _, doc := range docs {
+		paths := _manifestSecretFields[doc.Kind]
+		if len(paths) == 0 {
+			continue
+		}
+		spec, err := decodeManifestSpec(doc)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			visitManifestFields(spec, strings.Split(path, "."), func(obj map[string]interface{}, field string) {
+				if secrets == nil {
+					delete(obj, field)
+				} else if secret, ok := obj[field].(string); ok && secret != "" {
+					obj[field] = secrets.encrypt(secret)
+				}
+			})
+		}
+		if doc.Spec, err = json.Marshal(spec); err != nil {
+			return errors.Wrapf(err, "encode %s %s", doc.Kind, manifestDocumentName(doc))
+		}
+	}
+	return nil
+}
+
+// decryptManifestValue decrypts the encrypted secrets in the value recursively.
+func decryptManifestValue(secrets *manifestSecretCipher, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			decrypted, err := decryptManifestValue(secrets, elem)
+			if err != nil {
+				return nil, errors.Wrap(err, key)
+			}
+			v[key] = decrypted
+		}
+	case []interface{}:
+		for i, elem := range v {
+			decrypted, err := decryptManifestValue(secrets, elem)
+			if err != nil {
+				return nil, errors.Wrapf(err, "[%d]", i)
+			}
+			v[i] = decrypted
+		}
+	case string:
+		if strings.HasPrefix(v, _manifestSecretPrefix) {
+			return secrets.decrypt(v)
+		}
+	}
+	return value, nil
+}
+
+// joinManifestSecretPath joins the path of the child value to its parent path,
+// e.g., "brokers" and "[0].sasl_config.password".
+func joinManifestSecretPath(parent, child string) string {
+	if child == "" || strings.HasPrefix(child, "[") {
+		return parent + child
+	}
+	return parent + "." + child
+}
+
+// findEncryptedManifestSecret returns the path of the first encrypted secret
+// in the value, `found` is false if there is none.
+func findEncryptedManifestSecret(value interface{}) (path string, found bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if path, found = findEncryptedManifestSecret(v[key]); found {
+				return joinManifestSecretPath(key, path), true
+			}
+		}
+	case []interface{}:
+		for i, elem := range v {
+			if path, found = findEncryptedManifestSecret(elem); found {
+				return joinManifestSecretPath(fmt.Sprintf("[%d]", i), path), true
+			}
+		}
+	case string:
+		return "", strings.HasPrefix(v, _manifestSecretPrefix)
+	}
+	return "", false
+}
+
+// checkManifestSecrets rejects the Manifest which still carries the secrets
+// encrypted by ExportCluster, otherwise the ciphertexts would be applied as
+// the real secrets.
+func checkManifestSecrets(m *Manifest) error {
+	docs, err := m.Documents()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		spec, err := decodeManifestSpec(doc)
+		if err != nil {
+			return err
+		}
+		if path, found := findEncryptedManifestSecret(spec); found {
+			return fmt.Errorf("%s %s: %s is encrypted, decrypt the manifest by DecryptManifest first",
+				doc.Kind, manifestDocumentName(doc), path)
+		}
+	}
+	return nil
+}
+
+// keepLiveManifestSecret copies the secret at the `path` from the live value to
+// the desired value if it's absent or empty in the desired one, the items of
+// the arrays are matched by their indexes. It returns whether a secret is copied.
+func keepLiveManifestSecret(desired, live interface{}, path []string) bool {
+	obj, ok := desired.(map[string]interface{})
+	liveObj, liveOK := live.(map[string]interface{})
+	if !ok || !liveOK || len(path) == 0 {
+		return false
+	}
+	key := path[0]
+	if strings.HasSuffix(key, "[]") {
+		key = strings.TrimSuffix(key, "[]")
+		items, _ := obj[key].([]interface{})
+		liveItems, _ := liveObj[key].([]interface{})
+		copied := false
+		for i := 0; i < len(items) && i < len(liveItems); i++ {
+			if keepLiveManifestSecret(items[i], liveItems[i], path[1:]) {
+				copied = true
+			}
+		}
+		return copied
+	}
+	if len(path) == 1 {
+		secret, _ := obj[key].(string)
+		liveSecret, _ := liveObj[key].(string)
+		if secret != "" || liveSecret == "" {
+			return false
+		}
+		obj[key] = liveSecret
+		return true
+	}
+	return keepLiveManifestSecret(obj[key], liveObj[key], path[1:])
+}
+
+// keepLiveManifestSecrets fills the secrets which are absent or empty in the
+// `desired` resource of the `kind` with the ones of the `live` resource, so
+// that applying a Manifest exported with the ExportSecretsExclude policy keeps
+// the live secrets rather than clearing them. The `desired` should be a pointer,
+// it's replaced by a new value if any secret is filled.
+func keepLiveManifestSecrets(kind ManifestKind, desired, live interface{}) error {
+	paths := _manifestSecretFields[kind]
+	if len(paths) == 0 {
+		return nil
+	}
+	var desiredValue, liveValue interface{}
+	for _, v := range []struct {
+		src interface{}
+		dst *interface{}
+	}{{desired, &desiredValue}, {live, &liveValue}} {
+		data, err := json.Marshal(v.src)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(data, v.dst); err != nil {
+			return err
+		}
+	}
+
+	copied := false
+	for _, path := range paths {
+		if keepLiveManifestSecret(desiredValue, liveValue, strings.Split(path, ".")) {
+			copied = true
+		}
+	}
+	if !copied {
+		return nil
+	}
+	data, err := json.Marshal(desiredValue)
+	if err != nil {
+		return err
+	}
+	// Decode to a new value rather than the `desired` itself, since it may
+	// share the maps and pointers with the caller's Manifest.
+	filled := reflect.New(reflect.TypeOf(desired).Elem())
+	if err = json.Unmarshal(data, filled.Interface()); err != nil {
+		return err
+	}
+	reflect.ValueOf(desired).Elem().Set(filled.Elem())
+	return nil
+}
+
+// DecryptManifest decrypts the secrets in the Manifest which are encrypted by
+// ExportCluster with the ExportSecretsEncrypt policy, the `key` should be the
+// ExportOptions.EncryptionKey. The decrypted Manifest is returned.
+func DecryptManifest(m *Manifest, key []byte) (*Manifest, error) {
+	secrets, err := newManifestSecretCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := m.Documents()
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		spec, err := decodeManifestSpec(doc)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = decryptManifestValue(secrets, spec); err != nil {
+			return nil, errors.Wrapf(err, "decrypt %s %s", doc.Kind, manifestDocumentName(doc))
+		}
+		if doc.Spec, err = json.Marshal(spec); err != nil {
+			return nil, errors.Wrapf(err, "encode %s %s", doc.Kind, manifestDocumentName(doc))
+		}
+	}
+	return NewManifestFromDocuments(docs)
+}
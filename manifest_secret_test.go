@@ -0,0 +1,135 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestSecretCipher(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		key           []byte
+		expectedError string
+	}{
+		{
+			name: "AES-128",
+			key:  bytes.Repeat([]byte{1}, 16),
+		},
+		{
+			name: "AES-256",
+			key:  bytes.Repeat([]byte{1}, 32),
+		},
+		{
+			name:          "invalid key size",
+			key:           []byte("short"),
+			expectedError: "encryption key: crypto/aes: invalid key size 5",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			secrets, err := newManifestSecretCipher(tc.key)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "create cipher")
+
+			encrypted := secrets.encrypt("jack-key")
+			assert.Equal(t, encrypted, secrets.encrypt("jack-key"), "check the encryption is deterministic")
+			assert.NotEqual(t, encrypted, secrets.encrypt("jack-key2"), "check the different secrets")
+			decrypted, err := secrets.decrypt(encrypted)
+			assert.Nil(t, err, "decrypt the secret")
+			assert.Equal(t, "jack-key", decrypted, "check the decrypted secret")
+
+			// The EncryptionKey itself shouldn't be used to encrypt the secrets.
+			sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, _manifestSecretPrefix))
+			assert.Nil(t, err, "decode the encrypted secret")
+			block, err := aes.NewCipher(tc.key)
+			assert.Nil(t, err, "create AES cipher")
+			aead, err := cipher.NewGCM(block)
+			assert.Nil(t, err, "create GCM")
+			_, err = aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+			assert.NotNil(t, err, "check the secret can't be decrypted by the EncryptionKey")
+		})
+	}
+}
+
+func TestKeepLiveManifestSecrets(t *testing.T) {
+	t.Parallel()
+
+	desired := &Consumer{Name: "jack", Credentials: map[string]interface{}{
+		KeyAuthCredentialType:   map[string]interface{}{},
+		BasicAuthCredentialType: map[string]interface{}{"username": "jack", "password": "new"},
+	}}
+	live := &Consumer{ID: 1, Name: "jack", Credentials: map[string]interface{}{
+		KeyAuthCredentialType:   map[string]interface{}{"key": "jack-key"},
+		BasicAuthCredentialType: map[string]interface{}{"username": "jack", "password": "old"},
+		HMACAuthCredentialType:  map[string]interface{}{"access_key": "jack", "secret_key": "jack-secret"},
+	}}
+	body := *desired
+	assert.Nil(t, keepLiveManifestSecrets(ManifestKindConsumer, &body, live), "keep the live consumer secrets")
+	assert.Equal(t, map[string]interface{}{
+		KeyAuthCredentialType:   map[string]interface{}{"key": "jack-key"},
+		BasicAuthCredentialType: map[string]interface{}{"username": "jack", "password": "new"},
+	}, body.Credentials, "check the absent secret is filled and the others are kept")
+	assert.Empty(t, desired.Credentials[KeyAuthCredentialType], "check the desired consumer is unchanged")
+
+	lc := LogCollection{Name: "kafka", Type: KafkaLogCollection, Spec: &KafkaLoggerSpec{Brokers: []KafkaBroker{
+		{Host: "10.0.0.1", Port: 9092, SASLConfig: &KafkaSASLConfig{User: "admin"}},
+		{Host: "10.0.0.2", Port: 9092, SASLConfig: &KafkaSASLConfig{User: "admin"}},
+	}}}
+	liveLC := &LogCollection{ID: 2, Name: "kafka", Type: KafkaLogCollection, Spec: &KafkaLoggerSpec{Brokers: []KafkaBroker{
+		{Host: "10.0.0.1", Port: 9092, SASLConfig: &KafkaSASLConfig{User: "admin", Password: "secret"}},
+	}}}
+	assert.Nil(t, keepLiveManifestSecrets(ManifestKindLogCollection, &lc, liveLC), "keep the live log collection secrets")
+	brokers := lc.Spec.(*KafkaLoggerSpec).Brokers
+	assert.Equal(t, "secret", brokers[0].SASLConfig.Password, "check the broker password is filled")
+	assert.Equal(t, "", brokers[1].SASLConfig.Password, "check the new broker is unchanged")
+}
+
+func TestCheckManifestSecrets(t *testing.T) {
+	t.Parallel()
+
+	secrets, err := newManifestSecretCipher(bytes.Repeat([]byte{1}, 16))
+	assert.Nil(t, err, "create cipher")
+
+	m := &Manifest{LogCollections: []*LogCollection{{
+		Name: "kafka",
+		Type: KafkaLogCollection,
+		Spec: &KafkaLoggerSpec{Brokers: []KafkaBroker{
+			{Host: "10.0.0.1", Port: 9092},
+			{Host: "10.0.0.2", Port: 9092, SASLConfig: &KafkaSASLConfig{User: "admin", Password: secrets.encrypt("secret")}},
+		}},
+	}}}
+	err = checkManifestSecrets(m)
+	assert.Contains(t, err.Error(), "LogCollection kafka: spec.brokers[1].sasl_config.password is encrypted", "check the error details")
+
+	m.LogCollections[0].Spec.(*KafkaLoggerSpec).Brokers[1].SASLConfig.Password = "secret"
+	assert.Nil(t, checkManifestSecrets(m), "check the plain secrets")
+}
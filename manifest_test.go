@@ -0,0 +1,381 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestManifest returns a Manifest which contains all kinds of resources,
+// the certificates are issued by the `ca`.
+func newTestManifest(t *testing.T, ca *DevCA) *Manifest {
+	serverCert, err := ca.IssueCertificate(&DevCertificateRequest{
+		SNIs:   []string{"api7.local"},
+		Labels: []string{"managed"},
+	})
+	assert.Nil(t, err, "issue server certificate")
+	clientCert, err := ca.IssueCertificate(&DevCertificateRequest{
+		Type:    ClientCertificate,
+		Subject: pkix.Name{CommonName: "gateway"},
+		Labels:  []string{"managed"},
+	})
+	assert.Nil(t, err, "issue client certificate")
+
+	return &Manifest{
+		Certificates: []*ManifestCertificate{
+			{Name: "server", Certificate: *serverCert},
+			{Name: "upstream-client", Certificate: *clientCert},
+		},
+		ServiceRegistries: []*ServiceRegistry{
+			{
+				ServiceRegistrySpec: ServiceRegistrySpec{
+					Name:    "dns",
+					Enabled: true,
+					Type:    ServiceRegistryDNS,
+					DNS:     &DNSServiceRegistry{Servers: []string{"127.0.0.1:53"}},
+				},
+			},
+		},
+		LogCollections: []*LogCollection{
+			{
+				Name: "http-logger",
+				Type: HTTPLogCollection,
+				Spec: &HTTPLoggerSpec{URI: "http://logs.api7.local"},
+			},
+		},
+		Consumers: []*Consumer{
+			{Name: "jack", Labels: []string{"managed"}},
+		},
+		Applications: []*ManifestApplication{
+			{
+				Application: Application{
+					ApplicationSpec: ApplicationSpec{
+						Name:       "web",
+						Labels:     []string{"managed"},
+						Protocols:  []string{ProtocolHTTP},
+						PathPrefix: "/web",
+						Hosts:      []string{"api7.local"},
+						Upstreams: []UpstreamAndVersion{
+							{
+								Version:  "v1",
+								Upstream: Upstream{Scheme: UpstreamSchemeHTTPS},
+							},
+							{
+								Version: "v2",
+								Upstream: Upstream{
+									Scheme: UpstreamSchemeHTTP,
+									ServiceDiscovery: &UpstreamServiceDiscovery{
+										ServiceRegistry: ServiceRegistryDNS,
+										DNSService:      &DNSUpstreamServiceDiscovery{ServiceName: "web.svc"},
+									},
+								},
+							},
+						},
+						DefaultUpstreamVersion: "v1",
+					},
+				},
+				UpstreamReferences: []ManifestUpstreamReference{
+					{Version: "v1", ClientCertificate: "upstream-client"},
+					{Version: "v2", ServiceRegistry: "dns"},
+				},
+				APIs: []*API{
+					{APISpec: APISpec{Name: "users", Paths: []APIPath{{Path: "/users", PathType: PathPrefixMatch}}, Labels: []string{"managed"}}},
+				},
+				CanaryReleases: []*CanaryRelease{
+					{CanaryReleaseSpec: CanaryReleaseSpec{Name: "v2", Type: "percent", CanaryUpstreamVersion: "v2", Percent: 10}},
+				},
+			},
+		},
+	}
+}
+
+func planActions(plan *Plan) []string {
+	var actions []string
+	for _, step := range plan.Steps {
+		actions = append(actions, fmt.Sprintf("%s %s %s", step.Action, step.Kind, step.Name))
+	}
+	return actions
+}
+
+func TestApplyManifest(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	desired := newTestManifest(t, ca)
+	cli := newMemoryHTTPClient()
+	impl := newManifest(cli)
+
+	plan, err := impl.Apply(context.Background(), 1, desired, nil)
+	assert.Nil(t, err, "check the apply error")
+	assert.Equal(t, []string{
+		"create Certificate server",
+		"create Certificate upstream-client",
+		"create ServiceRegistry dns",
+		"create LogCollection http-logger",
+		"create Consumer jack",
+		"create Application web",
+		"create API web/users",
+		"create CanaryRelease web/v2",
+	}, planActions(plan), "check the plan")
+
+	certs := cli.items("/clusters/1/certificates")
+	registries := cli.items("/clusters/1/service_registries")
+	apps := cli.items("/clusters/1/apps")
+	assert.Len(t, certs, 2, "check the certificates")
+	assert.Len(t, apps, 1, "check the applications")
+	app, err := impl.applications.GetApplication(context.Background(), plan.Steps[5].ID, &ResourceGetOptions{Cluster: &Cluster{ID: 1}})
+	assert.Nil(t, err, "get the application")
+	assert.Equal(t, certs[1]["id"], app.Upstreams[0].Upstream.ClientCertID.String(), "check the client certificate reference")
+	assert.Equal(t, registries[0]["id"], app.Upstreams[1].Upstream.ServiceDiscovery.ServiceRegistryID.String(), "check the service registry reference")
+	assert.Equal(t, "web.svc", app.Upstreams[1].Upstream.ServiceDiscovery.DNSService.ServiceName, "check the service discovery settings are kept")
+	assert.Len(t, cli.items("/apps/"+app.ID.String()+"/apis"), 1, "check the apis")
+	assert.Len(t, cli.items("/apps/"+app.ID.String()+"/canary_releases"), 1, "check the canary releases")
+
+	plan, err = impl.PlanManifest(context.Background(), 1, desired, nil)
+	assert.Nil(t, err, "check the plan error")
+	assert.False(t, plan.HasChanges(), "check nothing changes after applying")
+	assert.Equal(t, 8, plan.Count(PlanActionNoop), "check the noop steps")
+
+	// Re-issue the client certificate and change the API.
+	clientCert, err := ca.IssueCertificate(&DevCertificateRequest{
+		Type:    ClientCertificate,
+		Subject: pkix.Name{CommonName: "gateway"},
+		Labels:  []string{"managed"},
+	})
+	assert.Nil(t, err, "issue client certificate")
+	desired.Certificates[1].Certificate = *clientCert
+	desired.Applications[0].APIs[0].Methods = []string{"GET"}
+	cli.calls = nil
+	plan, err = impl.Apply(context.Background(), 1, desired, nil)
+	assert.Nil(t, err, "check the apply error")
+	assert.Equal(t, []string{
+		"PUT " + _apiPathPrefix + "/clusters/1/certificates/" + certs[1]["id"].(string),
+		"PUT " + _apiPathPrefix + "/apps/" + app.ID.String() + "/apis/" + plan.Steps[6].ID.String(),
+	}, cli.calls, "check only the changed resources are updated")
+}
+
+func TestPlanManifest(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+
+	testCases := []struct {
+		name            string
+		seed            func(cli *memoryHTTPClient)
+		desired         func(m *Manifest)
+		opts            *ApplyOptions
+		expectedActions []string
+		expectedError   string
+	}{
+		{
+			name: "prune the labeled resources",
+			seed: func(cli *memoryHTTPClient) {
+				cli.seed("/clusters/1/consumers", &Consumer{Name: "legacy", Labels: []string{"managed"}})
+				cli.seed("/clusters/1/consumers", &Consumer{Name: "unmanaged"})
+				appID := cli.seed("/clusters/1/apps", &Application{ApplicationSpec: ApplicationSpec{Name: "web", Labels: []string{"managed"}}})
+				cli.seed("/apps/"+appID.String()+"/apis", &API{APISpec: APISpec{Name: "legacy", Labels: []string{"managed"}}})
+				cli.seed("/apps/"+appID.String()+"/canary_releases", &CanaryRelease{CanaryReleaseSpec: CanaryReleaseSpec{Name: "legacy"}})
+				cli.seed("/clusters/1/apps", &Application{ApplicationSpec: ApplicationSpec{Name: "legacy", Labels: []string{"managed"}}})
+			},
+			desired: func(m *Manifest) {
+				m.Certificates = nil
+				m.Applications[0].UpstreamReferences = nil
+			},
+			opts: &ApplyOptions{Prune: true, PruneLabels: []string{"managed"}},
+			expectedActions: []string{
+				"create ServiceRegistry dns",
+				"create LogCollection http-logger",
+				"create Consumer jack",
+				"update Application web",
+				"create API web/users",
+				"create CanaryRelease web/v2",
+				"delete CanaryRelease web/legacy",
+				"delete API web/legacy",
+				"delete Application legacy",
+				"delete Consumer legacy",
+			},
+		},
+		{
+			name: "update the application when the referenced certificate is created",
+			seed: func(cli *memoryHTTPClient) {
+				cli.seed("/clusters/1/apps", &Application{ApplicationSpec: ApplicationSpec{Name: "web"}})
+			},
+			desired: func(m *Manifest) {
+				m.ServiceRegistries, m.LogCollections, m.Consumers = nil, nil, nil
+				m.Applications[0].APIs, m.Applications[0].CanaryReleases = nil, nil
+				m.Applications[0].UpstreamReferences = m.Applications[0].UpstreamReferences[:1]
+				m.Applications[0].Application = Application{}
+				m.Applications[0].Name = "web"
+				m.Applications[0].Upstreams = []UpstreamAndVersion{{Version: "v1"}}
+			},
+			expectedActions: []string{
+				"create Certificate server",
+				"create Certificate upstream-client",
+				"update Application web",
+			},
+		},
+		{
+			name:          "prune without labels",
+			opts:          &ApplyOptions{Prune: true},
+			expectedError: "prune labels are required to prune resources",
+		},
+		{
+			name: "duplicated application",
+			desired: func(m *Manifest) {
+				m.Applications = append(m.Applications, m.Applications[0])
+			},
+			expectedError: "duplicated application web",
+		},
+		{
+			name: "unknown certificate",
+			desired: func(m *Manifest) {
+				m.Applications[0].UpstreamReferences[0].ClientCertificate = "unknown"
+			},
+			expectedError: `application web references unknown certificate "unknown"`,
+		},
+		{
+			name: "unknown upstream version",
+			desired: func(m *Manifest) {
+				m.Applications[0].UpstreamReferences[0].Version = "v3"
+			},
+			expectedError: `application web has no upstream with version "v3"`,
+		},
+		{
+			name: "invalid certificate",
+			desired: func(m *Manifest) {
+				m.Certificates[0].PrivateKey = m.Certificates[1].PrivateKey
+			},
+			expectedError: "validate certificate server: private key doesn't match the certificate",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := newMemoryHTTPClient()
+			if tc.seed != nil {
+				tc.seed(cli)
+			}
+			desired := newTestManifest(t, ca)
+			if tc.desired != nil {
+				tc.desired(desired)
+			}
+			plan, err := newManifest(cli).PlanManifest(context.Background(), 1, desired, tc.opts)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			assert.Equal(t, tc.expectedActions, planActions(plan), "check the plan")
+			assert.Empty(t, cli.calls, "check nothing is changed")
+		})
+	}
+}
+
+func TestPlanManifestWithDuplicatedLiveCertificates(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewDevCA(nil)
+	assert.Nil(t, err, "create dev CA")
+	desired := newTestManifest(t, ca)
+	desired.Applications = nil
+	issueClientCert := func(cn string, labels ...string) *Certificate {
+		cert, err := ca.IssueCertificate(&DevCertificateRequest{
+			Type:    ClientCertificate,
+			Subject: pkix.Name{CommonName: cn},
+			Labels:  labels,
+		})
+		assert.Nil(t, err, "issue client certificate")
+		return cert
+	}
+
+	testCases := []struct {
+		name            string
+		live            []*Certificate
+		opts            *ApplyOptions
+		expectedActions []string
+		expectedError   string
+	}{
+		{
+			name: "unreferenced duplicates are kept",
+			live: []*Certificate{issueClientCert("legacy"), issueClientCert("legacy")},
+			expectedActions: []string{
+				"create Certificate server",
+				"create Certificate upstream-client",
+				"create ServiceRegistry dns",
+				"create LogCollection http-logger",
+				"create Consumer jack",
+			},
+		},
+		{
+			name: "unreferenced duplicates are pruned by labels",
+			live: []*Certificate{issueClientCert("legacy", "managed"), issueClientCert("legacy", "managed")},
+			opts: &ApplyOptions{Prune: true, PruneLabels: []string{"managed"}},
+			expectedActions: []string{
+				"create Certificate server",
+				"create Certificate upstream-client",
+				"create ServiceRegistry dns",
+				"create LogCollection http-logger",
+				"create Consumer jack",
+				"delete Certificate legacy",
+				"delete Certificate legacy",
+			},
+		},
+		{
+			name: "match the duplicates by serial number",
+			live: []*Certificate{issueClientCert("gateway"), &desired.Certificates[1].Certificate},
+			expectedActions: []string{
+				"create Certificate server",
+				"noop Certificate upstream-client",
+				"create ServiceRegistry dns",
+				"create LogCollection http-logger",
+				"create Consumer jack",
+			},
+		},
+		{
+			name:          "ambiguous duplicates",
+			live:          []*Certificate{issueClientCert("gateway"), issueClientCert("gateway")},
+			expectedError: "certificate upstream-client: found multiple Client certificates for SNIs [gateway]",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cli := newMemoryHTTPClient()
+			for _, cert := range tc.live {
+				cli.seed("/clusters/1/certificates", cert)
+			}
+			plan, err := newManifest(cli).PlanManifest(context.Background(), 1, desired, tc.opts)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			assert.Equal(t, tc.expectedActions, planActions(plan), "check the plan")
+		})
+	}
+}
@@ -70,6 +70,10 @@ type Options struct {
 	// should be added for each API requests.
 	// Note, the ID will be put in the `X-Request-ID` header.
 	GenIDForCalls bool `json:"gen_id_for_calls" yaml:"gen_id_for_calls"`
+	// ValidatePlugins indicates if the plugins should be validated (see ValidatePlugins)
+	// before calling CreateApplication, UpdateAPI, UpdateClusterPlugins and UpdateConsumer,
+	// so that the invalid plugins can be found without sending requests to API7 Cloud.
+	ValidatePlugins bool `json:"validate_plugins" yaml:"validate_plugins"`
 }
 
 func (o *Options) merge(o2 *Options) {
@@ -17,8 +17,13 @@ package cloud
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"path"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -31,6 +36,15 @@ const (
 	MemberStatePending = "Pending"
 	// MemberStateActive means the member is active.
 	MemberStateActive = "Active"
+
+	// PermissionScopeOrganization indicates the organization scope of permissions.
+	PermissionScopeOrganization = "organization"
+	// PermissionScopeCluster indicates the cluster scope of permissions.
+	PermissionScopeCluster = "cluster"
+	// PermissionScopeBilling indicates the billing scope of permissions.
+	PermissionScopeBilling = "billing"
+	// PermissionScopeAPIManagement indicates the API management scope of permissions.
+	PermissionScopeAPIManagement = "api_management"
 )
 
 // Organization is the specification of an API7 Cloud organization.
@@ -57,7 +71,7 @@ type Organization struct {
 // Member is the member of organization.
 // It contains the member specification and some management fields.
 type Member struct {
-	MemberSpec `json:"-"`
+	MemberSpec `json:",inline" yaml:",inline"`
 
 	// ID is the unique identify to mark an object.
 	ID ID `json:"id,omitempty,inline" yaml:"id"`
@@ -78,9 +92,9 @@ type MemberSpec struct {
 	// LastName is the member last name
 	LastName string `json:"last_name,omitempty" yaml:"last_name"`
 	// Roles indicates the roles of the member.
-	Roles []Role `json:"roles"`
+	Roles []Role `json:"roles" yaml:"roles"`
 	// Email is the email address of the member.
-	Email string `json:"email"`
+	Email string `json:"email" yaml:"email"`
 	// UserId refers to a user, since a 3rd party User Management
 	// Service might be used so the type is not uint64.
 	UserId string `json:"user_id,omitempty" yaml:"user_id"`
@@ -116,6 +130,80 @@ type Permissions struct {
 	APIManagement map[string]Methods `json:"api_management"`
 }
 
+// Allows reports whether the given HTTP `method` (e.g. http.MethodGet) is allowed.
+func (m Methods) Allows(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		return m.Get
+	case http.MethodPut:
+		return m.Put
+	case http.MethodPost:
+		return m.Post
+	case http.MethodPatch:
+		return m.Patch
+	case http.MethodDelete:
+		return m.Delete
+	default:
+		return false
+	}
+}
+
+// Allows reports whether the permissions allow to perform the HTTP `method`
+// (e.g. http.MethodGet) on the `resource` in the `scope`.
+// Optional values of `scope` can be:
+// * PermissionScopeOrganization
+// * PermissionScopeCluster
+// * PermissionScopeBilling
+// * PermissionScopeAPIManagement
+func (p *Permissions) Allows(scope, resource, method string) bool {
+	var matrix map[string]Methods
+
+	switch scope {
+	case PermissionScopeOrganization:
+		matrix = p.Organization
+	case PermissionScopeCluster:
+		matrix = p.Cluster
+	case PermissionScopeBilling:
+		matrix = p.Billing
+	case PermissionScopeAPIManagement:
+		matrix = p.APIManagement
+	default:
+		return false
+	}
+	methods, ok := matrix[resource]
+	if !ok {
+		return false
+	}
+	return methods.Allows(method)
+}
+
+// RoleBindingsAllow reports whether any of the role bindings allows to perform the
+// HTTP `method` on the `resource` in the `scope`.
+// The `roles` parameter should contain the roles that the bindings refer to,
+// bindings which refer to unknown roles will be ignored.
+// The `clusterID` parameter specifies the cluster where the resource is, a binding
+// of a cluster scoped role takes effect only if its ClusterID is same to `clusterID`.
+// Note the owner role allows everything.
+func RoleBindingsAllow(bindings []RoleBinding, roles []Role, clusterID ID, scope, resource, method string) bool {
+	roleMap := make(map[ID]*Role, len(roles))
+	for i := range roles {
+		roleMap[roles[i].ID] = &roles[i]
+	}
+	for _, binding := range bindings {
+		role, ok := roleMap[binding.RoleID]
+		if !ok {
+			continue
+		}
+		if role.Scope == RoleScopeCluster && binding.ClusterID != clusterID {
+			continue
+		}
+		if role.Owner || role.Permissions.Allows(scope, resource, method) {
+			return true
+		}
+	}
+	return false
+}
+
 // Role is the role of a member.
 type Role struct {
 	// ID is the id of role
@@ -148,6 +236,70 @@ type RoleBinding struct {
 	ClusterID ID `json:"cluster_id"`
 }
 
+// IsOwner reports whether the member is the owner of the organization.
+func (m *Member) IsOwner() bool {
+	for _, role := range m.Roles {
+		if role.Owner {
+			return true
+		}
+	}
+	return false
+}
+
+// DesiredMember is the expected state of an organization member,
+// it's used by SyncMembers.
+type DesiredMember struct {
+	// Email is the email address of the member.
+	Email string
+	// RoleBindings indicates the roles that the member should have,
+	// at least one role binding should be specified.
+	RoleBindings []RoleBinding
+}
+
+// SyncMembersOptions contains some options for synchronizing organization members.
+type SyncMembersOptions struct {
+	// Organization indicates where the members are.
+	Organization *Organization
+	// DryRun indicates only reporting the changes without applying them.
+	DryRun bool
+}
+
+// MemberSyncAction is the kind of change made by SyncMembers.
+type MemberSyncAction string
+
+const (
+	// MemberSyncInvite means inviting a new member.
+	MemberSyncInvite MemberSyncAction = "invite"
+	// MemberSyncUpdateRoles means updating the roles of an existing member.
+	MemberSyncUpdateRoles MemberSyncAction = "update_roles"
+	// MemberSyncRemove means removing an existing member.
+	MemberSyncRemove MemberSyncAction = "remove"
+)
+
+// MemberSyncChange is a change made (or planned in dry-run mode) by SyncMembers.
+type MemberSyncChange struct {
+	// Action is the kind of change.
+	Action MemberSyncAction
+	// Email is the email address of the member.
+	Email string
+	// MemberID is the ID of the member, it's zero when inviting a member in dry-run mode.
+	MemberID ID
+	// RoleBindings indicates the new roles of the member, it's empty
+	// when removing a member.
+	RoleBindings []RoleBinding
+}
+
+// MemberSyncReport is the result of SyncMembers.
+type MemberSyncReport struct {
+	// DryRun indicates whether the changes were applied.
+	DryRun bool
+	// Changes contains the changes in the order they were (or would be) applied.
+	Changes []MemberSyncChange
+	// SkippedOwners contains the email addresses of organization owners which
+	// should be changed, owners are never updated or removed by SyncMembers.
+	SkippedOwners []string
+}
+
 // OrganizationInterface is the interface for manipulating Organization and Member.
 type OrganizationInterface interface {
 	// GetOrganization gets an existing API7 Cloud Organization.
@@ -180,10 +332,40 @@ type OrganizationInterface interface {
 	// The given `roleBindings` parameter specifies new roles for this member.
 	// Users need to specify the Organization in the `opts`.
 	UpdateMemberRoles(ctx context.Context, memberID ID, roleBindings []RoleBinding, opts *ResourceUpdateOptions) error
+	// FindMemberByEmail finds the member with the given email address (case-insensitive)
+	// in the organization, ErrMemberNotFound will be returned if there is no such member.
+	// Users need to specify the Organization in the `opts`.
+	FindMemberByEmail(ctx context.Context, email string, opts *ResourceGetOptions) (*Member, error)
+	// SyncMembers invites, updates roles or removes members so that the members of the
+	// organization match the `desired` list. Members whose email addresses are not
+	// in the `desired` list will be removed, and the organization owner is never changed.
+	// Since the member roles don't carry the cluster IDs, two role binding lists are
+	// considered as same if they refer to the same set of roles.
+	// Users need to specify the Organization in the `opts`, when opts.DryRun is true,
+	// the changes will be reported without being applied.
+	// The report contains the applied changes even if an error occurred.
+	SyncMembers(ctx context.Context, desired []DesiredMember, opts *SyncMembersOptions) (*MemberSyncReport, error)
 	// ListRoles returns an iterator for listing Roles in the specified Organization with the
 	// given list conditions.
 	// Users need to specify the Organization, Paging in the `opts`.
 	ListRoles(ctx context.Context, opts *ResourceListOptions) (RoleListIterator, error)
+	// CreateRole creates a custom role in the organization.
+	// The given `role` parameter should specify the Name, Scope and Permissions of the role.
+	// Users need to specify the Organization in the `opts`.
+	CreateRole(ctx context.Context, role *Role, opts *ResourceCreateOptions) (*Role, error)
+	// UpdateRole updates an existing custom role in the organization.
+	// The given `role` parameter should specify the ID of the role and the new
+	// Name, Scope and Permissions.
+	// Users need to specify the Organization in the `opts`.
+	UpdateRole(ctx context.Context, role *Role, opts *ResourceUpdateOptions) (*Role, error)
+	// DeleteRole deletes an existing custom role in the organization.
+	// The given `roleID` parameter should specify the role that you want to delete.
+	// Users need to specify the Organization in the `opts`.
+	DeleteRole(ctx context.Context, roleID ID, opts *ResourceDeleteOptions) error
+	// GetRole gets an existing role in the organization.
+	// The given `roleID` parameter should specify the role that you want to get.
+	// Users need to specify the Organization in the `opts`.
+	GetRole(ctx context.Context, roleID ID, opts *ResourceGetOptions) (*Role, error)
 	// TransferOwnership transfers the organization ownership from yourself to another member.
 	// The `toMember` parameter should specify the existing member in the same organization.
 	// Users need to specify the Organization, Paging in the `opts`.
@@ -194,12 +376,16 @@ type OrganizationInterface interface {
 
 // MemberListIterator is an iterator for listing Members.
 type MemberListIterator interface {
+	Checkpointer
+
 	// Next returns the next Member according to the filter conditions.
 	Next() (*Member, error)
 }
 
 // RoleListIterator is an iterator for listing Roles.
 type RoleListIterator interface {
+	Checkpointer
+
 	// Next returns the next Role according to the filter conditions.
 	Next() (*Role, error)
 }
@@ -227,6 +413,10 @@ func (iter *memberListIterator) Next() (*Member, error) {
 	return &member, nil
 }
 
+func (iter *memberListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
 type roleListIterator struct {
 	iter listIterator
 }
@@ -246,6 +436,10 @@ func (iter *roleListIterator) Next() (*Role, error) {
 	return &role, nil
 }
 
+func (iter *roleListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
 func newOrganization(cli httpClient) OrganizationInterface {
 	return &organizationImpl{
 		client: cli,
@@ -265,12 +459,20 @@ func (impl *organizationImpl) GetOrganization(ctx context.Context, orgID ID, _ *
 
 func (impl *organizationImpl) ListMembers(ctx context.Context, opts *ResourceListOptions) (MemberListIterator, error) {
 	iter := listIterator{
-		ctx:      ctx,
-		resource: "member",
-		client:   impl.client,
-		path:     path.Join(_apiPathPrefix, "orgs", opts.Organization.ID.String(), "members"),
-		paging:   mergePagination(opts.Pagination),
-		headers:  appendHeader(mapClusterIdFromOpts(opts)),
+		ctx:             ctx,
+		resource:        "member",
+		client:          impl.client,
+		path:            path.Join(_apiPathPrefix, "orgs", opts.Organization.ID.String(), "members"),
+		paging:          mergePagination(opts.Pagination),
+		filter:          opts.Filter,
+		resourceFilters: filterState | filterRole,
+		headers:         appendHeader(mapClusterIdFromOpts(opts)),
+	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
 	}
 
 	return &memberListIterator{
@@ -287,12 +489,56 @@ func (impl *organizationImpl) ListRoles(ctx context.Context, opts *ResourceListO
 		paging:   mergePagination(opts.Pagination),
 		headers:  appendHeader(mapClusterIdFromOpts(opts)),
 	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
+	}
 
 	return &roleListIterator{
 		iter: iter,
 	}, nil
 }
 
+func (impl *organizationImpl) CreateRole(ctx context.Context, role *Role, opts *ResourceCreateOptions) (*Role, error) {
+	var createdRole Role
+
+	uri := path.Join(_apiPathPrefix, "orgs", opts.Organization.ID.String(), "roles")
+	err := impl.client.sendPostRequest(ctx, uri, "", role, jsonPayloadDecodeFactory(&createdRole), appendHeader(mapClusterIdFromOpts(opts)))
+	if err != nil {
+		return nil, err
+	}
+	return &createdRole, nil
+}
+
+func (impl *organizationImpl) UpdateRole(ctx context.Context, role *Role, opts *ResourceUpdateOptions) (*Role, error) {
+	var updatedRole Role
+
+	uri := path.Join(_apiPathPrefix, "orgs", opts.Organization.ID.String(), "roles", role.ID.String())
+	err := impl.client.sendPutRequest(ctx, uri, "", role, jsonPayloadDecodeFactory(&updatedRole), appendHeader(mapClusterIdFromOpts(opts)))
+	if err != nil {
+		return nil, err
+	}
+	return &updatedRole, nil
+}
+
+func (impl *organizationImpl) DeleteRole(ctx context.Context, roleID ID, opts *ResourceDeleteOptions) error {
+	uri := path.Join(_apiPathPrefix, "orgs", opts.Organization.ID.String(), "roles", roleID.String())
+	return impl.client.sendDeleteRequest(ctx, uri, "", nil, appendHeader(mapClusterIdFromOpts(opts)))
+}
+
+func (impl *organizationImpl) GetRole(ctx context.Context, roleID ID, opts *ResourceGetOptions) (*Role, error) {
+	var role Role
+
+	uri := path.Join(_apiPathPrefix, "orgs", opts.Organization.ID.String(), "roles", roleID.String())
+	err := impl.client.sendGetRequest(ctx, uri, "", jsonPayloadDecodeFactory(&role), appendHeader(mapClusterIdFromOpts(opts)))
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
 func (impl *organizationImpl) InviteMember(ctx context.Context, email string, role *Role, opts *ResourceCreateOptions) (*Member, error) {
 	var member Member
 
@@ -360,3 +606,175 @@ func (impl *organizationImpl) UpdateMemberRoles(ctx context.Context, memberID ID
 	}
 	return nil
 }
+
+func (impl *organizationImpl) FindMemberByEmail(ctx context.Context, email string, opts *ResourceGetOptions) (*Member, error) {
+	iter, err := impl.ListMembers(ctx, &ResourceListOptions{
+		Organization: opts.Organization,
+		Cluster:      opts.Cluster,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		member, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if member == nil {
+			return nil, ErrMemberNotFound
+		}
+		if strings.EqualFold(member.Email, email) {
+			return member, nil
+		}
+	}
+}
+
+func (impl *organizationImpl) SyncMembers(ctx context.Context, desired []DesiredMember, opts *SyncMembersOptions) (*MemberSyncReport, error) {
+	report := &MemberSyncReport{
+		DryRun: opts.DryRun,
+	}
+
+	desiredMap := make(map[string]*DesiredMember, len(desired))
+	for i := range desired {
+		email := strings.ToLower(desired[i].Email)
+		if _, ok := desiredMap[email]; ok {
+			return nil, fmt.Errorf("duplicated member %s", desired[i].Email)
+		}
+		if len(desired[i].RoleBindings) == 0 {
+			return nil, fmt.Errorf("member %s has no role bindings", desired[i].Email)
+		}
+		desiredMap[email] = &desired[i]
+	}
+
+	iter, err := impl.ListMembers(ctx, &ResourceListOptions{
+		Organization: opts.Organization,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var existing []*Member
+	for {
+		member, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		if member == nil {
+			break
+		}
+		existing = append(existing, member)
+	}
+
+	var changes []MemberSyncChange
+	found := make(map[string]struct{}, len(existing))
+	for _, member := range existing {
+		email := strings.ToLower(member.Email)
+		found[email] = struct{}{}
+
+		want, ok := desiredMap[email]
+		if ok && sameRoles(member.Roles, want.RoleBindings) {
+			continue
+		}
+		if member.IsOwner() {
+			report.SkippedOwners = append(report.SkippedOwners, member.Email)
+			continue
+		}
+		if ok {
+			changes = append(changes, MemberSyncChange{
+				Action:       MemberSyncUpdateRoles,
+				Email:        member.Email,
+				MemberID:     member.ID,
+				RoleBindings: want.RoleBindings,
+			})
+		} else {
+			changes = append(changes, MemberSyncChange{
+				Action:   MemberSyncRemove,
+				Email:    member.Email,
+				MemberID: member.ID,
+			})
+		}
+	}
+	for i := range desired {
+		if _, ok := found[strings.ToLower(desired[i].Email)]; ok {
+			continue
+		}
+		changes = append(changes, MemberSyncChange{
+			Action:       MemberSyncInvite,
+			Email:        desired[i].Email,
+			RoleBindings: desired[i].RoleBindings,
+		})
+	}
+
+	if opts.DryRun {
+		report.Changes = changes
+		return report, nil
+	}
+
+	for _, change := range changes {
+		switch change.Action {
+		case MemberSyncInvite:
+			member, err := impl.inviteMemberWithBindings(ctx, change.Email, change.RoleBindings, opts.Organization)
+			if err != nil {
+				return report, errors.Wrapf(err, "invite member %s", change.Email)
+			}
+			change.MemberID = member.ID
+		case MemberSyncUpdateRoles:
+			err = impl.UpdateMemberRoles(ctx, change.MemberID, change.RoleBindings, &ResourceUpdateOptions{
+				Organization: opts.Organization,
+			})
+			if err != nil {
+				return report, errors.Wrapf(err, "update roles of member %s", change.Email)
+			}
+		case MemberSyncRemove:
+			err = impl.RemoveMember(ctx, change.MemberID, &ResourceDeleteOptions{
+				Organization: opts.Organization,
+			})
+			if err != nil {
+				return report, errors.Wrapf(err, "remove member %s", change.Email)
+			}
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	return report, nil
+}
+
+// inviteMemberWithBindings invites the member with the first role binding,
+// and updates the member roles if more role bindings are specified.
+func (impl *organizationImpl) inviteMemberWithBindings(ctx context.Context, email string, bindings []RoleBinding, org *Organization) (*Member, error) {
+	member, err := impl.InviteMember(ctx, email, &Role{ID: bindings[0].RoleID}, &ResourceCreateOptions{
+		Organization: org,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(bindings) == 1 && bindings[0].ClusterID == 0 {
+		return member, nil
+	}
+	err = impl.UpdateMemberRoles(ctx, member.ID, bindings, &ResourceUpdateOptions{
+		Organization: org,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// sameRoles reports whether the roles and the role bindings refer to the same set of roles.
+func sameRoles(roles []Role, bindings []RoleBinding) bool {
+	current := make(map[ID]struct{}, len(roles))
+	for _, role := range roles {
+		current[role.ID] = struct{}{}
+	}
+	expected := make(map[ID]struct{}, len(bindings))
+	for _, binding := range bindings {
+		expected[binding.RoleID] = struct{}{}
+	}
+	if len(current) != len(expected) {
+		return false
+	}
+	for id := range expected {
+		if _, ok := current[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
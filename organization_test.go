@@ -16,9 +16,11 @@ package cloud
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"net/http"
 	"path"
 	"testing"
 )
@@ -465,3 +467,373 @@ func TestTransferOwnership(t *testing.T) {
 		})
 	}
 }
+
+func TestRoleCRUD(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		expectedError string
+		mockFunc      func(t *testing.T) httpClient
+		call          func(impl OrganizationInterface) error
+	}{
+		{
+			name: "create role",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/roles"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				return cli
+			},
+			call: func(impl OrganizationInterface) error {
+				_, err := impl.CreateRole(context.Background(), &Role{Name: "viewer"}, &ResourceCreateOptions{
+					Organization: &Organization{ID: 1},
+				})
+				return err
+			},
+		},
+		{
+			name: "update role",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/roles/12"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+				return cli
+			},
+			call: func(impl OrganizationInterface) error {
+				_, err := impl.UpdateRole(context.Background(), &Role{ID: 12, Name: "viewer"}, &ResourceUpdateOptions{
+					Organization: &Organization{ID: 1},
+				})
+				return err
+			},
+			expectedError: "mock error",
+		},
+		{
+			name: "delete role",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/roles/12"), "", nil, gomock.Any()).Return(nil)
+				return cli
+			},
+			call: func(impl OrganizationInterface) error {
+				return impl.DeleteRole(context.Background(), 12, &ResourceDeleteOptions{
+					Organization: &Organization{ID: 1},
+				})
+			},
+		},
+		{
+			name: "get role",
+			mockFunc: func(t *testing.T) httpClient {
+				ctrl := gomock.NewController(t)
+				cli := NewMockhttpClient(ctrl)
+				cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/roles/12"), "", gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+				return cli
+			},
+			call: func(impl OrganizationInterface) error {
+				_, err := impl.GetRole(context.Background(), 12, &ResourceGetOptions{
+					Organization: &Organization{ID: 1},
+				})
+				return err
+			},
+			expectedError: "mock error",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.call(newOrganization(tc.mockFunc(t)))
+			if tc.expectedError == "" {
+				assert.Nil(t, err, "check role operation error")
+			} else {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			}
+		})
+	}
+}
+
+func TestPermissionsAllows(t *testing.T) {
+	t.Parallel()
+
+	perms := &Permissions{
+		Cluster: map[string]Methods{
+			"application": {Get: true, Put: true},
+		},
+		Billing: map[string]Methods{
+			"invoice": {Get: true},
+		},
+	}
+
+	assert.True(t, perms.Allows(PermissionScopeCluster, "application", http.MethodPut), "check allowed method")
+	assert.True(t, perms.Allows(PermissionScopeCluster, "application", "get"), "check lower case method")
+	assert.False(t, perms.Allows(PermissionScopeCluster, "application", http.MethodDelete), "check disallowed method")
+	assert.False(t, perms.Allows(PermissionScopeCluster, "consumer", http.MethodGet), "check unknown resource")
+	assert.False(t, perms.Allows(PermissionScopeOrganization, "invoice", http.MethodGet), "check another scope")
+	assert.False(t, perms.Allows("unknown", "invoice", http.MethodGet), "check unknown scope")
+}
+
+func TestRoleBindingsAllow(t *testing.T) {
+	t.Parallel()
+
+	roles := []Role{
+		{
+			ID:    1,
+			Scope: RoleScopeCluster,
+			Permissions: Permissions{
+				Cluster: map[string]Methods{
+					"application": {Get: true, Post: true},
+				},
+			},
+		},
+		{
+			ID:    2,
+			Scope: RoleScopeOrganization,
+			Permissions: Permissions{
+				Organization: map[string]Methods{
+					"member": {Get: true},
+				},
+			},
+		},
+		{
+			ID:    3,
+			Owner: true,
+			Scope: RoleScopeOrganization,
+		},
+	}
+
+	bindings := []RoleBinding{
+		{RoleID: 1, ClusterID: 10},
+		{RoleID: 2},
+		{RoleID: 100},
+	}
+	assert.True(t, RoleBindingsAllow(bindings, roles, 10, PermissionScopeCluster, "application", http.MethodPost), "check cluster role on the bound cluster")
+	assert.False(t, RoleBindingsAllow(bindings, roles, 11, PermissionScopeCluster, "application", http.MethodPost), "check cluster role on another cluster")
+	assert.True(t, RoleBindingsAllow(bindings, roles, 11, PermissionScopeOrganization, "member", http.MethodGet), "check organization role")
+	assert.False(t, RoleBindingsAllow(bindings, roles, 11, PermissionScopeOrganization, "member", http.MethodDelete), "check disallowed method")
+	assert.True(t, RoleBindingsAllow([]RoleBinding{{RoleID: 3}}, roles, 0, PermissionScopeBilling, "invoice", http.MethodDelete), "check owner role")
+}
+
+func mockListMembers(cli *MockhttpClient, payload string) {
+	cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/members"), "page=1&page_size=10",
+		gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, decode payloadDecodeFunc, _ http.Header) error {
+			return decode(json.RawMessage(payload))
+		})
+	cli.EXPECT().sendGetRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/members"), "page=2&page_size=10",
+		gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+}
+
+const _membersPayload = `{"list":[
+	{"id":"1","email":"owner@example.com","first_name":"Alice","state":"Active","roles":[{"id":"1","owner":true}]},
+	{"id":"2","email":"Bob@Example.com","first_name":"Bob","state":"Active","roles":[{"id":"2"}]},
+	{"id":"3","email":"carol@example.com","state":"Pending","roles":[{"id":"3"}]}
+]}`
+
+func TestMemberDecoding(t *testing.T) {
+	t.Parallel()
+
+	var member Member
+	err := json.Unmarshal([]byte(`{"id":"12","org_id":"1","email":"bob@example.com","first_name":"Bob","last_name":"Smith","user_id":"auth0|1","state":"Active","roles":[{"id":"2","name":"viewer"}]}`), &member)
+	assert.Nil(t, err, "check decode error")
+	assert.Equal(t, ID(12), member.ID, "check member id")
+	assert.Equal(t, ID(1), member.OrgId, "check org id")
+	assert.Equal(t, "bob@example.com", member.Email, "check email")
+	assert.Equal(t, "Bob", member.FirstName, "check first name")
+	assert.Equal(t, "Smith", member.LastName, "check last name")
+	assert.Equal(t, "auth0|1", member.UserId, "check user id")
+	assert.Equal(t, MemberStateActive, member.State, "check state")
+	assert.Equal(t, []Role{{ID: 2, Name: "viewer"}}, member.Roles, "check roles")
+}
+
+func TestListMembersWithFilter(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		filter *Filter
+		ids    []ID
+	}{
+		{
+			name:   "filter by state",
+			filter: &Filter{State: MemberStatePending},
+			ids:    []ID{3},
+		},
+		{
+			name:   "filter by role",
+			filter: &Filter{RoleID: 2},
+			ids:    []ID{2},
+		},
+		{
+			name:   "filter by state and role",
+			filter: &Filter{State: MemberStateActive, RoleID: 3},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			cli := NewMockhttpClient(ctrl)
+			mockListMembers(cli, _membersPayload)
+
+			iter, err := newOrganization(cli).ListMembers(context.Background(), &ResourceListOptions{
+				Organization: &Organization{ID: 1},
+				Filter:       tc.filter,
+			})
+			assert.Nil(t, err, "check list members error")
+
+			var ids []ID
+			for {
+				member, err := iter.Next()
+				assert.Nil(t, err, "check iterator error")
+				if member == nil {
+					break
+				}
+				ids = append(ids, member.ID)
+			}
+			assert.Equal(t, tc.ids, ids, "check listed members")
+		})
+	}
+}
+
+func TestFindMemberByEmail(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		email         string
+		expectedID    ID
+		expectedError string
+	}{
+		{
+			name:       "case-insensitive match",
+			email:      "bob@example.com",
+			expectedID: 2,
+		},
+		{
+			name:          "not found",
+			email:         "dave@example.com",
+			expectedError: ErrMemberNotFound.Error(),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			cli := NewMockhttpClient(ctrl)
+			mockListMembers(cli, _membersPayload)
+
+			member, err := newOrganization(cli).FindMemberByEmail(context.Background(), tc.email, &ResourceGetOptions{
+				Organization: &Organization{ID: 1},
+			})
+			if tc.expectedError == "" {
+				assert.Nil(t, err, "check find member error")
+				assert.Equal(t, tc.expectedID, member.ID, "check member id")
+			} else {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			}
+		})
+	}
+}
+
+func TestSyncMembers(t *testing.T) {
+	t.Parallel()
+
+	desired := []DesiredMember{
+		{Email: "owner@example.com", RoleBindings: []RoleBinding{{RoleID: 2}}},
+		{Email: "bob@example.com", RoleBindings: []RoleBinding{{RoleID: 2}}},
+		{Email: "dave@example.com", RoleBindings: []RoleBinding{{RoleID: 3}, {RoleID: 4, ClusterID: 10}}},
+	}
+	expectedChanges := []MemberSyncChange{
+		{Action: MemberSyncRemove, Email: "carol@example.com", MemberID: 3},
+		{Action: MemberSyncInvite, Email: "dave@example.com", MemberID: 4, RoleBindings: desired[2].RoleBindings},
+	}
+
+	testCases := []struct {
+		name            string
+		dryRun          bool
+		mockFunc        func(cli *MockhttpClient)
+		expectedChanges []MemberSyncChange
+		expectedError   string
+	}{
+		{
+			name:   "dry run",
+			dryRun: true,
+			expectedChanges: []MemberSyncChange{
+				expectedChanges[0],
+				{Action: MemberSyncInvite, Email: "dave@example.com", RoleBindings: desired[2].RoleBindings},
+			},
+		},
+		{
+			name: "apply changes",
+			mockFunc: func(cli *MockhttpClient) {
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/members/3"), "", nil, gomock.Any()).Return(nil)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/members"), "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, _, _ string, _ interface{}, decode payloadDecodeFunc, _ http.Header) error {
+						return decode(json.RawMessage(`{"id":"4","email":"dave@example.com"}`))
+					})
+				cli.EXPECT().sendPutRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/members/4"), "", desired[2].RoleBindings, nil, gomock.Any()).Return(nil)
+			},
+			expectedChanges: expectedChanges,
+		},
+		{
+			name: "partially applied",
+			mockFunc: func(cli *MockhttpClient) {
+				cli.EXPECT().sendDeleteRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/members/3"), "", nil, gomock.Any()).Return(nil)
+				cli.EXPECT().sendPostRequest(gomock.Any(), path.Join(_apiPathPrefix, "/orgs/1/members"), "", gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("mock error"))
+			},
+			expectedChanges: expectedChanges[:1],
+			expectedError:   "invite member dave@example.com: mock error",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			cli := NewMockhttpClient(ctrl)
+			mockListMembers(cli, _membersPayload)
+			if tc.mockFunc != nil {
+				tc.mockFunc(cli)
+			}
+
+			report, err := newOrganization(cli).SyncMembers(context.Background(), desired, &SyncMembersOptions{
+				Organization: &Organization{ID: 1},
+				DryRun:       tc.dryRun,
+			})
+			if tc.expectedError == "" {
+				assert.Nil(t, err, "check sync members error")
+			} else {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			}
+			assert.Equal(t, tc.dryRun, report.DryRun, "check dry run")
+			assert.Equal(t, tc.expectedChanges, report.Changes, "check changes")
+			assert.Equal(t, []string{"owner@example.com"}, report.SkippedOwners, "check skipped owners")
+		})
+	}
+}
+
+func TestSyncMembersWithInvalidDesiredList(t *testing.T) {
+	t.Parallel()
+
+	_, err := newOrganization(nil).SyncMembers(context.Background(), []DesiredMember{
+		{Email: "bob@example.com", RoleBindings: []RoleBinding{{RoleID: 2}}},
+		{Email: "Bob@example.com", RoleBindings: []RoleBinding{{RoleID: 3}}},
+	}, &SyncMembersOptions{Organization: &Organization{ID: 1}})
+	assert.Contains(t, err.Error(), "duplicated member Bob@example.com", "check duplicated member")
+
+	_, err = newOrganization(nil).SyncMembers(context.Background(), []DesiredMember{
+		{Email: "bob@example.com"},
+	}, &SyncMembersOptions{Organization: &Organization{ID: 1}})
+	assert.Contains(t, err.Error(), "member bob@example.com has no role bindings", "check empty role bindings")
+}
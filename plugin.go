@@ -1,4 +1,515 @@
 package cloud
 
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
 // Plugins contains a collect of plugins like CORS, Rate Limiting, Authentication and so on.
 type Plugins map[string]interface{}
+
+const (
+	// LimitCountPluginName is the name of limit-count plugin.
+	LimitCountPluginName = "limit-count"
+	// LimitReqPluginName is the name of limit-req plugin.
+	LimitReqPluginName = "limit-req"
+	// CORSPluginName is the name of cors plugin.
+	CORSPluginName = "cors"
+	// KeyAuthPluginName is the name of key-auth plugin.
+	KeyAuthPluginName = "key-auth"
+	// JWTAuthPluginName is the name of jwt-auth plugin.
+	JWTAuthPluginName = "jwt-auth"
+	// IPRestrictionPluginName is the name of ip-restriction plugin.
+	IPRestrictionPluginName = "ip-restriction"
+	// ProxyRewritePluginName is the name of proxy-rewrite plugin.
+	ProxyRewritePluginName = "proxy-rewrite"
+	// ResponseRewritePluginName is the name of response-rewrite plugin.
+	ResponseRewritePluginName = "response-rewrite"
+	// RequestIDPluginName is the name of request-id plugin.
+	RequestIDPluginName = "request-id"
+	// PrometheusPluginName is the name of prometheus plugin.
+	PrometheusPluginName = "prometheus"
+)
+
+// PluginConfig is the typed configuration of a plugin.
+type PluginConfig interface {
+	// PluginName returns the plugin name, which is also the key
+	// of the plugin configuration in the Plugins.
+	PluginName() string
+	// Validate checks whether the plugin configuration is valid.
+	Validate() error
+}
+
+// Set validates the plugin configuration and sets it to the Plugins, the existing
+// configuration of the same plugin will be replaced, but the fields that are
+// unknown to the typed configuration will be kept.
+func (p *Plugins) Set(cfg PluginConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	value, err := mergeTypedValue((*p)[cfg.PluginName()], cfg)
+	if err != nil {
+		return fmt.Errorf("encode %s plugin: %s", cfg.PluginName(), err)
+	}
+	if *p == nil {
+		*p = make(Plugins)
+	}
+	(*p)[cfg.PluginName()] = value
+	return nil
+}
+
+// Get decodes the configuration of the plugin `name` into `cfg`, which should be
+// a pointer (e.g. *LimitCountPlugin). The returned boolean value reports whether
+// the plugin is in the Plugins.
+func (p Plugins) Get(name string, cfg interface{}) (bool, error) {
+	value, ok := p[name]
+	if !ok {
+		return false, nil
+	}
+	if err := decodeTypedValue(value, cfg); err != nil {
+		return true, fmt.Errorf("decode %s plugin: %s", name, err)
+	}
+	return true, nil
+}
+
+// Remove removes the plugin `name` from the Plugins.
+func (p Plugins) Remove(name string) {
+	delete(p, name)
+}
+
+func pluginError(name, format string, args ...interface{}) error {
+	return fmt.Errorf("%s plugin: %s", name, fmt.Sprintf(format, args...))
+}
+
+func validateRejectedCode(name string, code int) error {
+	if code != 0 && (code < 200 || code > 599) {
+		return pluginError(name, "rejected_code should be in range [200, 599]")
+	}
+	return nil
+}
+
+func validateKeyType(name, keyType string) error {
+	switch keyType {
+	case "", "var", "var_combination", "constant":
+		return nil
+	default:
+		return pluginError(name, "unknown key_type %s", keyType)
+	}
+}
+
+// LimitCountPlugin is the configuration of limit-count plugin, it limits
+// the number of requests in a fixed time window.
+type LimitCountPlugin struct {
+	// Count is the maximum number of requests in the time window.
+	Count int `json:"count"`
+	// TimeWindow is the time window in seconds.
+	TimeWindow int `json:"time_window"`
+	// KeyType is the type of Key, optional values are "var" (default),
+	// "var_combination" and "constant".
+	KeyType string `json:"key_type,omitempty"`
+	// Key is the key to count requests, e.g. "remote_addr".
+	Key string `json:"key,omitempty"`
+	// RejectedCode is the HTTP status code returned when the limit is exceeded.
+	RejectedCode int `json:"rejected_code,omitempty"`
+	// RejectedMsg is the response body returned when the limit is exceeded.
+	RejectedMsg string `json:"rejected_msg,omitempty"`
+	// Policy is the counting policy, optional values are "local" (default),
+	// "redis" and "redis-cluster".
+	Policy string `json:"policy,omitempty"`
+	// AllowDegradation indicates whether to let requests pass when the plugin is not available.
+	AllowDegradation bool `json:"allow_degradation,omitempty"`
+	// ShowLimitQuotaHeader indicates whether to show the X-RateLimit-* headers.
+	ShowLimitQuotaHeader *bool `json:"show_limit_quota_header,omitempty"`
+	// Group shares the counter among the routes which have the same group.
+	Group string `json:"group,omitempty"`
+	// RedisHost is the address of Redis, it's required when Policy is "redis".
+	RedisHost string `json:"redis_host,omitempty"`
+	// RedisPort is the port of Redis.
+	RedisPort int `json:"redis_port,omitempty"`
+	// RedisPassword is the password of Redis.
+	RedisPassword string `json:"redis_password,omitempty"`
+	// RedisDatabase is the database of Redis.
+	RedisDatabase int `json:"redis_database,omitempty"`
+	// RedisTimeout is the timeout in milliseconds for Redis operations.
+	RedisTimeout int `json:"redis_timeout,omitempty"`
+	// RedisClusterNodes are the addresses of Redis cluster nodes,
+	// it's required when Policy is "redis-cluster".
+	RedisClusterNodes []string `json:"redis_cluster_nodes,omitempty"`
+	// RedisClusterName is the name of Redis cluster,
+	// it's required when Policy is "redis-cluster".
+	RedisClusterName string `json:"redis_cluster_name,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *LimitCountPlugin) PluginName() string {
+	return LimitCountPluginName
+}
+
+// Validate implements PluginConfig.
+func (p *LimitCountPlugin) Validate() error {
+	if p.Count <= 0 {
+		return pluginError(LimitCountPluginName, "count should be positive")
+	}
+	if p.TimeWindow <= 0 {
+		return pluginError(LimitCountPluginName, "time_window should be positive")
+	}
+	if err := validateKeyType(LimitCountPluginName, p.KeyType); err != nil {
+		return err
+	}
+	if err := validateRejectedCode(LimitCountPluginName, p.RejectedCode); err != nil {
+		return err
+	}
+	switch p.Policy {
+	case "", "local":
+	case "redis":
+		if p.RedisHost == "" {
+			return pluginError(LimitCountPluginName, "redis_host is required by the redis policy")
+		}
+	case "redis-cluster":
+		if len(p.RedisClusterNodes) == 0 || p.RedisClusterName == "" {
+			return pluginError(LimitCountPluginName, "redis_cluster_nodes and redis_cluster_name are required by the redis-cluster policy")
+		}
+	default:
+		return pluginError(LimitCountPluginName, "unknown policy %s", p.Policy)
+	}
+	return nil
+}
+
+// LimitReqPlugin is the configuration of limit-req plugin, it limits
+// the request rate with the leaky bucket algorithm.
+type LimitReqPlugin struct {
+	// Rate is the number of requests per second.
+	Rate float64 `json:"rate"`
+	// Burst is the number of requests per second which are allowed to be delayed.
+	Burst float64 `json:"burst"`
+	// KeyType is the type of Key, optional values are "var" (default),
+	// "var_combination" and "constant".
+	KeyType string `json:"key_type,omitempty"`
+	// Key is the key to limit requests, e.g. "remote_addr".
+	Key string `json:"key"`
+	// RejectedCode is the HTTP status code returned when the limit is exceeded.
+	RejectedCode int `json:"rejected_code,omitempty"`
+	// RejectedMsg is the response body returned when the limit is exceeded.
+	RejectedMsg string `json:"rejected_msg,omitempty"`
+	// NoDelay indicates not to delay the requests in the burst.
+	NoDelay bool `json:"nodelay,omitempty"`
+	// AllowDegradation indicates whether to let requests pass when the plugin is not available.
+	AllowDegradation bool `json:"allow_degradation,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *LimitReqPlugin) PluginName() string {
+	return LimitReqPluginName
+}
+
+// Validate implements PluginConfig.
+func (p *LimitReqPlugin) Validate() error {
+	if p.Rate <= 0 {
+		return pluginError(LimitReqPluginName, "rate should be positive")
+	}
+	if p.Burst < 0 {
+		return pluginError(LimitReqPluginName, "burst should not be negative")
+	}
+	if p.Key == "" {
+		return pluginError(LimitReqPluginName, "key is required")
+	}
+	if err := validateKeyType(LimitReqPluginName, p.KeyType); err != nil {
+		return err
+	}
+	return validateRejectedCode(LimitReqPluginName, p.RejectedCode)
+}
+
+// CORSPlugin is the configuration of cors plugin.
+type CORSPlugin struct {
+	// AllowOrigins is the comma separated origins which are allowed, "*" means all.
+	AllowOrigins string `json:"allow_origins,omitempty"`
+	// AllowMethods is the comma separated methods which are allowed, "*" means all.
+	AllowMethods string `json:"allow_methods,omitempty"`
+	// AllowHeaders is the comma separated headers which are allowed, "*" means all.
+	AllowHeaders string `json:"allow_headers,omitempty"`
+	// ExposeHeaders is the comma separated headers which are exposed, "*" means all.
+	ExposeHeaders string `json:"expose_headers,omitempty"`
+	// MaxAge is the time in seconds that the preflight result can be cached.
+	MaxAge int `json:"max_age,omitempty"`
+	// AllowCredential indicates whether the request can include credentials.
+	// Note "*" cannot be used in other fields when it's enabled.
+	AllowCredential bool `json:"allow_credential,omitempty"`
+	// AllowOriginsByRegex contains the regular expressions to match the allowed origins.
+	AllowOriginsByRegex []string `json:"allow_origins_by_regex,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *CORSPlugin) PluginName() string {
+	return CORSPluginName
+}
+
+// Validate implements PluginConfig.
+func (p *CORSPlugin) Validate() error {
+	if p.MaxAge < -1 {
+		return pluginError(CORSPluginName, "max_age should not be less than -1")
+	}
+	if p.AllowCredential {
+		fields := []struct {
+			name  string
+			value string
+		}{
+			{name: "allow_origins", value: p.AllowOrigins},
+			{name: "allow_methods", value: p.AllowMethods},
+			{name: "allow_headers", value: p.AllowHeaders},
+			{name: "expose_headers", value: p.ExposeHeaders},
+		}
+		for _, field := range fields {
+			if field.value == "*" {
+				return pluginError(CORSPluginName, "%s cannot be \"*\" when allow_credential is true", field.name)
+			}
+		}
+	}
+	return nil
+}
+
+// KeyAuthPlugin is the configuration of key-auth plugin, see
+// KeyAuthCredential for the consumer side configuration.
+type KeyAuthPlugin struct {
+	// Header is the header to get the key from.
+	Header string `json:"header,omitempty"`
+	// Query is the query string to get the key from.
+	Query string `json:"query,omitempty"`
+	// HideCredentials indicates whether to remove the key before proxying the request.
+	HideCredentials bool `json:"hide_credentials,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *KeyAuthPlugin) PluginName() string {
+	return KeyAuthPluginName
+}
+
+// Validate implements PluginConfig.
+func (p *KeyAuthPlugin) Validate() error {
+	return nil
+}
+
+// JWTAuthPlugin is the configuration of jwt-auth plugin, see
+// JWTAuthCredential for the consumer side configuration.
+type JWTAuthPlugin struct {
+	// Header is the header to get the token from.
+	Header string `json:"header,omitempty"`
+	// Query is the query string to get the token from.
+	Query string `json:"query,omitempty"`
+	// Cookie is the cookie to get the token from.
+	Cookie string `json:"cookie,omitempty"`
+	// HideCredentials indicates whether to remove the token before proxying the request.
+	HideCredentials bool `json:"hide_credentials,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *JWTAuthPlugin) PluginName() string {
+	return JWTAuthPluginName
+}
+
+// Validate implements PluginConfig.
+func (p *JWTAuthPlugin) Validate() error {
+	return nil
+}
+
+// IPRestrictionPlugin is the configuration of ip-restriction plugin.
+// Only one of the Whitelist and Blacklist can be specified.
+type IPRestrictionPlugin struct {
+	// Whitelist contains the IP addresses or CIDRs which are allowed.
+	Whitelist []string `json:"whitelist,omitempty"`
+	// Blacklist contains the IP addresses or CIDRs which are denied.
+	Blacklist []string `json:"blacklist,omitempty"`
+	// Message is the response body returned when the request is denied.
+	Message string `json:"message,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *IPRestrictionPlugin) PluginName() string {
+	return IPRestrictionPluginName
+}
+
+// Validate implements PluginConfig.
+func (p *IPRestrictionPlugin) Validate() error {
+	if (len(p.Whitelist) == 0) == (len(p.Blacklist) == 0) {
+		return pluginError(IPRestrictionPluginName, "one and only one of whitelist and blacklist should be specified")
+	}
+	for _, list := range [][]string{p.Whitelist, p.Blacklist} {
+		for _, addr := range list {
+			if net.ParseIP(addr) != nil {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(addr); err != nil {
+				return pluginError(IPRestrictionPluginName, "invalid IP address or CIDR %s", addr)
+			}
+		}
+	}
+	return nil
+}
+
+// ProxyRewriteHeaders contains the header operations of proxy-rewrite plugin.
+type ProxyRewriteHeaders struct {
+	// Add appends the headers.
+	Add map[string]string `json:"add,omitempty"`
+	// Set overwrites the headers.
+	Set map[string]string `json:"set,omitempty"`
+	// Remove removes the headers.
+	Remove []string `json:"remove,omitempty"`
+}
+
+// ProxyRewritePlugin is the configuration of proxy-rewrite plugin, it
+// rewrites the request before proxying it to the upstream.
+type ProxyRewritePlugin struct {
+	// URI is the new request URI.
+	URI string `json:"uri,omitempty"`
+	// Method is the new request method.
+	Method string `json:"method,omitempty"`
+	// RegexURI contains a regular expression and a replacement template
+	// to rewrite the request URI, it's ignored when URI is specified.
+	RegexURI []string `json:"regex_uri,omitempty"`
+	// Host is the new Host header.
+	Host string `json:"host,omitempty"`
+	// Headers contains the header operations.
+	Headers *ProxyRewriteHeaders `json:"headers,omitempty"`
+	// UseRealRequestURIUnsafe indicates whether to use the original request URI without normalization.
+	UseRealRequestURIUnsafe bool `json:"use_real_request_uri_unsafe,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *ProxyRewritePlugin) PluginName() string {
+	return ProxyRewritePluginName
+}
+
+// Validate implements PluginConfig.
+func (p *ProxyRewritePlugin) Validate() error {
+	if p.RegexURI != nil && len(p.RegexURI) != 2 {
+		return pluginError(ProxyRewritePluginName, "regex_uri should contain a regular expression and a replacement")
+	}
+	switch strings.ToUpper(p.Method) {
+	case "", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodHead, http.MethodDelete,
+		http.MethodOptions, http.MethodTrace, http.MethodPatch, "MKCOL", "COPY", "MOVE",
+		"PROPFIND", "LOCK", "UNLOCK":
+	default:
+		return pluginError(ProxyRewritePluginName, "unknown method %s", p.Method)
+	}
+	return nil
+}
+
+// ResponseRewriteHeaders contains the header operations of response-rewrite plugin.
+type ResponseRewriteHeaders struct {
+	// Add appends the headers, each element should be in the "name: value" format.
+	Add []string `json:"add,omitempty"`
+	// Set overwrites the headers.
+	Set map[string]string `json:"set,omitempty"`
+	// Remove removes the headers.
+	Remove []string `json:"remove,omitempty"`
+}
+
+// ResponseRewriteFilter is a rule to substitute the response body.
+type ResponseRewriteFilter struct {
+	// Regex is the regular expression to match the response body.
+	Regex string `json:"regex"`
+	// Scope is the substitution scope, optional values are "once" (default) and "global".
+	Scope string `json:"scope,omitempty"`
+	// Replace is the replacement.
+	Replace string `json:"replace"`
+	// Options are the regex options, default is "jo".
+	Options string `json:"options,omitempty"`
+}
+
+// ResponseRewritePlugin is the configuration of response-rewrite plugin, it
+// rewrites the response before returning it to the client.
+type ResponseRewritePlugin struct {
+	// StatusCode is the new response status code.
+	StatusCode int `json:"status_code,omitempty"`
+	// Body is the new response body.
+	Body string `json:"body,omitempty"`
+	// BodyBase64 indicates whether the Body is base64 encoded.
+	BodyBase64 bool `json:"body_base64,omitempty"`
+	// Headers contains the header operations.
+	Headers *ResponseRewriteHeaders `json:"headers,omitempty"`
+	// Vars are the conditions (in lua-resty-expr format) to rewrite the response.
+	Vars []interface{} `json:"vars,omitempty"`
+	// Filters contains the rules to substitute the response body,
+	// it cannot be used with the Body.
+	Filters []ResponseRewriteFilter `json:"filters,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *ResponseRewritePlugin) PluginName() string {
+	return ResponseRewritePluginName
+}
+
+// Validate implements PluginConfig.
+func (p *ResponseRewritePlugin) Validate() error {
+	if p.StatusCode != 0 && (p.StatusCode < 200 || p.StatusCode > 598) {
+		return pluginError(ResponseRewritePluginName, "status_code should be in range [200, 598]")
+	}
+	if p.Body != "" && len(p.Filters) > 0 {
+		return pluginError(ResponseRewritePluginName, "body and filters cannot be used together")
+	}
+	if p.BodyBase64 {
+		if _, err := base64.StdEncoding.DecodeString(p.Body); err != nil {
+			return pluginError(ResponseRewritePluginName, "body is not base64 encoded")
+		}
+	}
+	if p.Headers != nil {
+		for _, header := range p.Headers.Add {
+			if !strings.Contains(header, ":") {
+				return pluginError(ResponseRewritePluginName, "header %s should be in the \"name: value\" format", header)
+			}
+		}
+	}
+	for i, filter := range p.Filters {
+		if filter.Regex == "" {
+			return pluginError(ResponseRewritePluginName, "filters[%d].regex is required", i)
+		}
+		if filter.Scope != "" && filter.Scope != "once" && filter.Scope != "global" {
+			return pluginError(ResponseRewritePluginName, "filters[%d].scope should be \"once\" or \"global\"", i)
+		}
+	}
+	return nil
+}
+
+// RequestIDPlugin is the configuration of request-id plugin.
+type RequestIDPlugin struct {
+	// HeaderName is the header to carry the request ID, default is "X-Request-Id".
+	HeaderName string `json:"header_name,omitempty"`
+	// IncludeInResponse indicates whether to return the request ID in the response header.
+	IncludeInResponse *bool `json:"include_in_response,omitempty"`
+	// Algorithm is the algorithm to generate the request ID, optional values
+	// are "uuid" (default), "nanoid" and "range_id".
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *RequestIDPlugin) PluginName() string {
+	return RequestIDPluginName
+}
+
+// Validate implements PluginConfig.
+func (p *RequestIDPlugin) Validate() error {
+	switch p.Algorithm {
+	case "", "uuid", "nanoid", "range_id":
+		return nil
+	default:
+		return pluginError(RequestIDPluginName, "unknown algorithm %s", p.Algorithm)
+	}
+}
+
+// PrometheusPlugin is the configuration of prometheus plugin.
+type PrometheusPlugin struct {
+	// PreferName indicates whether to use the route name (instead of ID) in the metrics.
+	PreferName bool `json:"prefer_name,omitempty"`
+}
+
+// PluginName implements PluginConfig.
+func (p *PrometheusPlugin) PluginName() string {
+	return PrometheusPluginName
+}
+
+// Validate implements PluginConfig.
+func (p *PrometheusPlugin) Validate() error {
+	return nil
+}
@@ -0,0 +1,491 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed schemas/plugins/*.json
+var builtinPluginSchemas embed.FS
+
+var pluginSchemaRegistry = struct {
+	sync.RWMutex
+	schemas map[string]*jsonSchema
+}{
+	schemas: make(map[string]*jsonSchema),
+}
+
+func init() {
+	entries, err := builtinPluginSchemas.ReadDir("schemas/plugins")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := builtinPluginSchemas.ReadFile(path.Join("schemas/plugins", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if err = RegisterPluginSchema(name, data); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterPluginSchema registers the JSON schema for the plugin `name`, it's used
+// by ValidatePlugins. The existing schema of the same plugin will be replaced, so
+// users can register schemas for their own custom plugins or override the built-in ones.
+// Only a subset of JSON schema (draft 7) keywords are supported: type, enum, const,
+// properties, required, additionalProperties, minProperties, maxProperties, items,
+// minItems, maxItems, uniqueItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// minLength, maxLength, pattern, anyOf, oneOf, allOf and not. Other keywords are ignored.
+func RegisterPluginSchema(name string, schema []byte) error {
+	var s jsonSchema
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return errors.Wrapf(err, "parse %s plugin schema", name)
+	}
+	if err := s.compile(); err != nil {
+		return errors.Wrapf(err, "parse %s plugin schema", name)
+	}
+
+	pluginSchemaRegistry.Lock()
+	defer pluginSchemaRegistry.Unlock()
+	pluginSchemaRegistry.schemas[name] = &s
+	return nil
+}
+
+// PluginSchemaViolation describes a field which violates the plugin schema.
+type PluginSchemaViolation struct {
+	// Path is the location of the field, e.g. "limit-count.count" or
+	// "ip-restriction.whitelist[1]".
+	Path string
+	// Message is the reason of the violation.
+	Message string
+}
+
+// String implements fmt.Stringer.
+func (v PluginSchemaViolation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// PluginValidationError is returned by ValidatePlugins, it
+// contains all the violations in the validated plugins.
+type PluginValidationError struct {
+	// Violations contains the violations sorted by the plugin name.
+	Violations []PluginSchemaViolation
+}
+
+// Error implements error.
+func (e *PluginValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.String())
+	}
+	return "invalid plugins: " + strings.Join(messages, "; ")
+}
+
+// ValidatePlugins validates the plugins with the registered plugin schemas (see
+// RegisterPluginSchema). Plugins which don't have schemas are skipped.
+// A *PluginValidationError will be returned if some plugins are invalid.
+func ValidatePlugins(plugins Plugins) error {
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []PluginSchemaViolation
+	for _, name := range names {
+		pluginSchemaRegistry.RLock()
+		schema, ok := pluginSchemaRegistry.schemas[name]
+		pluginSchemaRegistry.RUnlock()
+		if !ok {
+			continue
+		}
+
+		// Normalize the plugin configuration, since it might be a typed value.
+		var value interface{}
+		if err := decodeTypedValue(plugins[name], &value); err != nil {
+			violations = append(violations, PluginSchemaViolation{
+				Path:    name,
+				Message: err.Error(),
+			})
+			continue
+		}
+		violations = append(violations, schema.validate(value, name)...)
+	}
+	if len(violations) > 0 {
+		return &PluginValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// pluginValidator validates the plugins before sending them to API7 Cloud,
+// it's enabled by the Options.ValidatePlugins.
+type pluginValidator struct {
+	enabled bool
+}
+
+func (v pluginValidator) validatePlugins(plugins Plugins) error {
+	if !v.enabled {
+		return nil
+	}
+	return ValidatePlugins(plugins)
+}
+
+// jsonSchema is the subset of JSON schema.
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Const                interface{}            `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+	MinProperties        *int                   `json:"minProperties"`
+	MaxProperties        *int                   `json:"maxProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	UniqueItems          bool                   `json:"uniqueItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+	Not                  *jsonSchema            `json:"not"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is the "type" keyword, which can be a string or an array of strings.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return errors.New("type should be a string or an array of strings")
+	}
+	*t = multiple
+	return nil
+}
+
+// additionalProperties is the "additionalProperties" keyword, which can be a boolean or a schema.
+type additionalProperties struct {
+	allowed bool
+	schema  *jsonSchema
+}
+
+func (ap *additionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &ap.allowed); err == nil {
+		return nil
+	}
+	ap.allowed = true
+	return json.Unmarshal(data, &ap.schema)
+}
+
+// compile compiles the patterns in the schema and its sub-schemas.
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "compile pattern %s", s.Pattern)
+		}
+		s.pattern = re
+	}
+	for _, t := range s.Type {
+		switch t {
+		case "object", "array", "string", "integer", "number", "boolean", "null":
+		default:
+			return fmt.Errorf("unknown type %s", t)
+		}
+	}
+
+	var subs []*jsonSchema
+	for _, sub := range s.Properties {
+		subs = append(subs, sub)
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.schema != nil {
+		subs = append(subs, s.AdditionalProperties.schema)
+	}
+	subs = append(subs, s.Items, s.Not)
+	subs = append(subs, s.AnyOf...)
+	subs = append(subs, s.OneOf...)
+	subs = append(subs, s.AllOf...)
+	for _, sub := range subs {
+		if sub == nil {
+			continue
+		}
+		if err := sub.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) validate(value interface{}, field string) []PluginSchemaViolation {
+	var violations []PluginSchemaViolation
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, PluginSchemaViolation{
+			Path:    field,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(s.Type) > 0 && !s.matchType(value) {
+		violate("should be %s", strings.Join(s.Type, " or "))
+		return violations
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, candidate := range s.Enum {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violate("should be one of %s", formatSchemaValues(s.Enum))
+		}
+	}
+	if s.Const != nil && !reflect.DeepEqual(s.Const, value) {
+		violate("should be %s", formatSchemaValues([]interface{}{s.Const}))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		violations = append(violations, s.validateObject(v, field)...)
+	case []interface{}:
+		violations = append(violations, s.validateArray(v, field)...)
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			violate("length should be >= %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			violate("length should be <= %d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			violate("should match pattern %s", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			violate("should be >= %s", formatSchemaNumber(*s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			violate("should be <= %s", formatSchemaNumber(*s.Maximum))
+		}
+		if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+			violate("should be > %s", formatSchemaNumber(*s.ExclusiveMinimum))
+		}
+		if s.ExclusiveMaximum != nil && v >= *s.ExclusiveMaximum {
+			violate("should be < %s", formatSchemaNumber(*s.ExclusiveMaximum))
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		violations = append(violations, sub.validate(value, field)...)
+	}
+	if len(s.AnyOf) > 0 {
+		var (
+			closest []PluginSchemaViolation
+			matched bool
+		)
+		for i, sub := range s.AnyOf {
+			subViolations := sub.validate(value, field)
+			if len(subViolations) == 0 {
+				matched = true
+				break
+			}
+			if i == 0 || len(subViolations) < len(closest) {
+				closest = subViolations
+			}
+		}
+		if !matched {
+			// Report the violations of the closest sub-schema, which is more useful
+			// than a general message.
+			violations = append(violations, closest...)
+		}
+	}
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, sub := range s.OneOf {
+			if len(sub.validate(value, field)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			violate("should match exactly one schema in oneOf, but matched %d", matched)
+		}
+	}
+	if s.Not != nil && len(s.Not.validate(value, field)) == 0 {
+		violate("should not match the schema in not")
+	}
+	return violations
+}
+
+func (s *jsonSchema) validateObject(obj map[string]interface{}, field string) []PluginSchemaViolation {
+	var violations []PluginSchemaViolation
+
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			violations = append(violations, PluginSchemaViolation{
+				Path:    joinSchemaPath(field, name),
+				Message: "is required",
+			})
+		}
+	}
+	if s.MinProperties != nil && len(obj) < *s.MinProperties {
+		violations = append(violations, PluginSchemaViolation{
+			Path:    field,
+			Message: fmt.Sprintf("should have at least %d properties", *s.MinProperties),
+		})
+	}
+	if s.MaxProperties != nil && len(obj) > *s.MaxProperties {
+		violations = append(violations, PluginSchemaViolation{
+			Path:    field,
+			Message: fmt.Sprintf("should have at most %d properties", *s.MaxProperties),
+		})
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sub, ok := s.Properties[key]
+		if !ok && s.AdditionalProperties != nil {
+			if !s.AdditionalProperties.allowed {
+				violations = append(violations, PluginSchemaViolation{
+					Path:    joinSchemaPath(field, key),
+					Message: "is not allowed",
+				})
+				continue
+			}
+			sub = s.AdditionalProperties.schema
+		}
+		if sub != nil {
+			violations = append(violations, sub.validate(obj[key], joinSchemaPath(field, key))...)
+		}
+	}
+	return violations
+}
+
+func (s *jsonSchema) validateArray(arr []interface{}, field string) []PluginSchemaViolation {
+	var violations []PluginSchemaViolation
+
+	if s.MinItems != nil && len(arr) < *s.MinItems {
+		violations = append(violations, PluginSchemaViolation{
+			Path:    field,
+			Message: fmt.Sprintf("should have at least %d items", *s.MinItems),
+		})
+	}
+	if s.MaxItems != nil && len(arr) > *s.MaxItems {
+		violations = append(violations, PluginSchemaViolation{
+			Path:    field,
+			Message: fmt.Sprintf("should have at most %d items", *s.MaxItems),
+		})
+	}
+	for i, item := range arr {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		if s.UniqueItems {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(arr[j], item) {
+					violations = append(violations, PluginSchemaViolation{
+						Path:    itemField,
+						Message: fmt.Sprintf("duplicates item %d", j),
+					})
+					break
+				}
+			}
+		}
+		if s.Items != nil {
+			violations = append(violations, s.Items.validate(item, itemField)...)
+		}
+	}
+	return violations
+}
+
+func (s *jsonSchema) matchType(value interface{}) bool {
+	for _, t := range s.Type {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case nil:
+			if t == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinSchemaPath(field, key string) string {
+	return field + "." + key
+}
+
+func formatSchemaNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func formatSchemaValues(values []interface{}) string {
+	formatted := make([]string, 0, len(values))
+	for _, v := range values {
+		data, _ := json.Marshal(v)
+		formatted = append(formatted, string(data))
+	}
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePlugins(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		plugins    Plugins
+		violations []PluginSchemaViolation
+	}{
+		{
+			name: "valid plugins",
+			plugins: Plugins{
+				"limit-count": map[string]interface{}{"count": 10, "time_window": 60, "rejected_code": 429},
+				"proxy-rewrite": &ProxyRewritePlugin{
+					URI:     "/v2/users",
+					Headers: &ProxyRewriteHeaders{Set: map[string]string{"X-Version": "2"}},
+				},
+				"ip-restriction":   map[string]interface{}{"whitelist": []string{"10.0.0.0/8"}},
+				"my-custom-plugin": "anything",
+			},
+		},
+		{
+			name: "path precise violations",
+			plugins: Plugins{
+				"limit-count": map[string]interface{}{"count": 1.5, "time_window": 0, "policy": "memory"},
+				"response-rewrite": map[string]interface{}{
+					"status_code": 200,
+					"filters":     []interface{}{map[string]interface{}{"regex": "a", "replace": "b", "scope": "all"}},
+				},
+				"proxy-rewrite": map[string]interface{}{"regex_uri": []string{"^/v1/(.*)"}},
+			},
+			violations: []PluginSchemaViolation{
+				{Path: "limit-count.count", Message: "should be integer"},
+				{Path: "limit-count.policy", Message: `should be one of ["local", "redis", "redis-cluster"]`},
+				{Path: "limit-count.time_window", Message: "should be > 0"},
+				{Path: "proxy-rewrite.regex_uri", Message: "should have at least 2 items"},
+				{Path: "response-rewrite.filters[0].scope", Message: `should be one of ["once", "global"]`},
+			},
+		},
+		{
+			name: "missing required fields",
+			plugins: Plugins{
+				"limit-req":      map[string]interface{}{"rate": 1},
+				"ip-restriction": map[string]interface{}{},
+			},
+			violations: []PluginSchemaViolation{
+				{Path: "ip-restriction", Message: "should match exactly one schema in oneOf, but matched 0"},
+				{Path: "limit-req.burst", Message: "is required"},
+				{Path: "limit-req.key", Message: "is required"},
+			},
+		},
+		{
+			name: "mutually exclusive fields",
+			plugins: Plugins{
+				"response-rewrite": map[string]interface{}{
+					"body":    "x",
+					"filters": []interface{}{map[string]interface{}{"regex": "a", "replace": "b"}},
+				},
+			},
+			violations: []PluginSchemaViolation{
+				{Path: "response-rewrite", Message: "should not match the schema in not"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidatePlugins(tc.plugins)
+			if tc.violations == nil {
+				assert.Nil(t, err, "check validate error")
+				return
+			}
+			var validationErr *PluginValidationError
+			assert.True(t, errors.As(err, &validationErr), "check error type")
+			assert.Equal(t, tc.violations, validationErr.Violations, "check violations")
+		})
+	}
+}
+
+func TestRegisterPluginSchema(t *testing.T) {
+	err := RegisterPluginSchema("test-custom-plugin", []byte(`{
+		"type": "object",
+		"properties": {
+			"endpoint": {"type": "string", "pattern": "^https://"},
+			"tags": {"type": "array", "uniqueItems": true, "items": {"type": "string"}}
+		},
+		"required": ["endpoint"],
+		"additionalProperties": false
+	}`))
+	assert.Nil(t, err, "check register error")
+
+	err = ValidatePlugins(Plugins{
+		"test-custom-plugin": map[string]interface{}{
+			"endpoint": "http://example.com",
+			"tags":     []string{"a", "a"},
+			"extra":    true,
+		},
+	})
+	assert.EqualError(t, err, "invalid plugins: test-custom-plugin.endpoint: should match pattern ^https://; "+
+		"test-custom-plugin.extra: is not allowed; test-custom-plugin.tags[1]: duplicates item 0", "check violations")
+
+	err = RegisterPluginSchema("test-invalid-plugin", []byte(`{"type": "object", "properties": {"a": {"pattern": "("}}}`))
+	assert.Contains(t, err.Error(), "parse test-invalid-plugin plugin schema: compile pattern (", "check invalid schema")
+	err = RegisterPluginSchema("test-invalid-plugin", []byte(`{"type": "map"}`))
+	assert.EqualError(t, err, "parse test-invalid-plugin plugin schema: unknown type map", "check invalid schema")
+}
+
+func TestValidatePluginsBeforeSending(t *testing.T) {
+	t.Parallel()
+
+	invalid := Plugins{"limit-count": map[string]interface{}{"count": 0, "time_window": 60}}
+
+	// The http client is nil, so the requests should be rejected before sending.
+	app := newApplication(nil)
+	app.pluginValidator = pluginValidator{enabled: true}
+	_, err := app.CreateApplication(context.Background(), &Application{ApplicationSpec: ApplicationSpec{Plugins: invalid}}, &ResourceCreateOptions{
+		Cluster: &Cluster{ID: 1},
+	})
+	assert.EqualError(t, err, "invalid plugins: limit-count.count: should be > 0", "check create application")
+
+	api := newAPI(nil)
+	api.pluginValidator = pluginValidator{enabled: true}
+	_, err = api.UpdateAPI(context.Background(), &API{APISpec: APISpec{Plugins: invalid}}, &ResourceUpdateOptions{
+		Cluster:     &Cluster{ID: 1},
+		Application: &Application{ID: 1},
+	})
+	assert.EqualError(t, err, "invalid plugins: limit-count.count: should be > 0", "check update api")
+	_, err = api.CreateAPI(context.Background(), &API{APISpec: APISpec{Plugins: invalid}}, &ResourceCreateOptions{
+		Cluster:     &Cluster{ID: 1},
+		Application: &Application{ID: 1},
+	})
+	assert.EqualError(t, err, "invalid plugins: limit-count.count: should be > 0", "check create api")
+
+	cluster := newCluster(nil)
+	cluster.pluginValidator = pluginValidator{enabled: true}
+	err = cluster.UpdateClusterPlugins(context.Background(), 1, invalid, nil)
+	assert.EqualError(t, err, "invalid plugins: limit-count.count: should be > 0", "check update cluster plugins")
+
+	consumer := newConsumer(nil)
+	consumer.pluginValidator = pluginValidator{enabled: true}
+	_, err = consumer.UpdateConsumer(context.Background(), &Consumer{Plugins: invalid}, &ResourceUpdateOptions{
+		Cluster: &Cluster{ID: 1},
+	})
+	assert.EqualError(t, err, "invalid plugins: limit-count.count: should be > 0", "check update consumer")
+	_, err = consumer.CreateConsumer(context.Background(), &Consumer{Plugins: invalid}, &ResourceCreateOptions{
+		Cluster: &Cluster{ID: 1},
+	})
+	assert.EqualError(t, err, "invalid plugins: limit-count.count: should be > 0", "check create consumer")
+
+	// The helpers of certificates share the validated Application client.
+	sdk, err := NewInterface(&Options{
+		ServerAddr:      "http://127.0.0.1:9080",
+		Token:           "fake token",
+		ValidatePlugins: true,
+	})
+	assert.Nil(t, err, "create the interface")
+	assert.Same(t, sdk.(*impl).ApplicationInterface, sdk.(*impl).CertificateInterface.(*certificateImpl).applications, "check the certificate helpers")
+}
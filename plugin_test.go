@@ -0,0 +1,156 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		cfg           PluginConfig
+		expectedError string
+	}{
+		{
+			name: "valid limit-count",
+			cfg:  &LimitCountPlugin{Count: 10, TimeWindow: 60, Key: "remote_addr", RejectedCode: 429},
+		},
+		{
+			name:          "limit-count without count",
+			cfg:           &LimitCountPlugin{TimeWindow: 60},
+			expectedError: "limit-count plugin: count should be positive",
+		},
+		{
+			name:          "limit-count redis policy without host",
+			cfg:           &LimitCountPlugin{Count: 10, TimeWindow: 60, Policy: "redis"},
+			expectedError: "limit-count plugin: redis_host is required by the redis policy",
+		},
+		{
+			name:          "limit-req without key",
+			cfg:           &LimitReqPlugin{Rate: 1, Burst: 1},
+			expectedError: "limit-req plugin: key is required",
+		},
+		{
+			name:          "limit-req with invalid rejected code",
+			cfg:           &LimitReqPlugin{Rate: 1, Key: "remote_addr", RejectedCode: 600},
+			expectedError: "limit-req plugin: rejected_code should be in range [200, 599]",
+		},
+		{
+			name:          "cors with wildcard and credential",
+			cfg:           &CORSPlugin{AllowOrigins: "https://a.com", AllowMethods: "*", AllowCredential: true},
+			expectedError: "cors plugin: allow_methods cannot be \"*\" when allow_credential is true",
+		},
+		{
+			name: "valid ip-restriction",
+			cfg:  &IPRestrictionPlugin{Whitelist: []string{"127.0.0.1", "10.0.0.0/8"}},
+		},
+		{
+			name:          "ip-restriction with both lists",
+			cfg:           &IPRestrictionPlugin{Whitelist: []string{"127.0.0.1"}, Blacklist: []string{"10.0.0.1"}},
+			expectedError: "ip-restriction plugin: one and only one of whitelist and blacklist should be specified",
+		},
+		{
+			name:          "ip-restriction with invalid address",
+			cfg:           &IPRestrictionPlugin{Blacklist: []string{"10.0.0.300"}},
+			expectedError: "ip-restriction plugin: invalid IP address or CIDR 10.0.0.300",
+		},
+		{
+			name:          "proxy-rewrite with invalid regex_uri",
+			cfg:           &ProxyRewritePlugin{RegexURI: []string{"^/v1/(.*)"}},
+			expectedError: "proxy-rewrite plugin: regex_uri should contain a regular expression and a replacement",
+		},
+		{
+			name:          "response-rewrite with body and filters",
+			cfg:           &ResponseRewritePlugin{Body: "x", Filters: []ResponseRewriteFilter{{Regex: "a", Replace: "b"}}},
+			expectedError: "response-rewrite plugin: body and filters cannot be used together",
+		},
+		{
+			name:          "response-rewrite with invalid header",
+			cfg:           &ResponseRewritePlugin{Headers: &ResponseRewriteHeaders{Add: []string{"X-Foo"}}},
+			expectedError: "response-rewrite plugin: header X-Foo should be in the \"name: value\" format",
+		},
+		{
+			name:          "request-id with unknown algorithm",
+			cfg:           &RequestIDPlugin{Algorithm: "snowflake"},
+			expectedError: "request-id plugin: unknown algorithm snowflake",
+		},
+		{
+			name: "valid prometheus",
+			cfg:  &PrometheusPlugin{PreferName: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.cfg.Validate()
+			if tc.expectedError == "" {
+				assert.Nil(t, err, "check validate error")
+			} else {
+				assert.EqualError(t, err, tc.expectedError, "check the error details")
+			}
+		})
+	}
+}
+
+func TestPluginsSetAndGet(t *testing.T) {
+	t.Parallel()
+
+	var app Application
+	err := json.Unmarshal([]byte(`{
+		"plugins": {
+			"limit-count": {"count": 10, "time_window": 60, "vendor_option": true},
+			"my-custom-plugin": {"foo": "bar"}
+		}
+	}`), &app)
+	assert.Nil(t, err, "check decode error")
+
+	var limitCount LimitCountPlugin
+	found, err := app.Plugins.Get(LimitCountPluginName, &limitCount)
+	assert.Nil(t, err, "check get plugin error")
+	assert.True(t, found, "check limit-count exists")
+	assert.Equal(t, LimitCountPlugin{Count: 10, TimeWindow: 60}, limitCount, "check limit-count")
+
+	limitCount.Count = 20
+	assert.Nil(t, app.Plugins.Set(&limitCount), "check set plugin error")
+	assert.Nil(t, app.Plugins.Set(&CORSPlugin{AllowOrigins: "*"}), "check set plugin error")
+	assert.Contains(t, app.Plugins.Set(&LimitReqPlugin{}).Error(), "rate should be positive", "check invalid plugin")
+
+	found, err = app.Plugins.Get(PrometheusPluginName, &PrometheusPlugin{})
+	assert.Nil(t, err, "check get plugin error")
+	assert.False(t, found, "check prometheus doesn't exist")
+
+	data, err := json.Marshal(app.Plugins)
+	assert.Nil(t, err, "check encode error")
+	assert.JSONEq(t, `{
+		"cors": {"allow_origins": "*"},
+		"limit-count": {"count": 20, "time_window": 60, "vendor_option": true},
+		"my-custom-plugin": {"foo": "bar"}
+	}`, string(data), "check plugins")
+
+	var plugins Plugins
+	assert.Nil(t, plugins.Set(&PrometheusPlugin{}), "check set plugin on nil Plugins")
+	assert.Equal(t, Plugins{"prometheus": map[string]interface{}{}}, plugins, "check plugins")
+	plugins.Remove(PrometheusPluginName)
+	assert.Len(t, plugins, 0, "check plugin removed")
+}
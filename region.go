@@ -48,6 +48,9 @@ type RegionInterface interface {
 
 // RegionListIterator is an iterator for listing Regions.
 type RegionListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next Region according to the filter conditions.
 	Next() (*Region, error)
 }
@@ -81,14 +84,24 @@ func (iter *regionListIterator) Next() (*Region, error) {
 	return &region, nil
 }
 
+func (iter *regionListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *regionListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
 func (impl *regionImpl) ListRegions(ctx context.Context, opts *ResourceListOptions) (RegionListIterator, error) {
 	var (
-		paging *Pagination
-		filter *Filter
+		paging     *Pagination
+		filter     *Filter
+		resumeFrom string
 	)
 	if opts != nil {
 		paging = opts.Pagination
 		filter = opts.Filter
+		resumeFrom = opts.ResumeFrom
 	}
 
 	iter := listIterator{
@@ -100,6 +113,9 @@ func (impl *regionImpl) ListRegions(ctx context.Context, opts *ResourceListOptio
 		filter:   filter,
 		headers:  appendHeader(mapClusterIdFromOpts(opts)),
 	}
+	if err := iter.resume(resumeFrom); err != nil {
+		return nil, err
+	}
 
 	return &regionListIterator{iter: iter}, nil
 }
@@ -17,7 +17,13 @@ package cloud
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
 	"path"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,8 +33,59 @@ type ServiceRegistryType int
 const (
 	// ServiceRegistryKubernetes indicates the kubernetes-type service registry.
 	ServiceRegistryKubernetes = ServiceRegistryType(iota) + 1
+	// ServiceRegistryConsul indicates the consul-type service registry.
+	ServiceRegistryConsul
+	// ServiceRegistryNacos indicates the nacos-type service registry.
+	ServiceRegistryNacos
+	// ServiceRegistryEureka indicates the eureka-type service registry.
+	ServiceRegistryEureka
+	// ServiceRegistryDNS indicates the DNS-based service registry.
+	ServiceRegistryDNS
 )
 
+var _serviceRegistryTypeNames = map[ServiceRegistryType]string{
+	ServiceRegistryKubernetes: "kubernetes",
+	ServiceRegistryConsul:     "consul",
+	ServiceRegistryNacos:      "nacos",
+	ServiceRegistryEureka:     "eureka",
+	ServiceRegistryDNS:        "dns",
+}
+
+func (t ServiceRegistryType) String() string {
+	if name, ok := _serviceRegistryTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// UnmarshalJSON decodes the ServiceRegistryType from either the number
+// or the name (e.g. "consul"), unknown values are rejected.
+func (t *ServiceRegistryType) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		*t = 0
+		return nil
+	case float64:
+		typ := ServiceRegistryType(v)
+		if _, ok := _serviceRegistryTypeNames[typ]; (ok || typ == 0) && float64(typ) == v {
+			*t = typ
+			return nil
+		}
+	case string:
+		for typ, name := range _serviceRegistryTypeNames {
+			if strings.EqualFold(name, v) {
+				*t = typ
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unknown service registry type %s", string(data))
+}
+
 // ServiceRegistrySpec is the service registry specification.
 type ServiceRegistrySpec struct {
 	// Name is the service registry name.
@@ -40,6 +97,180 @@ type ServiceRegistrySpec struct {
 	// Kubernetes is the kubernetes service registry.
 	// It's valid only if Type is ServiceRegistryKubernetes.
 	Kubernetes *KubernetesServiceRegistry `json:"kubernetes,omitempty"`
+	// Consul is the consul service registry.
+	// It's valid only if Type is ServiceRegistryConsul.
+	Consul *ConsulServiceRegistry `json:"consul,omitempty"`
+	// Nacos is the nacos service registry.
+	// It's valid only if Type is ServiceRegistryNacos.
+	Nacos *NacosServiceRegistry `json:"nacos,omitempty"`
+	// Eureka is the eureka service registry.
+	// It's valid only if Type is ServiceRegistryEureka.
+	Eureka *EurekaServiceRegistry `json:"eureka,omitempty"`
+	// DNS is the DNS service registry.
+	// It's valid only if Type is ServiceRegistryDNS.
+	DNS *DNSServiceRegistry `json:"dns,omitempty"`
+}
+
+// Validate checks whether the specification of the Type is set, and
+// it's the only one.
+func (spec *ServiceRegistrySpec) Validate() error {
+	specs := []struct {
+		typ ServiceRegistryType
+		set bool
+	}{
+		{typ: ServiceRegistryKubernetes, set: spec.Kubernetes != nil},
+		{typ: ServiceRegistryConsul, set: spec.Consul != nil},
+		{typ: ServiceRegistryNacos, set: spec.Nacos != nil},
+		{typ: ServiceRegistryEureka, set: spec.Eureka != nil},
+		{typ: ServiceRegistryDNS, set: spec.DNS != nil},
+	}
+	if _, ok := _serviceRegistryTypeNames[spec.Type]; !ok {
+		return fmt.Errorf("unknown service registry type %d", spec.Type)
+	}
+	for _, s := range specs {
+		if s.typ == spec.Type && !s.set {
+			return fmt.Errorf("%s service registry: %s spec is required", spec.Type, spec.Type)
+		}
+		if s.typ != spec.Type && s.set {
+			return fmt.Errorf("%s service registry: unexpected %s spec", spec.Type, s.typ)
+		}
+	}
+
+	switch spec.Type {
+	case ServiceRegistryKubernetes:
+		return spec.Kubernetes.validate()
+	case ServiceRegistryConsul:
+		return spec.Consul.validate()
+	case ServiceRegistryNacos:
+		return spec.Nacos.validate()
+	case ServiceRegistryEureka:
+		return spec.Eureka.validate()
+	case ServiceRegistryDNS:
+		return spec.DNS.validate()
+	}
+	return nil
+}
+
+// ServiceRegistryTimeout is the timeout settings (in milliseconds) for
+// communicating with the service registry.
+type ServiceRegistryTimeout struct {
+	// Connect is the connect timeout.
+	Connect int `json:"connect,omitempty"`
+	// Send is the send timeout.
+	Send int `json:"send,omitempty"`
+	// Read is the read timeout.
+	Read int `json:"read,omitempty"`
+}
+
+// validateRegistryURLs checks the registry server addresses are all valid http(s) URLs.
+func validateRegistryURLs(typ ServiceRegistryType, field string, addrs []string) error {
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s service registry: %s is required", typ, field)
+	}
+	for i, addr := range addrs {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s service registry: %s[%d] %q should be a http(s) URL", typ, field, i, addr)
+		}
+	}
+	return nil
+}
+
+// ConsulServiceRegistry is the Consul registry.
+type ConsulServiceRegistry struct {
+	// Servers are the Consul server addresses, e.g. "http://127.0.0.1:8500".
+	Servers []string `json:"servers"`
+	// Token is the ACL token for accessing Consul.
+	Token string `json:"token,omitempty"`
+	// Datacenter is the Consul datacenter, the agent's datacenter is used if it's empty.
+	Datacenter string `json:"datacenter,omitempty"`
+	// FetchInterval is the interval (in seconds) to fetch the services.
+	FetchInterval int `json:"fetch_interval,omitempty"`
+	// Weight is the default weight of the service nodes.
+	Weight int `json:"weight,omitempty"`
+	// SkipServices are the services that should not be discovered.
+	SkipServices []string `json:"skip_services,omitempty"`
+	// Timeout is the timeout settings.
+	Timeout *ServiceRegistryTimeout `json:"timeout,omitempty"`
+}
+
+func (consul *ConsulServiceRegistry) validate() error {
+	return validateRegistryURLs(ServiceRegistryConsul, "servers", consul.Servers)
+}
+
+// NacosServiceRegistry is the Nacos registry.
+type NacosServiceRegistry struct {
+	// Hosts are the Nacos server addresses, e.g. "http://127.0.0.1:8848".
+	Hosts []string `json:"host"`
+	// Prefix is the prefix of the Nacos API.
+	Prefix string `json:"prefix,omitempty"`
+	// Username is the username for Nacos authentication.
+	Username string `json:"username,omitempty"`
+	// Password is the password for Nacos authentication.
+	Password string `json:"password,omitempty"`
+	// FetchInterval is the interval (in seconds) to fetch the services.
+	FetchInterval int `json:"fetch_interval,omitempty"`
+	// Weight is the default weight of the service nodes.
+	Weight int `json:"weight,omitempty"`
+	// Timeout is the timeout settings.
+	Timeout *ServiceRegistryTimeout `json:"timeout,omitempty"`
+}
+
+func (nacos *NacosServiceRegistry) validate() error {
+	if (nacos.Username == "") != (nacos.Password == "") {
+		return fmt.Errorf("%s service registry: username and password should be set together", ServiceRegistryNacos)
+	}
+	return validateRegistryURLs(ServiceRegistryNacos, "host", nacos.Hosts)
+}
+
+// EurekaServiceRegistry is the Eureka registry.
+type EurekaServiceRegistry struct {
+	// Hosts are the Eureka server addresses, e.g. "http://127.0.0.1:8761".
+	Hosts []string `json:"host"`
+	// Prefix is the prefix of the Eureka API, e.g. "/eureka/".
+	Prefix string `json:"prefix,omitempty"`
+	// FetchInterval is the interval (in seconds) to fetch the services.
+	FetchInterval int `json:"fetch_interval,omitempty"`
+	// Weight is the default weight of the service nodes.
+	Weight int `json:"weight,omitempty"`
+	// Timeout is the timeout settings.
+	Timeout *ServiceRegistryTimeout `json:"timeout,omitempty"`
+}
+
+func (eureka *EurekaServiceRegistry) validate() error {
+	return validateRegistryURLs(ServiceRegistryEureka, "host", eureka.Hosts)
+}
+
+// DNSServiceRegistry is the DNS-based registry.
+type DNSServiceRegistry struct {
+	// Servers are the DNS server addresses, e.g. "127.0.0.1:53".
+	Servers []string `json:"servers"`
+	// Order is the order of the record types to query,
+	// optional values are "SRV", "A", "AAAA" and "CNAME".
+	Order []string `json:"order,omitempty"`
+}
+
+func (dns *DNSServiceRegistry) validate() error {
+	if len(dns.Servers) == 0 {
+		return fmt.Errorf("%s service registry: servers is required", ServiceRegistryDNS)
+	}
+	for i, server := range dns.Servers {
+		host, port, err := net.SplitHostPort(server)
+		if err != nil || net.ParseIP(host) == nil {
+			return fmt.Errorf("%s service registry: servers[%d] %q should be an ip:port address", ServiceRegistryDNS, i, server)
+		}
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("%s service registry: servers[%d] %q has an invalid port", ServiceRegistryDNS, i, server)
+		}
+	}
+	for _, typ := range dns.Order {
+		switch typ {
+		case "SRV", "A", "AAAA", "CNAME":
+		default:
+			return fmt.Errorf("%s service registry: unknown record type %s in order", ServiceRegistryDNS, typ)
+		}
+	}
+	return nil
 }
 
 // KubernetesServiceRegistry is the Kubernetes registry.
@@ -56,6 +287,29 @@ type KubernetesServiceRegistry struct {
 	EndpointsLabelSelectors []KubernetesEndpointsLabelSelector `json:"endpoints_label_selectors,omitempty"`
 }
 
+func (k8s *KubernetesServiceRegistry) validate() error {
+	sel := k8s.NamespaceSelector
+	if sel == nil {
+		return nil
+	}
+	switch sel.Operator {
+	case KubernetesSelectorEqual, KubernetesSelectorNotEqual, KubernetesSelectorMatch, KubernetesSelectorNotMatch:
+	default:
+		return fmt.Errorf("%s service registry: unknown namespace selector operator %q", ServiceRegistryKubernetes, sel.Operator)
+	}
+	if len(sel.Patterns) == 0 {
+		return fmt.Errorf("%s service registry: namespace selector patterns are required by the %s operator", ServiceRegistryKubernetes, sel.Operator)
+	}
+	if sel.Operator == KubernetesSelectorMatch || sel.Operator == KubernetesSelectorNotMatch {
+		for i, pattern := range sel.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s service registry: namespace selector patterns[%d] %q is invalid: %s", ServiceRegistryKubernetes, i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
 // KubernetesAPIServer is configuration for the Kubernetes API server.
 type KubernetesAPIServer struct {
 	// Scheme is the scheme of http server
@@ -66,6 +320,21 @@ type KubernetesAPIServer struct {
 	Port int `json:"port,omitempty"`
 }
 
+const (
+	// KubernetesSelectorEqual selects the namespaces (or labels) which are equal to one of the patterns (or the value).
+	KubernetesSelectorEqual = "equal"
+	// KubernetesSelectorNotEqual selects the namespaces (or labels) which are not equal to any of the patterns (or the value).
+	KubernetesSelectorNotEqual = "not_equal"
+	// KubernetesSelectorMatch selects the namespaces which match one of the regular expression patterns.
+	KubernetesSelectorMatch = "match"
+	// KubernetesSelectorNotMatch selects the namespaces which don't match any of the regular expression patterns.
+	KubernetesSelectorNotMatch = "not_match"
+	// KubernetesSelectorExists selects the endpoints which have the label.
+	KubernetesSelectorExists = "exists"
+	// KubernetesSelectorNotExists selects the endpoints which don't have the label.
+	KubernetesSelectorNotExists = "not_exists"
+)
+
 // KubernetesNamespaceSelector is the namespace selector of kubernetes service discovery
 type KubernetesNamespaceSelector struct {
 	// Operator is the operator of the selector
@@ -126,10 +395,19 @@ type ServiceDiscoveryInterface interface {
 	// with the given list conditions.
 	// Users need to specify the Cluster, Paging and Filter conditions (if necessary) in the `opts`.
 	ListServiceRegistries(ctx context.Context, opts *ResourceListOptions) (ServiceRegistryListIterator, error)
+	// VerifyServiceRegistry checks whether the service registry is reachable with the
+	// given `registry` settings from the caller's machine. For the Kubernetes service
+	// registry, it gets the API server version and lists the endpoints in the selected
+	// namespaces with the service account token.
+	// Currently only the Kubernetes service registry can be verified.
+	VerifyServiceRegistry(ctx context.Context, registry *ServiceRegistry, opts *ServiceRegistryVerifyOptions) (*ServiceRegistryVerification, error)
 }
 
 // ServiceRegistryListIterator is an iterator for listing service registries.
 type ServiceRegistryListIterator interface {
+	ClientSideFilterReporter
+	Checkpointer
+
 	// Next returns the next ServiceRegistry according to the filter conditions.
 	Next() (*ServiceRegistry, error)
 }
@@ -157,6 +435,14 @@ func (iter *serviceRegistryListIterator) Next() (*ServiceRegistry, error) {
 	return &registry, nil
 }
 
+func (iter *serviceRegistryListIterator) ClientSideFilters() []string {
+	return iter.iter.ClientSideFilters()
+}
+
+func (iter *serviceRegistryListIterator) Checkpoint() (string, error) {
+	return iter.iter.Checkpoint()
+}
+
 func newServiceDiscovery(cli httpClient) ServiceDiscoveryInterface {
 	return &serviceRegistryImpl{
 		client: cli,
@@ -216,6 +502,12 @@ func (impl *serviceRegistryImpl) ListServiceRegistries(ctx context.Context, opts
 		filter:   opts.Filter,
 		headers:  appendHeader(mapClusterIdFromOpts(opts)),
 	}
+	if err := iter.validateFilter(); err != nil {
+		return nil, err
+	}
+	if err := iter.resume(opts.ResumeFrom); err != nil {
+		return nil, err
+	}
 
 	return &serviceRegistryListIterator{iter: iter}, nil
 }
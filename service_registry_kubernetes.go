@@ -0,0 +1,542 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultServiceAccountDir is the directory where the Kubernetes service account is mounted in pods.
+	DefaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	_kubernetesVerifyTimeout = 10 * time.Second
+)
+
+// KubernetesBootstrapOptions contains options for building the Kubernetes ServiceRegistry.
+type KubernetesBootstrapOptions struct {
+	// Name is the service registry name, the kubeconfig context name
+	// (or "in-cluster" for the in-cluster service account) is used if it's empty.
+	Name string
+	// Context is the kubeconfig context, the current context is used if it's empty.
+	Context string
+	// NamespaceSelector selects the namespaces to discover, the namespace of the
+	// kubeconfig context (or the service account) is selected if it's nil.
+	NamespaceSelector *KubernetesNamespaceSelector
+	// EndpointsLabelSelectors selects the endpoints to discover.
+	EndpointsLabelSelectors []KubernetesEndpointsLabelSelector
+	// ServiceAccountDir is the directory of the in-cluster service account,
+	// DefaultServiceAccountDir is used if it's empty.
+	ServiceAccountDir string
+}
+
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token     string `yaml:"token"`
+			TokenFile string `yaml:"tokenFile"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// defaultKubeconfigPath returns the first path in the KUBECONFIG environment
+// variable, or the ~/.kube/config if KUBECONFIG is not set.
+func defaultKubeconfigPath() (string, error) {
+	if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 {
+		return paths[0], nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "find kubeconfig")
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+// readKubeconfigFile reads the file which is relative to the kubeconfig directory.
+func readKubeconfigFile(kubeconfigPath, name string) ([]byte, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(kubeconfigPath), name)
+	}
+	return os.ReadFile(name)
+}
+
+// NewKubernetesServiceRegistryFromKubeconfig builds a Kubernetes ServiceRegistry from
+// the kubeconfig file, the KUBECONFIG environment variable (or the ~/.kube/config)
+// is used if `kubeconfigPath` is empty. The user of the context should use a bearer token
+// (e.g. a service account token) since it's the only credential the gateway supports,
+// the token value is put into the ServiceRegistry.
+// The returned warnings describe the settings that might stop the gateway from
+// connecting to the API server, e.g. a private certificate authority.
+func NewKubernetesServiceRegistryFromKubeconfig(kubeconfigPath string, opts *KubernetesBootstrapOptions) (*ServiceRegistry, []string, error) {
+	if opts == nil {
+		opts = &KubernetesBootstrapOptions{}
+	}
+	if kubeconfigPath == "" {
+		var err error
+		if kubeconfigPath, err = defaultKubeconfigPath(); err != nil {
+			return nil, nil, err
+		}
+	}
+	data, err := os.ReadFile(kubeconfigPath)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read kubeconfig")
+	}
+	var config kubeconfig
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid kubeconfig")
+	}
+
+	contextName := opts.Context
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	if contextName == "" {
+		return nil, nil, errors.New("kubeconfig: no context is specified")
+	}
+	var clusterName, userName, namespace string
+	found := false
+	for _, c := range config.Contexts {
+		if c.Name == contextName {
+			clusterName, userName, namespace = c.Context.Cluster, c.Context.User, c.Context.Namespace
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("kubeconfig: context %s not found", contextName)
+	}
+
+	var (
+		server   string
+		caData   []byte
+		insecure bool
+	)
+	found = false
+	for _, c := range config.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		server = c.Cluster.Server
+		insecure = c.Cluster.InsecureSkipTLSVerify
+		if c.Cluster.CertificateAuthorityData != "" {
+			if caData, err = base64.StdEncoding.DecodeString(c.Cluster.CertificateAuthorityData); err != nil {
+				return nil, nil, errors.Wrapf(err, "kubeconfig: cluster %s: decode certificate-authority-data", clusterName)
+			}
+		} else if c.Cluster.CertificateAuthority != "" {
+			if caData, err = readKubeconfigFile(kubeconfigPath, c.Cluster.CertificateAuthority); err != nil {
+				return nil, nil, errors.Wrapf(err, "kubeconfig: cluster %s: read certificate-authority", clusterName)
+			}
+		}
+		break
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("kubeconfig: cluster %s not found", clusterName)
+	}
+
+	var token string
+	found = false
+	for _, u := range config.Users {
+		if u.Name != userName {
+			continue
+		}
+		found = true
+		token = u.User.Token
+		if token == "" && u.User.TokenFile != "" {
+			value, err := readKubeconfigFile(kubeconfigPath, u.User.TokenFile)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "kubeconfig: user %s: read tokenFile", userName)
+			}
+			token = strings.TrimSpace(string(value))
+		}
+		break
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("kubeconfig: user %s not found", userName)
+	}
+	if token == "" {
+		return nil, nil, fmt.Errorf("kubeconfig: user %s has no bearer token, the gateway only supports token authentication", userName)
+	}
+
+	apiServer, warnings, err := kubernetesAPIServer(server, caData, insecure)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "kubeconfig: cluster %s", clusterName)
+	}
+	name := opts.Name
+	if name == "" {
+		name = contextName
+	}
+	registry := newKubernetesServiceRegistry(name, namespace, opts)
+	registry.Kubernetes.APIServer = *apiServer
+	registry.Kubernetes.ServiceAccountTokenValue = token
+	return registry, warnings, nil
+}
+
+// NewInClusterKubernetesServiceRegistry builds a Kubernetes ServiceRegistry from the
+// service account mounted in the pod, the API server address comes from the
+// KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT environment variables.
+// The ServiceRegistry refers to the token file rather than the token value, so
+// the gateway running in the same cluster always reads the refreshed token.
+// The returned warnings describe the settings that might stop the gateway from
+// connecting to the API server, e.g. a private certificate authority.
+func NewInClusterKubernetesServiceRegistry(opts *KubernetesBootstrapOptions) (*ServiceRegistry, []string, error) {
+	if opts == nil {
+		opts = &KubernetesBootstrapOptions{}
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT is not set")
+	}
+	dir := opts.ServiceAccountDir
+	if dir == "" {
+		dir = DefaultServiceAccountDir
+	}
+	tokenFile := filepath.Join(dir, "token")
+	if _, err := os.Stat(tokenFile); err != nil {
+		return nil, nil, errors.Wrap(err, "service account token")
+	}
+	caData, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, errors.Wrap(err, "service account ca.crt")
+	}
+	namespace, err := os.ReadFile(filepath.Join(dir, "namespace"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, errors.Wrap(err, "service account namespace")
+	}
+
+	apiServer, warnings, err := kubernetesAPIServer("https://"+net.JoinHostPort(host, port), caData, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := opts.Name
+	if name == "" {
+		name = "in-cluster"
+	}
+	registry := newKubernetesServiceRegistry(name, strings.TrimSpace(string(namespace)), opts)
+	registry.Kubernetes.APIServer = *apiServer
+	registry.Kubernetes.ServiceAccountTokenFile = tokenFile
+	return registry, warnings, nil
+}
+
+func newKubernetesServiceRegistry(name, namespace string, opts *KubernetesBootstrapOptions) *ServiceRegistry {
+	selector := opts.NamespaceSelector
+	if selector == nil && namespace != "" {
+		selector = &KubernetesNamespaceSelector{
+			Operator: KubernetesSelectorEqual,
+			Patterns: []string{namespace},
+		}
+	}
+	return &ServiceRegistry{
+		ServiceRegistrySpec: ServiceRegistrySpec{
+			Name:    name,
+			Enabled: true,
+			Type:    ServiceRegistryKubernetes,
+			Kubernetes: &KubernetesServiceRegistry{
+				NamespaceSelector:       selector,
+				EndpointsLabelSelectors: opts.EndpointsLabelSelectors,
+			},
+		},
+	}
+}
+
+// kubernetesAPIServer parses the API server address and checks whether the gateway
+// can trust the API server, the gateway only trusts the public certificate authorities.
+func kubernetesAPIServer(server string, caData []byte, insecure bool) (*KubernetesAPIServer, []string, error) {
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		return nil, nil, fmt.Errorf("invalid API server address %q", server)
+	}
+	apiServer := &KubernetesAPIServer{
+		Scheme: u.Scheme,
+		Host:   u.Hostname(),
+	}
+	switch {
+	case u.Port() != "":
+		apiServer.Port, _ = strconv.Atoi(u.Port())
+	case u.Scheme == "http":
+		apiServer.Port = 80
+	default:
+		apiServer.Port = 443
+	}
+
+	var warnings []string
+	if u.Scheme == "http" {
+		warnings = append(warnings, "the API server is accessed over plain HTTP, the service account token is not protected")
+		return apiServer, warnings, nil
+	}
+	if insecure {
+		warnings = append(warnings, "the kubeconfig skips the TLS verification, but the gateway always verifies the API server certificate")
+	}
+	if len(caData) == 0 {
+		return apiServer, warnings, nil
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	for rest := caData; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("the API server certificate authority can't be parsed: %s", err))
+			continue
+		}
+		if _, err = ca.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+			warnings = append(warnings, fmt.Sprintf("the API server certificate authority %q is not publicly trusted, the gateway will fail to verify the API server certificate", ca.Subject.String()))
+		}
+	}
+	return apiServer, warnings, nil
+}
+
+// ServiceRegistryVerifyOptions contains options for verifying the ServiceRegistry.
+type ServiceRegistryVerifyOptions struct {
+	// RootCAs is the set of certificate authorities to verify the API server
+	// certificate, the system pool (which is what the gateway trusts) is used if it's nil.
+	RootCAs *x509.CertPool
+}
+
+// ServiceRegistryVerification is the result of VerifyServiceRegistry.
+type ServiceRegistryVerification struct {
+	// Version is the version of the service registry, e.g. "v1.27.3".
+	Version string
+	// Endpoints is the number of the selected endpoints in each namespace.
+	Endpoints map[string]int
+}
+
+// kubernetesLabelSelector converts the selectors to the Kubernetes label selector.
+func kubernetesLabelSelector(selectors []KubernetesEndpointsLabelSelector) (string, error) {
+	var requirements []string
+	for _, s := range selectors {
+		switch s.Operator {
+		case KubernetesSelectorEqual:
+			requirements = append(requirements, s.Key+"="+s.Value)
+		case KubernetesSelectorNotEqual:
+			requirements = append(requirements, s.Key+"!="+s.Value)
+		case KubernetesSelectorExists:
+			requirements = append(requirements, s.Key)
+		case KubernetesSelectorNotExists:
+			requirements = append(requirements, "!"+s.Key)
+		default:
+			return "", fmt.Errorf("unknown endpoints label selector operator %q", s.Operator)
+		}
+	}
+	return strings.Join(requirements, ","), nil
+}
+
+// namespaceSelected reports whether the namespace is selected by the selector.
+func namespaceSelected(selector *KubernetesNamespaceSelector, namespace string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	switch selector.Operator {
+	case KubernetesSelectorEqual, KubernetesSelectorNotEqual:
+		for _, pattern := range selector.Patterns {
+			if pattern == namespace {
+				return selector.Operator == KubernetesSelectorEqual, nil
+			}
+		}
+		return selector.Operator == KubernetesSelectorNotEqual, nil
+	case KubernetesSelectorMatch, KubernetesSelectorNotMatch:
+		for _, pattern := range selector.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return false, errors.Wrapf(err, "namespace selector pattern %q", pattern)
+			}
+			if re.MatchString(namespace) {
+				return selector.Operator == KubernetesSelectorMatch, nil
+			}
+		}
+		return selector.Operator == KubernetesSelectorNotMatch, nil
+	default:
+		return false, fmt.Errorf("unknown namespace selector operator %q", selector.Operator)
+	}
+}
+
+type kubernetesClient struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+func (kc *kubernetesClient) get(ctx context.Context, uri string, query url.Values, v interface{}) error {
+	u := kc.baseURL + uri
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+kc.token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := kc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &status) == nil && status.Message != "" {
+			return fmt.Errorf("GET %s: status %d: %s", uri, resp.StatusCode, status.Message)
+		}
+		return fmt.Errorf("GET %s: status %d", uri, resp.StatusCode)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (impl *serviceRegistryImpl) VerifyServiceRegistry(ctx context.Context, registry *ServiceRegistry, opts *ServiceRegistryVerifyOptions) (*ServiceRegistryVerification, error) {
+	if registry.Type != ServiceRegistryKubernetes {
+		return nil, fmt.Errorf("verifying %s service registry is not supported", registry.Type)
+	}
+	if err := registry.Validate(); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &ServiceRegistryVerifyOptions{}
+	}
+	spec := registry.Kubernetes
+	token := spec.ServiceAccountTokenValue
+	if token == "" && spec.ServiceAccountTokenFile != "" {
+		data, err := os.ReadFile(spec.ServiceAccountTokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read service account token")
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	labelSelector, err := kubernetesLabelSelector(spec.EndpointsLabelSelectors)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := spec.APIServer.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	kc := &kubernetesClient{
+		client: &http.Client{
+			Timeout: _kubernetesVerifyTimeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: opts.RootCAs},
+			},
+		},
+		baseURL: scheme + "://" + net.JoinHostPort(spec.APIServer.Host, strconv.Itoa(spec.APIServer.Port)),
+		token:   token,
+	}
+
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err = kc.get(ctx, "/version", nil, &version); err != nil {
+		return nil, errors.Wrap(err, "get API server version")
+	}
+
+	query := url.Values{}
+	if labelSelector != "" {
+		query.Set("labelSelector", labelSelector)
+	}
+	// List the namespaces one by one if they're known, otherwise
+	// list all the endpoints and select the namespaces locally.
+	uris := []string{"/api/v1/endpoints"}
+	if sel := spec.NamespaceSelector; sel != nil && sel.Operator == KubernetesSelectorEqual {
+		uris = uris[:0]
+		namespaces := append([]string(nil), sel.Patterns...)
+		sort.Strings(namespaces)
+		for _, ns := range namespaces {
+			uris = append(uris, path.Join("/api/v1/namespaces", ns, "endpoints"))
+		}
+	}
+
+	verification := &ServiceRegistryVerification{
+		Version:   version.GitVersion,
+		Endpoints: make(map[string]int),
+	}
+	for _, uri := range uris {
+		var list struct {
+			Items []struct {
+				Metadata struct {
+					Namespace string `json:"namespace"`
+				} `json:"metadata"`
+			} `json:"items"`
+		}
+		if err = kc.get(ctx, uri, query, &list); err != nil {
+			return nil, errors.Wrap(err, "list endpoints")
+		}
+		for _, item := range list.Items {
+			selected, err := namespaceSelected(spec.NamespaceSelector, item.Metadata.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			if selected {
+				verification.Endpoints[item.Metadata.Namespace]++
+			}
+		}
+	}
+	return verification, nil
+}
@@ -0,0 +1,348 @@
+// Copyright 2022 API7.ai, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/api7/cloud-go-sdk/internal/fake"
+)
+
+func TestNewKubernetesServiceRegistryFromKubeconfig(t *testing.T) {
+	t.Parallel()
+
+	ca, err := os.ReadFile("testdata/test.pem")
+	assert.Nil(t, err, "read the test certificate")
+	caData := base64.StdEncoding.EncodeToString(ca)
+
+	testCases := []struct {
+		name             string
+		kubeconfig       string
+		files            map[string]string
+		opts             *KubernetesBootstrapOptions
+		expectedRegistry *ServiceRegistry
+		expectedWarnings []string
+		expectedError    string
+	}{
+		{
+			name: "current context with private CA",
+			kubeconfig: `
+current-context: prod
+clusters:
+- name: prod-cluster
+  cluster:
+    server: https://10.0.0.1:6443
+    certificate-authority-data: ` + caData + `
+users:
+- name: gateway
+  user:
+    token: abc
+contexts:
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: gateway
+    namespace: apps
+`,
+			expectedRegistry: &ServiceRegistry{
+				ServiceRegistrySpec: ServiceRegistrySpec{
+					Name:    "prod",
+					Enabled: true,
+					Type:    ServiceRegistryKubernetes,
+					Kubernetes: &KubernetesServiceRegistry{
+						APIServer:                KubernetesAPIServer{Scheme: "https", Host: "10.0.0.1", Port: 6443},
+						ServiceAccountTokenValue: "abc",
+						NamespaceSelector: &KubernetesNamespaceSelector{
+							Operator: KubernetesSelectorEqual,
+							Patterns: []string{"apps"},
+						},
+					},
+				},
+			},
+			expectedWarnings: []string{
+				`the API server certificate authority "CN=vault,OU=cloud,O=API7,L=HangZhou,C=CN" is not publicly trusted, the gateway will fail to verify the API server certificate`,
+			},
+		},
+		{
+			name: "specified context with token file",
+			kubeconfig: `
+current-context: prod
+clusters:
+- name: dev
+  cluster:
+    server: https://kube.example.com
+    insecure-skip-tls-verify: true
+users:
+- name: dev
+  user:
+    tokenFile: token
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+`,
+			files: map[string]string{"token": "def\n"},
+			opts: &KubernetesBootstrapOptions{
+				Name:    "dev registry",
+				Context: "dev",
+				EndpointsLabelSelectors: []KubernetesEndpointsLabelSelector{
+					{Key: "app", Operator: KubernetesSelectorExists},
+				},
+			},
+			expectedRegistry: &ServiceRegistry{
+				ServiceRegistrySpec: ServiceRegistrySpec{
+					Name:    "dev registry",
+					Enabled: true,
+					Type:    ServiceRegistryKubernetes,
+					Kubernetes: &KubernetesServiceRegistry{
+						APIServer:                KubernetesAPIServer{Scheme: "https", Host: "kube.example.com", Port: 443},
+						ServiceAccountTokenValue: "def",
+						EndpointsLabelSelectors: []KubernetesEndpointsLabelSelector{
+							{Key: "app", Operator: KubernetesSelectorExists},
+						},
+					},
+				},
+			},
+			expectedWarnings: []string{
+				"the kubeconfig skips the TLS verification, but the gateway always verifies the API server certificate",
+			},
+		},
+		{
+			name: "context not found",
+			kubeconfig: `
+current-context: prod
+`,
+			expectedError: "kubeconfig: context prod not found",
+		},
+		{
+			name: "client certificate user",
+			kubeconfig: `
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: http://127.0.0.1:8080
+users:
+- name: admin
+  user:
+    client-certificate-data: abc
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+`,
+			expectedError: "kubeconfig: user admin has no bearer token, the gateway only supports token authentication",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			kubeconfigPath := filepath.Join(dir, "config")
+			assert.Nil(t, os.WriteFile(kubeconfigPath, []byte(tc.kubeconfig), 0600), "write kubeconfig")
+			for name, content := range tc.files {
+				assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600), "write file")
+			}
+
+			registry, warnings, err := NewKubernetesServiceRegistryFromKubeconfig(kubeconfigPath, tc.opts)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			assert.Equal(t, tc.expectedRegistry, registry, "check the registry")
+			assert.Equal(t, tc.expectedWarnings, warnings, "check the warnings")
+		})
+	}
+}
+
+func TestNewInClusterKubernetesServiceRegistry(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := os.ReadFile("testdata/test.pem")
+	assert.Nil(t, err, "read the test certificate")
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "token"), []byte("abc"), 0600), "write token")
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0600), "write ca.crt")
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("apisix"), 0600), "write namespace")
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	_, _, err = NewInClusterKubernetesServiceRegistry(&KubernetesBootstrapOptions{ServiceAccountDir: dir})
+	assert.Contains(t, err.Error(), "not running in a Kubernetes cluster", "check the error details")
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	registry, warnings, err := NewInClusterKubernetesServiceRegistry(&KubernetesBootstrapOptions{ServiceAccountDir: dir})
+	assert.Nil(t, err, "check the error")
+	assert.Equal(t, &ServiceRegistry{
+		ServiceRegistrySpec: ServiceRegistrySpec{
+			Name:    "in-cluster",
+			Enabled: true,
+			Type:    ServiceRegistryKubernetes,
+			Kubernetes: &KubernetesServiceRegistry{
+				APIServer:               KubernetesAPIServer{Scheme: "https", Host: "10.96.0.1", Port: 443},
+				ServiceAccountTokenFile: filepath.Join(dir, "token"),
+				NamespaceSelector: &KubernetesNamespaceSelector{
+					Operator: KubernetesSelectorEqual,
+					Patterns: []string{"apisix"},
+				},
+			},
+		},
+	}, registry, "check the registry")
+	assert.Len(t, warnings, 1, "check the warnings")
+}
+
+func TestVerifyServiceRegistry(t *testing.T) {
+	t.Parallel()
+
+	kube, err := fake.NewKubeAPIServer("abc")
+	assert.Nil(t, err, "check create fake kubernetes api server error")
+	go func() {
+		_ = kube.Serve()
+	}()
+	t.Cleanup(func() {
+		_ = kube.Close()
+	})
+	kube.AddEndpoints("default", "web", map[string]string{"app": "web"})
+	kube.AddEndpoints("default", "db", map[string]string{"app": "db"})
+	kube.AddEndpoints("apps", "api", map[string]string{"app": "api"})
+	kube.AddEndpoints("kube-system", "kube-dns", map[string]string{"k8s-app": "kube-dns"})
+
+	u, err := url.Parse(kube.Addr())
+	assert.Nil(t, err, "parse the api server addr")
+	port, _ := strconv.Atoi(u.Port())
+	apiServer := KubernetesAPIServer{Scheme: u.Scheme, Host: u.Hostname(), Port: port}
+
+	testCases := []struct {
+		name                 string
+		registry             *KubernetesServiceRegistry
+		expectedVerification *ServiceRegistryVerification
+		expectedError        string
+	}{
+		{
+			name: "all namespaces",
+			registry: &KubernetesServiceRegistry{
+				APIServer:                apiServer,
+				ServiceAccountTokenValue: "abc",
+			},
+			expectedVerification: &ServiceRegistryVerification{
+				Version:   "v1.27.3",
+				Endpoints: map[string]int{"default": 2, "apps": 1, "kube-system": 1},
+			},
+		},
+		{
+			name: "equal namespaces with label selectors",
+			registry: &KubernetesServiceRegistry{
+				APIServer:                apiServer,
+				ServiceAccountTokenValue: "abc",
+				NamespaceSelector: &KubernetesNamespaceSelector{
+					Operator: KubernetesSelectorEqual,
+					Patterns: []string{"default", "apps"},
+				},
+				EndpointsLabelSelectors: []KubernetesEndpointsLabelSelector{
+					{Key: "app", Operator: KubernetesSelectorNotEqual, Value: "db"},
+				},
+			},
+			expectedVerification: &ServiceRegistryVerification{
+				Version:   "v1.27.3",
+				Endpoints: map[string]int{"default": 1, "apps": 1},
+			},
+		},
+		{
+			name: "not match namespaces",
+			registry: &KubernetesServiceRegistry{
+				APIServer:                apiServer,
+				ServiceAccountTokenValue: "abc",
+				NamespaceSelector: &KubernetesNamespaceSelector{
+					Operator: KubernetesSelectorNotMatch,
+					Patterns: []string{"^kube-"},
+				},
+			},
+			expectedVerification: &ServiceRegistryVerification{
+				Version:   "v1.27.3",
+				Endpoints: map[string]int{"default": 2, "apps": 1},
+			},
+		},
+		{
+			name: "bad token",
+			registry: &KubernetesServiceRegistry{
+				APIServer:                apiServer,
+				ServiceAccountTokenValue: "bad",
+			},
+			expectedError: "get API server version: GET /version: status 401: Unauthorized",
+		},
+		{
+			name: "unknown label selector operator",
+			registry: &KubernetesServiceRegistry{
+				APIServer:                apiServer,
+				ServiceAccountTokenValue: "abc",
+				EndpointsLabelSelectors: []KubernetesEndpointsLabelSelector{
+					{Key: "app", Operator: "in"},
+				},
+			},
+			expectedError: `unknown endpoints label selector operator "in"`,
+		},
+		{
+			name: "equal namespace selector without patterns",
+			registry: &KubernetesServiceRegistry{
+				APIServer:                apiServer,
+				ServiceAccountTokenValue: "abc",
+				NamespaceSelector:        &KubernetesNamespaceSelector{Operator: KubernetesSelectorEqual},
+			},
+			expectedError: "namespace selector patterns are required by the equal operator",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			impl := &serviceRegistryImpl{}
+			verification, err := impl.VerifyServiceRegistry(context.Background(), &ServiceRegistry{
+				ServiceRegistrySpec: ServiceRegistrySpec{
+					Type:       ServiceRegistryKubernetes,
+					Kubernetes: tc.registry,
+				},
+			}, nil)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			assert.Equal(t, tc.expectedVerification, verification, "check the verification")
+		})
+	}
+
+	impl := &serviceRegistryImpl{}
+	_, err = impl.VerifyServiceRegistry(context.Background(), &ServiceRegistry{
+		ServiceRegistrySpec: ServiceRegistrySpec{
+			Type:   ServiceRegistryConsul,
+			Consul: &ConsulServiceRegistry{Servers: []string{"http://127.0.0.1:8500"}},
+		},
+	}, nil)
+	assert.Contains(t, err.Error(), "verifying consul service registry is not supported", "check the error details")
+}
@@ -16,6 +16,7 @@ package cloud
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"path"
 	"testing"
@@ -305,3 +306,279 @@ func TestListServiceRegistries(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceRegistryTypeUnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name          string
+		data          string
+		expectedType  ServiceRegistryType
+		expectedError string
+	}{
+		{
+			name:         "number",
+			data:         `3`,
+			expectedType: ServiceRegistryNacos,
+		},
+		{
+			name:         "name",
+			data:         `"Consul"`,
+			expectedType: ServiceRegistryConsul,
+		},
+		{
+			name:         "zero",
+			data:         `0`,
+			expectedType: 0,
+		},
+		{
+			name:          "unknown number",
+			data:          `9`,
+			expectedError: "unknown service registry type 9",
+		},
+		{
+			name:          "fractional number",
+			data:          `1.5`,
+			expectedError: "unknown service registry type 1.5",
+		},
+		{
+			name:          "unknown name",
+			data:          `"zookeeper"`,
+			expectedError: `unknown service registry type "zookeeper"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var typ ServiceRegistryType
+			err := json.Unmarshal([]byte(tc.data), &typ)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+				return
+			}
+			assert.Nil(t, err, "check the error")
+			assert.Equal(t, tc.expectedType, typ, "check the type")
+		})
+	}
+}
+
+func TestServiceRegistrySpecValidate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		spec          ServiceRegistrySpec
+		expectedError string
+	}{
+		{
+			name: "kubernetes",
+			spec: ServiceRegistrySpec{
+				Type:       ServiceRegistryKubernetes,
+				Kubernetes: &KubernetesServiceRegistry{},
+			},
+		},
+		{
+			name: "kubernetes namespace selector",
+			spec: ServiceRegistrySpec{
+				Type: ServiceRegistryKubernetes,
+				Kubernetes: &KubernetesServiceRegistry{
+					NamespaceSelector: &KubernetesNamespaceSelector{Operator: KubernetesSelectorMatch, Patterns: []string{"^team-"}},
+				},
+			},
+		},
+		{
+			name: "kubernetes namespace selector without patterns",
+			spec: ServiceRegistrySpec{
+				Type: ServiceRegistryKubernetes,
+				Kubernetes: &KubernetesServiceRegistry{
+					NamespaceSelector: &KubernetesNamespaceSelector{Operator: KubernetesSelectorEqual},
+				},
+			},
+			expectedError: "kubernetes service registry: namespace selector patterns are required by the equal operator",
+		},
+		{
+			name: "kubernetes invalid namespace selector pattern",
+			spec: ServiceRegistrySpec{
+				Type: ServiceRegistryKubernetes,
+				Kubernetes: &KubernetesServiceRegistry{
+					NamespaceSelector: &KubernetesNamespaceSelector{Operator: KubernetesSelectorNotMatch, Patterns: []string{"("}},
+				},
+			},
+			expectedError: `kubernetes service registry: namespace selector patterns[0] "(" is invalid`,
+		},
+		{
+			name: "kubernetes unknown namespace selector operator",
+			spec: ServiceRegistrySpec{
+				Type: ServiceRegistryKubernetes,
+				Kubernetes: &KubernetesServiceRegistry{
+					NamespaceSelector: &KubernetesNamespaceSelector{Operator: "in", Patterns: []string{"default"}},
+				},
+			},
+			expectedError: `kubernetes service registry: unknown namespace selector operator "in"`,
+		},
+		{
+			name: "consul",
+			spec: ServiceRegistrySpec{
+				Type:   ServiceRegistryConsul,
+				Consul: &ConsulServiceRegistry{Servers: []string{"http://127.0.0.1:8500"}},
+			},
+		},
+		{
+			name: "nacos",
+			spec: ServiceRegistrySpec{
+				Type:  ServiceRegistryNacos,
+				Nacos: &NacosServiceRegistry{Hosts: []string{"http://127.0.0.1:8848"}, Username: "nacos", Password: "nacos"},
+			},
+		},
+		{
+			name: "eureka",
+			spec: ServiceRegistrySpec{
+				Type:   ServiceRegistryEureka,
+				Eureka: &EurekaServiceRegistry{Hosts: []string{"https://eureka.example.com"}},
+			},
+		},
+		{
+			name: "dns",
+			spec: ServiceRegistrySpec{
+				Type: ServiceRegistryDNS,
+				DNS:  &DNSServiceRegistry{Servers: []string{"127.0.0.1:53"}, Order: []string{"SRV", "A"}},
+			},
+		},
+		{
+			name:          "unknown type",
+			spec:          ServiceRegistrySpec{Type: 10},
+			expectedError: "unknown service registry type 10",
+		},
+		{
+			name:          "missing spec",
+			spec:          ServiceRegistrySpec{Type: ServiceRegistryConsul},
+			expectedError: "consul service registry: consul spec is required",
+		},
+		{
+			name: "mismatched spec",
+			spec: ServiceRegistrySpec{
+				Type:       ServiceRegistryConsul,
+				Consul:     &ConsulServiceRegistry{Servers: []string{"http://127.0.0.1:8500"}},
+				Kubernetes: &KubernetesServiceRegistry{},
+			},
+			expectedError: "consul service registry: unexpected kubernetes spec",
+		},
+		{
+			name: "invalid consul server",
+			spec: ServiceRegistrySpec{
+				Type:   ServiceRegistryConsul,
+				Consul: &ConsulServiceRegistry{Servers: []string{"127.0.0.1:8500"}},
+			},
+			expectedError: `consul service registry: servers[0] "127.0.0.1:8500" should be a http(s) URL`,
+		},
+		{
+			name: "nacos password without username",
+			spec: ServiceRegistrySpec{
+				Type:  ServiceRegistryNacos,
+				Nacos: &NacosServiceRegistry{Hosts: []string{"http://127.0.0.1:8848"}, Password: "nacos"},
+			},
+			expectedError: "username and password should be set together",
+		},
+		{
+			name: "missing eureka host",
+			spec: ServiceRegistrySpec{
+				Type:   ServiceRegistryEureka,
+				Eureka: &EurekaServiceRegistry{},
+			},
+			expectedError: "eureka service registry: host is required",
+		},
+		{
+			name: "invalid dns server",
+			spec: ServiceRegistrySpec{
+				Type: ServiceRegistryDNS,
+				DNS:  &DNSServiceRegistry{Servers: []string{"dns.example.com:53"}},
+			},
+			expectedError: `dns service registry: servers[0] "dns.example.com:53" should be an ip:port address`,
+		},
+		{
+			name: "unknown dns record type",
+			spec: ServiceRegistrySpec{
+				Type: ServiceRegistryDNS,
+				DNS:  &DNSServiceRegistry{Servers: []string{"127.0.0.1:53"}, Order: []string{"MX"}},
+			},
+			expectedError: "dns service registry: unknown record type MX in order",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.spec.Validate()
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			} else {
+				assert.Nil(t, err, "check the error")
+			}
+		})
+	}
+}
+
+func TestUpstreamServiceDiscoveryValidate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		sd            UpstreamServiceDiscovery
+		expectedError string
+	}{
+		{
+			name: "kubernetes",
+			sd: UpstreamServiceDiscovery{
+				ServiceRegistry:   ServiceRegistryKubernetes,
+				KubernetesService: KubernetesUpstreamServiceDiscovery{Namespace: "default", Name: "httpbin", Port: "http"},
+			},
+		},
+		{
+			name: "consul",
+			sd: UpstreamServiceDiscovery{
+				ServiceRegistry: ServiceRegistryConsul,
+				ConsulService:   &ConsulUpstreamServiceDiscovery{ServiceName: "httpbin", Tags: []string{"v1"}},
+			},
+		},
+		{
+			name: "nacos",
+			sd: UpstreamServiceDiscovery{
+				ServiceRegistry: ServiceRegistryNacos,
+				NacosService:    &NacosUpstreamServiceDiscovery{ServiceName: "httpbin", NamespaceID: "test", GroupName: "group"},
+			},
+		},
+		{
+			name: "missing variant",
+			sd: UpstreamServiceDiscovery{
+				ServiceRegistry: ServiceRegistryEureka,
+			},
+			expectedError: "eureka service discovery: eureka_service is required",
+		},
+		{
+			name: "mismatched variant",
+			sd: UpstreamServiceDiscovery{
+				ServiceRegistry: ServiceRegistryDNS,
+				DNSService:      &DNSUpstreamServiceDiscovery{ServiceName: "example.com"},
+				ConsulService:   &ConsulUpstreamServiceDiscovery{ServiceName: "httpbin"},
+			},
+			expectedError: "dns service discovery: unexpected consul_service",
+		},
+		{
+			name: "missing service name",
+			sd: UpstreamServiceDiscovery{
+				ServiceRegistry: ServiceRegistryKubernetes,
+				KubernetesService: KubernetesUpstreamServiceDiscovery{
+					Namespace: "default",
+				},
+			},
+			expectedError: "kubernetes service discovery: service name is required",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.sd.Validate()
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError, "check the error details")
+			} else {
+				assert.Nil(t, err, "check the error")
+			}
+		})
+	}
+}
@@ -36,6 +36,7 @@ type Interface interface {
 	ConsumerInterface
 	LogCollectionInterface
 	ServiceDiscoveryInterface
+	ManifestInterface
 }
 
 // AccessToken is the token used by API7 Cloud to authenticate clients.
@@ -62,6 +63,7 @@ type impl struct {
 	ConsumerInterface
 	LogCollectionInterface
 	ServiceDiscoveryInterface
+	ManifestInterface
 }
 
 func (i *impl) SetGlobalClusterID(id ID) {
@@ -111,20 +113,39 @@ func NewInterface(opts *Options) (Interface, error) {
 		return nil, errors.Wrap(err, "new interface")
 	}
 
+	validator := pluginValidator{enabled: opts.ValidatePlugins}
+	application := newApplication(cli)
+	application.pluginValidator = validator
+	api := newAPI(cli)
+	api.pluginValidator = validator
+	cluster := newCluster(cli)
+	cluster.pluginValidator = validator
+	consumer := newConsumer(cli)
+	consumer.pluginValidator = validator
+	certificate := newCertificate(cli)
+	certificate.applications = application
+	manifest := newManifest(cli)
+	manifest.clusters = cluster
+	manifest.applications = application
+	manifest.apis = api
+	manifest.consumers = consumer
+	manifest.certificates = certificate
+
 	return &impl{
 		httpCli:                   cli,
 		TraceInterface:            trace,
 		UserInterface:             newUser(cli),
 		AuthInterface:             newAuth(cli),
-		ApplicationInterface:      newApplication(cli),
-		APIInterface:              newAPI(cli),
-		ClusterInterface:          newCluster(cli),
+		ApplicationInterface:      application,
+		APIInterface:              api,
+		ClusterInterface:          cluster,
 		OrganizationInterface:     newOrganization(cli),
 		RegionInterface:           newRegion(cli),
 		CanaryReleaseInterface:    newCanaryRelease(cli),
-		CertificateInterface:      newCertificate(cli),
-		ConsumerInterface:         newConsumer(cli),
+		CertificateInterface:      certificate,
+		ConsumerInterface:         consumer,
 		LogCollectionInterface:    newLogCollection(cli),
 		ServiceDiscoveryInterface: newServiceDiscovery(cli),
+		ManifestInterface:         manifest,
 	}, err
 }
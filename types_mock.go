@@ -5,7 +5,9 @@ package cloud
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -33,6 +35,36 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// Apply mocks base method.
+func (m *MockInterface) Apply(ctx context.Context, clusterID ID, desired *Manifest, opts *ApplyOptions) (*Plan, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Apply", ctx, clusterID, desired, opts)
+	ret0, _ := ret[0].(*Plan)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Apply indicates an expected call of Apply.
+func (mr *MockInterfaceMockRecorder) Apply(ctx, clusterID, desired, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Apply", reflect.TypeOf((*MockInterface)(nil).Apply), ctx, clusterID, desired, opts)
+}
+
+// CloneCluster mocks base method.
+func (m *MockInterface) CloneCluster(ctx context.Context, srcClusterID, dstClusterID ID, opts *CloneOptions) (*Plan, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CloneCluster", ctx, srcClusterID, dstClusterID, opts)
+	ret0, _ := ret[0].(*Plan)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CloneCluster indicates an expected call of CloneCluster.
+func (mr *MockInterfaceMockRecorder) CloneCluster(ctx, srcClusterID, dstClusterID, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloneCluster", reflect.TypeOf((*MockInterface)(nil).CloneCluster), ctx, srcClusterID, dstClusterID, opts)
+}
+
 // CreateAPI mocks base method.
 func (m *MockInterface) CreateAPI(ctx context.Context, api *API, opts *ResourceCreateOptions) (*API, error) {
 	m.ctrl.T.Helper()
@@ -108,6 +140,21 @@ func (mr *MockInterfaceMockRecorder) CreateCertificate(ctx, cert, opts interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCertificate", reflect.TypeOf((*MockInterface)(nil).CreateCertificate), ctx, cert, opts)
 }
 
+// CreateCluster mocks base method.
+func (m *MockInterface) CreateCluster(ctx context.Context, cluster *Cluster, opts *ResourceCreateOptions) (*Cluster, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCluster", ctx, cluster, opts)
+	ret0, _ := ret[0].(*Cluster)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateCluster indicates an expected call of CreateCluster.
+func (mr *MockInterfaceMockRecorder) CreateCluster(ctx, cluster, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCluster", reflect.TypeOf((*MockInterface)(nil).CreateCluster), ctx, cluster, opts)
+}
+
 // CreateConsumer mocks base method.
 func (m *MockInterface) CreateConsumer(ctx context.Context, consumer *Consumer, opts *ResourceCreateOptions) (*Consumer, error) {
 	m.ctrl.T.Helper()
@@ -123,6 +170,36 @@ func (mr *MockInterfaceMockRecorder) CreateConsumer(ctx, consumer, opts interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateConsumer", reflect.TypeOf((*MockInterface)(nil).CreateConsumer), ctx, consumer, opts)
 }
 
+// CreateDevCertificate mocks base method.
+func (m *MockInterface) CreateDevCertificate(ctx context.Context, ca *DevCA, req *DevCertificateRequest, opts *ResourceCreateOptions) (*CertificateDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateDevCertificate", ctx, ca, req, opts)
+	ret0, _ := ret[0].(*CertificateDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateDevCertificate indicates an expected call of CreateDevCertificate.
+func (mr *MockInterfaceMockRecorder) CreateDevCertificate(ctx, ca, req, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDevCertificate", reflect.TypeOf((*MockInterface)(nil).CreateDevCertificate), ctx, ca, req, opts)
+}
+
+// CreateDevUpstreamClientCertificate mocks base method.
+func (m *MockInterface) CreateDevUpstreamClientCertificate(ctx context.Context, ca *DevCA, appID ID, upstreamVersion string, req *DevCertificateRequest, opts *ResourceCreateOptions) (*CertificateDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateDevUpstreamClientCertificate", ctx, ca, appID, upstreamVersion, req, opts)
+	ret0, _ := ret[0].(*CertificateDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateDevUpstreamClientCertificate indicates an expected call of CreateDevUpstreamClientCertificate.
+func (mr *MockInterfaceMockRecorder) CreateDevUpstreamClientCertificate(ctx, ca, appID, upstreamVersion, req, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateDevUpstreamClientCertificate", reflect.TypeOf((*MockInterface)(nil).CreateDevUpstreamClientCertificate), ctx, ca, appID, upstreamVersion, req, opts)
+}
+
 // CreateLogCollection mocks base method.
 func (m *MockInterface) CreateLogCollection(ctx context.Context, lc *LogCollection, opts *ResourceCreateOptions) (*LogCollection, error) {
 	m.ctrl.T.Helper()
@@ -138,6 +215,21 @@ func (mr *MockInterfaceMockRecorder) CreateLogCollection(ctx, lc, opts interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLogCollection", reflect.TypeOf((*MockInterface)(nil).CreateLogCollection), ctx, lc, opts)
 }
 
+// CreateRole mocks base method.
+func (m *MockInterface) CreateRole(ctx context.Context, role *Role, opts *ResourceCreateOptions) (*Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRole", ctx, role, opts)
+	ret0, _ := ret[0].(*Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRole indicates an expected call of CreateRole.
+func (mr *MockInterfaceMockRecorder) CreateRole(ctx, role, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRole", reflect.TypeOf((*MockInterface)(nil).CreateRole), ctx, role, opts)
+}
+
 // CreateServiceRegistry mocks base method.
 func (m *MockInterface) CreateServiceRegistry(ctx context.Context, registry *ServiceRegistry, opts *ResourceCreateOptions) (*ServiceRegistry, error) {
 	m.ctrl.T.Helper()
@@ -298,6 +390,20 @@ func (mr *MockInterfaceMockRecorder) DeleteCertificate(ctx, certID, opts interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCertificate", reflect.TypeOf((*MockInterface)(nil).DeleteCertificate), ctx, certID, opts)
 }
 
+// DeleteCluster mocks base method.
+func (m *MockInterface) DeleteCluster(ctx context.Context, clusterID ID, opts *ResourceDeleteOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCluster", ctx, clusterID, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCluster indicates an expected call of DeleteCluster.
+func (mr *MockInterfaceMockRecorder) DeleteCluster(ctx, clusterID, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCluster", reflect.TypeOf((*MockInterface)(nil).DeleteCluster), ctx, clusterID, opts)
+}
+
 // DeleteConsumer mocks base method.
 func (m *MockInterface) DeleteConsumer(ctx context.Context, consumerID ID, opts *ResourceDeleteOptions) error {
 	m.ctrl.T.Helper()
@@ -326,6 +432,20 @@ func (mr *MockInterfaceMockRecorder) DeleteLogCollection(ctx, lcID, opts interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLogCollection", reflect.TypeOf((*MockInterface)(nil).DeleteLogCollection), ctx, lcID, opts)
 }
 
+// DeleteRole mocks base method.
+func (m *MockInterface) DeleteRole(ctx context.Context, roleID ID, opts *ResourceDeleteOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRole", ctx, roleID, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRole indicates an expected call of DeleteRole.
+func (mr *MockInterfaceMockRecorder) DeleteRole(ctx, roleID, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRole", reflect.TypeOf((*MockInterface)(nil).DeleteRole), ctx, roleID, opts)
+}
+
 // DeleteServiceRegistry mocks base method.
 func (m *MockInterface) DeleteServiceRegistry(ctx context.Context, registryID ID, opts *ResourceDeleteOptions) error {
 	m.ctrl.T.Helper()
@@ -340,6 +460,50 @@ func (mr *MockInterfaceMockRecorder) DeleteServiceRegistry(ctx, registryID, opts
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteServiceRegistry", reflect.TypeOf((*MockInterface)(nil).DeleteServiceRegistry), ctx, registryID, opts)
 }
 
+// Diff mocks base method.
+func (m *MockInterface) Diff(ctx context.Context, clusterID ID, desired *Manifest) (*ManifestDiff, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Diff", ctx, clusterID, desired)
+	ret0, _ := ret[0].(*ManifestDiff)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Diff indicates an expected call of Diff.
+func (mr *MockInterfaceMockRecorder) Diff(ctx, clusterID, desired interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Diff", reflect.TypeOf((*MockInterface)(nil).Diff), ctx, clusterID, desired)
+}
+
+// ExportCluster mocks base method.
+func (m *MockInterface) ExportCluster(ctx context.Context, clusterID ID, w io.Writer, opts *ExportOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportCluster", ctx, clusterID, w, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportCluster indicates an expected call of ExportCluster.
+func (mr *MockInterfaceMockRecorder) ExportCluster(ctx, clusterID, w, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportCluster", reflect.TypeOf((*MockInterface)(nil).ExportCluster), ctx, clusterID, w, opts)
+}
+
+// FindMemberByEmail mocks base method.
+func (m *MockInterface) FindMemberByEmail(ctx context.Context, email string, opts *ResourceGetOptions) (*Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMemberByEmail", ctx, email, opts)
+	ret0, _ := ret[0].(*Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMemberByEmail indicates an expected call of FindMemberByEmail.
+func (mr *MockInterfaceMockRecorder) FindMemberByEmail(ctx, email, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMemberByEmail", reflect.TypeOf((*MockInterface)(nil).FindMemberByEmail), ctx, email, opts)
+}
+
 // FinishCanaryRelease mocks base method.
 func (m *MockInterface) FinishCanaryRelease(ctx context.Context, cr *CanaryRelease, opts *ResourceUpdateOptions) (*CanaryRelease, error) {
 	m.ctrl.T.Helper()
@@ -385,6 +549,21 @@ func (mr *MockInterfaceMockRecorder) GetAPI(ctx, apiID, opts interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPI", reflect.TypeOf((*MockInterface)(nil).GetAPI), ctx, apiID, opts)
 }
 
+// GetAccessToken mocks base method.
+func (m *MockInterface) GetAccessToken(ctx context.Context, tokenID string) (*AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccessToken", ctx, tokenID)
+	ret0, _ := ret[0].(*AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccessToken indicates an expected call of GetAccessToken.
+func (mr *MockInterfaceMockRecorder) GetAccessToken(ctx, tokenID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccessToken", reflect.TypeOf((*MockInterface)(nil).GetAccessToken), ctx, tokenID)
+}
+
 // GetApplication mocks base method.
 func (m *MockInterface) GetApplication(ctx context.Context, appID ID, opts *ResourceGetOptions) (*Application, error) {
 	m.ctrl.T.Helper()
@@ -520,6 +699,21 @@ func (mr *MockInterfaceMockRecorder) GetOrganization(ctx, orgID, opts interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrganization", reflect.TypeOf((*MockInterface)(nil).GetOrganization), ctx, orgID, opts)
 }
 
+// GetRole mocks base method.
+func (m *MockInterface) GetRole(ctx context.Context, roleID ID, opts *ResourceGetOptions) (*Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRole", ctx, roleID, opts)
+	ret0, _ := ret[0].(*Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRole indicates an expected call of GetRole.
+func (mr *MockInterfaceMockRecorder) GetRole(ctx, roleID, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRole", reflect.TypeOf((*MockInterface)(nil).GetRole), ctx, roleID, opts)
+}
+
 // GetServiceRegistry mocks base method.
 func (m *MockInterface) GetServiceRegistry(ctx context.Context, registryID ID, opts *ResourceGetOptions) (*ServiceRegistry, error) {
 	m.ctrl.T.Helper()
@@ -550,6 +744,21 @@ func (mr *MockInterfaceMockRecorder) InviteMember(ctx, email, role, opts interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InviteMember", reflect.TypeOf((*MockInterface)(nil).InviteMember), ctx, email, role, opts)
 }
 
+// IssueApplicationCertificate mocks base method.
+func (m *MockInterface) IssueApplicationCertificate(ctx context.Context, appID ID, acmeOpts *ACMEOptions, opts *ResourceCreateOptions) (*CertificateDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssueApplicationCertificate", ctx, appID, acmeOpts, opts)
+	ret0, _ := ret[0].(*CertificateDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IssueApplicationCertificate indicates an expected call of IssueApplicationCertificate.
+func (mr *MockInterfaceMockRecorder) IssueApplicationCertificate(ctx, appID, acmeOpts, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssueApplicationCertificate", reflect.TypeOf((*MockInterface)(nil).IssueApplicationCertificate), ctx, appID, acmeOpts, opts)
+}
+
 // ListAPIs mocks base method.
 func (m *MockInterface) ListAPIs(ctx context.Context, opts *ResourceListOptions) (APIListIterator, error) {
 	m.ctrl.T.Helper()
@@ -565,6 +774,21 @@ func (mr *MockInterfaceMockRecorder) ListAPIs(ctx, opts interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAPIs", reflect.TypeOf((*MockInterface)(nil).ListAPIs), ctx, opts)
 }
 
+// ListAccessTokens mocks base method.
+func (m *MockInterface) ListAccessTokens(ctx context.Context, opts *ResourceListOptions) (AccessTokenListIterator, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAccessTokens", ctx, opts)
+	ret0, _ := ret[0].(AccessTokenListIterator)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAccessTokens indicates an expected call of ListAccessTokens.
+func (mr *MockInterfaceMockRecorder) ListAccessTokens(ctx, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAccessTokens", reflect.TypeOf((*MockInterface)(nil).ListAccessTokens), ctx, opts)
+}
+
 // ListAllAPILabels mocks base method.
 func (m *MockInterface) ListAllAPILabels(ctx context.Context, clusterID ID, opts *ResourceListOptions) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -715,6 +939,21 @@ func (mr *MockInterfaceMockRecorder) ListConsumers(ctx, opts interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListConsumers", reflect.TypeOf((*MockInterface)(nil).ListConsumers), ctx, opts)
 }
 
+// ListExpiringAccessTokens mocks base method.
+func (m *MockInterface) ListExpiringAccessTokens(ctx context.Context, within time.Duration, opts *ResourceListOptions) ([]*AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListExpiringAccessTokens", ctx, within, opts)
+	ret0, _ := ret[0].([]*AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListExpiringAccessTokens indicates an expected call of ListExpiringAccessTokens.
+func (mr *MockInterfaceMockRecorder) ListExpiringAccessTokens(ctx, within, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListExpiringAccessTokens", reflect.TypeOf((*MockInterface)(nil).ListExpiringAccessTokens), ctx, within, opts)
+}
+
 // ListLogCollections mocks base method.
 func (m *MockInterface) ListLogCollections(ctx context.Context, opts *ResourceListOptions) (LogCollectionIterator, error) {
 	m.ctrl.T.Helper()
@@ -820,6 +1059,21 @@ func (mr *MockInterfaceMockRecorder) PauseCanaryRelease(ctx, cr, opts interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseCanaryRelease", reflect.TypeOf((*MockInterface)(nil).PauseCanaryRelease), ctx, cr, opts)
 }
 
+// PlanManifest mocks base method.
+func (m *MockInterface) PlanManifest(ctx context.Context, clusterID ID, desired *Manifest, opts *ApplyOptions) (*Plan, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PlanManifest", ctx, clusterID, desired, opts)
+	ret0, _ := ret[0].(*Plan)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PlanManifest indicates an expected call of PlanManifest.
+func (mr *MockInterfaceMockRecorder) PlanManifest(ctx, clusterID, desired, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PlanManifest", reflect.TypeOf((*MockInterface)(nil).PlanManifest), ctx, clusterID, desired, opts)
+}
+
 // PublishAPI mocks base method.
 func (m *MockInterface) PublishAPI(ctx context.Context, apiID ID, opts *ResourceUpdateOptions) (*API, error) {
 	m.ctrl.T.Helper()
@@ -879,6 +1133,81 @@ func (mr *MockInterfaceMockRecorder) RemoveMember(ctx, memberID, opts interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMember", reflect.TypeOf((*MockInterface)(nil).RemoveMember), ctx, memberID, opts)
 }
 
+// RenewACMECertificate mocks base method.
+func (m *MockInterface) RenewACMECertificate(ctx context.Context, certID ID, acmeOpts *ACMEOptions, opts *ResourceUpdateOptions) (*CertificateDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewACMECertificate", ctx, certID, acmeOpts, opts)
+	ret0, _ := ret[0].(*CertificateDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenewACMECertificate indicates an expected call of RenewACMECertificate.
+func (mr *MockInterfaceMockRecorder) RenewACMECertificate(ctx, certID, acmeOpts, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewACMECertificate", reflect.TypeOf((*MockInterface)(nil).RenewACMECertificate), ctx, certID, acmeOpts, opts)
+}
+
+// RenewCertificate mocks base method.
+func (m *MockInterface) RenewCertificate(ctx context.Context, certID ID, spec *CertificateSpec, opts *ResourceUpdateOptions) (*CertificateDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewCertificate", ctx, certID, spec, opts)
+	ret0, _ := ret[0].(*CertificateDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenewCertificate indicates an expected call of RenewCertificate.
+func (mr *MockInterfaceMockRecorder) RenewCertificate(ctx, certID, spec, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewCertificate", reflect.TypeOf((*MockInterface)(nil).RenewCertificate), ctx, certID, spec, opts)
+}
+
+// RotateAccessToken mocks base method.
+func (m *MockInterface) RotateAccessToken(ctx context.Context, token *AccessToken, expire time.Time) (*AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateAccessToken", ctx, token, expire)
+	ret0, _ := ret[0].(*AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateAccessToken indicates an expected call of RotateAccessToken.
+func (mr *MockInterfaceMockRecorder) RotateAccessToken(ctx, token, expire interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateAccessToken", reflect.TypeOf((*MockInterface)(nil).RotateAccessToken), ctx, token, expire)
+}
+
+// RotateConsumerCredential mocks base method.
+func (m *MockInterface) RotateConsumerCredential(ctx context.Context, consumerID ID, cred ConsumerCredential, rotateOpts *ConsumerCredentialRotateOptions, opts *ResourceUpdateOptions) (*Consumer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateConsumerCredential", ctx, consumerID, cred, rotateOpts, opts)
+	ret0, _ := ret[0].(*Consumer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateConsumerCredential indicates an expected call of RotateConsumerCredential.
+func (mr *MockInterfaceMockRecorder) RotateConsumerCredential(ctx, consumerID, cred, rotateOpts, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateConsumerCredential", reflect.TypeOf((*MockInterface)(nil).RotateConsumerCredential), ctx, consumerID, cred, rotateOpts, opts)
+}
+
+// ScanExpiringCertificates mocks base method.
+func (m *MockInterface) ScanExpiringCertificates(ctx context.Context, clusterID ID, within time.Duration) ([]*ExpiringCertificate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanExpiringCertificates", ctx, clusterID, within)
+	ret0, _ := ret[0].([]*ExpiringCertificate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScanExpiringCertificates indicates an expected call of ScanExpiringCertificates.
+func (mr *MockInterfaceMockRecorder) ScanExpiringCertificates(ctx, clusterID, within interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanExpiringCertificates", reflect.TypeOf((*MockInterface)(nil).ScanExpiringCertificates), ctx, clusterID, within)
+}
+
 // SetGlobalClusterID mocks base method.
 func (m *MockInterface) SetGlobalClusterID(id ID) {
 	m.ctrl.T.Helper()
@@ -906,6 +1235,36 @@ func (mr *MockInterfaceMockRecorder) StartCanaryRelease(ctx, cr, opts interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartCanaryRelease", reflect.TypeOf((*MockInterface)(nil).StartCanaryRelease), ctx, cr, opts)
 }
 
+// SyncMembers mocks base method.
+func (m *MockInterface) SyncMembers(ctx context.Context, desired []DesiredMember, opts *SyncMembersOptions) (*MemberSyncReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SyncMembers", ctx, desired, opts)
+	ret0, _ := ret[0].(*MemberSyncReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SyncMembers indicates an expected call of SyncMembers.
+func (mr *MockInterfaceMockRecorder) SyncMembers(ctx, desired, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncMembers", reflect.TypeOf((*MockInterface)(nil).SyncMembers), ctx, desired, opts)
+}
+
+// TestLogCollection mocks base method.
+func (m *MockInterface) TestLogCollection(ctx context.Context, lc *LogCollection) (*LogCollectionTestReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TestLogCollection", ctx, lc)
+	ret0, _ := ret[0].(*LogCollectionTestReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TestLogCollection indicates an expected call of TestLogCollection.
+func (mr *MockInterfaceMockRecorder) TestLogCollection(ctx, lc interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TestLogCollection", reflect.TypeOf((*MockInterface)(nil).TestLogCollection), ctx, lc)
+}
+
 // TraceChan mocks base method.
 func (m *MockInterface) TraceChan() <-chan *TraceSeries {
 	m.ctrl.T.Helper()
@@ -1096,6 +1455,21 @@ func (mr *MockInterfaceMockRecorder) UpdateMemberRoles(ctx, memberID, roleBindin
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMemberRoles", reflect.TypeOf((*MockInterface)(nil).UpdateMemberRoles), ctx, memberID, roleBindings, opts)
 }
 
+// UpdateRole mocks base method.
+func (m *MockInterface) UpdateRole(ctx context.Context, role *Role, opts *ResourceUpdateOptions) (*Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRole", ctx, role, opts)
+	ret0, _ := ret[0].(*Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateRole indicates an expected call of UpdateRole.
+func (mr *MockInterfaceMockRecorder) UpdateRole(ctx, role, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRole", reflect.TypeOf((*MockInterface)(nil).UpdateRole), ctx, role, opts)
+}
+
 // UpdateServiceRegistry mocks base method.
 func (m *MockInterface) UpdateServiceRegistry(ctx context.Context, registry *ServiceRegistry, opts *ResourceUpdateOptions) (*ServiceRegistry, error) {
 	m.ctrl.T.Helper()
@@ -1111,6 +1485,36 @@ func (mr *MockInterfaceMockRecorder) UpdateServiceRegistry(ctx, registry, opts i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateServiceRegistry", reflect.TypeOf((*MockInterface)(nil).UpdateServiceRegistry), ctx, registry, opts)
 }
 
+// VerifyServiceRegistry mocks base method.
+func (m *MockInterface) VerifyServiceRegistry(ctx context.Context, registry *ServiceRegistry, opts *ServiceRegistryVerifyOptions) (*ServiceRegistryVerification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyServiceRegistry", ctx, registry, opts)
+	ret0, _ := ret[0].(*ServiceRegistryVerification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyServiceRegistry indicates an expected call of VerifyServiceRegistry.
+func (mr *MockInterfaceMockRecorder) VerifyServiceRegistry(ctx, registry, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyServiceRegistry", reflect.TypeOf((*MockInterface)(nil).VerifyServiceRegistry), ctx, registry, opts)
+}
+
+// WaitForClusterStage mocks base method.
+func (m *MockInterface) WaitForClusterStage(ctx context.Context, clusterID ID, stage ClusterStage, opts *ClusterWaitOptions) (*Cluster, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitForClusterStage", ctx, clusterID, stage, opts)
+	ret0, _ := ret[0].(*Cluster)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WaitForClusterStage indicates an expected call of WaitForClusterStage.
+func (mr *MockInterfaceMockRecorder) WaitForClusterStage(ctx, clusterID, stage, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitForClusterStage", reflect.TypeOf((*MockInterface)(nil).WaitForClusterStage), ctx, clusterID, stage, opts)
+}
+
 // sendSeries mocks base method.
 func (m *MockInterface) sendSeries(series *TraceSeries) {
 	m.ctrl.T.Helper()
@@ -207,6 +207,59 @@ type UpstreamServiceDiscovery struct {
 	ServiceRegistryID ID `json:"service_registry_id"`
 	// KubernetesService is the kubernetes service discovery of the upstream
 	KubernetesService KubernetesUpstreamServiceDiscovery `json:"kubernetes_service"`
+	// ConsulService is the consul service discovery of the upstream
+	ConsulService *ConsulUpstreamServiceDiscovery `json:"consul_service,omitempty"`
+	// NacosService is the nacos service discovery of the upstream
+	NacosService *NacosUpstreamServiceDiscovery `json:"nacos_service,omitempty"`
+	// EurekaService is the eureka service discovery of the upstream
+	EurekaService *EurekaUpstreamServiceDiscovery `json:"eureka_service,omitempty"`
+	// DNSService is the DNS service discovery of the upstream
+	DNSService *DNSUpstreamServiceDiscovery `json:"dns_service,omitempty"`
+}
+
+// Validate checks whether the service discovery of the ServiceRegistry
+// type is set, and it's the only one.
+func (sd *UpstreamServiceDiscovery) Validate() error {
+	if _, ok := _serviceRegistryTypeNames[sd.ServiceRegistry]; !ok {
+		return fmt.Errorf("unknown service registry type %d", sd.ServiceRegistry)
+	}
+	variants := []struct {
+		typ   ServiceRegistryType
+		field string
+		set   bool
+	}{
+		{typ: ServiceRegistryKubernetes, field: "kubernetes_service", set: sd.KubernetesService != KubernetesUpstreamServiceDiscovery{}},
+		{typ: ServiceRegistryConsul, field: "consul_service", set: sd.ConsulService != nil},
+		{typ: ServiceRegistryNacos, field: "nacos_service", set: sd.NacosService != nil},
+		{typ: ServiceRegistryEureka, field: "eureka_service", set: sd.EurekaService != nil},
+		{typ: ServiceRegistryDNS, field: "dns_service", set: sd.DNSService != nil},
+	}
+	for _, v := range variants {
+		if v.typ == sd.ServiceRegistry && !v.set {
+			return fmt.Errorf("%s service discovery: %s is required", sd.ServiceRegistry, v.field)
+		}
+		if v.typ != sd.ServiceRegistry && v.set {
+			return fmt.Errorf("%s service discovery: unexpected %s", sd.ServiceRegistry, v.field)
+		}
+	}
+
+	var name string
+	switch sd.ServiceRegistry {
+	case ServiceRegistryKubernetes:
+		name = sd.KubernetesService.Name
+	case ServiceRegistryConsul:
+		name = sd.ConsulService.ServiceName
+	case ServiceRegistryNacos:
+		name = sd.NacosService.ServiceName
+	case ServiceRegistryEureka:
+		name = sd.EurekaService.ServiceName
+	case ServiceRegistryDNS:
+		name = sd.DNSService.ServiceName
+	}
+	if name == "" {
+		return fmt.Errorf("%s service discovery: service name is required", sd.ServiceRegistry)
+	}
+	return nil
 }
 
 // KubernetesUpstreamServiceDiscovery is the kubernetes service discovery of the upstream.
@@ -219,6 +272,36 @@ type KubernetesUpstreamServiceDiscovery struct {
 	Port string `json:"port"`
 }
 
+// ConsulUpstreamServiceDiscovery is the consul service discovery of the upstream.
+type ConsulUpstreamServiceDiscovery struct {
+	// ServiceName is the name of the consul service
+	ServiceName string `json:"service_name"`
+	// Tags filters the service instances by the tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+// NacosUpstreamServiceDiscovery is the nacos service discovery of the upstream.
+type NacosUpstreamServiceDiscovery struct {
+	// ServiceName is the name of the nacos service
+	ServiceName string `json:"service_name"`
+	// NamespaceID is the namespace of the nacos service, the "public" namespace is used if it's empty
+	NamespaceID string `json:"namespace_id,omitempty"`
+	// GroupName is the group of the nacos service, the "DEFAULT_GROUP" is used if it's empty
+	GroupName string `json:"group_name,omitempty"`
+}
+
+// EurekaUpstreamServiceDiscovery is the eureka service discovery of the upstream.
+type EurekaUpstreamServiceDiscovery struct {
+	// ServiceName is the application name registered in eureka
+	ServiceName string `json:"service_name"`
+}
+
+// DNSUpstreamServiceDiscovery is the DNS service discovery of the upstream.
+type DNSUpstreamServiceDiscovery struct {
+	// ServiceName is the domain to resolve, the port can be specified like "example.com:8080"
+	ServiceName string `json:"service_name"`
+}
+
 // UpstreamTarget is the definition for an upstream endpoint.
 type UpstreamTarget struct {
 	Host   string `json:"host"`
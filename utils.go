@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"reflect"
 
 	"github.com/bitly/go-simplejson"
 	"github.com/pkg/errors"
@@ -151,3 +152,72 @@ func combineHeaderToReq(r *http.Request, headers http.Header) {
 		}
 	}
 }
+
+// decodeTypedValue decodes the loosely typed value (e.g. an element of the Plugins
+// or Consumer.Credentials) to the typed value `v`.
+func decodeTypedValue(value interface{}, v interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// mergeTypedValue encodes the typed value `v` and merges it to the loosely typed
+// value `old`. Fields in `old` that `v` doesn't know are kept, so that the
+// fields which are not supported by the SDK won't be lost.
+func mergeTypedValue(old interface{}, v interface{}) (map[string]interface{}, error) {
+	var merged map[string]interface{}
+	if oldMap, ok := old.(map[string]interface{}); ok {
+		merged = make(map[string]interface{}, len(oldMap))
+		for key, value := range oldMap {
+			merged[key] = value
+		}
+		for _, key := range jsonFieldNames(reflect.TypeOf(v)) {
+			delete(merged, key)
+		}
+	}
+
+	var encoded map[string]interface{}
+	if err := decodeTypedValue(v, &encoded); err != nil {
+		return nil, err
+	}
+	if merged == nil {
+		return encoded, nil
+	}
+	for key, value := range encoded {
+		merged[key] = value
+	}
+	return merged, nil
+}
+
+// jsonFieldNames returns the JSON field names of the struct type.
+func jsonFieldNames(typ reflect.Type) []string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			names = append(names, jsonFieldNames(field.Type)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}